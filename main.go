@@ -7,21 +7,52 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
+	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/admin"
+	"github.com/alphagov/paas-auditor/pkg/archive"
 	"github.com/alphagov/paas-auditor/pkg/collectors"
 	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/enrichers"
 	"github.com/alphagov/paas-auditor/pkg/fetchers"
 	inf "github.com/alphagov/paas-auditor/pkg/informer"
+	"github.com/alphagov/paas-auditor/pkg/integrity"
+	"github.com/alphagov/paas-auditor/pkg/leader"
+	"github.com/alphagov/paas-auditor/pkg/partitions"
 	"github.com/alphagov/paas-auditor/pkg/shippers"
+	"github.com/alphagov/paas-auditor/pkg/supervisor"
 
 	cfclient "github.com/cloudfoundry-community/go-cfclient"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// Stages in which components are stopped, so that nothing is stopped while
+// something later in the pipeline still depends on it
+const (
+	stageCollect = iota
+	stageShip
+	stageLead
+	stageServe
+	stageDatabase
+)
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(runVerify(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify-digest" {
+		os.Exit(runVerifyDigest(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	}
+
 	ctx, shutdown := context.WithCancel(context.Background())
 	go func() {
 		sigChan := make(chan os.Signal, 1)
@@ -37,39 +68,24 @@ func main() {
 	if err != nil {
 		cfg.Logger.Fatal("failed to connect to database", err)
 	}
-	eventDB := db.NewEventStore(ctx, pq, cfg.Logger)
+	// The store is not cancelled by ctx so that the shippers can save their
+	// cursors while stopping. It is stopped by closing the database last.
+	eventDB := db.NewEventStore(context.Background(), pq, cfg.Logger)
 	if err := eventDB.Init(); err != nil {
 		cfg.Logger.Fatal("failed to initialise database", err)
 	}
 
-	cfClient, err := cfclient.NewClient(cfg.CFClientConfig)
-	if err != nil {
-		cfg.Logger.Fatal("failed to create CF client", err)
-	}
-
-	fetcherCfg := fetchers.FetcherConfig{
-		CFClient:           cfClient,
-		Logger:             cfg.Logger.Session("cf-audit-event-fetcher"),
-		PaginationWaitTime: cfg.PaginationWaitTime,
-	}
-	fetcher := func(pullEventsSince time.Time, resultsChan chan fetchers.CFAuditEventResult) {
-		fetchers.FetchCFAuditEvents(&fetcherCfg, pullEventsSince, resultsChan)
+	foundationNames := make([]string, 0, len(cfg.Foundations))
+	for _, foundation := range cfg.Foundations {
+		foundationNames = append(foundationNames, foundation.Name)
 	}
 
-	collector := collectors.NewCFAuditEventCollector(cfg.CollectorSchedule, cfg.Logger, fetcher, eventDB)
-
-	shipper := shippers.NewCFAuditEventsToSplunkShipper(
-		cfg.ShipperSchedule,
-		cfg.Logger,
-		eventDB,
-		cfg.DeployEnv,
-		cfg.SplunkAPIKey, cfg.SplunkURL,
-	)
-
 	informer := inf.NewInformer(
+		foundationNames,
 		cfg.InformerSchedule,
 		cfg.Logger,
 		eventDB,
+		eventDB,
 	)
 
 	mux := http.NewServeMux()
@@ -85,51 +101,286 @@ func main() {
 		Handler: mux,
 	}
 
-	var wg sync.WaitGroup
+	sup := supervisor.New(cfg.Logger, supervisor.RestartPolicy{
+		MaxRestarts:    int(cfg.SupervisorMaxRestarts),
+		InitialBackoff: cfg.SupervisorRestartInitialBackoff,
+		MaxBackoff:     cfg.SupervisorRestartMaxBackoff,
+		ResetAfter:     10 * time.Minute,
+	})
 
-	wg.Add(1)
-	go func() {
-		err := collector.Run(ctx)
-		if err != nil {
-			cfg.Logger.Error("err-fatal-collector", err)
-		}
-		shutdown()
-		os.Exit(1)
-	}()
+	// Only the leader collects and ships, so that running more than one
+	// instance does not fetch or ship everything more than once
+	elector := leader.New(
+		cfg.Logger,
+		db.NewAdvisoryLock(pq, db.LeaderLockKey),
+		cfg.LeaderCandidate,
+		cfg.LeaderElectionInterval,
+	)
 
-	wg.Add(1)
-	go func() {
-		err := informer.Run(ctx)
-		if err != nil {
-			cfg.Logger.Error("err-fatal-informer", err)
-		}
-		shutdown()
-		os.Exit(1)
-	}()
+	partitionMaintainer := partitions.NewMaintainer(cfg.Logger, eventDB, partitions.Config{
+		Schedule:        cfg.PartitionMaintainerSchedule,
+		Ahead:           int(cfg.PartitionsAhead),
+		RetentionMonths: int(cfg.RetentionMonths),
+		Action:          cfg.RetentionAction,
+	})
 
-	if cfg.SplunkAPIKey != "" && cfg.SplunkURL != "" {
-		cfg.Logger.Info("creds-present-starting-shipper")
+	// The head of the hash chain is checkpointed into the logs and metrics,
+	// outside the database, so that rewriting the chain can be detected
+	chainCheckpointer := integrity.NewCheckpointer(cfg.ChainCheckpointSchedule, cfg.Logger, eventDB)
 
-		wg.Add(1)
+	adminCollectors := map[string]admin.Collector{}
+	for _, foundation := range cfg.Foundations {
+		components, collector := newFoundationComponents(cfg, foundation, eventDB, elector)
+		sup.Add(components...)
+		adminCollectors[foundation.Name] = collector
+	}
+
+	if cfg.DigestSigningKey != nil {
+		sup.Add(supervisor.Component{Name: "digester", Stage: stageCollect, Run: elector.Leading(newDigester(cfg, eventDB).Run)})
+	}
+
+	if cfg.ArchiveStorage != nil {
+		archiver := archive.NewArchiver(cfg.Logger, eventDB, cfg.ArchiveStorage, archive.Config{
+			Schedule: cfg.ArchiverSchedule,
+			Delay:    cfg.ArchiverDelay,
+		})
+		sup.Add(supervisor.Component{Name: "archiver", Stage: stageCollect, Run: elector.Leading(archiver.Run)})
+	}
+
+	if cfg.AdminToken != "" {
+		adminHandler := admin.NewHandler(ctx, cfg.Logger, cfg.AdminToken, eventDB, adminCollectors, elector.IsLeader)
+		adminHandler.Register(mux)
+		sup.Add(supervisor.Component{Name: "admin-jobs", Stage: stageCollect, Run: elector.Leading(adminHandler.Run)})
+	}
+
+	sup.Add(
+		supervisor.Component{Name: "informer", Stage: stageCollect, Run: informer.Run},
+		supervisor.Component{Name: "partition-maintainer", Stage: stageCollect, Run: elector.Leading(partitionMaintainer.Run)},
+		supervisor.Component{Name: "chain-checkpointer", Stage: stageCollect, Run: elector.Leading(chainCheckpointer.Run)},
+		supervisor.Component{Name: "leader-elector", Stage: stageLead, Run: elector.Run},
+		supervisor.Component{Name: "server", Stage: stageServe, Run: serve(server)},
+		supervisor.Component{Name: "database", Stage: stageDatabase, Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return pq.Close()
+		}},
+	)
+
+	if err := sup.Run(ctx); err != nil {
+		cfg.Logger.Error("err-fatal", err)
+		os.Exit(1)
+	}
+}
+
+// serve runs server until ctx is cancelled, then waits for in-flight
+// requests to finish
+func serve(server *http.Server) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		errChan := make(chan error, 1)
 		go func() {
-			err := shipper.Run(ctx)
-			if err != nil {
-				cfg.Logger.Error("err-fatal-shipper", err)
-			}
-			shutdown()
-			os.Exit(1)
+			errChan <- server.ListenAndServe()
 		}()
+
+		select {
+		case err := <-errChan:
+			return err
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			return server.Shutdown(shutdownCtx)
+		}
 	}
+}
 
-	wg.Add(1)
-	go func() {
-		err := server.ListenAndServe()
-		if err != nil {
-			cfg.Logger.Error("err-fatal-server", err)
+// newFoundationComponents creates the collectors for a foundation, and the
+// shippers if Splunk credentials are configured. They only run while elector
+// is the leader. The audit event collector is also returned so that jobs can
+// be run through it. Everything they log is labelled with the foundation.
+func newFoundationComponents(
+	cfg Config,
+	foundation FoundationConfig,
+	eventDB *db.EventStore,
+	elector *leader.Elector,
+) ([]supervisor.Component, *collectors.CFAuditEventCollector) {
+	logger := cfg.Logger.WithData(lager.Data{"foundation": foundation.Name})
+
+	cfClient, err := cfclient.NewClient(foundation.CFClientConfig)
+	if err != nil {
+		logger.Fatal("failed to create CF client", err)
+	}
+
+	fetcherCfg := fetchers.FetcherConfig{
+		Foundation:         foundation.Name,
+		CFClient:           cfClient,
+		Logger:             logger.Session("cf-audit-event-fetcher"),
+		PaginationWaitTime: cfg.PaginationWaitTime,
+
+		APIAddress: cfClient.Config.ApiAddress,
+		HTTPClient: foundation.CFClientConfig.HttpClient,
+
+		MaxRetries:          int(cfg.FetcherMaxRetries),
+		RetryInitialBackoff: cfg.FetcherRetryInitialBackoff,
+		RetryMaxBackoff:     cfg.FetcherRetryMaxBackoff,
+
+		EventTypes: cfg.EventTypes,
+
+		RateLimiter: fetchers.NewRateLimiter(cfg.FetcherMinRequestInterval),
+	}
+
+	var fetcher fetchers.CFAuditEventFetcher
+	switch cfg.CFAuditEventsAPIVersion {
+	case "v2":
+		fetcher = func(ctx context.Context, query fetchers.CFAuditEventQuery, resultsChan chan fetchers.CFAuditEventResult) {
+			fetchers.FetchCFAuditEvents(ctx, &fetcherCfg, query, resultsChan)
 		}
-		shutdown()
-		os.Exit(1)
-	}()
+	case "v3":
+		fetcher = func(ctx context.Context, query fetchers.CFAuditEventQuery, resultsChan chan fetchers.CFAuditEventResult) {
+			fetchers.FetchCFV3AuditEvents(ctx, &fetcherCfg, query, resultsChan)
+		}
+	default:
+		logger.Fatal("unknown-cf-audit-events-api-version", fmt.Errorf(
+			"CF_AUDIT_EVENTS_API_VERSION must be v2 or v3, got %q", cfg.CFAuditEventsAPIVersion,
+		))
+	}
 
-	wg.Wait()
+	var enricher enrichers.Chain
+	if cfg.EnrichNames {
+		// Shares the rate limiter with the audit event fetcher
+		nameFetcherCfg := fetcherCfg
+		nameFetcherCfg.Logger = logger.Session("cf-name-fetcher")
+		enricher = append(enricher, enrichers.NewCFNameEnricher(
+			foundation.Name,
+			logger,
+			func(ctx context.Context, guid string) (string, error) {
+				return fetchers.GetCFOrganizationName(ctx, &nameFetcherCfg, guid)
+			},
+			func(ctx context.Context, guid string) (string, error) {
+				return fetchers.GetCFSpaceName(ctx, &nameFetcherCfg, guid)
+			},
+			eventDB,
+			cfg.EnricherCacheTTL,
+		))
+	}
+	if cfg.EnrichActors {
+		// Users are looked up in the UAA that issues the foundation's tokens
+		uaaFetcherCfg := fetcherCfg
+		uaaFetcherCfg.Logger = logger.Session("uaa-user-fetcher")
+		uaaFetcherCfg.APIAddress = cfClient.Endpoint.TokenEndpoint
+		enricher = append(enricher, enrichers.NewUAAActorEnricher(
+			foundation.Name,
+			logger,
+			func(ctx context.Context, guid string) (fetchers.UAAUser, error) {
+				return fetchers.GetUAAUser(ctx, &uaaFetcherCfg, guid)
+			},
+			eventDB,
+			cfg.EnricherCacheTTL,
+		))
+	}
+
+	collector := collectors.NewCFAuditEventCollector(
+		foundation.Name,
+		cfg.CollectorSchedule,
+		logger,
+		fetcher,
+		enricher,
+		eventDB,
+		collectors.BackfillConfig{
+			SliceDuration: cfg.CollectorBackfillSliceDuration,
+			Workers:       int(cfg.CollectorBackfillWorkers),
+		},
+		collectors.WatermarkConfig{
+			Overlap:         cfg.CollectorOverlap,
+			ResweepInterval: cfg.CollectorResweepInterval,
+			ResweepWindow:   cfg.CollectorResweepWindow,
+		},
+	)
+	components := []supervisor.Component{{
+		Name:  "collector/" + foundation.Name,
+		Stage: stageCollect,
+		Run:   elector.Leading(collector.Run),
+	}}
+
+	usageEventPaths := map[db.UsageEventKind]string{
+		db.AppUsageEvents:     fetchers.AppUsageEventsPath,
+		db.ServiceUsageEvents: fetchers.ServiceUsageEventsPath,
+	}
+	if cfg.CollectUsageEvents {
+		for _, kind := range []db.UsageEventKind{db.AppUsageEvents, db.ServiceUsageEvents} {
+			path := usageEventPaths[kind]
+
+			// Shares the rate limiter with the audit event fetcher
+			usageFetcherCfg := fetcherCfg
+			usageFetcherCfg.Logger = logger.Session(fmt.Sprintf("%s-usage-event-fetcher", kind))
+			components = append(components, supervisor.Component{
+				Name:  fmt.Sprintf("%s-usage-event-collector/%s", kind, foundation.Name),
+				Stage: stageCollect,
+				Run: elector.Leading(collectors.NewUsageEventCollector(
+					kind,
+					foundation.Name,
+					cfg.CollectorSchedule,
+					logger,
+					func(ctx context.Context, query fetchers.UsageEventQuery, resultsChan chan fetchers.UsageEventResult) {
+						fetchers.FetchCFV3UsageEvents(ctx, &usageFetcherCfg, path, query, resultsChan)
+					},
+					eventDB,
+				).Run),
+			})
+		}
+	}
+
+	if cfg.SplunkAPIKey == "" || cfg.SplunkURL == "" {
+		return components, collector
+	}
+
+	logger.Info("creds-present-starting-shipper")
+	components = append(components, supervisor.Component{
+		Name:  "shipper/" + foundation.Name,
+		Stage: stageShip,
+		Run: elector.Leading(shippers.NewCFAuditEventsToSplunkShipper(
+			foundation.Name,
+			cfg.ShipperSchedule,
+			int(cfg.ShipperBatchSize),
+			logger,
+			eventDB,
+			cfg.DeployEnv,
+			cfg.SplunkAPIKey, cfg.SplunkURL,
+		).Run),
+	})
+
+	if cfg.CollectUsageEvents {
+		for _, kind := range []db.UsageEventKind{db.AppUsageEvents, db.ServiceUsageEvents} {
+			components = append(components, supervisor.Component{
+				Name:  fmt.Sprintf("%s-usage-events-shipper/%s", kind, foundation.Name),
+				Stage: stageShip,
+				Run: elector.Leading(shippers.NewUsageEventsToSplunkShipper(
+					kind,
+					foundation.Name,
+					cfg.ShipperSchedule,
+					int(cfg.ShipperBatchSize),
+					logger,
+					eventDB,
+					cfg.DeployEnv,
+					cfg.SplunkAPIKey, cfg.SplunkURL,
+				).Run),
+			})
+		}
+	}
+
+	return components, collector
+}
+
+// newDigester creates the digester, which writes digests to DIGEST_DIR and
+// ships them to Splunk as well, if they are configured
+func newDigester(cfg Config, eventDB *db.EventStore) *integrity.Digester {
+	sinks := []integrity.DigestSink{}
+	if cfg.DigestDir != "" {
+		sinks = append(sinks, integrity.FileDigestSink{Dir: cfg.DigestDir})
+	}
+	if cfg.SplunkAPIKey != "" && cfg.SplunkURL != "" {
+		sinks = append(sinks, shippers.NewSplunkDigestSink(cfg.DeployEnv, cfg.SplunkAPIKey, cfg.SplunkURL))
+	}
+	return integrity.NewDigester(cfg.Logger, eventDB, integrity.DigesterConfig{
+		Schedule: cfg.DigestSchedule,
+		Delay:    cfg.DigestDelay,
+		Key:      cfg.DigestSigningKey,
+	}, sinks...)
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"strconv"
@@ -10,24 +13,83 @@ import (
 	cfclient "github.com/cloudfoundry-community/go-cfclient"
 
 	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/archive"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+	"github.com/alphagov/paas-auditor/pkg/integrity"
 )
 
+// FoundationConfig is a Cloud Foundry deployment to collect audit events
+// from. Name is stored alongside every event collected from it.
+type FoundationConfig struct {
+	Name           string
+	CFClientConfig *cfclient.Config
+}
+
 type Config struct {
 	DeployEnv string
 
 	Logger      lager.Logger
 	DatabaseURL string
 
-	CFClientConfig *cfclient.Config
+	Foundations []FoundationConfig
+
+	CFAuditEventsAPIVersion string
+	CollectUsageEvents      bool
+	EnrichNames             bool
+	EnrichActors            bool
 
 	PaginationWaitTime time.Duration
 	CollectorSchedule  time.Duration
 	InformerSchedule   time.Duration
 	ShipperSchedule    time.Duration
+	ShipperBatchSize   uint
+
+	FetcherMaxRetries          uint
+	FetcherRetryInitialBackoff time.Duration
+	FetcherRetryMaxBackoff     time.Duration
+	FetcherMinRequestInterval  time.Duration
+
+	CollectorBackfillSliceDuration time.Duration
+	CollectorBackfillWorkers       uint
+
+	CollectorOverlap         time.Duration
+	CollectorResweepInterval time.Duration
+	CollectorResweepWindow   time.Duration
+
+	EventTypes fetchers.EventTypeFilter
+
+	SupervisorMaxRestarts           uint
+	SupervisorRestartInitialBackoff time.Duration
+	SupervisorRestartMaxBackoff     time.Duration
+
+	LeaderElectionInterval time.Duration
+	LeaderCandidate        string
+
+	EnricherCacheTTL time.Duration
+
+	PartitionMaintainerSchedule time.Duration
+	PartitionsAhead             uint
+	RetentionMonths             uint
+	RetentionAction             db.RetentionAction
+
+	ChainCheckpointSchedule time.Duration
+
+	DigestSigningKey ed25519.PrivateKey
+	DigestSchedule   time.Duration
+	DigestDelay      time.Duration
+	DigestDir        string
+
+	ArchiveStorage   archive.Storage
+	ArchiverSchedule time.Duration
+	ArchiverDelay    time.Duration
 
 	SplunkAPIKey string
 	SplunkURL    string
 
+	AdminToken string
+
 	ListenPort uint
 }
 
@@ -36,34 +98,170 @@ func NewConfigFromEnv() Config {
 		DeployEnv: getEnvWithDefaultString("DEPLOY_ENV", "dev"),
 
 		Logger:      getDefaultLogger(),
-		DatabaseURL: getEnvWithDefaultString("DATABASE_URL", "postgres://postgres:@localhost:5432/"),
-
-		CFClientConfig: &cfclient.Config{
-			ApiAddress:        os.Getenv("CF_API_ADDRESS"),
-			Username:          os.Getenv("CF_USERNAME"),
-			Password:          os.Getenv("CF_PASSWORD"),
-			ClientID:          os.Getenv("CF_CLIENT_ID"),
-			ClientSecret:      os.Getenv("CF_CLIENT_SECRET"),
-			SkipSslValidation: os.Getenv("CF_SKIP_SSL_VALIDATION") == "true",
-			Token:             os.Getenv("CF_TOKEN"),
-			UserAgent:         os.Getenv("CF_USER_AGENT"),
-			HttpClient: &http.Client{
-				Timeout: 30 * time.Second,
-			},
-		},
+		DatabaseURL: getDatabaseURL(),
+
+		Foundations: getFoundationsFromEnv(),
+
+		CFAuditEventsAPIVersion: getEnvWithDefaultString("CF_AUDIT_EVENTS_API_VERSION", "v2"),
+		CollectUsageEvents:      os.Getenv("COLLECT_USAGE_EVENTS") == "true",
+		EnrichNames:             os.Getenv("ENRICH_NAMES") == "true",
+		EnrichActors:            os.Getenv("ENRICH_ACTORS") == "true",
 
 		PaginationWaitTime: getEnvWithDefaultDuration("FETCHER_PAGINATION_WAIT_TIME", 200*time.Millisecond),
 		CollectorSchedule:  getEnvWithDefaultDuration("COLLECTOR_SCHEDULE", 2*time.Minute),
 		InformerSchedule:   getEnvWithDefaultDuration("INFORMER_SCHEDULE", 15*time.Second),
 		ShipperSchedule:    getEnvWithDefaultDuration("SHIPPER_SCHEDULE", 15*time.Second),
+		ShipperBatchSize:   getShipperBatchSize(),
+
+		FetcherMaxRetries:          getEnvWithDefaultInt("FETCHER_MAX_RETRIES", 5),
+		FetcherRetryInitialBackoff: getEnvWithDefaultDuration("FETCHER_RETRY_INITIAL_BACKOFF", 1*time.Second),
+		FetcherRetryMaxBackoff:     getEnvWithDefaultDuration("FETCHER_RETRY_MAX_BACKOFF", 1*time.Minute),
+		FetcherMinRequestInterval:  getEnvWithDefaultDuration("FETCHER_MIN_REQUEST_INTERVAL", 100*time.Millisecond),
+
+		CollectorBackfillSliceDuration: getEnvWithDefaultDuration("COLLECTOR_BACKFILL_SLICE_DURATION", 24*time.Hour),
+		CollectorBackfillWorkers:       getEnvWithDefaultInt("COLLECTOR_BACKFILL_WORKERS", 4),
+
+		CollectorOverlap:         getEnvWithDefaultDuration("COLLECTOR_OVERLAP", 5*time.Minute),
+		CollectorResweepInterval: getEnvWithDefaultDuration("COLLECTOR_RESWEEP_INTERVAL", 1*time.Hour),
+		CollectorResweepWindow:   getEnvWithDefaultDuration("COLLECTOR_RESWEEP_WINDOW", 6*time.Hour),
+
+		EventTypes: getEventTypeFilterFromEnv(),
+
+		SupervisorMaxRestarts:           getEnvWithDefaultInt("SUPERVISOR_MAX_RESTARTS", 5),
+		SupervisorRestartInitialBackoff: getEnvWithDefaultDuration("SUPERVISOR_RESTART_INITIAL_BACKOFF", 1*time.Second),
+		SupervisorRestartMaxBackoff:     getEnvWithDefaultDuration("SUPERVISOR_RESTART_MAX_BACKOFF", 1*time.Minute),
+
+		LeaderElectionInterval: getEnvWithDefaultDuration("LEADER_ELECTION_INTERVAL", 2*time.Second),
+		LeaderCandidate:        getLeaderCandidate(),
+
+		EnricherCacheTTL: getEnvWithDefaultDuration("ENRICHER_CACHE_TTL", 10*time.Minute),
+
+		PartitionMaintainerSchedule: getEnvWithDefaultDuration("PARTITION_MAINTAINER_SCHEDULE", 1*time.Hour),
+		PartitionsAhead:             getEnvWithDefaultInt("CF_AUDIT_EVENTS_PARTITIONS_AHEAD", 3),
+		RetentionMonths:             getEnvWithDefaultInt("CF_AUDIT_EVENTS_RETENTION_MONTHS", 0),
+		RetentionAction:             getRetentionAction(),
+
+		ChainCheckpointSchedule: getEnvWithDefaultDuration("CHAIN_CHECKPOINT_SCHEDULE", 1*time.Hour),
+
+		DigestSigningKey: getDigestSigningKey(),
+		DigestSchedule:   getEnvWithDefaultDuration("DIGEST_SCHEDULE", 1*time.Hour),
+		DigestDelay:      getEnvWithDefaultDuration("DIGEST_DELAY", 6*time.Hour),
+		DigestDir:        os.Getenv("DIGEST_DIR"),
+
+		ArchiveStorage:   getArchiveStorage(),
+		ArchiverSchedule: getEnvWithDefaultDuration("ARCHIVER_SCHEDULE", 1*time.Hour),
+		ArchiverDelay:    getEnvWithDefaultDuration("ARCHIVER_DELAY", 6*time.Hour),
 
 		SplunkAPIKey: os.Getenv("SPLUNK_API_KEY"),
 		SplunkURL:    os.Getenv("SPLUNK_HEC_ENDPOINT_URL"),
 
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+
 		ListenPort: getEnvWithDefaultInt("PORT", 9299),
 	}
 }
 
+// foundationJSON is the format of each entry in CF_FOUNDATIONS
+type foundationJSON struct {
+	Name              string `json:"name"`
+	APIAddress        string `json:"api_address"`
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	ClientID          string `json:"client_id"`
+	ClientSecret      string `json:"client_secret"`
+	SkipSSLValidation bool   `json:"skip_ssl_validation"`
+	Token             string `json:"token"`
+}
+
+// getFoundationsFromEnv reads the list of foundations from CF_FOUNDATIONS. If
+// it is not set the single foundation configured by the CF_* variables is
+// used, named by CF_FOUNDATION_NAME.
+func getFoundationsFromEnv() []FoundationConfig {
+	v := os.Getenv("CF_FOUNDATIONS")
+	if v == "" {
+		return []FoundationConfig{{
+			Name: getEnvWithDefaultString("CF_FOUNDATION_NAME", db.DefaultFoundation),
+			CFClientConfig: newCFClientConfig(foundationJSON{
+				APIAddress:        os.Getenv("CF_API_ADDRESS"),
+				Username:          os.Getenv("CF_USERNAME"),
+				Password:          os.Getenv("CF_PASSWORD"),
+				ClientID:          os.Getenv("CF_CLIENT_ID"),
+				ClientSecret:      os.Getenv("CF_CLIENT_SECRET"),
+				SkipSSLValidation: os.Getenv("CF_SKIP_SSL_VALIDATION") == "true",
+				Token:             os.Getenv("CF_TOKEN"),
+			}),
+		}}
+	}
+
+	var entries []foundationJSON
+	if err := json.Unmarshal([]byte(v), &entries); err != nil {
+		panic(fmt.Errorf("CF_FOUNDATIONS is not valid JSON: %s", err))
+	}
+	if len(entries) == 0 {
+		panic(fmt.Errorf("CF_FOUNDATIONS must list at least one foundation"))
+	}
+
+	seen := map[string]bool{}
+	foundations := make([]FoundationConfig, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name == "" || entry.APIAddress == "" {
+			panic(fmt.Errorf("CF_FOUNDATIONS entries must have a name and api_address"))
+		}
+		if seen[entry.Name] {
+			panic(fmt.Errorf("CF_FOUNDATIONS has more than one foundation named %q", entry.Name))
+		}
+		seen[entry.Name] = true
+
+		foundations = append(foundations, FoundationConfig{
+			Name:           entry.Name,
+			CFClientConfig: newCFClientConfig(entry),
+		})
+	}
+	return foundations
+}
+
+// getEventTypeFilterFromEnv reads the comma separated event type patterns in
+// EVENT_TYPES_INCLUDE and EVENT_TYPES_EXCLUDE
+func getEventTypeFilterFromEnv() fetchers.EventTypeFilter {
+	filter := fetchers.EventTypeFilter{
+		Include: getEnvList("EVENT_TYPES_INCLUDE"),
+		Exclude: getEnvList("EVENT_TYPES_EXCLUDE"),
+	}
+	if err := filter.Validate(); err != nil {
+		panic(err)
+	}
+	return filter
+}
+
+func newCFClientConfig(f foundationJSON) *cfclient.Config {
+	return &cfclient.Config{
+		ApiAddress:        f.APIAddress,
+		Username:          f.Username,
+		Password:          f.Password,
+		ClientID:          f.ClientID,
+		ClientSecret:      f.ClientSecret,
+		SkipSslValidation: f.SkipSSLValidation,
+		Token:             f.Token,
+		UserAgent:         os.Getenv("CF_USER_AGENT"),
+		HttpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// getLeaderCandidate identifies this instance in leader election logs and
+// metrics, using the Cloud Foundry instance index if there is one
+func getLeaderCandidate() string {
+	if index := os.Getenv("CF_INSTANCE_INDEX"); index != "" {
+		return index
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		panic(err)
+	}
+	return hostname
+}
+
 func getEnvWithDefaultDuration(k string, def time.Duration) time.Duration {
 	v := getEnvWithDefaultString(k, "")
 	if v == "" {
@@ -84,6 +282,16 @@ func getEnvWithDefaultString(k string, def string) string {
 	return v
 }
 
+func getEnvList(k string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(k), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
 func getEnvWithDefaultInt(k string, def uint) uint {
 	v := os.Getenv(k)
 	if v == "" {
@@ -96,6 +304,69 @@ func getEnvWithDefaultInt(k string, def uint) uint {
 	return uint(d)
 }
 
+func getShipperBatchSize() uint {
+	batchSize := getEnvWithDefaultInt("SHIPPER_BATCH_SIZE", 8192)
+	if batchSize == 0 {
+		panic(fmt.Errorf("SHIPPER_BATCH_SIZE must be at least 1"))
+	}
+	return batchSize
+}
+
+func getRetentionAction() db.RetentionAction {
+	action := db.RetentionAction(getEnvWithDefaultString("CF_AUDIT_EVENTS_RETENTION_ACTION", string(db.RetentionDrop)))
+	if action != db.RetentionDrop && action != db.RetentionArchive {
+		panic(fmt.Errorf("CF_AUDIT_EVENTS_RETENTION_ACTION must be drop or archive, got %q", action))
+	}
+	return action
+}
+
+// getDigestSigningKey reads the key which signs daily digests, which are
+// not created if it is not set
+func getDigestSigningKey() ed25519.PrivateKey {
+	v := os.Getenv("DIGEST_SIGNING_KEY")
+	if v == "" {
+		return nil
+	}
+	key, err := integrity.ParseSigningKey(v)
+	if err != nil {
+		panic(fmt.Errorf("DIGEST_SIGNING_KEY: %s", err))
+	}
+	return key
+}
+
+// getArchiveStorage returns where events are archived, by
+// ARCHIVE_STORAGE, or nil if they are not archived
+func getArchiveStorage() archive.Storage {
+	switch storage := os.Getenv("ARCHIVE_STORAGE"); storage {
+	case "":
+		return nil
+	case "local":
+		dir := os.Getenv("ARCHIVE_DIR")
+		if dir == "" {
+			panic(fmt.Errorf("ARCHIVE_DIR must be set when ARCHIVE_STORAGE is local"))
+		}
+		return archive.LocalStorage{Dir: dir}
+	case "s3":
+		cfg := archive.S3Config{
+			Endpoint:        os.Getenv("ARCHIVE_S3_ENDPOINT"),
+			Region:          os.Getenv("ARCHIVE_S3_REGION"),
+			Bucket:          os.Getenv("ARCHIVE_S3_BUCKET"),
+			AccessKeyID:     os.Getenv("ARCHIVE_S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("ARCHIVE_S3_SECRET_ACCESS_KEY"),
+		}
+		if cfg.Endpoint == "" || cfg.Region == "" || cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+			panic(fmt.Errorf("ARCHIVE_S3_ENDPOINT, ARCHIVE_S3_REGION, ARCHIVE_S3_BUCKET, ARCHIVE_S3_ACCESS_KEY_ID and ARCHIVE_S3_SECRET_ACCESS_KEY must be set when ARCHIVE_STORAGE is s3"))
+		}
+		return archive.NewS3Storage(cfg)
+	default:
+		panic(fmt.Errorf("ARCHIVE_STORAGE must be local or s3, got %q", storage))
+	}
+}
+
+func getDatabaseURL() string {
+	return getEnvWithDefaultString("DATABASE_URL", "postgres://postgres:@localhost:5432/")
+}
+
 func getDefaultLogger() lager.Logger {
 	logger := lager.NewLogger("paas-auditor")
 	logLevel := lager.INFO
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/importer"
+)
+
+const importUsage = `usage: paas-auditor import [-foundation name] [-batch-size n] file...
+
+  store the audit events in newline-delimited JSON files, which may be
+  gzipped archives or Splunk exports, skipping events which are already
+  stored. A file of - is read from stdin.
+`
+
+// runImport runs the import subcommand, which only needs DATABASE_URL, and
+// returns the exit code, which is 1 if any line could not be imported
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, importUsage)
+		flags.PrintDefaults()
+	}
+	foundation := flags.String("foundation", db.DefaultFoundation, "foundation of events which do not say which they were collected from")
+	batchSize := flags.Int("batch-size", 1000, "how many events to store at a time")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 || *batchSize < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	logger := getDefaultLogger()
+	pq, err := sql.Open("postgres", getDatabaseURL())
+	if err != nil {
+		logger.Error("failed to connect to database", err)
+		return 1
+	}
+	defer pq.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	store := db.NewEventStore(ctx, pq, logger)
+	if err := store.Init(); err != nil {
+		logger.Error("failed to initialise database", err)
+		return 1
+	}
+
+	imp := importer.NewImporter(store, importer.Config{
+		DefaultFoundation: *foundation,
+		BatchSize:         *batchSize,
+		Progress:          os.Stderr,
+		ProgressInterval:  5 * time.Second,
+	})
+	for _, name := range flags.Args() {
+		if err := importFile(ctx, imp, name); err != nil {
+			logger.Error("failed to import", err)
+			return 1
+		}
+	}
+	summary, err := imp.Finish()
+	if err != nil {
+		logger.Error("failed to import", err)
+		return 1
+	}
+
+	printImportSummary(summary)
+	if summary.Invalid > 0 {
+		return 1
+	}
+	return 0
+}
+
+func importFile(ctx context.Context, imp *importer.Importer, name string) error {
+	if name == "-" {
+		return imp.Import(ctx, "stdin", os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return imp.Import(ctx, name, f)
+}
+
+func printImportSummary(summary importer.Summary) {
+	foundations := []string{}
+	for foundation := range summary.Inserted {
+		foundations = append(foundations, foundation)
+	}
+	sort.Strings(foundations)
+
+	fmt.Printf("read:       %d lines from %d files\n", summary.Lines, summary.Files)
+	for _, foundation := range foundations {
+		fmt.Printf("%-11s %d inserted, %d duplicates\n", foundation+":", summary.Inserted[foundation], summary.Duplicates[foundation])
+	}
+	fmt.Printf("skipped:    %d lines which are not audit events\n", summary.Skipped)
+	fmt.Printf("invalid:    %d lines\n", summary.Invalid)
+	for _, line := range summary.InvalidLines {
+		fmt.Printf("  %s\n", line)
+	}
+	if len(summary.InvalidLines) < summary.Invalid {
+		fmt.Printf("  and %d more\n", summary.Invalid-len(summary.InvalidLines))
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const migrateUsage = `usage: paas-auditor migrate status|up|down [steps]
+
+  status       list migrations and when they were applied
+  up           apply every migration which has not been applied
+  down [steps] roll back the last steps migrations (default 1)
+`
+
+// runMigrate runs the migrate subcommand, which only needs DATABASE_URL,
+// and returns the exit code
+func runMigrate(args []string) int {
+	if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[0] != "down") {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	steps := 1
+	if len(args) == 2 {
+		var err error
+		steps, err = strconv.Atoi(args[1])
+		if err != nil || steps < 1 {
+			fmt.Fprintf(os.Stderr, "steps must be a positive number, got %q\n", args[1])
+			return 2
+		}
+	}
+
+	logger := getDefaultLogger()
+	pq, err := sql.Open("postgres", getDatabaseURL())
+	if err != nil {
+		logger.Error("failed to connect to database", err)
+		return 1
+	}
+	defer pq.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), db.DefaultInitTimeout)
+	defer cancel()
+
+	migrator := db.NewMigrator(pq, logger, db.Migrations)
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			logger.Error("failed to get migration status", err)
+			return 1
+		}
+		printMigrationStatus(statuses)
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			logger.Error("failed to apply migrations", err)
+			return 1
+		}
+		fmt.Printf("applied %d migrations\n", applied)
+	case "down":
+		rolledBack, err := migrator.Down(ctx, steps)
+		if err != nil {
+			logger.Error("failed to roll back migrations", err)
+			return 1
+		}
+		fmt.Printf("rolled back %d migrations\n", rolledBack)
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
+
+func printMigrationStatus(statuses []db.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		if status.Unknown {
+			appliedAt += " (unknown to this version)"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	w.Flush()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const verifyUsage = `usage: paas-auditor verify
+
+  walk the hash chain over the stored audit events and report the first
+  event which does not match it
+`
+
+// runVerify runs the verify subcommand, which only needs DATABASE_URL, and
+// returns the exit code, which is 1 if the chain is broken
+func runVerify(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprint(os.Stderr, verifyUsage)
+		return 2
+	}
+
+	logger := getDefaultLogger()
+	pq, err := sql.Open("postgres", getDatabaseURL())
+	if err != nil {
+		logger.Error("failed to connect to database", err)
+		return 1
+	}
+	defer pq.Close()
+
+	store := db.NewEventStore(context.Background(), pq, logger)
+	result, err := store.VerifyCFAuditEventChain(context.Background())
+	if err != nil {
+		logger.Error("failed to verify chain", err)
+		return 1
+	}
+
+	fmt.Printf("head:      %s (length %d, updated %s)\n", hex.EncodeToString(result.Head.Hash), result.Head.Length, result.Head.UpdatedAt.UTC().Format("2006-01-02T15:04:05Z"))
+	fmt.Printf("checked:   %d events\n", result.Checked)
+	fmt.Printf("unchained: %d events stored before the chain began\n", result.Unchained)
+	fmt.Printf("retired:   %d events retired with their partitions\n", result.Retired)
+	if result.Truncated {
+		fmt.Println("the chain starts after its first event, which was retired before retirements were recorded")
+	}
+	if result.Broken != nil {
+		fmt.Printf("BROKEN:    %s\n", result.Broken)
+		return 1
+	}
+	fmt.Println("the chain is intact")
+	return 0
+}
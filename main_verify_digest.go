@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/integrity"
+)
+
+const verifyDigestUsage = `usage: paas-auditor verify-digest <date>|<file>
+
+  check a signed daily digest against the events now in the database. The
+  digest is either a date, like 2019-10-31, to read it from the digests
+  table, or a file written to DIGEST_DIR or exported from Splunk.
+
+  The digest must be signed with DIGEST_PUBLIC_KEY, or the public key of
+  DIGEST_SIGNING_KEY if that is not set.
+`
+
+// runVerifyDigest runs the verify-digest subcommand and returns the exit
+// code, which is 1 if the digest does not match
+func runVerifyDigest(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, verifyDigestUsage)
+		return 2
+	}
+
+	publicKey, err := getDigestPublicKey()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	logger := getDefaultLogger()
+	pq, err := sql.Open("postgres", getDatabaseURL())
+	if err != nil {
+		logger.Error("failed to connect to database", err)
+		return 1
+	}
+	defer pq.Close()
+	store := db.NewEventStore(context.Background(), pq, logger)
+
+	var digest db.Digest
+	if date, err := time.Parse("2006-01-02", args[0]); err == nil {
+		stored, err := store.GetDigest(date)
+		if err != nil {
+			logger.Error("failed to get digest", err)
+			return 1
+		}
+		if stored == nil {
+			fmt.Fprintf(os.Stderr, "there is no digest of %s\n", args[0])
+			return 1
+		}
+		digest = *stored
+	} else {
+		b, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		digest, err = integrity.ParseDigestJSON(b)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	// Events of the day stored after the digest was made, such as by a
+	// backfill or an import, are not covered by it, so are listed rather
+	// than taken as changes
+	summary, err := integrity.SummariseDay(context.Background(), store, digest.Date, digest.MaxEventID)
+	if err != nil {
+		logger.Error("failed to get events", err)
+		return 1
+	}
+
+	date := digest.Date.Format("2006-01-02")
+	code := 0
+	if err := integrity.VerifyDigest(digest, publicKey, summary.Digest()); err != nil {
+		fmt.Printf("%s: FAILED: %s\n", date, err)
+		code = 1
+	} else {
+		fmt.Printf("%s: OK, %d events match the signed digest\n", date, digest.EventCount)
+	}
+	if summary.LateEvents > 0 {
+		fmt.Printf("%s: %d events were stored after the digest was made, so are not covered by it:\n", date, summary.LateEvents)
+		for _, guid := range summary.LateGUIDs {
+			fmt.Printf("  %s\n", guid)
+		}
+		if more := summary.LateEvents - int64(len(summary.LateGUIDs)); more > 0 {
+			fmt.Printf("  and %d more\n", more)
+		}
+	}
+	return code
+}
+
+func getDigestPublicKey() (ed25519.PublicKey, error) {
+	if v := os.Getenv("DIGEST_PUBLIC_KEY"); v != "" {
+		return integrity.ParsePublicKey(v)
+	}
+	if v := os.Getenv("DIGEST_SIGNING_KEY"); v != "" {
+		key, err := integrity.ParseSigningKey(v)
+		if err != nil {
+			return nil, err
+		}
+		return key.Public().(ed25519.PublicKey), nil
+	}
+	return nil, fmt.Errorf("DIGEST_PUBLIC_KEY or DIGEST_SIGNING_KEY must be set")
+}
@@ -0,0 +1,395 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/collectors"
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// maxUnfinishedJobs is how many jobs can be queued or running at once. Jobs
+// are run one at a time, so more are refused rather than left waiting.
+const maxUnfinishedJobs = 10
+
+// Collector is what jobs are run through, one for each foundation
+type Collector interface {
+	Collect(ctx context.Context, progress collectors.JobProgress) error
+	Backfill(ctx context.Context, since time.Time, until time.Time, progress collectors.JobProgress) error
+	ReprocessQuarantine(ctx context.Context, progress collectors.JobProgress) error
+}
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is a collection asked for through the admin endpoints
+type Job struct {
+	ID              string     `json:"id"`
+	Kind            string     `json:"kind"`
+	Foundation      string     `json:"foundation"`
+	From            *time.Time `json:"from,omitempty"`
+	To              *time.Time `json:"to,omitempty"`
+	Status          JobStatus  `json:"status"`
+	EventsCollected int64      `json:"events_collected"`
+	Error           string     `json:"error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+// job tracks a Job while it runs, as its collectors.JobProgress, and
+// records each change in the admin_jobs table so that any instance can
+// report on it
+type job struct {
+	mu     sync.Mutex
+	jobDB  db.AdminJobDB
+	logger lager.Logger
+	Job
+}
+
+func (j *job) Started() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.Status = JobRunning
+	j.StartedAt = &now
+	j.save()
+}
+
+func (j *job) EventsStored(count int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.EventsCollected += int64(count)
+	j.save()
+}
+
+func (j *job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.FinishedAt = &now
+	j.Status = JobSucceeded
+	if err != nil {
+		j.Status = JobFailed
+		j.Error = err.Error()
+	}
+	j.save()
+	AdminJobsTotal.WithLabelValues(j.Kind, string(j.Status)).Inc()
+}
+
+// save records the job. It is called with mu held, so that changes are
+// recorded in order. A change which cannot be recorded is logged rather than
+// failing the job, and the next change records it.
+func (j *job) save() {
+	if err := j.jobDB.UpdateAdminJob(toAdminJob(j.Job)); err != nil {
+		j.logger.Error("err-update-admin-job", err)
+	}
+}
+
+func toAdminJob(j Job) db.AdminJob {
+	return db.AdminJob{
+		ID:              j.ID,
+		Kind:            j.Kind,
+		Foundation:      j.Foundation,
+		From:            j.From,
+		To:              j.To,
+		Status:          string(j.Status),
+		EventsCollected: j.EventsCollected,
+		Error:           j.Error,
+		CreatedAt:       j.CreatedAt,
+		StartedAt:       j.StartedAt,
+		FinishedAt:      j.FinishedAt,
+	}
+}
+
+func fromAdminJob(j db.AdminJob) Job {
+	return Job{
+		ID:              j.ID,
+		Kind:            j.Kind,
+		Foundation:      j.Foundation,
+		From:            j.From,
+		To:              j.To,
+		Status:          JobStatus(j.Status),
+		EventsCollected: j.EventsCollected,
+		Error:           j.Error,
+		CreatedAt:       j.CreatedAt,
+		StartedAt:       j.StartedAt,
+		FinishedAt:      j.FinishedAt,
+	}
+}
+
+// Handler serves the admin endpoints, which let operators collect events
+// without waiting for the collector's schedule. Every request must have the
+// shared token as a bearer token.
+type Handler struct {
+	ctx        context.Context
+	logger     lager.Logger
+	token      string
+	jobDB      db.AdminJobDB
+	collectors map[string]Collector
+	isLeader   func() bool
+
+	mu sync.Mutex
+	// jobs are the jobs this instance has accepted which have not finished
+	jobs map[string]*job
+}
+
+// NewHandler creates a Handler. Jobs are cancelled when ctx is. Jobs are
+// only accepted while isLeader returns true, as only the leader's
+// collectors run, but are recorded in jobDB so that any instance can report
+// on them.
+func NewHandler(
+	ctx context.Context,
+	logger lager.Logger,
+	token string,
+	jobDB db.AdminJobDB,
+	collectors map[string]Collector,
+	isLeader func() bool,
+) *Handler {
+	return &Handler{
+		ctx:        ctx,
+		logger:     logger.Session("admin"),
+		token:      token,
+		jobDB:      jobDB,
+		collectors: collectors,
+		isLeader:   isLeader,
+		jobs:       map[string]*job{},
+	}
+}
+
+// Run fails the jobs which an earlier leader did not finish, for example
+// because it was stopped, as nothing else will. It is run while leading,
+// and waits for ctx to be done.
+func (h *Handler) Run(ctx context.Context) error {
+	lsession := h.logger.Session("run")
+
+	h.mu.Lock()
+	running := make([]string, 0, len(h.jobs))
+	for id := range h.jobs {
+		running = append(running, id)
+	}
+	h.mu.Unlock()
+
+	failed, err := h.jobDB.FailUnfinishedAdminJobs(running, "the instance running the job stopped leading before it finished")
+	if err != nil {
+		lsession.Error("err-fail-unfinished-admin-jobs", err)
+	} else if failed > 0 {
+		lsession.Info("failed-unfinished-jobs", lager.Data{"failed": failed})
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// Register adds the admin endpoints to mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle("POST /admin/collect", h.authenticated(h.collect))
+	mux.Handle("POST /admin/backfill", h.authenticated(h.backfill))
+	mux.Handle("POST /admin/quarantine/reprocess", h.authenticated(h.reprocessQuarantine))
+	mux.Handle("GET /admin/jobs/{id}", h.authenticated(h.getJob))
+}
+
+func (h *Handler) authenticated(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("a valid admin token is required"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (h *Handler) collect(w http.ResponseWriter, r *http.Request) {
+	foundation, collector, ok := h.collectorFor(w, r)
+	if !ok {
+		return
+	}
+
+	h.start(w, Job{Kind: "collect", Foundation: foundation}, func(ctx context.Context, j *job) error {
+		return collector.Collect(ctx, j)
+	})
+}
+
+func (h *Handler) backfill(w http.ResponseWriter, r *http.Request) {
+	foundation, collector, ok := h.collectorFor(w, r)
+	if !ok {
+		return
+	}
+
+	from, err := time.Parse(time.RFC3339, r.URL.Query().Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("from must be an RFC 3339 time: %s", err))
+		return
+	}
+	to, err := time.Parse(time.RFC3339, r.URL.Query().Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("to must be an RFC 3339 time: %s", err))
+		return
+	}
+	if !to.After(from) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("to must be after from"))
+		return
+	}
+	if to.After(time.Now()) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("to must not be in the future"))
+		return
+	}
+
+	h.start(w, Job{Kind: "backfill", Foundation: foundation, From: &from, To: &to}, func(ctx context.Context, j *job) error {
+		return collector.Backfill(ctx, from, to, j)
+	})
+}
+
+func (h *Handler) reprocessQuarantine(w http.ResponseWriter, r *http.Request) {
+	foundation, collector, ok := h.collectorFor(w, r)
+	if !ok {
+		return
+	}
+
+	h.start(w, Job{Kind: "reprocess-quarantine", Foundation: foundation}, func(ctx context.Context, j *job) error {
+		return collector.ReprocessQuarantine(ctx, j)
+	})
+}
+
+func (h *Handler) getJob(w http.ResponseWriter, r *http.Request) {
+	j, err := h.jobDB.GetAdminJob(r.PathValue("id"))
+	if err != nil {
+		h.logger.Error("err-get-admin-job", err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to get the job"))
+		return
+	}
+	if j == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such job"))
+		return
+	}
+	writeJSON(w, http.StatusOK, fromAdminJob(*j))
+}
+
+// collectorFor finds the collector for the foundation asked for, which can
+// be left out if there is only one
+func (h *Handler) collectorFor(w http.ResponseWriter, r *http.Request) (string, Collector, bool) {
+	if !h.isLeader() {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("this instance is not the leader, try another"))
+		return "", nil, false
+	}
+
+	foundation := r.URL.Query().Get("foundation")
+	if foundation == "" && len(h.collectors) == 1 {
+		for name := range h.collectors {
+			foundation = name
+		}
+	}
+	if foundation == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("foundation is required"))
+		return "", nil, false
+	}
+
+	collector, ok := h.collectors[foundation]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown foundation %q", foundation))
+		return "", nil, false
+	}
+	return foundation, collector, true
+}
+
+// start runs a job in the background and responds with it
+func (h *Handler) start(w http.ResponseWriter, details Job, run func(ctx context.Context, j *job) error) {
+	id, err := newJobID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger := h.logger.Session("job", lager.Data{
+		"id":         id,
+		"kind":       details.Kind,
+		"foundation": details.Foundation,
+	})
+	j := &job{Job: details, jobDB: h.jobDB, logger: logger}
+	j.ID = id
+	j.Status = JobQueued
+	j.CreatedAt = time.Now()
+	if !h.add(j) {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf(
+			"there are already %d jobs queued or running, try again once they have finished", maxUnfinishedJobs,
+		))
+		return
+	}
+	if err := h.jobDB.CreateAdminJob(toAdminJob(j.Job)); err != nil {
+		h.remove(j)
+		logger.Error("err-create-admin-job", err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to record the job"))
+		return
+	}
+	logger.Info("queued")
+	queued := j.Job
+
+	go func() {
+		err := run(h.ctx, j)
+		j.finish(err)
+		h.remove(j)
+		if err != nil {
+			logger.Error("err-job-failed", err)
+			return
+		}
+		logger.Info("succeeded")
+	}()
+
+	w.Header().Set("Location", "/admin/jobs/"+j.ID)
+	writeJSON(w, http.StatusAccepted, queued)
+}
+
+// add remembers an unfinished job, unless there are too many, when it
+// returns false
+func (h *Handler) add(j *job) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.jobs) >= maxUnfinishedJobs {
+		return false
+	}
+	h.jobs[j.ID] = j
+	return true
+}
+
+// remove forgets a job once it has finished
+func (h *Handler) remove(j *job) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.jobs, j.ID)
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
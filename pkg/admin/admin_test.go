@@ -0,0 +1,323 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/admin"
+	"github.com/alphagov/paas-auditor/pkg/collectors"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+type fakeCollector struct {
+	collect   func(ctx context.Context, progress collectors.JobProgress) error
+	backfill  func(ctx context.Context, since time.Time, until time.Time, progress collectors.JobProgress) error
+	reprocess func(ctx context.Context, progress collectors.JobProgress) error
+}
+
+func (c *fakeCollector) Collect(ctx context.Context, progress collectors.JobProgress) error {
+	return c.collect(ctx, progress)
+}
+
+func (c *fakeCollector) Backfill(ctx context.Context, since time.Time, until time.Time, progress collectors.JobProgress) error {
+	return c.backfill(ctx, since, until, progress)
+}
+
+func (c *fakeCollector) ReprocessQuarantine(ctx context.Context, progress collectors.JobProgress) error {
+	return c.reprocess(ctx, progress)
+}
+
+var _ = Describe("Handler", func() {
+	var (
+		ctx       context.Context
+		cancel    context.CancelFunc
+		collector *fakeCollector
+		jobDB     *dbfakes.FakeAdminJobDB
+		handler   *admin.Handler
+		leader    int64
+		server    *httptest.Server
+	)
+
+	BeforeEach(func() {
+		logger := lager.NewLogger("admin-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		collector = &fakeCollector{}
+		atomic.StoreInt64(&leader, 1)
+
+		// The jobs are kept in a map, as they would be in the admin_jobs
+		// table
+		var mu sync.Mutex
+		jobs := map[string]db.AdminJob{}
+		jobDB = &dbfakes.FakeAdminJobDB{}
+		jobDB.CreateAdminJobCalls(func(job db.AdminJob) error {
+			mu.Lock()
+			defer mu.Unlock()
+			jobs[job.ID] = job
+			return nil
+		})
+		jobDB.UpdateAdminJobCalls(func(job db.AdminJob) error {
+			mu.Lock()
+			defer mu.Unlock()
+			jobs[job.ID] = job
+			return nil
+		})
+		jobDB.GetAdminJobCalls(func(id string) (*db.AdminJob, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			job, ok := jobs[id]
+			if !ok {
+				return nil, nil
+			}
+			return &job, nil
+		})
+
+		ctx, cancel = context.WithCancel(context.Background())
+		handler = admin.NewHandler(
+			ctx,
+			logger,
+			"s3cret",
+			jobDB,
+			map[string]admin.Collector{"london": collector},
+			func() bool { return atomic.LoadInt64(&leader) == 1 },
+		)
+
+		mux := http.NewServeMux()
+		handler.Register(mux)
+		server = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		cancel()
+	})
+
+	request := func(method string, path string, token string) (*http.Response, map[string]interface{}) {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		body := map[string]interface{}{}
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		return resp, body
+	}
+
+	getJob := func(id string) map[string]interface{} {
+		resp, body := request("GET", "/admin/jobs/"+id, "s3cret")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		return body
+	}
+
+	It("requires the admin token", func() {
+		resp, body := request("POST", "/admin/collect", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(body["error"]).To(ContainSubstring("admin token"))
+
+		resp, _ = request("POST", "/admin/collect", "wrong")
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		resp, _ = request("GET", "/admin/jobs/anything", "wrong")
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("runs a collection and reports its progress", func() {
+		succeededBefore := h.CurrentMetricValue(admin.AdminJobsTotal.WithLabelValues("collect", "succeeded"))
+
+		release := make(chan struct{})
+		collector.collect = func(ctx context.Context, progress collectors.JobProgress) error {
+			progress.Started()
+			progress.EventsStored(5)
+			<-release
+			progress.EventsStored(2)
+			return nil
+		}
+
+		resp, job := request("POST", "/admin/collect", "s3cret")
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(job["kind"]).To(Equal("collect"))
+		Expect(job["foundation"]).To(Equal("london"))
+		id := job["id"].(string)
+		Expect(resp.Header.Get("Location")).To(Equal("/admin/jobs/" + id))
+
+		Eventually(func() interface{} { return getJob(id)["events_collected"] }).Should(BeNumerically("==", 5))
+		Expect(getJob(id)["status"]).To(Equal("running"))
+
+		close(release)
+		Eventually(func() interface{} { return getJob(id)["status"] }).Should(Equal("succeeded"))
+		Expect(getJob(id)["events_collected"]).To(BeNumerically("==", 7))
+		Expect(getJob(id)).To(HaveKey("finished_at"))
+
+		Expect(admin.AdminJobsTotal.WithLabelValues("collect", "succeeded")).To(
+			h.MetricIncrementedBy(succeededBefore, "==", 1),
+		)
+	})
+
+	It("runs a backfill of the window asked for", func() {
+		windows := make(chan [2]time.Time, 1)
+		collector.backfill = func(ctx context.Context, since time.Time, until time.Time, progress collectors.JobProgress) error {
+			windows <- [2]time.Time{since, until}
+			return fmt.Errorf("cloud controller is down")
+		}
+
+		resp, job := request("POST", "/admin/backfill?foundation=london&from=2019-10-01T00:00:00Z&to=2019-10-03T00:00:00Z", "s3cret")
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(job["from"]).To(Equal("2019-10-01T00:00:00Z"))
+		Expect(job["to"]).To(Equal("2019-10-03T00:00:00Z"))
+
+		var window [2]time.Time
+		Eventually(windows).Should(Receive(&window))
+		Expect(window[0]).To(Equal(time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)))
+		Expect(window[1]).To(Equal(time.Date(2019, 10, 3, 0, 0, 0, 0, time.UTC)))
+
+		id := job["id"].(string)
+		Eventually(func() interface{} { return getJob(id)["status"] }).Should(Equal("failed"))
+		Expect(getJob(id)["error"]).To(Equal("cloud controller is down"))
+	})
+
+	It("reprocesses quarantined events", func() {
+		collector.reprocess = func(ctx context.Context, progress collectors.JobProgress) error {
+			progress.Started()
+			progress.EventsStored(4)
+			return nil
+		}
+
+		resp, job := request("POST", "/admin/quarantine/reprocess", "s3cret")
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(job["kind"]).To(Equal("reprocess-quarantine"))
+
+		id := job["id"].(string)
+		Eventually(func() interface{} { return getJob(id)["status"] }).Should(Equal("succeeded"))
+		Expect(getJob(id)["events_collected"]).To(BeNumerically("==", 4))
+	})
+
+	It("rejects backfills with a bad window", func() {
+		for _, query := range []string{
+			"",
+			"from=yesterday&to=2019-10-03T00:00:00Z",
+			"from=2019-10-03T00:00:00Z&to=2019-10-01T00:00:00Z",
+			"from=2019-10-03T00:00:00Z&to=2999-10-01T00:00:00Z",
+		} {
+			resp, body := request("POST", "/admin/backfill?"+query, "s3cret")
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest), query)
+			Expect(body).To(HaveKey("error"))
+		}
+	})
+
+	It("rejects unknown foundations", func() {
+		resp, body := request("POST", "/admin/collect?foundation=paris", "s3cret")
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(body["error"]).To(ContainSubstring(`unknown foundation "paris"`))
+	})
+
+	It("only accepts jobs while leader", func() {
+		atomic.StoreInt64(&leader, 0)
+		resp, body := request("POST", "/admin/collect", "s3cret")
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(body["error"]).To(ContainSubstring("not the leader"))
+	})
+
+	It("refuses jobs while too many are unfinished", func() {
+		release := make(chan struct{})
+		collector.collect = func(ctx context.Context, progress collectors.JobProgress) error {
+			<-release
+			return nil
+		}
+
+		ids := []string{}
+		for i := 0; i < 10; i++ {
+			resp, job := request("POST", "/admin/collect", "s3cret")
+			Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+			ids = append(ids, job["id"].(string))
+		}
+		resp, body := request("POST", "/admin/collect", "s3cret")
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(body["error"]).To(ContainSubstring("already 10 jobs"))
+
+		close(release)
+		for _, id := range ids {
+			Eventually(func() interface{} { return getJob(id)["status"] }).Should(Equal("succeeded"))
+		}
+		Eventually(func() int {
+			resp, _ := request("POST", "/admin/collect", "s3cret")
+			return resp.StatusCode
+		}).Should(Equal(http.StatusAccepted))
+	})
+
+	It("serves jobs recorded by other instances", func() {
+		startedAt := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+		jobDB.GetAdminJobReturns(&db.AdminJob{
+			ID:              "elsewhere",
+			Kind:            "collect",
+			Foundation:      "london",
+			Status:          "running",
+			EventsCollected: 3,
+			CreatedAt:       startedAt,
+			StartedAt:       &startedAt,
+		}, nil)
+		jobDB.GetAdminJobStub = nil
+
+		job := getJob("elsewhere")
+		Expect(job["status"]).To(Equal("running"))
+		Expect(job["events_collected"]).To(BeNumerically("==", 3))
+		Expect(job["started_at"]).To(Equal("2019-10-01T00:00:00Z"))
+		Expect(jobDB.GetAdminJobArgsForCall(0)).To(Equal("elsewhere"))
+	})
+
+	It("does not accept a job it cannot record", func() {
+		jobDB.CreateAdminJobStub = nil
+		jobDB.CreateAdminJobReturns(fmt.Errorf("database is down"))
+		collector.collect = func(ctx context.Context, progress collectors.JobProgress) error {
+			Fail("the job should not have run")
+			return nil
+		}
+
+		resp, body := request("POST", "/admin/collect", "s3cret")
+		Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+		Expect(body["error"]).To(ContainSubstring("failed to record the job"))
+	})
+
+	It("fails the jobs an earlier leader did not finish, but not its own", func() {
+		release := make(chan struct{})
+		defer close(release)
+		collector.collect = func(ctx context.Context, progress collectors.JobProgress) error {
+			<-release
+			return nil
+		}
+		resp, job := request("POST", "/admin/collect", "s3cret")
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+
+		leading, stopLeading := context.WithCancel(ctx)
+		stopped := make(chan error, 1)
+		go func() { stopped <- handler.Run(leading) }()
+
+		Eventually(jobDB.FailUnfinishedAdminJobsCallCount).Should(Equal(1))
+		except, reason := jobDB.FailUnfinishedAdminJobsArgsForCall(0)
+		Expect(except).To(ConsistOf(job["id"]))
+		Expect(reason).To(ContainSubstring("stopped leading"))
+
+		stopLeading()
+		Eventually(stopped).Should(Receive(BeNil()))
+	})
+
+	It("returns 404 for unknown jobs", func() {
+		resp, _ := request("GET", "/admin/jobs/unknown", "s3cret")
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+})
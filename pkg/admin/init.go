@@ -0,0 +1,5 @@
+package admin
+
+func init() {
+	initMetrics()
+}
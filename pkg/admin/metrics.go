@@ -0,0 +1,16 @@
+package admin
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	AdminJobsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "admin_jobs_total",
+		Help: "Number of jobs asked for through the admin endpoints which have finished",
+	}, []string{"kind", "status"})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(AdminJobsTotal)
+}
@@ -0,0 +1,225 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const (
+	// ArchiverCursorName is the name of the archiver's cursor in
+	// shipper_cursors. Its updated_at is the end of the last day archived,
+	// and its shipped_id the date of that day.
+	ArchiverCursorName = "cf-audit-events-archiver"
+
+	dateFormat = "2006-01-02"
+)
+
+// EventsKey is the key of the archive of the events of a day
+func EventsKey(day time.Time) string {
+	return "cf-audit-events/" + day.UTC().Format("2006/01/02") + "/events.ndjson.gz"
+}
+
+// ManifestKey is the key of the manifest of the archive of a day, which is
+// written after the events, so a day with a manifest is completely archived
+func ManifestKey(day time.Time) string {
+	return "cf-audit-events/" + day.UTC().Format("2006/01/02") + "/manifest.json"
+}
+
+// Manifest describes the archive of a day
+type Manifest struct {
+	Date       string    `json:"date"`
+	EventCount int64     `json:"event_count"`
+	Key        string    `json:"key"`
+	SHA256     string    `json:"sha256"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// Event is a line of an archive, which is the event as shipped to Splunk
+// along with the foundation it was collected from
+type Event struct {
+	Foundation string `json:"foundation"`
+	db.CFAuditEvent
+}
+
+type Config struct {
+	// Schedule is how often the archiver looks for days to archive
+	Schedule time.Duration
+	// Delay is how long after a day ends it is archived, so that events
+	// which are collected late are included
+	Delay time.Duration
+}
+
+// Archiver writes the events created on each UTC day, once the day is over,
+// to storage as gzipped newline-delimited JSON, followed by a manifest. It
+// carries on from the day after its cursor, so every day is archived once.
+type Archiver struct {
+	logger    lager.Logger
+	archiveDB db.ArchiveDB
+	storage   Storage
+	cfg       Config
+}
+
+func NewArchiver(logger lager.Logger, archiveDB db.ArchiveDB, storage Storage, cfg Config) *Archiver {
+	return &Archiver{
+		logger:    logger.Session("archiver"),
+		archiveDB: archiveDB,
+		storage:   storage,
+		cfg:       cfg,
+	}
+}
+
+func (a *Archiver) Run(ctx context.Context) error {
+	lsession := a.logger.Session("run")
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		select {
+		case <-ctx.Done():
+			lsession.Info("done")
+			return nil
+		case <-time.After(a.cfg.Schedule):
+			if err := a.archive(ctx, lsession, time.Now()); err != nil {
+				ErrorsTotal.Inc()
+				lsession.Error("err-archive", err)
+			}
+		}
+	}
+}
+
+// archive archives every day which ended at least Delay before now and is
+// after the cursor
+func (a *Archiver) archive(ctx context.Context, logger lager.Logger, now time.Time) error {
+	next, err := a.nextDay()
+	if err != nil || next.IsZero() {
+		return err
+	}
+
+	for ; !next.Add(24*time.Hour + a.cfg.Delay).After(now); next = next.AddDate(0, 0, 1) {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// The cursor is saved after the manifest is written, so a day can
+		// have a manifest but not be past the cursor. It is not archived
+		// again.
+		archived, err := a.storage.Exists(ctx, ManifestKey(next))
+		if err != nil {
+			return fmt.Errorf("failed to check for the archive of %s: %s", next.Format(dateFormat), err)
+		}
+		if archived {
+			logger.Info("already-archived", lager.Data{"date": next.Format(dateFormat)})
+		} else {
+			manifest, err := a.archiveDay(ctx, next)
+			if err != nil {
+				return fmt.Errorf("failed to archive %s: %s", next.Format(dateFormat), err)
+			}
+			DaysArchivedTotal.Inc()
+			EventsArchivedTotal.Add(float64(manifest.EventCount))
+			logger.Info("archived-day", lager.Data{"manifest": manifest})
+		}
+
+		err = a.archiveDB.UpdateShipperCursor(
+			ArchiverCursorName, next.AddDate(0, 0, 1).Format(time.RFC3339), next.Format(dateFormat),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update the cursor after %s: %s", next.Format(dateFormat), err)
+		}
+		LatestDayTimestamp.Set(float64(next.Unix()))
+	}
+	return nil
+}
+
+// nextDay returns the day after the cursor, or the day of the earliest
+// event if there is no cursor, or the zero time if there are no events
+func (a *Archiver) nextDay() (time.Time, error) {
+	cursor, err := a.archiveDB.GetShipperCursor(ArchiverCursorName)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get the cursor: %s", err)
+	}
+	if cursor != nil {
+		return cursor.UpdatedAt.UTC(), nil
+	}
+
+	earliest, err := a.archiveDB.GetEarliestCFEventTime()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get the earliest event: %s", err)
+	}
+	if earliest.IsZero() {
+		return time.Time{}, nil
+	}
+	return earliest.UTC().Truncate(24 * time.Hour), nil
+}
+
+func (a *Archiver) archiveDay(ctx context.Context, day time.Time) (Manifest, error) {
+	manifest := Manifest{
+		Date: day.Format(dateFormat),
+		Key:  EventsKey(day),
+	}
+
+	// The events are streamed from the database through gzip into storage,
+	// so however many there are in a day they are not held in memory
+	pr, pw := io.Pipe()
+	hash := sha256.New()
+	type written struct {
+		eventCount int64
+		err        error
+	}
+	writtenChan := make(chan written, 1)
+	go func() {
+		eventCount, err := a.writeEvents(ctx, day, io.MultiWriter(pw, hash))
+		pw.CloseWithError(err)
+		writtenChan <- written{eventCount, err}
+	}()
+
+	putErr := a.storage.Put(ctx, manifest.Key, pr)
+	// Stops the events being written if storing them failed part way
+	pr.CloseWithError(fmt.Errorf("storing %s stopped", manifest.Key))
+	w := <-writtenChan
+	if w.err != nil {
+		return manifest, w.err
+	}
+	if putErr != nil {
+		return manifest, putErr
+	}
+	manifest.EventCount = w.eventCount
+	manifest.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	manifest.ArchivedAt = time.Now().UTC()
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, a.storage.Put(ctx, ManifestKey(day), bytes.NewReader(append(manifestJSON, '\n')))
+}
+
+// writeEvents writes the events of a day to w as gzipped NDJSON, returning
+// how many there were
+func (a *Archiver) writeEvents(ctx context.Context, day time.Time, w io.Writer) (int64, error) {
+	gz := gzip.NewWriter(w)
+	encoder := json.NewEncoder(gz)
+
+	var eventCount int64
+	err := a.archiveDB.StreamCFAuditEvents(ctx, db.EventQuery{
+		From: day,
+		To:   day.AddDate(0, 0, 1),
+	}, func(event db.CFAuditEvent) error {
+		eventCount++
+		return encoder.Encode(Event{Foundation: event.Foundation, CFAuditEvent: event})
+	})
+	if err != nil {
+		return eventCount, err
+	}
+	return eventCount, gz.Close()
+}
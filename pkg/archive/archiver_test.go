@@ -0,0 +1,193 @@
+package archive_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/archive"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Archiver", func() {
+	var (
+		logger    lager.Logger
+		archiveDB *dbfakes.FakeArchiveDB
+		storage   archive.LocalStorage
+		today     time.Time
+		ctx       context.Context
+		cancel    context.CancelFunc
+		wg        sync.WaitGroup
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("archive-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+		storage = archive.LocalStorage{Dir: GinkgoT().TempDir()}
+		today = time.Now().UTC().Truncate(24 * time.Hour)
+
+		archiveDB = &dbfakes.FakeArchiveDB{}
+		var (
+			mu     sync.Mutex
+			cursor *db.ShipperCursor
+		)
+		archiveDB.GetShipperCursorStub = func(name string) (*db.ShipperCursor, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return cursor, nil
+		}
+		archiveDB.UpdateShipperCursorStub = func(name string, shipperTime string, shippedID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			updatedAt, err := time.Parse(time.RFC3339, shipperTime)
+			Expect(err).NotTo(HaveOccurred())
+			cursor = &db.ShipperCursor{Name: name, UpdatedAt: updatedAt, ShippedID: shippedID}
+			return nil
+		}
+		archiveDB.GetEarliestCFEventTimeReturns(today.AddDate(0, 0, -2).Add(5*time.Hour), nil)
+		archiveDB.StreamCFAuditEventsStub = func(ctx context.Context, query db.EventQuery, fn func(event db.CFAuditEvent) error) error {
+			for i := 0; i < 2; i++ {
+				err := fn(db.CFAuditEvent{
+					Event: cfclient.Event{
+						GUID:      fmt.Sprintf("%d0000000-0000-0000-0000-000000000000", i+1),
+						CreatedAt: query.From.Add(time.Duration(i) * time.Hour).Format(time.RFC3339),
+						Type:      "audit.app.create",
+					},
+					Foundation:       "london",
+					OrganizationName: "my-org",
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	start := func() {
+		archiver := archive.NewArchiver(logger, archiveDB, storage, archive.Config{Schedule: 10 * time.Millisecond})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = archiver.Run(ctx)
+		}()
+	}
+
+	It("archives every day which is over, once, with a manifest", func() {
+		daysBefore := h.CurrentMetricValue(archive.DaysArchivedTotal)
+
+		start()
+
+		Eventually(archiveDB.UpdateShipperCursorCallCount).Should(Equal(2))
+		Consistently(archiveDB.UpdateShipperCursorCallCount, "50ms").Should(Equal(2))
+		Expect(archiveDB.StreamCFAuditEventsCallCount()).To(Equal(2))
+		Expect(archive.DaysArchivedTotal).To(h.MetricIncrementedBy(daysBefore, "==", 2))
+
+		day := today.AddDate(0, 0, -1)
+		_, query, _ := archiveDB.StreamCFAuditEventsArgsForCall(1)
+		Expect(query).To(Equal(db.EventQuery{From: day, To: today}))
+
+		name, cursorTime, cursorID := archiveDB.UpdateShipperCursorArgsForCall(1)
+		Expect(name).To(Equal(archive.ArchiverCursorName))
+		Expect(cursorTime).To(Equal(today.Format(time.RFC3339)))
+		Expect(cursorID).To(Equal(day.Format("2006-01-02")))
+
+		By("writing the events as gzipped NDJSON")
+		data, err := storage.Get(ctx, archive.EventsKey(day))
+		Expect(err).NotTo(HaveOccurred())
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		Expect(err).NotTo(HaveOccurred())
+		lines := []map[string]interface{}{}
+		scanner := bufio.NewScanner(gz)
+		for scanner.Scan() {
+			line := map[string]interface{}{}
+			Expect(json.Unmarshal(scanner.Bytes(), &line)).To(Succeed())
+			lines = append(lines, line)
+		}
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(HaveKeyWithValue("foundation", "london"))
+		Expect(lines[0]).To(HaveKeyWithValue("guid", "10000000-0000-0000-0000-000000000000"))
+		Expect(lines[0]).To(HaveKeyWithValue("organization_name", "my-org"))
+
+		By("writing a manifest which matches them")
+		manifestJSON, err := storage.Get(ctx, archive.ManifestKey(day))
+		Expect(err).NotTo(HaveOccurred())
+		manifest := archive.Manifest{}
+		Expect(json.Unmarshal(manifestJSON, &manifest)).To(Succeed())
+		sum := sha256.Sum256(data)
+		Expect(manifest.Date).To(Equal(day.Format("2006-01-02")))
+		Expect(manifest.EventCount).To(BeNumerically("==", 2))
+		Expect(manifest.Key).To(Equal(archive.EventsKey(day)))
+		Expect(manifest.SHA256).To(Equal(hex.EncodeToString(sum[:])))
+	})
+
+	It("does not archive a day again which already has a manifest", func() {
+		day := today.AddDate(0, 0, -2)
+		Expect(storage.Put(ctx, archive.ManifestKey(day), strings.NewReader("{}"))).To(Succeed())
+
+		start()
+
+		Eventually(archiveDB.UpdateShipperCursorCallCount).Should(Equal(2))
+		Expect(archiveDB.StreamCFAuditEventsCallCount()).To(Equal(1))
+		Expect(storage.Get(ctx, archive.ManifestKey(day))).To(Equal([]byte("{}")))
+	})
+
+	It("does not move the cursor past a day which could not be archived", func() {
+		errorsBefore := h.CurrentMetricValue(archive.ErrorsTotal)
+		archiveDB.StreamCFAuditEventsReturns(fmt.Errorf("connection reset"))
+
+		start()
+
+		Eventually(archiveDB.StreamCFAuditEventsCallCount).Should(BeNumerically(">=", 2))
+		Expect(archiveDB.UpdateShipperCursorCallCount()).To(Equal(0))
+		Expect(archive.ErrorsTotal).To(h.MetricIncrementedBy(errorsBefore, ">=", 1))
+		exists, err := storage.Exists(ctx, archive.ManifestKey(today.AddDate(0, 0, -2)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeFalse())
+	})
+
+	It("stores nothing for a day whose events stop part way", func() {
+		archiveDB.StreamCFAuditEventsStub = func(ctx context.Context, query db.EventQuery, fn func(event db.CFAuditEvent) error) error {
+			err := fn(db.CFAuditEvent{Event: cfclient.Event{
+				GUID:      "10000000-0000-0000-0000-000000000000",
+				CreatedAt: query.From.Format(time.RFC3339),
+			}})
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("connection reset")
+		}
+
+		start()
+
+		Eventually(archiveDB.StreamCFAuditEventsCallCount).Should(BeNumerically(">=", 2))
+		Expect(archiveDB.UpdateShipperCursorCallCount()).To(Equal(0))
+		for _, key := range []string{archive.EventsKey(today.AddDate(0, 0, -2)), archive.ManifestKey(today.AddDate(0, 0, -2))} {
+			exists, err := storage.Exists(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse(), key)
+		}
+	})
+})
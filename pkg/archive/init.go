@@ -0,0 +1,5 @@
+package archive
+
+func init() {
+	initMetrics()
+}
@@ -0,0 +1,34 @@
+package archive
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	DaysArchivedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archiver_days_archived_total",
+		Help: "Number of days of CF audit events archived",
+	})
+
+	EventsArchivedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archiver_events_archived_total",
+		Help: "Number of CF audit events archived",
+	})
+
+	LatestDayTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "archiver_latest_day_timestamp",
+		Help: "Unix epoch seconds of the start of the latest day archived",
+	})
+
+	ErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archiver_errors_total",
+		Help: "Number of errors encountered archiving CF audit events",
+	})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(DaysArchivedTotal)
+	prometheus.MustRegister(EventsArchivedTotal)
+	prometheus.MustRegister(LatestDayTimestamp)
+	prometheus.MustRegister(ErrorsTotal)
+}
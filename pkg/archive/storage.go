@@ -0,0 +1,22 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned by Storage.Get for objects which do not exist
+var ErrNotFound = errors.New("object not found")
+
+// Storage is somewhere archives are kept, by key, like
+// cf-audit-events/2019/10/31/events.ndjson.gz
+type Storage interface {
+	// Put stores an object read from r, replacing any with the same key.
+	// The object is stored only if r is read to the end without an error.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get returns an object, or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Exists says whether there is an object with the key
+	Exists(ctx context.Context, key string) (bool, error)
+}
@@ -0,0 +1,139 @@
+package archive_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing/iotest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/archive"
+)
+
+// s3StandIn is enough of the S3 API to store and read objects, which checks
+// that each request is signed
+type s3StandIn struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+	body, err := io.ReadAll(r.Body)
+	Expect(err).NotTo(HaveOccurred())
+
+	sum := sha256.Sum256(body)
+	Expect(r.Header.Get("X-Amz-Content-Sha256")).To(Equal(hex.EncodeToString(sum[:])))
+	signedAt, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	Expect(err).NotTo(HaveOccurred())
+	resigned, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	Expect(err).NotTo(HaveOccurred())
+	archive.SignV4(resigned, r.Header.Get("X-Amz-Content-Sha256"), "access-key-id", "secret-access-key", "eu-west-2", signedAt)
+	if r.Header.Get("Authorization") != resigned.Header.Get("Authorization") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	Expect(r.URL.Path).To(HavePrefix("/audit-archive/"))
+	key := strings.TrimPrefix(r.URL.Path, "/audit-archive/")
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = body
+	case http.MethodGet, http.MethodHead:
+		object, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(object)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+var _ = Describe("Storage", func() {
+	behavesLikeStorage := func(newStorage func() archive.Storage) {
+		It("stores, replaces and reads objects", func() {
+			storage := newStorage()
+			ctx := context.Background()
+			key := "cf-audit-events/2019/10/31/events.ndjson.gz"
+
+			exists, err := storage.Exists(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+			_, err = storage.Get(ctx, key)
+			Expect(err).To(MatchError(archive.ErrNotFound))
+
+			Expect(storage.Put(ctx, key, strings.NewReader("first"))).To(Succeed())
+			Expect(storage.Put(ctx, key, strings.NewReader("second"))).To(Succeed())
+
+			exists, err = storage.Exists(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(storage.Get(ctx, key)).To(Equal([]byte("second")))
+		})
+
+		It("stores nothing if the object cannot be read to the end", func() {
+			storage := newStorage()
+			ctx := context.Background()
+			key := "cf-audit-events/2019/10/31/events.ndjson.gz"
+
+			r := io.MultiReader(strings.NewReader("half"), iotest.ErrReader(fmt.Errorf("connection reset")))
+			Expect(storage.Put(ctx, key, r)).To(MatchError("connection reset"))
+
+			exists, err := storage.Exists(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+	}
+
+	Context("on the local filesystem", func() {
+		behavesLikeStorage(func() archive.Storage {
+			return archive.LocalStorage{Dir: GinkgoT().TempDir()}
+		})
+	})
+
+	Context("in S3", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewServer(&s3StandIn{objects: map[string][]byte{}})
+			DeferCleanup(server.Close)
+		})
+
+		behavesLikeStorage(func() archive.Storage {
+			return archive.NewS3Storage(archive.S3Config{
+				Endpoint:        server.URL,
+				Region:          "eu-west-2",
+				Bucket:          "audit-archive",
+				AccessKeyID:     "access-key-id",
+				SecretAccessKey: "secret-access-key",
+			})
+		})
+
+		It("fails when the request is refused", func() {
+			storage := archive.NewS3Storage(archive.S3Config{
+				Endpoint:        server.URL,
+				Region:          "eu-west-2",
+				Bucket:          "audit-archive",
+				AccessKeyID:     "access-key-id",
+				SecretAccessKey: "wrong",
+			})
+			err := storage.Put(context.Background(), "key", strings.NewReader("data"))
+			Expect(err).To(MatchError(ContainSubstring("status 403")))
+		})
+	})
+})
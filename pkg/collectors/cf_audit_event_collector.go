@@ -2,29 +2,100 @@ package collectors
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+
 	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/enrichers"
 	"github.com/alphagov/paas-auditor/pkg/fetchers"
 )
 
+// backfillHorizon is roughly how long Cloud Controller keeps events for.
+// Backfills are only sliced up within this horizon, anything older is
+// collected as a single window as there is unlikely to be anything there.
+const backfillHorizon = 31 * 24 * time.Hour
+
+// BackfillConfig controls how the collector catches up when it is a long way
+// behind, for example when it starts with an empty database
+type BackfillConfig struct {
+	// SliceDuration is the length of the windows a backfill is split into.
+	// If zero the missing events are collected as a single window.
+	SliceDuration time.Duration
+	// Workers is how many windows are collected at once
+	Workers int
+}
+
+// WatermarkConfig controls how the collector makes sure it does not miss
+// events which Cloud Controller commits late, with a created_at earlier than
+// events it has already returned
+type WatermarkConfig struct {
+	// Overlap is how far before the watermark each pass starts
+	Overlap time.Duration
+	// ResweepInterval is how often to collect the ResweepWindow before the
+	// watermark again. If zero there are no re-sweeps.
+	ResweepInterval time.Duration
+	ResweepWindow   time.Duration
+}
+
 type CFAuditEventCollector struct {
+	foundation      string
 	schedule        time.Duration
 	logger          lager.Logger
 	fetcher         fetchers.CFAuditEventFetcher
+	enricher        enrichers.Enricher
 	eventDB         db.EventDB
-	eventsCollected int
+	backfill        BackfillConfig
+	watermark       WatermarkConfig
+	jobs            chan collectorJob
+	eventsCollected int64
+
+	mu sync.Mutex
+	// stopped is closed when Run returns, so that jobs waiting for it fail
+	// rather than wait for a leadership which may not come back
+	stopped chan struct{}
 }
 
+// ErrCollectorStopped is returned for jobs which were not run because the
+// collector stopped, for example because this instance is no longer leader
+var ErrCollectorStopped = errors.New("the collector has stopped, so the job was not run")
+
+// ErrJobInterrupted is returned for jobs which the collector stopped part way
+// through, so which may not have collected every event
+var ErrJobInterrupted = errors.New("the collector stopped before the job finished")
+
 func NewCFAuditEventCollector(
+	foundation string,
 	schedule time.Duration,
 	logger lager.Logger,
 	fetcher fetchers.CFAuditEventFetcher,
+	enricher enrichers.Enricher,
 	eventDB db.EventDB,
+	backfill BackfillConfig,
+	watermark WatermarkConfig,
 ) *CFAuditEventCollector {
-	logger = logger.Session("cf-audit-event-collector")
-	return &CFAuditEventCollector{schedule, logger, fetcher, eventDB, 0}
+	logger = logger.Session("cf-audit-event-collector", lager.Data{"foundation": foundation})
+	if backfill.Workers < 1 {
+		backfill.Workers = 1
+	}
+	return &CFAuditEventCollector{
+		foundation: foundation,
+		schedule:   schedule,
+		logger:     logger,
+		fetcher:    fetcher,
+		enricher:   enricher,
+		eventDB:    eventDB,
+		backfill:   backfill,
+		watermark:  watermark,
+		jobs:       make(chan collectorJob),
+		stopped:    make(chan struct{}),
+	}
 }
 
 func (c *CFAuditEventCollector) Run(ctx context.Context) error {
@@ -32,65 +103,651 @@ func (c *CFAuditEventCollector) Run(ctx context.Context) error {
 	lsession.Info("start")
 	defer lsession.Info("end")
 
-	for {
-		pullEventsSince, err := c.pullEventsSince(5 * time.Second)
-		if err != nil {
-			lsession.Error("err-pull-events-since", err)
-			CFAuditEventCollectorErrorsTotal.Inc()
-			return err
-		}
+	stopped := c.start()
+	defer close(stopped)
 
+	for {
 		select {
 		case <-ctx.Done():
 			lsession.Info("done")
 			return nil
+		case job := <-c.jobs:
+			job.progress.Started()
+			err := job.run(ctx, lsession)
+			if err == nil && ctx.Err() != nil {
+				err = ErrJobInterrupted
+			}
+			job.done <- err
 		case <-time.After(c.schedule):
-			startTime := time.Now()
+			if err := c.collect(ctx, lsession, nil); err != nil {
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			lsession.Info("done")
+			return nil
+		}
+	}
+}
+
+// start returns the channel to close when Run returns, making a new one if
+// Run has stopped before
+func (c *CFAuditEventCollector) start() chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.stopped:
+		c.stopped = make(chan struct{})
+	default:
+	}
+	return c.stopped
+}
 
-			resultsChan := make(chan fetchers.CFAuditEventResult, 3)
-			go c.fetcher(pullEventsSince, resultsChan)
+// JobProgress is told how a job run with Collect, Backfill or
+// ReprocessQuarantine is going
+type JobProgress interface {
+	// Started is called when the collector starts the job, which may be after
+	// it has finished what it was already doing
+	Started()
+	// EventsStored is called after each page of events is stored, with how
+	// many of them were new
+	EventsStored(count int)
+}
 
-			for result := range resultsChan {
-				if result.Err != nil {
-					lsession.Error("err-recv-events", err)
-					CFAuditEventCollectorErrorsTotal.Inc()
-					return result.Err
-				}
+type collectorJob struct {
+	run      func(ctx context.Context, lsession lager.Logger) error
+	progress JobProgress
+	done     chan error
+}
+
+// Collect brings the collector up to date straight away, rather than waiting
+// for its schedule. It returns once the collection has finished.
+func (c *CFAuditEventCollector) Collect(ctx context.Context, progress JobProgress) error {
+	return c.runJob(ctx, collectorJob{
+		run: func(ctx context.Context, lsession lager.Logger) error {
+			return c.collect(ctx, lsession, progress)
+		},
+		progress: progress,
+	})
+}
+
+// Backfill collects the events created in [since, until). It does not move
+// the watermark, as there may be events missing before since. It returns
+// once the window has been collected.
+func (c *CFAuditEventCollector) Backfill(ctx context.Context, since time.Time, until time.Time, progress JobProgress) error {
+	if !until.After(since) {
+		return fmt.Errorf("backfill must end after it starts")
+	}
+	return c.runJob(ctx, collectorJob{
+		run: func(ctx context.Context, lsession lager.Logger) error {
+			return c.collectExplicitWindow(ctx, lsession, since, until, progress)
+		},
+		progress: progress,
+	})
+}
+
+// ReprocessQuarantine tries to store the foundation's quarantined events
+// again, for example after they have been corrected. Events which are still
+// invalid are left in quarantine. It returns once every event has been
+// tried.
+func (c *CFAuditEventCollector) ReprocessQuarantine(ctx context.Context, progress JobProgress) error {
+	return c.runJob(ctx, collectorJob{
+		run: func(ctx context.Context, lsession lager.Logger) error {
+			return c.reprocessQuarantine(lsession, progress)
+		},
+		progress: progress,
+	})
+}
+
+// runJob hands a job to Run, waiting for it to be picked up if the collector
+// is busy or has not started yet. The job fails with ErrCollectorStopped if
+// Run returns first, for example because leadership was lost.
+func (c *CFAuditEventCollector) runJob(ctx context.Context, job collectorJob) error {
+	c.mu.Lock()
+	stopped := c.stopped
+	c.mu.Unlock()
+
+	job.done = make(chan error, 1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-stopped:
+		return ErrCollectorStopped
+	case c.jobs <- job:
+	}
+	// Run sends the job's result before it returns
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-job.done:
+		return err
+	}
+}
+
+// collect brings the collector up to date from its watermark, and re-sweeps
+// for late events if one is due. Errors are returned, except those caused by
+// ctx being cancelled part way through.
+func (c *CFAuditEventCollector) collect(ctx context.Context, lsession lager.Logger, progress JobProgress) error {
+	startTime := time.Now()
+
+	watermark, err := c.eventDB.GetCollectorWatermark(db.CFAuditEventsSource, c.foundation)
+	if err != nil {
+		lsession.Error("err-get-collector-watermark", err)
+		CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+		return err
+	}
 
-				err := c.eventDB.StoreCFAuditEvents(result.Events)
+	checkpoints, err := c.checkpointsToCollect(startTime, watermark)
+	if err != nil {
+		lsession.Error("err-checkpoints-to-collect", err)
+		CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+		return err
+	}
+
+	_, err = c.collectWindows(ctx, lsession, startTime, checkpoints, progress)
+	if err != nil || ctx.Err() != nil {
+		return err
+	}
+
+	watermark, err = c.advanceWatermark(watermark, checkpoints)
+	if err != nil {
+		lsession.Error("err-update-collector-watermark", err)
+		CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+		return err
+	}
+
+	if c.resweepDue(startTime, watermark) {
+		err = c.resweep(ctx, lsession, startTime, watermark, progress)
+		if err != nil || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	c.pruneCheckpoints(lsession, watermark)
+	c.logCollected(lsession, startTime)
+	return nil
+}
+
+// pruneCheckpoints deletes the checkpoints of completed windows which the
+// watermark has passed, as they will not be resumed. Failing to is logged
+// rather than failing the pass, as the next pass tries again.
+func (c *CFAuditEventCollector) pruneCheckpoints(lsession lager.Logger, watermark db.CollectorWatermark) {
+	if watermark.Watermark.IsZero() {
+		return
+	}
+	deleted, err := c.eventDB.DeleteCompletedBackfillCheckpoints(c.foundation, watermark.Watermark)
+	if err != nil {
+		lsession.Error("err-delete-completed-backfill-checkpoints", err)
+		CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+		return
+	}
+	if deleted > 0 {
+		lsession.Info("deleted-completed-backfill-checkpoints", lager.Data{"deleted": deleted})
+	}
+}
+
+// collectExplicitWindow collects an explicit window
+func (c *CFAuditEventCollector) collectExplicitWindow(
+	ctx context.Context,
+	lsession lager.Logger,
+	since time.Time,
+	until time.Time,
+	progress JobProgress,
+) error {
+	startTime := time.Now()
+	lsession = lsession.Session("backfill", lager.Data{"since": since, "until": until})
+
+	checkpoints, err := c.startWindows(since, until)
+	if err != nil {
+		lsession.Error("err-start-windows", err)
+		CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+		return err
+	}
+
+	_, err = c.collectWindows(ctx, lsession, startTime, checkpoints, progress)
+	if err != nil || ctx.Err() != nil {
+		return err
+	}
+
+	c.logCollected(lsession, startTime)
+	return nil
+}
+
+func (c *CFAuditEventCollector) reprocessQuarantine(lsession lager.Logger, progress JobProgress) error {
+	lsession = lsession.Session("reprocess-quarantine")
+
+	quarantined, err := c.eventDB.GetQuarantinedCFAuditEvents(c.foundation)
+	if err != nil {
+		lsession.Error("err-get-quarantined-cf-audit-events", err)
+		CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+		return err
+	}
+
+	events := []cfclient.Event{}
+	ids := []int64{}
+	for _, q := range quarantined {
+		event, err := fetchers.DecodeCFAuditEvent(q.Event)
+		if err != nil {
+			lsession.Info("still-invalid", lager.Data{"id": q.ID, "reason": err.Error()})
+			continue
+		}
+		if err := db.ValidateCFAuditEvent(event); err != nil {
+			lsession.Info("still-invalid", lager.Data{"id": q.ID, "reason": err.Error()})
+			continue
+		}
+		events = append(events, event)
+		ids = append(ids, q.ID)
+	}
+
+	if len(events) > 0 {
+		stored, err := c.eventDB.StoreCFAuditEvents(c.foundation, events)
+		if err != nil {
+			lsession.Error("err-store-cf-audit-events", err)
+			CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+			return err
+		}
+		if progress != nil {
+			progress.EventsStored(stored.Inserted)
+		}
+		if err := c.eventDB.MarkCFAuditEventsReprocessed(ids); err != nil {
+			lsession.Error("err-mark-cf-audit-events-reprocessed", err)
+			CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+			return err
+		}
+	}
+
+	lsession.Info("reprocessed", lager.Data{
+		"reprocessed":   len(events),
+		"still-invalid": len(quarantined) - len(events),
+	})
+	return nil
+}
+
+func (c *CFAuditEventCollector) logCollected(lsession lager.Logger, startTime time.Time) {
+	duration := time.Since(startTime)
+	lsession.Info(
+		"stored-all-events",
+		lager.Data{
+			"duration":         duration,
+			"events-collected": atomic.LoadInt64(&c.eventsCollected),
+		},
+	)
+	CFAuditEventCollectorEventsCollectDurationTotal.WithLabelValues(c.foundation).Add(duration.Seconds())
+}
+
+// checkpointsToCollect returns the windows which need collecting. If a
+// previous run stopped part way through any windows then those windows are
+// resumed, otherwise new windows are started from the watermark.
+func (c *CFAuditEventCollector) checkpointsToCollect(
+	now time.Time,
+	watermark db.CollectorWatermark,
+) ([]db.BackfillCheckpoint, error) {
+	checkpoints, err := c.eventDB.GetIncompleteBackfillCheckpoints(c.foundation)
+	if err != nil {
+		return nil, err
+	}
+	if len(checkpoints) > 0 {
+		return checkpoints, nil
+	}
+
+	pullEventsSince, err := c.pullEventsSince(watermark, c.watermark.Overlap)
+	if err != nil {
+		return nil, err
+	}
+	if !now.After(pullEventsSince) {
+		return nil, nil
+	}
+
+	return c.startWindows(pullEventsSince, now)
+}
+
+// startWindows checkpoints the windows from start to end. Every window is
+// checkpointed before any are collected, so that none are forgotten if we
+// stop part way through.
+func (c *CFAuditEventCollector) startWindows(start time.Time, end time.Time) ([]db.BackfillCheckpoint, error) {
+	checkpoints := sliceWindow(start, end, c.backfill.SliceDuration)
+	for i := range checkpoints {
+		checkpoints[i].Foundation = c.foundation
+		if err := c.eventDB.UpdateBackfillCheckpoint(checkpoints[i]); err != nil {
+			return nil, err
+		}
+	}
+	return checkpoints, nil
+}
+
+// sliceWindow splits the window from start to end into windows no longer
+// than sliceDuration, apart from anything before the backfill horizon.
+// Neighbouring windows share a boundary, and an event created on it is
+// fetched by the later window, as windows include their start.
+func sliceWindow(start time.Time, end time.Time, sliceDuration time.Duration) []db.BackfillCheckpoint {
+	if sliceDuration <= 0 || end.Sub(start) <= sliceDuration {
+		return []db.BackfillCheckpoint{{WindowStart: start, WindowEnd: end}}
+	}
+
+	checkpoints := []db.BackfillCheckpoint{}
+
+	horizon := end.Add(-backfillHorizon)
+	if start.Before(horizon) {
+		checkpoints = append(checkpoints, db.BackfillCheckpoint{
+			WindowStart: start, WindowEnd: horizon,
+		})
+		start = horizon
+	}
+
+	for sliceStart := start; sliceStart.Before(end); sliceStart = sliceStart.Add(sliceDuration) {
+		sliceEnd := sliceStart.Add(sliceDuration)
+		if sliceEnd.After(end) {
+			sliceEnd = end
+		}
+		checkpoints = append(checkpoints, db.BackfillCheckpoint{
+			WindowStart: sliceStart, WindowEnd: sliceEnd,
+		})
+	}
+
+	return checkpoints
+}
+
+// collectWindows collects each window using a bounded pool of workers,
+// returning how many new events were stored. If any window fails the others
+// are stopped and the first error is returned.
+func (c *CFAuditEventCollector) collectWindows(
+	ctx context.Context,
+	lsession lager.Logger,
+	startTime time.Time,
+	checkpoints []db.BackfillCheckpoint,
+	progress JobProgress,
+) (int64, error) {
+	workersCtx, cancelWorkers := context.WithCancel(ctx)
+	defer cancelWorkers()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		inserted int64
+	)
+
+	checkpointsChan := make(chan db.BackfillCheckpoint)
+	go func() {
+		defer close(checkpointsChan)
+		for _, checkpoint := range checkpoints {
+			select {
+			case <-workersCtx.Done():
+				return
+			case checkpointsChan <- checkpoint:
+			}
+		}
+	}()
+
+	for i := 0; i < c.backfill.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for checkpoint := range checkpointsChan {
+				windowInserted, err := c.collectWindow(workersCtx, lsession, startTime, checkpoint, progress)
+				atomic.AddInt64(&inserted, windowInserted)
 				if err != nil {
-					lsession.Error("err-store-cf-audit-events", err)
-					CFAuditEventCollectorErrorsTotal.Inc()
-					return err
+					errOnce.Do(func() {
+						firstErr = err
+						cancelWorkers()
+					})
+					return
 				}
+			}
+		}()
+	}
 
-				c.eventsCollected += len(result.Events)
-				CFAuditEventCollectorEventsCollectedTotal.Add(float64(len(result.Events)))
+	wg.Wait()
+	return atomic.LoadInt64(&inserted), firstErr
+}
 
-				lsession.Info(
-					"stored-events",
-					lager.Data{
-						"duration":         time.Since(startTime),
-						"events-collected": c.eventsCollected,
-					},
-				)
+// collectWindow fetches and stores the events in the checkpoint's window,
+// starting from the last page stored, and marks the window complete once the
+// last page has been stored. It returns how many new events were stored.
+func (c *CFAuditEventCollector) collectWindow(
+	ctx context.Context,
+	lsession lager.Logger,
+	startTime time.Time,
+	checkpoint db.BackfillCheckpoint,
+	progress JobProgress,
+) (int64, error) {
+	var inserted int64
+
+	lsession = lsession.WithData(lager.Data{
+		"window-start":    checkpoint.WindowStart,
+		"window-end":      checkpoint.WindowEnd,
+		"resume-page-url": checkpoint.LastPageURL,
+	})
+
+	fetchCtx, cancelFetch := context.WithCancel(ctx)
+	defer cancelFetch()
+
+	resultsChan := make(chan fetchers.CFAuditEventResult, 3)
+	go c.fetcher(fetchCtx, fetchers.CFAuditEventQuery{
+		Since:        checkpoint.WindowStart,
+		Until:        checkpoint.WindowEnd,
+		StartPageURL: checkpoint.LastPageURL,
+	}, resultsChan)
+
+	for result := range resultsChan {
+		if result.Err != nil {
+			lsession.Error("err-recv-events", result.Err)
+			CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+			return inserted, result.Err
+		}
+
+		events, invalid := setAsideInvalidEvents(result)
+		if len(invalid) > 0 {
+			err := c.eventDB.QuarantineCFAuditEvents(c.foundation, invalid)
+			if err != nil && ctx.Err() != nil {
+				return inserted, nil
 			}
+			if err != nil {
+				lsession.Error("err-quarantine-cf-audit-events", err)
+				CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+				return inserted, err
+			}
+		}
 
-			duration := time.Since(startTime)
-			lsession.Info(
-				"stored-all-events",
-				lager.Data{
-					"duration":         duration,
-					"events-collected": c.eventsCollected,
-				},
-			)
-			CFAuditEventCollectorEventsCollectDurationTotal.Add(duration.Seconds())
+		if c.enricher != nil {
+			c.enricher.Enrich(ctx, events)
 		}
+
+		stored, err := c.eventDB.StoreCFAuditEvents(c.foundation, events)
+		if err != nil && ctx.Err() != nil {
+			// We are shutting down, the page will be fetched again next time
+			return inserted, nil
+		}
+		if err != nil {
+			lsession.Error("err-store-cf-audit-events", err)
+			CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+			return inserted, err
+		}
+		stored.Quarantined += len(invalid)
+		inserted += int64(stored.Inserted)
+		CFAuditEventCollectorDuplicateEventsTotal.WithLabelValues(c.foundation).Add(float64(stored.Duplicates))
+		if stored.Quarantined > 0 {
+			lsession.Info("quarantined-events", lager.Data{"quarantined": stored.Quarantined})
+			CFAuditEventCollectorQuarantinedEventsTotal.WithLabelValues(c.foundation).Add(float64(stored.Quarantined))
+		}
+
+		fetched := len(result.Events) + len(result.Undecodable)
+		eventsCollected := atomic.AddInt64(&c.eventsCollected, int64(fetched))
+		CFAuditEventCollectorEventsCollectedTotal.WithLabelValues(c.foundation).Add(float64(fetched))
+		if progress != nil {
+			progress.EventsStored(stored.Inserted)
+		}
+
+		checkpoint.LastPageURL = result.PageURL
+		checkpoint.EventCount += int64(fetched)
+		err = c.eventDB.UpdateBackfillCheckpoint(checkpoint)
+		if err != nil && ctx.Err() != nil {
+			return inserted, nil
+		}
+		if err != nil {
+			lsession.Error("err-update-backfill-checkpoint", err)
+			CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+			return inserted, err
+		}
+
+		lsession.Info(
+			"stored-events",
+			lager.Data{
+				"duration":         time.Since(startTime),
+				"events-collected": eventsCollected,
+				"inserted":         stored.Inserted,
+				"duplicates":       stored.Duplicates,
+			},
+		)
 	}
+
+	if ctx.Err() != nil {
+		return inserted, nil
+	}
+
+	checkpoint.Completed = true
+	if err := c.eventDB.UpdateBackfillCheckpoint(checkpoint); err != nil {
+		lsession.Error("err-complete-backfill-checkpoint", err)
+		CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+		return inserted, err
+	}
+	lsession.Info("completed-window", lager.Data{"event-count": checkpoint.EventCount})
+
+	return inserted, nil
 }
 
-func (c *CFAuditEventCollector) pullEventsSince(overlapBy time.Duration) (time.Time, error) {
-	latestCFEventTime, err := c.eventDB.GetLatestCFEventTime()
+// setAsideInvalidEvents returns the events of a page which can be stored, and
+// those which cannot along with the items of the page they were fetched as,
+// so that they are quarantined as Cloud Controller sent them. If the page
+// does not have the items, invalid events are returned to be stored, and the
+// store quarantines them as they were decoded.
+func setAsideInvalidEvents(result fetchers.CFAuditEventResult) ([]cfclient.Event, []db.QuarantinedCFAuditEvent) {
+	invalid := []db.QuarantinedCFAuditEvent{}
+	for _, item := range result.Undecodable {
+		invalid = append(invalid, db.QuarantinedCFAuditEvent{
+			GUID:   item.GUID,
+			Event:  item.Raw,
+			Reason: item.Err.Error(),
+		})
+	}
+	if len(result.Raw) != len(result.Events) {
+		return result.Events, invalid
+	}
+
+	events := make([]cfclient.Event, 0, len(result.Events))
+	for i, event := range result.Events {
+		if err := db.ValidateCFAuditEvent(event); err != nil {
+			invalid = append(invalid, db.QuarantinedCFAuditEvent{
+				GUID:   event.GUID,
+				Event:  result.Raw[i],
+				Reason: err.Error(),
+			})
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, invalid
+}
+
+// advanceWatermark moves the watermark on to the end of the windows which
+// have just been collected, if that is later. It only moves through windows
+// which follow on from the watermark, so that a resumed backfill of a later
+// window cannot move it past events which have not been collected.
+func (c *CFAuditEventCollector) advanceWatermark(
+	watermark db.CollectorWatermark,
+	checkpoints []db.BackfillCheckpoint,
+) (db.CollectorWatermark, error) {
+	sorted := append([]db.BackfillCheckpoint{}, checkpoints...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].WindowStart.Before(sorted[j].WindowStart)
+	})
+
+	end := watermark.Watermark
+	for _, checkpoint := range sorted {
+		if !end.IsZero() && checkpoint.WindowStart.After(end) {
+			break
+		}
+		if checkpoint.WindowEnd.After(end) {
+			end = checkpoint.WindowEnd
+		}
+	}
+	if !end.After(watermark.Watermark) {
+		return watermark, nil
+	}
+
+	watermark.Watermark = end
+	if watermark.LastResweep.IsZero() {
+		// Everything up to the watermark has only just been collected
+		watermark.LastResweep = end
+	}
+	if err := c.eventDB.UpdateCollectorWatermark(watermark); err != nil {
+		return watermark, err
+	}
+	CFAuditEventCollectorWatermarkTimestamp.WithLabelValues(c.foundation).Set(
+		float64(watermark.Watermark.Unix()),
+	)
+	return watermark, nil
+}
+
+func (c *CFAuditEventCollector) resweepDue(now time.Time, watermark db.CollectorWatermark) bool {
+	return c.watermark.ResweepInterval > 0 &&
+		c.watermark.ResweepWindow > 0 &&
+		!watermark.Watermark.IsZero() &&
+		now.Sub(watermark.LastResweep) >= c.watermark.ResweepInterval
+}
+
+// resweep collects the events in the ResweepWindow before the watermark
+// again, to catch any which Cloud Controller committed after we had already
+// collected that part of the window, and reports how many it found
+func (c *CFAuditEventCollector) resweep(
+	ctx context.Context,
+	lsession lager.Logger,
+	startTime time.Time,
+	watermark db.CollectorWatermark,
+	progress JobProgress,
+) error {
+	until := watermark.Watermark
+	since := until.Add(-c.watermark.ResweepWindow)
+	lsession = lsession.Session("resweep", lager.Data{"since": since, "until": until})
+	lsession.Info("start")
+
+	checkpoints, err := c.startWindows(since, until)
+	if err != nil {
+		lsession.Error("err-start-windows", err)
+		CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+		return err
+	}
+	// Everything in the window was stored before, so any new events are late
+	lateEvents, err := c.collectWindows(ctx, lsession, startTime, checkpoints, progress)
+	if err != nil || ctx.Err() != nil {
+		return err
+	}
+
+	CFAuditEventCollectorLateEventsTotal.WithLabelValues(c.foundation).Add(float64(lateEvents))
+	CFAuditEventCollectorResweepLateEvents.WithLabelValues(c.foundation).Set(float64(lateEvents))
+	lsession.Info("found-late-events", lager.Data{"late-events": lateEvents})
+
+	watermark.LastResweep = startTime
+	if err := c.eventDB.UpdateCollectorWatermark(watermark); err != nil {
+		lsession.Error("err-update-collector-watermark", err)
+		CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+		return err
+	}
+	return nil
+}
+
+// pullEventsSince returns when the next pass should start from: the
+// watermark less the overlap. Before there is a watermark, the most recent
+// event stored is used instead.
+func (c *CFAuditEventCollector) pullEventsSince(
+	watermark db.CollectorWatermark,
+	overlapBy time.Duration,
+) (time.Time, error) {
+	if !watermark.Watermark.IsZero() {
+		return watermark.Watermark.Add(-overlapBy), nil
+	}
+
+	latestCFEventTime, err := c.eventDB.GetLatestCFEventTime(c.foundation)
 
 	if err != nil {
 		return latestCFEventTime, err
@@ -2,6 +2,8 @@ package collectors_test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 
@@ -12,11 +14,34 @@ import (
 	cfclient "github.com/cloudfoundry-community/go-cfclient"
 
 	"github.com/alphagov/paas-auditor/pkg/collectors"
+	"github.com/alphagov/paas-auditor/pkg/db"
 	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
 	"github.com/alphagov/paas-auditor/pkg/fetchers"
 	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
 )
 
+type enricherFunc func(ctx context.Context, events []cfclient.Event)
+
+func (f enricherFunc) Enrich(ctx context.Context, events []cfclient.Event) { f(ctx, events) }
+
+type jobProgress struct {
+	mu           sync.Mutex
+	started      bool
+	eventsStored int
+}
+
+func (p *jobProgress) Started() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started = true
+}
+
+func (p *jobProgress) EventsStored(count int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.eventsStored += count
+}
+
 var _ = Describe("CFAuditEventCollector Run", func() {
 	var (
 		coll    *collectors.CFAuditEventCollector
@@ -32,7 +57,7 @@ var _ = Describe("CFAuditEventCollector Run", func() {
 
 		By("checking the value of the metrics to test against them later")
 		cfAuditEventCollectorEventsCollectedTotal = h.CurrentMetricValue(
-			collectors.CFAuditEventCollectorEventsCollectedTotal,
+			collectors.CFAuditEventCollectorEventsCollectedTotal.WithLabelValues("test-foundation"),
 		)
 	})
 
@@ -45,7 +70,7 @@ var _ = Describe("CFAuditEventCollector Run", func() {
 			fetchers.CFAuditEventResult{Events: []cfclient.Event{cfclient.Event{}}},
 		}
 
-		fetcher := func(_ time.Time, c chan fetchers.CFAuditEventResult) {
+		fetcher := func(_ context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
 			for _, eventPage := range eventsToReceive {
 				c <- eventPage
 			}
@@ -54,10 +79,14 @@ var _ = Describe("CFAuditEventCollector Run", func() {
 		}
 
 		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
 			10*time.Millisecond,
 			logger,
 			fetcher,
+			nil,
 			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
 		)
 
 		var (
@@ -85,7 +114,7 @@ var _ = Describe("CFAuditEventCollector Run", func() {
 		Expect(eventDB.GetLatestCFEventTimeCallCount()).Should(BeNumerically(">=", 1))
 
 		By("checking the metrics")
-		Expect(collectors.CFAuditEventCollectorEventsCollectedTotal).To(
+		Expect(collectors.CFAuditEventCollectorEventsCollectedTotal.WithLabelValues("test-foundation")).To(
 			h.MetricIncrementedBy(cfAuditEventCollectorEventsCollectedTotal, ">=", 3),
 		)
 
@@ -94,4 +123,887 @@ var _ = Describe("CFAuditEventCollector Run", func() {
 		collectWG.Wait()
 		Expect(collectError).NotTo(HaveOccurred())
 	})
+
+	It("enriches events before storing them", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+
+		fetcher := func(_ context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{GUID: "event-guid"}}}
+			close(c)
+		}
+
+		var (
+			enrichedMu         sync.Mutex
+			enriched           []string
+			storedBeforeEnrich int
+		)
+		enricher := enricherFunc(func(_ context.Context, events []cfclient.Event) {
+			enrichedMu.Lock()
+			defer enrichedMu.Unlock()
+			if len(enriched) == 0 {
+				storedBeforeEnrich = eventDB.StoreCFAuditEventsCallCount()
+			}
+			for _, event := range events {
+				enriched = append(enriched, event.GUID)
+			}
+		})
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			10*time.Millisecond,
+			logger,
+			fetcher,
+			enricher,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		Eventually(
+			eventDB.StoreCFAuditEventsCallCount, "100ms", "1ms",
+		).Should(BeNumerically(">=", 1))
+		cancelCollect()
+
+		enrichedMu.Lock()
+		defer enrichedMu.Unlock()
+		Expect(enriched).To(ContainElement("event-guid"))
+		Expect(storedBeforeEnrich).To(Equal(0))
+	})
+
+	It("stops collecting when the context is cancelled mid-fetch", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+
+		fetcherStarted := make(chan struct{})
+		fetcher := func(ctx context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{cfclient.Event{}}}
+			close(fetcherStarted)
+			<-ctx.Done()
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			10*time.Millisecond,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
+		)
+
+		var (
+			collectError error
+			collectWG    sync.WaitGroup
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+
+		By("running the collector")
+		collectWG.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			collectError = coll.Run(collectContext)
+			collectWG.Done()
+		}()
+
+		By("waiting for the fetcher to start")
+		Eventually(fetcherStarted, "100ms", "1ms").Should(BeClosed())
+
+		By("cancelling the collector")
+		cancelCollect()
+
+		By("checking the collector stopped cleanly")
+		collectWG.Wait()
+		Expect(collectError).NotTo(HaveOccurred())
+	})
+
+	It("checkpoints each page and completes the window after the last page", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+		latestEventTime := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+		eventDB.GetLatestCFEventTimeReturns(latestEventTime, nil)
+
+		fetcher := func(_ context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{}, {}}, PageURL: "/page-1"}
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{}}, PageURL: "/page-2"}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			10*time.Millisecond,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{Overlap: 5 * time.Second},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+
+		By("running the collector")
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		By("waiting for the window to be completed")
+		Eventually(
+			eventDB.UpdateBackfillCheckpointCallCount, "100ms", "1ms",
+		).Should(BeNumerically(">=", 4))
+		cancelCollect()
+
+		Expect(eventDB.GetLatestCFEventTimeArgsForCall(0)).To(Equal("test-foundation"))
+		Expect(eventDB.GetIncompleteBackfillCheckpointsArgsForCall(0)).To(Equal("test-foundation"))
+
+		started := eventDB.UpdateBackfillCheckpointArgsForCall(0)
+		Expect(started.Foundation).To(Equal("test-foundation"))
+		Expect(started.WindowStart).To(Equal(latestEventTime.Add(-5 * time.Second)))
+		Expect(started.WindowEnd).To(BeTemporally(">", started.WindowStart))
+		Expect(started.Completed).To(BeFalse())
+
+		firstPage := eventDB.UpdateBackfillCheckpointArgsForCall(1)
+		Expect(firstPage.LastPageURL).To(Equal("/page-1"))
+		Expect(firstPage.EventCount).To(BeNumerically("==", 2))
+		Expect(firstPage.Completed).To(BeFalse())
+
+		secondPage := eventDB.UpdateBackfillCheckpointArgsForCall(2)
+		Expect(secondPage.LastPageURL).To(Equal("/page-2"))
+		Expect(secondPage.EventCount).To(BeNumerically("==", 3))
+		Expect(secondPage.Completed).To(BeFalse())
+
+		completed := eventDB.UpdateBackfillCheckpointArgsForCall(3)
+		Expect(completed.WindowStart).To(Equal(started.WindowStart))
+		Expect(completed.WindowEnd).To(Equal(started.WindowEnd))
+		Expect(completed.EventCount).To(BeNumerically("==", 3))
+		Expect(completed.Completed).To(BeTrue())
+	})
+
+	It("resumes an incomplete window from the last page stored", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+		checkpoint := db.BackfillCheckpoint{
+			WindowStart: time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC),
+			WindowEnd:   time.Date(2019, 10, 5, 12, 40, 43, 0, time.UTC),
+			LastPageURL: "/page-7",
+			EventCount:  700,
+		}
+		eventDB.GetIncompleteBackfillCheckpointsReturnsOnCall(
+			0, []db.BackfillCheckpoint{checkpoint}, nil,
+		)
+
+		queries := make(chan fetchers.CFAuditEventQuery, 10)
+		fetcher := func(_ context.Context, query fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			queries <- query
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{}}, PageURL: "/page-8"}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			10*time.Millisecond,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+
+		By("running the collector")
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		By("checking the fetcher resumed from the checkpoint")
+		Eventually(queries, "100ms", "1ms").Should(Receive(Equal(fetchers.CFAuditEventQuery{
+			Since:        checkpoint.WindowStart,
+			Until:        checkpoint.WindowEnd,
+			StartPageURL: "/page-7",
+		})))
+
+		By("checking the checkpoint was completed")
+		Eventually(
+			eventDB.UpdateBackfillCheckpointCallCount, "100ms", "1ms",
+		).Should(BeNumerically(">=", 2))
+		cancelCollect()
+
+		completed := eventDB.UpdateBackfillCheckpointArgsForCall(1)
+		Expect(completed.LastPageURL).To(Equal("/page-8"))
+		Expect(completed.EventCount).To(BeNumerically("==", 701))
+		Expect(completed.Completed).To(BeTrue())
+	})
+
+	It("does not complete the window when fetching fails", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+
+		fetcher := func(_ context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{}}, PageURL: "/page-1"}
+			c <- fetchers.CFAuditEventResult{Err: fmt.Errorf("sadpanda")}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			10*time.Millisecond,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
+		)
+
+		By("running the collector")
+		err := coll.Run(context.Background())
+		Expect(err).To(MatchError("sadpanda"))
+
+		By("checking the window was not completed")
+		Expect(eventDB.UpdateBackfillCheckpointCallCount()).To(Equal(2))
+		Expect(eventDB.UpdateBackfillCheckpointArgsForCall(1).LastPageURL).To(Equal("/page-1"))
+		Expect(eventDB.UpdateBackfillCheckpointArgsForCall(1).Completed).To(BeFalse())
+	})
+
+	It("slices a long backfill into windows and collects them in parallel", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.GetLatestCFEventTimeReturns(time.Now().Add(-72*time.Hour), nil)
+
+		var (
+			mu             sync.Mutex
+			inFlight       int
+			maxInFlight    int
+			fetchedWindows []fetchers.CFAuditEventQuery
+		)
+		fetcher := func(_ context.Context, query fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			fetchedWindows = append(fetchedWindows, query)
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{}}, PageURL: "/page-1"}
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			10*time.Millisecond,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{SliceDuration: 24 * time.Hour, Workers: 3},
+			collectors.WatermarkConfig{},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+
+		By("running the collector")
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		By("waiting for every window to be completed")
+		completedWindows := func() int {
+			completed := 0
+			for i := 0; i < eventDB.UpdateBackfillCheckpointCallCount(); i++ {
+				if eventDB.UpdateBackfillCheckpointArgsForCall(i).Completed {
+					completed++
+				}
+			}
+			return completed
+		}
+		Eventually(completedWindows, "1s", "1ms").Should(BeNumerically(">=", 4))
+		cancelCollect()
+
+		By("checking every window was checkpointed before collecting any")
+		for i := 0; i < 4; i++ {
+			checkpoint := eventDB.UpdateBackfillCheckpointArgsForCall(i)
+			Expect(checkpoint.Completed).To(BeFalse())
+			Expect(checkpoint.LastPageURL).To(BeEmpty())
+			if i > 0 {
+				previous := eventDB.UpdateBackfillCheckpointArgsForCall(i - 1)
+				Expect(checkpoint.WindowStart).To(Equal(previous.WindowEnd))
+			}
+		}
+		Expect(eventDB.UpdateBackfillCheckpointArgsForCall(0).WindowEnd.Sub(
+			eventDB.UpdateBackfillCheckpointArgsForCall(0).WindowStart,
+		)).To(Equal(24 * time.Hour))
+
+		By("checking the windows were collected in parallel")
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(fetchedWindows).To(HaveLen(4))
+		Expect(maxInFlight).To(BeNumerically(">", 1))
+		Expect(maxInFlight).To(BeNumerically("<=", 3))
+	})
+
+	It("collects anything before the backfill horizon as a single window", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+
+		fetcher := func(ctx context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			<-ctx.Done()
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			10*time.Millisecond,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{SliceDuration: 24 * time.Hour, Workers: 2},
+			collectors.WatermarkConfig{},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+
+		By("running the collector")
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		By("waiting for the windows to be checkpointed")
+		Eventually(
+			eventDB.UpdateBackfillCheckpointCallCount, "100ms", "1ms",
+		).Should(Equal(32))
+		cancelCollect()
+
+		first := eventDB.UpdateBackfillCheckpointArgsForCall(0)
+		last := eventDB.UpdateBackfillCheckpointArgsForCall(31)
+		Expect(first.WindowStart).To(Equal(time.Time{}))
+		Expect(first.WindowEnd).To(Equal(last.WindowEnd.Add(-31 * 24 * time.Hour)))
+		Expect(last.WindowEnd.Sub(last.WindowStart)).To(Equal(24 * time.Hour))
+	})
+
+	It("starts from the watermark less the overlap and advances it after a full pass", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+		watermark := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+		eventDB.GetCollectorWatermarkReturns(db.CollectorWatermark{
+			Source:      db.CFAuditEventsSource,
+			Foundation:  "test-foundation",
+			Watermark:   watermark,
+			LastResweep: watermark,
+		}, nil)
+
+		fetcher := func(_ context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{}}, PageURL: "/page-1"}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			10*time.Millisecond,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{Overlap: 5 * time.Minute},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+
+		By("running the collector")
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		By("waiting for the watermark to be advanced")
+		Eventually(eventDB.UpdateCollectorWatermarkCallCount, "100ms", "1ms").Should(BeNumerically(">=", 1))
+		cancelCollect()
+
+		Expect(eventDB.GetCollectorWatermarkCallCount()).To(BeNumerically(">=", 1))
+		source, foundation := eventDB.GetCollectorWatermarkArgsForCall(0)
+		Expect(source).To(Equal(db.CFAuditEventsSource))
+		Expect(foundation).To(Equal("test-foundation"))
+		Expect(eventDB.GetLatestCFEventTimeCallCount()).To(Equal(0))
+
+		started := eventDB.UpdateBackfillCheckpointArgsForCall(0)
+		Expect(started.WindowStart).To(Equal(watermark.Add(-5 * time.Minute)))
+
+		advanced := eventDB.UpdateCollectorWatermarkArgsForCall(0)
+		Expect(advanced.Source).To(Equal(db.CFAuditEventsSource))
+		Expect(advanced.Foundation).To(Equal("test-foundation"))
+		Expect(advanced.Watermark).To(Equal(started.WindowEnd))
+		Expect(advanced.LastResweep).To(Equal(watermark))
+
+		Expect(h.CurrentMetricValue(
+			collectors.CFAuditEventCollectorWatermarkTimestamp.WithLabelValues("test-foundation"),
+		)).To(Equal(float64(started.WindowEnd.Unix())))
+
+		By("deleting the checkpoints of the windows the watermark has passed")
+		Eventually(eventDB.DeleteCompletedBackfillCheckpointsCallCount, "100ms", "1ms").Should(BeNumerically(">=", 1))
+		foundation, until := eventDB.DeleteCompletedBackfillCheckpointsArgsForCall(0)
+		Expect(foundation).To(Equal("test-foundation"))
+		Expect(until).To(Equal(advanced.Watermark))
+	})
+
+	It("does not advance the watermark when a pass fails", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+
+		fetcher := func(_ context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{Err: fmt.Errorf("cloud controller is down")}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			10*time.Millisecond,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{Overlap: 5 * time.Minute},
+		)
+
+		Expect(coll.Run(context.Background())).To(MatchError("cloud controller is down"))
+		Expect(eventDB.UpdateCollectorWatermarkCallCount()).To(Equal(0))
+		Expect(eventDB.DeleteCompletedBackfillCheckpointsCallCount()).To(Equal(0))
+	})
+
+	It("periodically re-sweeps before the watermark and reports the late events it finds", func() {
+		lateEventsBefore := h.CurrentMetricValue(
+			collectors.CFAuditEventCollectorLateEventsTotal.WithLabelValues("test-foundation"),
+		)
+
+		eventDB = &dbfakes.FakeEventDB{}
+		watermark := time.Now().Add(-1 * time.Minute)
+		lastResweep := time.Now().Add(-2 * time.Hour)
+		eventDB.GetCollectorWatermarkReturnsOnCall(0, db.CollectorWatermark{
+			Source:      db.CFAuditEventsSource,
+			Foundation:  "test-foundation",
+			Watermark:   watermark,
+			LastResweep: lastResweep,
+		}, nil)
+		eventDB.StoreCFAuditEventsReturnsOnCall(0, db.StoreResult{Inserted: 2}, nil)
+		eventDB.StoreCFAuditEventsReturnsOnCall(1, db.StoreResult{Inserted: 3, Duplicates: 10}, nil)
+
+		queries := make(chan fetchers.CFAuditEventQuery, 10)
+		fetcher := func(_ context.Context, query fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			queries <- query
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{}}}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			10*time.Millisecond,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{
+				Overlap:         5 * time.Minute,
+				ResweepInterval: 1 * time.Hour,
+				ResweepWindow:   6 * time.Hour,
+			},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+
+		By("running the collector")
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		By("waiting for the re-sweep to be recorded")
+		Eventually(eventDB.UpdateCollectorWatermarkCallCount, "100ms", "1ms").Should(BeNumerically(">=", 2))
+		cancelCollect()
+
+		var pass, resweep fetchers.CFAuditEventQuery
+		Eventually(queries).Should(Receive(&pass))
+		Eventually(queries).Should(Receive(&resweep))
+		Expect(pass.Since).To(Equal(watermark.Add(-5 * time.Minute)))
+		Expect(resweep.Until).To(Equal(pass.Until))
+		Expect(resweep.Since).To(Equal(pass.Until.Add(-6 * time.Hour)))
+
+		advanced := eventDB.UpdateCollectorWatermarkArgsForCall(0)
+		Expect(advanced.Watermark).To(Equal(pass.Until))
+		Expect(advanced.LastResweep).To(Equal(lastResweep))
+
+		reswept := eventDB.UpdateCollectorWatermarkArgsForCall(1)
+		Expect(reswept.Watermark).To(Equal(pass.Until))
+		Expect(reswept.LastResweep).To(BeTemporally(">", lastResweep))
+
+		Expect(collectors.CFAuditEventCollectorLateEventsTotal.WithLabelValues("test-foundation")).To(
+			h.MetricIncrementedBy(lateEventsBefore, "==", 3),
+		)
+		Expect(h.CurrentMetricValue(
+			collectors.CFAuditEventCollectorResweepLateEvents.WithLabelValues("test-foundation"),
+		)).To(Equal(3.0))
+	})
+
+	It("collects straight away when asked to", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.StoreCFAuditEventsStub = func(_ string, events []cfclient.Event) (db.StoreResult, error) {
+			return db.StoreResult{Inserted: len(events) - 1, Duplicates: 1}, nil
+		}
+
+		fetcher := func(_ context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{}, {}}, PageURL: "/page-1"}
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{}}, PageURL: "/page-2"}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			1*time.Hour,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		progress := &jobProgress{}
+		Expect(coll.Collect(context.Background(), progress)).To(Succeed())
+
+		Expect(progress.started).To(BeTrue())
+		Expect(progress.eventsStored).To(Equal(1), "only new events are counted")
+		Expect(eventDB.StoreCFAuditEventsCallCount()).To(Equal(2))
+		Expect(eventDB.UpdateCollectorWatermarkCallCount()).To(Equal(1))
+	})
+
+	It("backfills an explicit window without moving the watermark", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.StoreCFAuditEventsReturns(db.StoreResult{Inserted: 1}, nil)
+
+		queries := make(chan fetchers.CFAuditEventQuery, 10)
+		fetcher := func(_ context.Context, query fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			queries <- query
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{}}, PageURL: "/page-1"}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			1*time.Hour,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{SliceDuration: 24 * time.Hour},
+			collectors.WatermarkConfig{},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		since := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+		until := time.Date(2019, 10, 3, 0, 0, 0, 0, time.UTC)
+		progress := &jobProgress{}
+		Expect(coll.Backfill(context.Background(), since, until, progress)).To(Succeed())
+
+		Expect(progress.eventsStored).To(Equal(2))
+		Expect(queries).To(HaveLen(2))
+		Expect(eventDB.UpdateBackfillCheckpointArgsForCall(0).WindowStart).To(Equal(since))
+		Expect(eventDB.UpdateBackfillCheckpointArgsForCall(1).WindowEnd).To(Equal(until))
+		Expect(eventDB.UpdateCollectorWatermarkCallCount()).To(Equal(0))
+
+		Expect(coll.Backfill(context.Background(), until, since, progress)).To(
+			MatchError(ContainSubstring("must end after it starts")),
+		)
+	})
+
+	It("gives up waiting for a job when cancelled", func() {
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			1*time.Hour,
+			logger,
+			nil,
+			nil,
+			&dbfakes.FakeEventDB{},
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		Expect(coll.Collect(ctx, &jobProgress{})).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("fails jobs once it has stopped", func() {
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			1*time.Hour,
+			logger,
+			nil,
+			nil,
+			&dbfakes.FakeEventDB{},
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		cancelCollect()
+		Expect(coll.Run(collectContext)).To(Succeed())
+
+		Expect(coll.Collect(context.Background(), &jobProgress{})).To(MatchError(collectors.ErrCollectorStopped))
+	})
+
+	It("fails jobs which it stops part way through", func() {
+		fetching := make(chan struct{})
+		fetcher := func(ctx context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			close(fetching)
+			<-ctx.Done()
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			1*time.Hour,
+			logger,
+			fetcher,
+			nil,
+			&dbfakes.FakeEventDB{},
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+		go func() {
+			<-fetching
+			cancelCollect()
+		}()
+
+		Expect(coll.Collect(context.Background(), &jobProgress{})).To(MatchError(collectors.ErrJobInterrupted))
+	})
+
+	It("counts events which were already stored", func() {
+		duplicatesBefore := h.CurrentMetricValue(
+			collectors.CFAuditEventCollectorDuplicateEventsTotal.WithLabelValues("test-foundation"),
+		)
+
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.StoreCFAuditEventsReturns(db.StoreResult{Inserted: 1, Duplicates: 2}, nil)
+
+		fetcher := func(_ context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{}, {}, {}}, PageURL: "/page-1"}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			1*time.Hour,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		Expect(coll.Collect(context.Background(), &jobProgress{})).To(Succeed())
+
+		Expect(collectors.CFAuditEventCollectorDuplicateEventsTotal.WithLabelValues("test-foundation")).To(
+			h.MetricIncrementedBy(duplicatesBefore, "==", 2),
+		)
+	})
+
+	It("counts events which were quarantined", func() {
+		quarantinedBefore := h.CurrentMetricValue(
+			collectors.CFAuditEventCollectorQuarantinedEventsTotal.WithLabelValues("test-foundation"),
+		)
+
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.StoreCFAuditEventsReturns(db.StoreResult{Inserted: 2, Quarantined: 1}, nil)
+
+		fetcher := func(_ context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{{}, {}, {}}, PageURL: "/page-1"}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			1*time.Hour,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		Expect(coll.Collect(context.Background(), &jobProgress{})).To(Succeed())
+
+		Expect(collectors.CFAuditEventCollectorQuarantinedEventsTotal.WithLabelValues("test-foundation")).To(
+			h.MetricIncrementedBy(quarantinedBefore, "==", 1),
+		)
+	})
+
+	It("quarantines invalid events as Cloud Controller sent them", func() {
+		quarantinedBefore := h.CurrentMetricValue(
+			collectors.CFAuditEventCollectorQuarantinedEventsTotal.WithLabelValues("test-foundation"),
+		)
+
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.StoreCFAuditEventsReturns(db.StoreResult{Inserted: 1}, nil)
+
+		valid := cfclient.Event{GUID: "2c1b4b21-7be8-4f38-a4dd-ac7d5b6ad4b7", CreatedAt: "2019-10-04T12:40:43Z"}
+		invalid := cfclient.Event{GUID: "not-a-guid", CreatedAt: "2019-10-04T12:40:43Z"}
+		fetcher := func(_ context.Context, _ fetchers.CFAuditEventQuery, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{
+				Events: []cfclient.Event{valid, invalid},
+				Raw:    []json.RawMessage{[]byte(`{"valid":true}`), []byte(`{"invalid":true}`)},
+				Undecodable: []fetchers.UndecodableCFAuditEvent{{
+					GUID: "3a6b1b8e-48fd-4e4b-9c63-4dbe3a4d1c36",
+					Raw:  []byte(`{"created_at":1}`),
+					Err:  fmt.Errorf("error unmarshaling event"),
+				}},
+				PageURL: "/page-1",
+			}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			1*time.Hour,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		Expect(coll.Collect(context.Background(), &jobProgress{})).To(Succeed())
+
+		Expect(eventDB.QuarantineCFAuditEventsCallCount()).To(Equal(1))
+		foundation, quarantined := eventDB.QuarantineCFAuditEventsArgsForCall(0)
+		Expect(foundation).To(Equal("test-foundation"))
+		Expect(quarantined).To(HaveLen(2))
+		Expect(quarantined[0].GUID).To(Equal("3a6b1b8e-48fd-4e4b-9c63-4dbe3a4d1c36"))
+		Expect(string(quarantined[0].Event)).To(Equal(`{"created_at":1}`))
+		Expect(quarantined[0].Reason).To(Equal("error unmarshaling event"))
+		Expect(quarantined[1].GUID).To(Equal("not-a-guid"))
+		Expect(string(quarantined[1].Event)).To(Equal(`{"invalid":true}`))
+		Expect(quarantined[1].Reason).To(ContainSubstring("is not a UUID"))
+
+		_, stored := eventDB.StoreCFAuditEventsArgsForCall(0)
+		Expect(stored).To(Equal([]cfclient.Event{valid}))
+
+		Expect(collectors.CFAuditEventCollectorQuarantinedEventsTotal.WithLabelValues("test-foundation")).To(
+			h.MetricIncrementedBy(quarantinedBefore, "==", 2),
+		)
+	})
+
+	It("stores quarantined events which are now valid", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.GetQuarantinedCFAuditEventsReturns([]db.QuarantinedCFAuditEvent{
+			{ID: 1, Event: []byte(`{"guid":"2c1b4b21-7be8-4f38-a4dd-ac7d5b6ad4b7","created_at":"2019-10-04T12:40:43Z"}`)},
+			{ID: 2, Event: []byte(`{"guid":"not-a-guid","created_at":"2019-10-04T12:40:43Z"}`)},
+			{ID: 3, Event: []byte(`{"guid":"3a6b1b8e-48fd-4e4b-9c63-4dbe3a4d1c36","created_at":"2019-10-04T12:40:44Z"}`)},
+			{ID: 4, Event: []byte(`{"metadata":{"guid":"4b0d3c84-5e4a-4a53-9f4e-4c2c6f0a3f1d","created_at":"2019-10-04T12:40:45Z"},"entity":{"type":"audit.app.update"}}`)},
+		}, nil)
+		eventDB.StoreCFAuditEventsReturns(db.StoreResult{Inserted: 3}, nil)
+
+		coll = collectors.NewCFAuditEventCollector(
+			"test-foundation",
+			1*time.Hour,
+			logger,
+			nil,
+			nil,
+			eventDB,
+			collectors.BackfillConfig{},
+			collectors.WatermarkConfig{},
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		progress := &jobProgress{}
+		Expect(coll.ReprocessQuarantine(context.Background(), progress)).To(Succeed())
+
+		Expect(eventDB.GetQuarantinedCFAuditEventsArgsForCall(0)).To(Equal("test-foundation"))
+
+		Expect(eventDB.StoreCFAuditEventsCallCount()).To(Equal(1))
+		foundation, events := eventDB.StoreCFAuditEventsArgsForCall(0)
+		Expect(foundation).To(Equal("test-foundation"))
+		Expect(events).To(HaveLen(3))
+		Expect(events[0].GUID).To(Equal("2c1b4b21-7be8-4f38-a4dd-ac7d5b6ad4b7"))
+		Expect(events[1].GUID).To(Equal("3a6b1b8e-48fd-4e4b-9c63-4dbe3a4d1c36"))
+
+		By("decoding events quarantined as Cloud Controller sent them")
+		Expect(events[2].GUID).To(Equal("4b0d3c84-5e4a-4a53-9f4e-4c2c6f0a3f1d"))
+		Expect(events[2].Type).To(Equal("audit.app.update"))
+
+		Expect(eventDB.MarkCFAuditEventsReprocessedArgsForCall(0)).To(Equal([]int64{1, 3, 4}))
+		Expect(progress.eventsStored).To(Equal(3))
+	})
 })
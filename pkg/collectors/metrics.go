@@ -5,24 +5,72 @@ import (
 )
 
 var (
-	CFAuditEventCollectorErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	CFAuditEventCollectorErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "cf_audit_event_collector_errors_total",
 		Help: "Number of errors encountered by CF Audit Event Collector",
-	})
+	}, []string{"foundation"})
 
-	CFAuditEventCollectorEventsCollectedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	CFAuditEventCollectorEventsCollectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "cf_audit_event_collector_events_collected_total",
 		Help: "Number of events collected and saved to the DB by CF Audit Event Collector",
-	})
+	}, []string{"foundation"})
 
-	CFAuditEventCollectorEventsCollectDurationTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	CFAuditEventCollectorEventsCollectDurationTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "cf_audit_event_collector_collect_duration_total",
 		Help: "Number of seconds spent collecting events by CF Audit Event Collector",
-	})
+	}, []string{"foundation"})
+
+	CFAuditEventCollectorDuplicateEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_event_collector_duplicate_events_total",
+		Help: "Number of events collected by CF Audit Event Collector which were already stored",
+	}, []string{"foundation"})
+
+	CFAuditEventCollectorQuarantinedEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_event_collector_quarantined_events_total",
+		Help: "Number of invalid events collected by CF Audit Event Collector which were quarantined rather than stored",
+	}, []string{"foundation"})
+
+	CFAuditEventCollectorWatermarkTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cf_audit_event_collector_watermark_timestamp",
+		Help: "Unix epoch seconds before which CF Audit Event Collector has collected every event",
+	}, []string{"foundation"})
+
+	CFAuditEventCollectorLateEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_event_collector_late_events_total",
+		Help: "Number of events found by CF Audit Event Collector re-sweeps which had been missed because they were committed late",
+	}, []string{"foundation"})
+
+	CFAuditEventCollectorResweepLateEvents = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cf_audit_event_collector_resweep_late_events",
+		Help: "Number of late events found by the most recent CF Audit Event Collector re-sweep",
+	}, []string{"foundation"})
+
+	UsageEventCollectorErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_usage_event_collector_errors_total",
+		Help: "Number of errors encountered by CF Usage Event Collector",
+	}, []string{"foundation", "kind"})
+
+	UsageEventCollectorEventsCollectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_usage_event_collector_events_collected_total",
+		Help: "Number of usage events collected and saved to the DB by CF Usage Event Collector",
+	}, []string{"foundation", "kind"})
+
+	UsageEventCollectorCollectDurationTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_usage_event_collector_collect_duration_total",
+		Help: "Number of seconds spent collecting usage events by CF Usage Event Collector",
+	}, []string{"foundation", "kind"})
 )
 
 func initMetrics() {
 	prometheus.MustRegister(CFAuditEventCollectorErrorsTotal)
 	prometheus.MustRegister(CFAuditEventCollectorEventsCollectedTotal)
 	prometheus.MustRegister(CFAuditEventCollectorEventsCollectDurationTotal)
+	prometheus.MustRegister(CFAuditEventCollectorDuplicateEventsTotal)
+	prometheus.MustRegister(CFAuditEventCollectorQuarantinedEventsTotal)
+	prometheus.MustRegister(CFAuditEventCollectorWatermarkTimestamp)
+	prometheus.MustRegister(CFAuditEventCollectorLateEventsTotal)
+	prometheus.MustRegister(CFAuditEventCollectorResweepLateEvents)
+	prometheus.MustRegister(UsageEventCollectorErrorsTotal)
+	prometheus.MustRegister(UsageEventCollectorEventsCollectedTotal)
+	prometheus.MustRegister(UsageEventCollectorCollectDurationTotal)
 }
@@ -0,0 +1,128 @@
+package collectors
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+)
+
+// UsageEventCollector collects app or service usage events. Cloud Controller
+// pages through usage events after a GUID, so rather than checkpointing
+// windows of time the collector keeps the GUID of the last event it stored.
+type UsageEventCollector struct {
+	kind            db.UsageEventKind
+	foundation      string
+	schedule        time.Duration
+	logger          lager.Logger
+	fetcher         fetchers.UsageEventFetcher
+	usageEventDB    db.UsageEventDB
+	eventsCollected int64
+}
+
+func NewUsageEventCollector(
+	kind db.UsageEventKind,
+	foundation string,
+	schedule time.Duration,
+	logger lager.Logger,
+	fetcher fetchers.UsageEventFetcher,
+	usageEventDB db.UsageEventDB,
+) *UsageEventCollector {
+	logger = logger.Session("usage-event-collector", lager.Data{
+		"foundation": foundation,
+		"kind":       kind,
+	})
+	return &UsageEventCollector{kind, foundation, schedule, logger, fetcher, usageEventDB, 0}
+}
+
+func (c *UsageEventCollector) Run(ctx context.Context) error {
+	lsession := c.logger.Session("run")
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		select {
+		case <-ctx.Done():
+			lsession.Info("done")
+			return nil
+		case <-time.After(c.schedule):
+			startTime := time.Now()
+
+			err := c.collect(ctx, lsession, startTime)
+			if err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				lsession.Info("done")
+				return nil
+			}
+
+			duration := time.Since(startTime)
+			lsession.Info(
+				"stored-all-events",
+				lager.Data{
+					"duration":         duration,
+					"events-collected": c.eventsCollected,
+				},
+			)
+			UsageEventCollectorCollectDurationTotal.WithLabelValues(c.foundation, string(c.kind)).Add(duration.Seconds())
+		}
+	}
+}
+
+// collect fetches and stores the events after the last one stored. Each page
+// is stored along with the new cursor, so a restart resumes from the last page
+// stored.
+func (c *UsageEventCollector) collect(ctx context.Context, lsession lager.Logger, startTime time.Time) error {
+	afterGUID, err := c.usageEventDB.GetUsageEventCursor(c.kind, c.foundation)
+	if err != nil {
+		lsession.Error("err-get-usage-event-cursor", err)
+		UsageEventCollectorErrorsTotal.WithLabelValues(c.foundation, string(c.kind)).Inc()
+		return err
+	}
+
+	fetchCtx, cancelFetch := context.WithCancel(ctx)
+	defer cancelFetch()
+
+	resultsChan := make(chan fetchers.UsageEventResult, 3)
+	go c.fetcher(fetchCtx, fetchers.UsageEventQuery{AfterGUID: afterGUID}, resultsChan)
+
+	for result := range resultsChan {
+		if result.Err != nil {
+			lsession.Error("err-recv-events", result.Err)
+			UsageEventCollectorErrorsTotal.WithLabelValues(c.foundation, string(c.kind)).Inc()
+			return result.Err
+		}
+
+		events := make([]db.UsageEvent, len(result.Events))
+		for i, event := range result.Events {
+			events[i] = db.UsageEvent(event)
+		}
+
+		err := c.usageEventDB.StoreUsageEvents(c.kind, c.foundation, events)
+		if err != nil && ctx.Err() != nil {
+			// We are shutting down, the page will be fetched again next time
+			return nil
+		}
+		if err != nil {
+			lsession.Error("err-store-usage-events", err)
+			UsageEventCollectorErrorsTotal.WithLabelValues(c.foundation, string(c.kind)).Inc()
+			return err
+		}
+
+		c.eventsCollected += int64(len(events))
+		UsageEventCollectorEventsCollectedTotal.WithLabelValues(c.foundation, string(c.kind)).Add(float64(len(events)))
+
+		lsession.Info(
+			"stored-events",
+			lager.Data{
+				"duration":         time.Since(startTime),
+				"events-collected": c.eventsCollected,
+			},
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package collectors_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/collectors"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("UsageEventCollector Run", func() {
+	var (
+		logger       lager.Logger
+		usageEventDB *dbfakes.FakeUsageEventDB
+
+		usageEventCollectorEventsCollectedTotal float64
+		usageEventCollectorErrorsTotal          float64
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("collector-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		usageEventDB = &dbfakes.FakeUsageEventDB{}
+
+		By("checking the value of the metrics to test against them later")
+		usageEventCollectorEventsCollectedTotal = h.CurrentMetricValue(
+			collectors.UsageEventCollectorEventsCollectedTotal.WithLabelValues("test-foundation", "app"),
+		)
+		usageEventCollectorErrorsTotal = h.CurrentMetricValue(
+			collectors.UsageEventCollectorErrorsTotal.WithLabelValues("test-foundation", "app"),
+		)
+	})
+
+	It("fetches after the stored cursor and stores each page", func() {
+		usageEventDB.GetUsageEventCursorReturns("last-guid", nil)
+
+		queriesChan := make(chan fetchers.UsageEventQuery, 10)
+		fetcher := func(_ context.Context, query fetchers.UsageEventQuery, c chan fetchers.UsageEventResult) {
+			defer close(c)
+			queriesChan <- query
+			c <- fetchers.UsageEventResult{Events: []fetchers.UsageEvent{
+				{GUID: "guid-1", State: "STARTED", Raw: json.RawMessage(`{"guid":"guid-1"}`)},
+				{GUID: "guid-2", State: "STOPPED", Raw: json.RawMessage(`{"guid":"guid-2"}`)},
+			}}
+			c <- fetchers.UsageEventResult{Events: []fetchers.UsageEvent{
+				{GUID: "guid-3", State: "STARTED", Raw: json.RawMessage(`{"guid":"guid-3"}`)},
+			}}
+		}
+
+		coll := collectors.NewUsageEventCollector(
+			db.AppUsageEvents,
+			"test-foundation",
+			10*time.Millisecond,
+			logger,
+			fetcher,
+			usageEventDB,
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+
+		By("running the collector")
+		go func() {
+			defer GinkgoRecover()
+			Expect(coll.Run(collectContext)).To(Succeed())
+		}()
+
+		By("waiting for events to be stored")
+		Eventually(
+			usageEventDB.StoreUsageEventsCallCount, "100ms", "1ms",
+		).Should(BeNumerically(">=", 2))
+		cancelCollect()
+
+		Eventually(queriesChan).Should(Receive(Equal(fetchers.UsageEventQuery{AfterGUID: "last-guid"})))
+		kind, foundation := usageEventDB.GetUsageEventCursorArgsForCall(0)
+		Expect(kind).To(Equal(db.AppUsageEvents))
+		Expect(foundation).To(Equal("test-foundation"))
+
+		kind, foundation, events := usageEventDB.StoreUsageEventsArgsForCall(0)
+		Expect(kind).To(Equal(db.AppUsageEvents))
+		Expect(foundation).To(Equal("test-foundation"))
+		Expect(events).To(Equal([]db.UsageEvent{
+			{GUID: "guid-1", State: "STARTED", Raw: json.RawMessage(`{"guid":"guid-1"}`)},
+			{GUID: "guid-2", State: "STOPPED", Raw: json.RawMessage(`{"guid":"guid-2"}`)},
+		}))
+
+		_, _, events = usageEventDB.StoreUsageEventsArgsForCall(1)
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].GUID).To(Equal("guid-3"))
+
+		By("checking the metrics")
+		Expect(collectors.UsageEventCollectorEventsCollectedTotal.WithLabelValues("test-foundation", "app")).To(
+			h.MetricIncrementedBy(usageEventCollectorEventsCollectedTotal, ">=", 3),
+		)
+	})
+
+	It("returns an error when the fetcher fails", func() {
+		fetcher := func(_ context.Context, _ fetchers.UsageEventQuery, c chan fetchers.UsageEventResult) {
+			defer close(c)
+			c <- fetchers.UsageEventResult{Err: fmt.Errorf("fetch failed")}
+		}
+
+		coll := collectors.NewUsageEventCollector(
+			db.AppUsageEvents,
+			"test-foundation",
+			10*time.Millisecond,
+			logger,
+			fetcher,
+			usageEventDB,
+		)
+
+		err := coll.Run(context.Background())
+		Expect(err).To(MatchError("fetch failed"))
+		Expect(usageEventDB.StoreUsageEventsCallCount()).To(Equal(0))
+		Expect(collectors.UsageEventCollectorErrorsTotal.WithLabelValues("test-foundation", "app")).To(
+			h.MetricIncrementedBy(usageEventCollectorErrorsTotal, "==", 1),
+		)
+	})
+})
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const ActorsTable = "cf_actors"
+
+// Actor is what UAA knows about a user who made a change
+type Actor struct {
+	GUID     string
+	Username string
+	// Origin is the identity provider the user logs in with, for example
+	// uaa, google or microsoft
+	Origin string
+	Email  string
+	Active bool
+}
+
+type ActorDB interface {
+	RecordActor(foundation string, actor Actor, seenAt time.Time) error
+	RecordActorDeleted(foundation string, guid string, seenAt time.Time) error
+}
+
+// cfAuditEventActorsJoin joins the details of the user who made each event,
+// if they are known to the event's foundation. It expects cf_audit_events to
+// be aliased as e.
+const cfAuditEventActorsJoin = `
+	left join ` + ActorsTable + ` actor
+		on actor.foundation = e.foundation and actor.guid = e.actor and e.actor_type = 'user'
+`
+
+// RecordActor records the latest details of a UAA user of a foundation
+func (s *EventStore) RecordActor(foundation string, actor Actor, seenAt time.Time) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	stmt := fmt.Sprintf(
+		`insert into %s (
+				guid, foundation, username, origin, email, active, first_seen, last_seen
+			) values (
+				$1, $2, $3, $4, $5, $6, $7, $7
+			) on conflict (foundation, guid) do
+			update set
+				username = excluded.username,
+				origin = excluded.origin,
+				email = excluded.email,
+				active = excluded.active,
+				deleted = false,
+				first_seen = least(%s.first_seen, excluded.first_seen),
+				last_seen = greatest(%s.last_seen, excluded.last_seen)`,
+		ActorsTable, ActorsTable, ActorsTable,
+	)
+
+	_, err := s.db.ExecContext(
+		ctx, stmt,
+		actor.GUID, foundation, actor.Username, actor.Origin, actor.Email, actor.Active, seenAt,
+	)
+	return err
+}
+
+// RecordActorDeleted records that a UAA user no longer exists. Their last
+// known details are kept, users who were never seen are not recorded.
+func (s *EventStore) RecordActorDeleted(foundation string, guid string, seenAt time.Time) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	stmt := fmt.Sprintf(
+		`update %s set
+				active = false,
+				deleted = true,
+				last_seen = greatest(last_seen, $3)
+			where guid = $1 and foundation = $2`,
+		ActorsTable,
+	)
+
+	_, err := s.db.ExecContext(ctx, stmt, guid, foundation, seenAt)
+	return err
+}
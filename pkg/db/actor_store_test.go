@@ -0,0 +1,66 @@
+package db_test
+
+import (
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("Actors", func() {
+	Context("against Postgres", func() {
+		var store *db.EventStore
+
+		createdAt := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+
+		BeforeEach(func() {
+			store, _ = newTestEventStore()
+
+			for foundation, guid := range map[string]string{
+				"london":  "10000000-0000-0000-0000-000000000001",
+				"ireland": "20000000-0000-0000-0000-000000000002",
+			} {
+				_, err := store.StoreCFAuditEvents(foundation, []cfclient.Event{{
+					GUID:      guid,
+					CreatedAt: createdAt.Format(time.RFC3339),
+					Type:      "audit.app.create",
+					Actor:     "actor-guid",
+					ActorType: "user",
+				}})
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		actorEmails := func(foundation string) []string {
+			page, err := store.QueryCFAuditEvents(db.EventQuery{
+				Foundation: foundation,
+				To:         createdAt.Add(time.Hour),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			emails := []string{}
+			for _, event := range page.Events {
+				emails = append(emails, event.ActorEmail)
+			}
+			return emails
+		}
+
+		It("keeps a user with the same GUID separately for each foundation", func() {
+			Expect(store.RecordActor("london", db.Actor{GUID: "actor-guid", Email: "london@example.com", Active: true}, createdAt)).To(Succeed())
+			Expect(store.RecordActor("ireland", db.Actor{GUID: "actor-guid", Email: "ireland@example.com", Active: true}, createdAt)).To(Succeed())
+
+			Expect(actorEmails("london")).To(Equal([]string{"london@example.com"}))
+			Expect(actorEmails("ireland")).To(Equal([]string{"ireland@example.com"}))
+		})
+
+		It("only joins events to the users of their own foundation", func() {
+			Expect(store.RecordActor("london", db.Actor{GUID: "actor-guid", Email: "london@example.com", Active: true}, createdAt)).To(Succeed())
+			Expect(store.RecordActorDeleted("ireland", "actor-guid", createdAt)).To(Succeed())
+
+			Expect(actorEmails("london")).To(Equal([]string{"london@example.com"}))
+			Expect(actorEmails("ireland")).To(Equal([]string{""}))
+		})
+	})
+})
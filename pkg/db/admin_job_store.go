@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const AdminJobsTable = "admin_jobs"
+
+// AdminJobDB records the jobs asked for through the admin endpoints
+type AdminJobDB interface {
+	CreateAdminJob(job AdminJob) error
+	UpdateAdminJob(job AdminJob) error
+	GetAdminJob(id string) (*AdminJob, error)
+	FailUnfinishedAdminJobs(except []string, reason string) (int64, error)
+}
+
+// AdminJob is a job asked for through the admin endpoints
+type AdminJob struct {
+	ID         string
+	Kind       string
+	Foundation string
+	// From and To are the window of a backfill, or nil for other jobs
+	From            *time.Time
+	To              *time.Time
+	Status          string
+	EventsCollected int64
+	Error           string
+	CreatedAt       time.Time
+	StartedAt       *time.Time
+	FinishedAt      *time.Time
+}
+
+// CreateAdminJob records a new job
+func (s *EventStore) CreateAdminJob(job AdminJob) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		insert into `+AdminJobsTable+` (
+			id, kind, foundation, window_from, window_to, status,
+			events_collected, error, created_at, started_at, finished_at
+		) values (
+			$1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10, $11
+		)
+	`,
+		job.ID, job.Kind, job.Foundation, job.From, job.To, job.Status,
+		job.EventsCollected, job.Error, job.CreatedAt, job.StartedAt, job.FinishedAt,
+	)
+	return err
+}
+
+// UpdateAdminJob records how a job is going
+func (s *EventStore) UpdateAdminJob(job AdminJob) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		update `+AdminJobsTable+` set
+			status = $2,
+			events_collected = $3,
+			error = NULLIF($4, ''),
+			started_at = $5,
+			finished_at = $6
+		where
+			id = $1
+	`, job.ID, job.Status, job.EventsCollected, job.Error, job.StartedAt, job.FinishedAt)
+	return err
+}
+
+// GetAdminJob returns a job, or nil if there is no such job
+func (s *EventStore) GetAdminJob(id string) (*AdminJob, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	job := AdminJob{}
+	var from, to, startedAt, finishedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		select
+			id, kind, foundation, window_from, window_to, status,
+			events_collected, coalesce(error, ''), created_at, started_at, finished_at
+		from
+			`+AdminJobsTable+`
+		where
+			id = $1
+	`, id).Scan(
+		&job.ID, &job.Kind, &job.Foundation, &from, &to, &job.Status,
+		&job.EventsCollected, &job.Error, &job.CreatedAt, &startedAt, &finishedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	job.From, job.To = nullTime(from), nullTime(to)
+	job.StartedAt, job.FinishedAt = nullTime(startedAt), nullTime(finishedAt)
+	job.CreatedAt = job.CreatedAt.UTC()
+	return &job, nil
+}
+
+// FailUnfinishedAdminJobs marks every unfinished job, apart from those in
+// except, as failed for reason, and returns how many there were. A new
+// leader uses it for the jobs of an instance which stopped without
+// finishing them.
+func (s *EventStore) FailUnfinishedAdminJobs(except []string, reason string) (int64, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	if except == nil {
+		except = []string{}
+	}
+	res, err := s.db.ExecContext(ctx, `
+		update `+AdminJobsTable+` set
+			status = 'failed',
+			error = $2,
+			finished_at = now()
+		where
+			finished_at is null
+			and not (id = any($1))
+	`, pq.Array(except), reason)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
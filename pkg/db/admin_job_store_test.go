@@ -0,0 +1,97 @@
+package db_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("Admin jobs", func() {
+	Context("against Postgres", func() {
+		var store *db.EventStore
+
+		createdAt := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+
+		BeforeEach(func() {
+			store, _ = newTestEventStore()
+		})
+
+		It("records a job as it runs", func() {
+			from, to := createdAt.AddDate(0, 0, -2), createdAt.AddDate(0, 0, -1)
+			Expect(store.CreateAdminJob(db.AdminJob{
+				ID:         "job-1",
+				Kind:       "backfill",
+				Foundation: "london",
+				From:       &from,
+				To:         &to,
+				Status:     "queued",
+				CreatedAt:  createdAt,
+			})).To(Succeed())
+
+			job, err := store.GetAdminJob("job-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.Status).To(Equal("queued"))
+			Expect(*job.From).To(BeTemporally("==", from))
+			Expect(*job.To).To(BeTemporally("==", to))
+			Expect(job.StartedAt).To(BeNil())
+
+			startedAt, finishedAt := createdAt.Add(time.Minute), createdAt.Add(time.Hour)
+			job.Status = "failed"
+			job.EventsCollected = 12
+			job.Error = "cloud controller is down"
+			job.StartedAt = &startedAt
+			job.FinishedAt = &finishedAt
+			Expect(store.UpdateAdminJob(*job)).To(Succeed())
+
+			job, err = store.GetAdminJob("job-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.Status).To(Equal("failed"))
+			Expect(job.EventsCollected).To(BeEquivalentTo(12))
+			Expect(job.Error).To(Equal("cloud controller is down"))
+			Expect(*job.StartedAt).To(BeTemporally("==", startedAt))
+			Expect(*job.FinishedAt).To(BeTemporally("==", finishedAt))
+		})
+
+		It("returns nil for unknown jobs", func() {
+			job, err := store.GetAdminJob("unknown")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job).To(BeNil())
+		})
+
+		It("fails unfinished jobs apart from those it is told to keep", func() {
+			finishedAt := createdAt.Add(time.Hour)
+			for _, job := range []db.AdminJob{
+				{ID: "orphaned", Status: "running"},
+				{ID: "running-here", Status: "running"},
+				{ID: "finished", Status: "succeeded", FinishedAt: &finishedAt},
+			} {
+				job.Kind = "collect"
+				job.Foundation = "london"
+				job.CreatedAt = createdAt
+				Expect(store.CreateAdminJob(job)).To(Succeed())
+			}
+
+			failed, err := store.FailUnfinishedAdminJobs([]string{"running-here"}, "stopped")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(failed).To(BeEquivalentTo(1))
+
+			for id, status := range map[string]string{
+				"orphaned":     "failed",
+				"running-here": "running",
+				"finished":     "succeeded",
+			} {
+				job, err := store.GetAdminJob(id)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(job.Status).To(Equal(status), id)
+			}
+
+			job, err := store.GetAdminJob("orphaned")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.Error).To(Equal("stopped"))
+			Expect(job.FinishedAt).NotTo(BeNil())
+		})
+	})
+})
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+)
+
+// LeaderLockKey is the Postgres advisory lock held by the auditor instance
+// which is doing the collecting and shipping
+const LeaderLockKey int64 = 0x7061617341756469 // "paasAudi"
+
+// LeaderLock is a lock which at most one instance can hold at a time
+type LeaderLock interface {
+	// TryAcquire takes the lock if nobody else holds it, returning whether
+	// it is now held
+	TryAcquire(ctx context.Context) (bool, error)
+	// Check returns an error if the lock may have been lost, including if
+	// it could not be checked before ctx is done
+	Check(ctx context.Context) error
+	Release() error
+}
+
+// AdvisoryLock is a LeaderLock using a Postgres session level advisory lock.
+// The lock belongs to a single connection, which is kept out of the pool for
+// as long as the lock is wanted. If the connection is lost then so is the
+// lock.
+type AdvisoryLock struct {
+	db  *sql.DB
+	key int64
+
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+func NewAdvisoryLock(db *sql.DB, key int64) *AdvisoryLock {
+	return &AdvisoryLock{db: db, key: key}
+}
+
+func (l *AdvisoryLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	if l.conn == nil {
+		conn, err := l.db.Conn(ctx)
+		if err != nil {
+			return false, fmt.Errorf("error getting connection: %s", err)
+		}
+		l.conn = conn
+	}
+
+	var acquired bool
+	err := l.conn.QueryRowContext(ctx, `select pg_try_advisory_lock($1)`, l.key).Scan(&acquired)
+	if err != nil {
+		l.closeConn()
+		return false, err
+	}
+	return acquired, nil
+}
+
+// Check checks that the connection still holds the lock. It takes as long as
+// ctx allows rather than DefaultQueryTimeout, as a check which hangs must
+// not keep an instance leading for longer than a standby takes to take over.
+// If the check fails or times out the connection is closed, which ends the
+// session and so releases the lock if it was still held.
+func (l *AdvisoryLock) Check(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return fmt.Errorf("lock is not held")
+	}
+
+	var held bool
+	err := l.conn.QueryRowContext(ctx, `
+		select exists (
+			select 1 from pg_locks
+			where locktype = 'advisory'
+			and pid = pg_backend_pid()
+			and granted
+			and objsubid = 1
+			and ((classid::bigint << 32) | objid::bigint) = $1
+		)
+	`, l.key).Scan(&held)
+	if err != nil {
+		l.closeConn()
+		return fmt.Errorf("could not check the lock is held: %s", err)
+	}
+	if !held {
+		return fmt.Errorf("lock is not held")
+	}
+	return nil
+}
+
+func (l *AdvisoryLock) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultQueryTimeout)
+	defer cancel()
+
+	_, err := l.conn.ExecContext(ctx, `select pg_advisory_unlock($1)`, l.key)
+	if err != nil {
+		l.closeConn()
+		return err
+	}
+	err = l.conn.Close()
+	l.conn = nil
+	return err
+}
+
+// closeConn closes the connection rather than returning it to the pool, so
+// that the session and any lock it still holds are ended. Must be called
+// with mu held.
+func (l *AdvisoryLock) closeConn() {
+	if l.conn != nil {
+		_ = l.conn.Raw(func(interface{}) error {
+			return driver.ErrBadConn
+		})
+		l.conn = nil
+	}
+}
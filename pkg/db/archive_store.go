@@ -0,0 +1,16 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// ArchiveDB is what the archiver needs to read each day of events and keep
+// its cursor
+type ArchiveDB interface {
+	GetEarliestCFEventTime() (time.Time, error)
+	StreamCFAuditEvents(ctx context.Context, query EventQuery, fn func(event CFAuditEvent) error) error
+
+	GetShipperCursor(shipperName string) (*ShipperCursor, error)
+	UpdateShipperCursor(shipperName string, shipperTime string, shippedID string) error
+}
@@ -0,0 +1,380 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+)
+
+const (
+	CFAuditEventsChainTable            = "cf_audit_events_chain"
+	CFAuditEventsChainRetirementsTable = "cf_audit_events_chain_retirements"
+)
+
+// GenesisHash is the previous hash of the first event in the chain
+var GenesisHash = make([]byte, sha256.Size)
+
+// ChainDB reads the head of the hash chain over cf_audit_events
+type ChainDB interface {
+	GetCFAuditEventChainHead() (ChainHead, error)
+}
+
+// ChainHead is the hash of the last event added to the chain, and how many
+// events have been added to it
+type ChainHead struct {
+	Length    int64
+	Hash      []byte
+	UpdatedAt time.Time
+}
+
+// ChainBreak is where the chain stops matching the events stored
+type ChainBreak struct {
+	// ID and GUID are of the first event which does not match the chain, or
+	// empty if the events match but the head does not
+	ID     int64
+	GUID   string
+	Reason string
+}
+
+func (b ChainBreak) String() string {
+	if b.GUID == "" {
+		return b.Reason
+	}
+	return fmt.Sprintf("event %d (%s): %s", b.ID, b.GUID, b.Reason)
+}
+
+// ChainVerification is the result of walking the chain
+type ChainVerification struct {
+	// Head is the head of the chain when it was walked
+	Head ChainHead
+	// Unchained is how many events were stored before the chain began
+	Unchained int64
+	// Checked is how many events in the chain were checked
+	Checked int64
+	// Retired is how many events the chain was followed across because they
+	// were retired with their partitions
+	Retired int64
+	// Truncated is true when the first event checked does not follow the
+	// genesis hash, because older events were retired before retirements
+	// were recorded
+	Truncated bool
+	// Broken is the first break in the chain, or nil if it is intact
+	Broken *ChainBreak
+}
+
+// ChainHash is the hash of an event in the chain. It covers the previous
+// event's hash and the event's canonical form.
+func ChainHash(prevHash []byte, foundation string, event cfclient.Event) ([]byte, error) {
+	canonical, err := canonicalCFAuditEvent(foundation, event)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(prevHash)
+	h.Write(canonical)
+	return h.Sum(nil), nil
+}
+
+// CFAuditEventHash is the hash of an event's canonical form, which does not
+// depend on any other event
+func CFAuditEventHash(foundation string, event cfclient.Event) ([]byte, error) {
+	canonical, err := canonicalCFAuditEvent(foundation, event)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(canonical)
+	return sum[:], nil
+}
+
+// canonicalCFAuditEvent encodes every field of an event which is stored,
+// the foundation it was collected from, and its metadata. Fields are in the
+// form Postgres returns them, so that a stored event has the same encoding as
+// when it was fetched.
+func canonicalCFAuditEvent(foundation string, event cfclient.Event) ([]byte, error) {
+	createdAt, err := time.Parse(time.RFC3339Nano, event.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	metadataJSON, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	metadataJSON, err = canonicalJSON(metadataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	// A JSON array of strings, so that fields cannot run into each other
+	return json.Marshal([]string{
+		strings.ToLower(event.GUID),
+		createdAt.UTC().Round(time.Microsecond).Format(time.RFC3339Nano),
+		event.Type,
+		event.Actor,
+		event.ActorType,
+		event.ActorName,
+		event.ActorUsername,
+		event.Actee,
+		event.ActeeType,
+		event.ActeeName,
+		strings.ToLower(event.OrganizationGUID),
+		strings.ToLower(event.SpaceGUID),
+		foundation,
+		string(metadataJSON),
+	})
+}
+
+// canonicalJSON re-encodes a JSON document so that the same document always
+// has the same encoding, whether it came from the API or from jsonb, which
+// orders keys and spaces values its own way
+func canonicalJSON(b []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// lockCFAuditEventChain locks the head of the chain until the transaction
+// ends, so that only one page of events is added to the chain at a time
+func lockCFAuditEventChain(ctx context.Context, tx *sql.Tx) (ChainHead, error) {
+	head := ChainHead{}
+	err := tx.QueryRowContext(ctx, `
+		select length, head_hash, updated_at from `+CFAuditEventsChainTable+` for update
+	`).Scan(&head.Length, &head.Hash, &head.UpdatedAt)
+	if err != nil {
+		return ChainHead{}, wrapPqError(err, "failed to lock chain")
+	}
+	return head, nil
+}
+
+func updateCFAuditEventChain(ctx context.Context, tx *sql.Tx, head ChainHead) error {
+	_, err := tx.ExecContext(ctx, `
+		update `+CFAuditEventsChainTable+` set length = $1, head_hash = $2, updated_at = now()
+	`, head.Length, head.Hash)
+	return err
+}
+
+// GetCFAuditEventChainHead returns the head of the chain
+func (s *EventStore) GetCFAuditEventChainHead() (ChainHead, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	head := ChainHead{}
+	err := s.db.QueryRowContext(ctx, `
+		select length, head_hash, updated_at from `+CFAuditEventsChainTable+`
+	`).Scan(&head.Length, &head.Hash, &head.UpdatedAt)
+	return head, err
+}
+
+// VerifyCFAuditEventChain walks the chain in the order events were stored,
+// working out the hash of every event again, and stops at the first event
+// which does not match. The events are read through a server-side cursor in
+// a single snapshot, so events stored meanwhile are not included.
+func (s *EventStore) VerifyCFAuditEventChain(ctx context.Context) (ChainVerification, error) {
+	result := ChainVerification{}
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		select length, head_hash, updated_at from `+CFAuditEventsChainTable+`
+	`).Scan(&result.Head.Length, &result.Head.Hash, &result.Head.UpdatedAt)
+	if err != nil {
+		return result, err
+	}
+
+	retired, err := getRetiredChainRuns(ctx, tx)
+	if err != nil {
+		return result, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		declare cf_audit_events_chain_walk no scroll cursor for
+		select
+			`+hashedEventColumns+`
+		from
+			`+CFAuditEventsTable+`
+		order by
+			id
+	`)
+	if err != nil {
+		return result, wrapPqError(err, "failed to declare cursor")
+	}
+
+	var prevHash []byte
+	for {
+		rows, err := tx.QueryContext(ctx, `fetch forward `+strconv.Itoa(streamFetchSize)+` from cf_audit_events_chain_walk`)
+		if err != nil {
+			return result, err
+		}
+		fetched := 0
+		for rows.Next() {
+			fetched++
+			e, err := scanHashedEvent(rows)
+			if err != nil {
+				rows.Close()
+				return result, err
+			}
+			chainPrevHash, chainHash := e.prevHash, e.hash
+
+			broken := func(reason string) (ChainVerification, error) {
+				rows.Close()
+				result.Broken = &ChainBreak{ID: e.id, GUID: e.event.GUID, Reason: reason}
+				return result, nil
+			}
+
+			if chainHash == nil {
+				if prevHash == nil {
+					result.Unchained++
+					continue
+				}
+				return broken("event has no hash, but was stored after the chain began")
+			}
+			if prevHash == nil {
+				if n, ok := retired.follow(GenesisHash, chainPrevHash); ok {
+					result.Retired += n
+				} else {
+					result.Truncated = true
+				}
+			} else if n, ok := retired.follow(prevHash, chainPrevHash); ok {
+				result.Retired += n
+			} else {
+				return broken("previous hash does not match the event before, which has been changed, or events between them have been deleted")
+			}
+			hash, err := ChainHash(chainPrevHash, e.foundation, e.event)
+			if err != nil {
+				return broken(err.Error())
+			}
+			if !bytes.Equal(hash, chainHash) {
+				return broken("hash does not match the event, which has been changed")
+			}
+			prevHash = chainHash
+			result.Checked++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return result, err
+		}
+		if fetched < streamFetchSize {
+			break
+		}
+	}
+
+	// Deleting the newest events leaves a chain which is intact, but which
+	// stops short of the head
+	if prevHash == nil {
+		prevHash = GenesisHash
+	}
+	if n, ok := retired.follow(prevHash, result.Head.Hash); ok {
+		result.Retired += n
+	} else {
+		result.Broken = &ChainBreak{Reason: fmt.Sprintf(
+			"the last event in the chain has hash %s, but the head of the chain is %s, so events have been deleted",
+			hex.EncodeToString(prevHash), hex.EncodeToString(result.Head.Hash),
+		)}
+	}
+	return result, nil
+}
+
+// retiredChainRuns are the runs of the chain retired with partitions, by the
+// hex of the hash before each run
+type retiredChainRuns map[string]retiredChainRun
+
+type retiredChainRun struct {
+	eventCount int64
+	lastHash   []byte
+}
+
+func getRetiredChainRuns(ctx context.Context, tx *sql.Tx) (retiredChainRuns, error) {
+	rows, err := tx.QueryContext(ctx, `
+		select event_count, prev_hash, last_hash from `+CFAuditEventsChainRetirementsTable+`
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := retiredChainRuns{}
+	for rows.Next() {
+		var (
+			run      retiredChainRun
+			prevHash []byte
+		)
+		if err := rows.Scan(&run.eventCount, &prevHash, &run.lastHash); err != nil {
+			return nil, err
+		}
+		runs[hex.EncodeToString(prevHash)] = run
+	}
+	return runs, rows.Err()
+}
+
+// follow follows the chain from one hash across retired runs until it
+// reaches another, returning how many retired events it went across, and
+// false if it cannot be reached
+func (runs retiredChainRuns) follow(from []byte, to []byte) (int64, bool) {
+	var retired int64
+	// Each run can be followed at most once
+	for i := 0; i <= len(runs); i++ {
+		if bytes.Equal(from, to) {
+			return retired, true
+		}
+		run, ok := runs[hex.EncodeToString(from)]
+		if !ok {
+			return 0, false
+		}
+		retired += run.eventCount
+		from = run.lastHash
+	}
+	return 0, false
+}
+
+// hashedEventColumns are the columns of cf_audit_events scanned by
+// scanHashedEvent
+const hashedEventColumns = `
+			id, guid, created_at, event_type,
+			actor, actor_type, actor_name, actor_username,
+			actee, actee_type, actee_name,
+			coalesce(organization_guid::text, ''), coalesce(space_guid::text, ''),
+			foundation, metadata, chain_prev_hash, chain_hash`
+
+// hashedEvent is an event as stored, with what is needed to hash it
+type hashedEvent struct {
+	id         int64
+	foundation string
+	event      cfclient.Event
+	prevHash   []byte
+	hash       []byte
+}
+
+func scanHashedEvent(rows *sql.Rows) (hashedEvent, error) {
+	var (
+		e            hashedEvent
+		createdAt    time.Time
+		metadataJSON []byte
+	)
+	err := rows.Scan(
+		&e.id, &e.event.GUID, &createdAt, &e.event.Type,
+		&e.event.Actor, &e.event.ActorType, &e.event.ActorName, &e.event.ActorUsername,
+		&e.event.Actee, &e.event.ActeeType, &e.event.ActeeName,
+		&e.event.OrganizationGUID, &e.event.SpaceGUID,
+		&e.foundation, &metadataJSON, &e.prevHash, &e.hash,
+	)
+	if err != nil {
+		return e, err
+	}
+	e.event.CreatedAt = createdAt.Format(time.RFC3339Nano)
+	if err := json.Unmarshal(metadataJSON, &e.event.Metadata); err != nil {
+		return e, err
+	}
+	return e, nil
+}
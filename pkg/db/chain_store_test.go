@@ -0,0 +1,201 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("ChainHash", func() {
+	event := cfclient.Event{
+		GUID:             "A0000000-0000-0000-0000-000000000001",
+		CreatedAt:        "2019-10-31T01:00:00.000000001+01:00",
+		Type:             "audit.app.create",
+		Actor:            "actor-guid",
+		ActeeName:        "my-app",
+		OrganizationGUID: "B0000000-0000-0000-0000-000000000000",
+		Metadata:         map[string]interface{}{"b": 1.0, "a": map[string]interface{}{"c": "<d>"}},
+	}
+
+	It("is the same for the event as stored", func() {
+		hash, err := db.ChainHash(db.GenesisHash, "london", event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(HaveLen(32))
+
+		var metadata map[string]interface{}
+		Expect(json.Unmarshal([]byte(`{"a": {"c": "<d>"}, "b": 1.0}`), &metadata)).To(Succeed())
+		stored := event
+		stored.GUID = "a0000000-0000-0000-0000-000000000001"
+		stored.CreatedAt = "2019-10-31T00:00:00Z"
+		stored.OrganizationGUID = "b0000000-0000-0000-0000-000000000000"
+		stored.Metadata = metadata
+
+		storedHash, err := db.ChainHash(db.GenesisHash, "london", stored)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(storedHash).To(Equal(hash))
+	})
+
+	It("changes with the event, its foundation and the previous hash", func() {
+		hash, err := db.ChainHash(db.GenesisHash, "london", event)
+		Expect(err).NotTo(HaveOccurred())
+
+		changed := event
+		changed.ActeeName = "my-app2"
+		Expect(db.ChainHash(db.GenesisHash, "london", changed)).NotTo(Equal(hash))
+
+		changed = event
+		changed.Metadata = map[string]interface{}{"b": 2.0}
+		Expect(db.ChainHash(db.GenesisHash, "london", changed)).NotTo(Equal(hash))
+
+		By("not letting one field run into the next")
+		changed = event
+		changed.Actor, changed.ActorType = "actor-", "guid"
+		Expect(db.ChainHash(db.GenesisHash, "london", changed)).NotTo(Equal(hash))
+
+		Expect(db.ChainHash(db.GenesisHash, "paris", event)).NotTo(Equal(hash))
+		Expect(db.ChainHash(hash, "london", event)).NotTo(Equal(hash))
+	})
+
+	Context("against Postgres", func() {
+		var (
+			store *db.EventStore
+			conn  *sql.DB
+		)
+
+		event := func(guid string, createdAt time.Time) cfclient.Event {
+			return cfclient.Event{
+				GUID:      guid,
+				CreatedAt: createdAt.Format(time.RFC3339Nano),
+				Type:      "audit.app.update",
+				Actor:     "actor-guid",
+				ActorType: "user",
+				Actee:     "app-guid",
+				ActeeType: "app",
+				Metadata:  map[string]interface{}{"request": map[string]interface{}{"state": "STARTED", "instances": 2.0}},
+			}
+		}
+
+		start := time.Date(2019, 10, 31, 23, 0, 0, 123456000, time.UTC)
+
+		BeforeEach(func() {
+			store, conn = newTestEventStore()
+
+			_, err := store.StoreCFAuditEvents("london", []cfclient.Event{
+				event("10000000-0000-0000-0000-000000000001", start),
+				event("20000000-0000-0000-0000-000000000002", start.Add(time.Hour)),
+				event("20000000-0000-0000-0000-000000000002", start.Add(time.Hour)),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err := store.StoreCFAuditEvents("paris", []cfclient.Event{
+				event("20000000-0000-0000-0000-000000000002", start.Add(time.Hour)),
+				event("30000000-0000-0000-0000-000000000003", start.Add(2*time.Hour)),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Inserted).To(Equal(1))
+			Expect(result.Duplicates).To(Equal(1))
+		})
+
+		It("chains every new event in the order it was stored", func() {
+			head, err := store.GetCFAuditEventChainHead()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(head.Length).To(BeNumerically("==", 3))
+
+			result, err := store.VerifyCFAuditEventChain(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Broken).To(BeNil())
+			Expect(result.Checked).To(BeNumerically("==", 3))
+			Expect(result.Truncated).To(BeFalse())
+			Expect(result.Head.Hash).To(Equal(head.Hash))
+		})
+
+		It("follows the chain across retired partitions whose events are interleaved with newer ones", func() {
+			By("storing an October event late, after November events")
+			_, err := store.StoreCFAuditEvents("london", []cfclient.Event{
+				event("40000000-0000-0000-0000-000000000004", start.Add(-time.Hour)),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = store.StoreCFAuditEvents("london", []cfclient.Event{
+				event("50000000-0000-0000-0000-000000000005", start.Add(3*time.Hour)),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			partitions, err := store.GetCFAuditEventPartitions()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(partitions[0].Month).To(Equal(time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)))
+			retired, err := store.RetireCFAuditEventPartition(partitions[0], db.RetentionDrop)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retired).To(BeNumerically("==", 2))
+
+			result, err := store.VerifyCFAuditEventChain(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Broken).To(BeNil())
+			Expect(result.Truncated).To(BeFalse())
+			Expect(result.Retired).To(BeNumerically("==", 2))
+			Expect(result.Checked).To(BeNumerically("==", 3))
+
+			By("still finding events deleted other than by retiring their partition")
+			_, err = conn.Exec(`delete from cf_audit_events where guid = '30000000-0000-0000-0000-000000000003'`)
+			Expect(err).NotTo(HaveOccurred())
+			result, err = store.VerifyCFAuditEventChain(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Broken).NotTo(BeNil())
+			Expect(result.Broken.GUID).To(Equal("50000000-0000-0000-0000-000000000005"))
+		})
+
+		It("follows the chain across the newest events being retired", func() {
+			_, err := store.StoreCFAuditEvents("london", []cfclient.Event{
+				event("40000000-0000-0000-0000-000000000004", start.Add(-time.Hour)),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			partitions, err := store.GetCFAuditEventPartitions()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = store.RetireCFAuditEventPartition(partitions[0], db.RetentionArchive)
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := store.VerifyCFAuditEventChain(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Broken).To(BeNil())
+			Expect(result.Retired).To(BeNumerically("==", 2))
+		})
+
+		It("finds events which have been changed", func() {
+			_, err := conn.Exec(`update cf_audit_events set actee_name = 'renamed' where guid = '20000000-0000-0000-0000-000000000002'`)
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := store.VerifyCFAuditEventChain(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Broken).NotTo(BeNil())
+			Expect(result.Broken.GUID).To(Equal("20000000-0000-0000-0000-000000000002"))
+			Expect(result.Checked).To(BeNumerically("==", 1))
+		})
+
+		It("finds events which have been deleted", func() {
+			_, err := conn.Exec(`delete from cf_audit_events where guid = '20000000-0000-0000-0000-000000000002'`)
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := store.VerifyCFAuditEventChain(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Broken).NotTo(BeNil())
+			Expect(result.Broken.GUID).To(Equal("30000000-0000-0000-0000-000000000003"))
+		})
+
+		It("finds the newest events having been deleted", func() {
+			_, err := conn.Exec(`delete from cf_audit_events where guid = '30000000-0000-0000-0000-000000000003'`)
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := store.VerifyCFAuditEventChain(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Broken).NotTo(BeNil())
+			Expect(result.Broken.GUID).To(BeEmpty())
+			Expect(result.Checked).To(BeNumerically("==", 2))
+		})
+	})
+})
@@ -0,0 +1,512 @@
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// The same specs run against every EventDB, so that MemoryEventStore can be
+// trusted to behave like EventStore
+var _ = Describe("EventDB", func() {
+	Context("MemoryEventStore", func() {
+		itBehavesLikeAnEventDB(func() db.EventDB {
+			return db.NewMemoryEventStore()
+		})
+	})
+
+	Context("EventStore", func() {
+		itBehavesLikeAnEventDB(func() db.EventDB {
+			store, _ := newTestEventStore()
+			return store
+		})
+	})
+})
+
+func itBehavesLikeAnEventDB(newEventDB func() db.EventDB) {
+	var store db.EventDB
+
+	// shipperBatchSize is the default SHIPPER_BATCH_SIZE
+	const shipperBatchSize = 8192
+
+	start := time.Date(2019, 10, 31, 23, 0, 0, 123456000, time.UTC)
+
+	event := func(n int, createdAt time.Time) cfclient.Event {
+		return cfclient.Event{
+			GUID:      fmt.Sprintf("00000000-0000-0000-0000-%012d", n),
+			CreatedAt: createdAt.Format(time.RFC3339Nano),
+			Type:      "audit.app.update",
+			Actor:     "actor-guid",
+			ActorType: "user",
+			Actee:     "app-guid",
+			ActeeType: "app",
+			Metadata:  map[string]interface{}{"request": map[string]interface{}{"instances": 2, "state": "STARTED"}},
+		}
+	}
+
+	guids := func(events []db.CFAuditEvent) []string {
+		guids := []string{}
+		for _, event := range events {
+			guids = append(guids, event.GUID)
+		}
+		return guids
+	}
+
+	createdAt := func(event db.CFAuditEvent) time.Time {
+		t, err := time.Parse(time.RFC3339Nano, event.CreatedAt)
+		Expect(err).NotTo(HaveOccurred())
+		return t
+	}
+
+	BeforeEach(func() {
+		store = newEventDB()
+	})
+
+	Describe("StoreCFAuditEvents", func() {
+		It("stores each GUID once, whatever its case or foundation", func() {
+			upper := event(1, start)
+			upper.GUID = "A0000000-0000-0000-0000-000000000001"
+
+			result, err := store.StoreCFAuditEvents("london", []cfclient.Event{upper, event(2, start), event(2, start)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(db.StoreResult{Inserted: 2, Duplicates: 1}))
+
+			lower := upper
+			lower.GUID = "a0000000-0000-0000-0000-000000000001"
+			result, err = store.StoreCFAuditEvents("paris", []cfclient.Event{lower, event(3, start)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(db.StoreResult{Inserted: 1, Duplicates: 1}))
+
+			events, err := store.GetCFAuditEvents(db.RawEventFilter{Reverse: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(events)).To(Equal([]string{
+				"a0000000-0000-0000-0000-000000000001",
+				"00000000-0000-0000-0000-000000000002",
+				"00000000-0000-0000-0000-000000000003",
+			}))
+			Expect(events[0].Foundation).To(Equal("london"))
+			Expect(events[2].Foundation).To(Equal("paris"))
+		})
+
+		It("returns events as they were stored, to the microsecond", func() {
+			e := event(1, start.Add(999*time.Nanosecond).In(time.FixedZone("BST", 3600)))
+			e.OrganizationGUID = "B0000000-0000-0000-0000-000000000000"
+			_, err := store.StoreCFAuditEvents("london", []cfclient.Event{e})
+			Expect(err).NotTo(HaveOccurred())
+
+			events, err := store.GetCFAuditEvents(db.RawEventFilter{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(HaveLen(1))
+			Expect(createdAt(events[0])).To(BeTemporally("==", start.Add(time.Microsecond)))
+			Expect(events[0].OrganizationGUID).To(Equal("b0000000-0000-0000-0000-000000000000"))
+			Expect(events[0].SpaceGUID).To(BeEmpty())
+			Expect(events[0].Metadata).To(Equal(map[string]interface{}{
+				"request": map[string]interface{}{"instances": 2.0, "state": "STARTED"},
+			}))
+		})
+
+		It("quarantines invalid events once, until they are reprocessed", func() {
+			invalid := event(1, start)
+			invalid.CreatedAt = "yesterday"
+
+			for i := 0; i < 2; i++ {
+				result, err := store.StoreCFAuditEvents("london", []cfclient.Event{invalid, event(2, start)})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Quarantined).To(Equal(1))
+			}
+
+			quarantined, err := store.GetQuarantinedCFAuditEvents("london")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(quarantined).To(HaveLen(1))
+			Expect(quarantined[0].Reason).To(ContainSubstring(`created_at "yesterday" is not a time`))
+			var quarantinedEvent cfclient.Event
+			Expect(json.Unmarshal(quarantined[0].Event, &quarantinedEvent)).To(Succeed())
+			Expect(quarantinedEvent.CreatedAt).To(Equal("yesterday"))
+
+			Expect(store.GetQuarantinedCFAuditEvents("paris")).To(BeEmpty())
+
+			Expect(store.MarkCFAuditEventsReprocessed([]int64{quarantined[0].ID})).To(Succeed())
+			Expect(store.GetQuarantinedCFAuditEvents("london")).To(BeEmpty())
+		})
+
+		It("quarantines events with NUL, which Postgres cannot store", func() {
+			inMetadata := event(1, start)
+			inMetadata.Metadata = map[string]interface{}{
+				"request": map[string]interface{}{"names": []interface{}{"ok", "not\u0000ok"}},
+			}
+			inActor := event(2, start)
+			inActor.ActorName = "\x00"
+
+			result, err := store.StoreCFAuditEvents("london", []cfclient.Event{inMetadata, inActor, event(3, start)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Inserted).To(Equal(1))
+			Expect(result.Quarantined).To(Equal(2))
+
+			quarantined, err := store.GetQuarantinedCFAuditEvents("london")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(quarantined).To(HaveLen(2))
+			Expect(quarantined[0].Reason).To(Equal("metadata.request.names[1] contains NUL"))
+			Expect(quarantined[1].Reason).To(Equal("actor_name contains NUL"))
+			var quarantinedEvent cfclient.Event
+			Expect(json.Unmarshal(quarantined[0].Event, &quarantinedEvent)).To(Succeed())
+			Expect(quarantinedEvent.Metadata).To(Equal(inMetadata.Metadata))
+		})
+
+		It("quarantines events as they were fetched, once", func() {
+			raw := json.RawMessage(`{"metadata": {"guid": "00000000-0000-0000-0000-000000000001", "created_at": 1570190400}, "entity": {"unknown_field": "kept"}}`)
+			for i := 0; i < 2; i++ {
+				Expect(store.QuarantineCFAuditEvents("london", []db.QuarantinedCFAuditEvent{{
+					GUID:   "00000000-0000-0000-0000-000000000001",
+					Event:  raw,
+					Reason: "error unmarshaling event",
+				}})).To(Succeed())
+			}
+
+			quarantined, err := store.GetQuarantinedCFAuditEvents("london")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(quarantined).To(HaveLen(1))
+			Expect(quarantined[0].Foundation).To(Equal("london"))
+			Expect(quarantined[0].GUID).To(Equal("00000000-0000-0000-0000-000000000001"))
+			Expect(string(quarantined[0].Event)).To(Equal(string(raw)))
+			Expect(quarantined[0].Reason).To(Equal("error unmarshaling event"))
+		})
+
+		It("can be called concurrently", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					events := []cfclient.Event{}
+					for n := 1; n <= 20; n++ {
+						events = append(events, event(n, start.Add(time.Duration(n)*time.Second)))
+					}
+					_, err := store.StoreCFAuditEvents("london", events)
+					Expect(err).NotTo(HaveOccurred())
+				}()
+			}
+			wg.Wait()
+
+			Expect(store.GetCFAuditEvents(db.RawEventFilter{})).To(HaveLen(20))
+		})
+	})
+
+	Describe("GetCFAuditEvents", func() {
+		It("returns events in the order they were stored, newest first", func() {
+			_, err := store.StoreCFAuditEvents("london", []cfclient.Event{
+				event(2, start.Add(time.Hour)),
+				event(1, start),
+				event(3, start.Add(-time.Hour)),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			events, err := store.GetCFAuditEvents(db.RawEventFilter{Limit: 2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(events)).To(Equal([]string{
+				"00000000-0000-0000-0000-000000000003",
+				"00000000-0000-0000-0000-000000000001",
+			}))
+
+			events, err = store.GetCFAuditEvents(db.RawEventFilter{Reverse: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(events)).To(Equal([]string{
+				"00000000-0000-0000-0000-000000000002",
+				"00000000-0000-0000-0000-000000000001",
+				"00000000-0000-0000-0000-000000000003",
+			}))
+		})
+	})
+
+	Describe("GetLatestCFEventTime", func() {
+		It("is when the newest event from the foundation was created, or the epoch", func() {
+			_, err := store.StoreCFAuditEvents("london", []cfclient.Event{
+				event(1, start.Add(time.Hour)),
+				event(2, start),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(store.GetLatestCFEventTime("london")).To(BeTemporally("==", start.Add(time.Hour)))
+			Expect(store.GetLatestCFEventTime("paris")).To(BeTemporally("==", time.Unix(0, 0)))
+		})
+	})
+
+	Describe("QueryCFAuditEvents and StreamCFAuditEvents", func() {
+		BeforeEach(func() {
+			stopped := event(5, start.Add(time.Hour))
+			stopped.Type = "audit.app.stop"
+			stopped.Metadata = map[string]interface{}{"request": map[string]interface{}{"state": "STOPPED", "tags": []interface{}{"a", "b"}}}
+
+			_, err := store.StoreCFAuditEvents("london", []cfclient.Event{
+				event(4, start.Add(time.Hour)),
+				event(3, start.Add(time.Hour)),
+				event(1, start),
+				stopped,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = store.StoreCFAuditEvents("paris", []cfclient.Event{event(2, start.Add(30*time.Minute))})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("pages by created_at and then GUID, in either order", func() {
+			all := []string{}
+			query := db.EventQuery{Limit: 2}
+			for {
+				page, err := store.QueryCFAuditEvents(query)
+				Expect(err).NotTo(HaveOccurred())
+				all = append(all, guids(page.Events)...)
+				if page.NextPageToken == "" {
+					break
+				}
+				query.PageToken = page.NextPageToken
+			}
+			Expect(all).To(Equal([]string{
+				"00000000-0000-0000-0000-000000000001",
+				"00000000-0000-0000-0000-000000000002",
+				"00000000-0000-0000-0000-000000000003",
+				"00000000-0000-0000-0000-000000000004",
+				"00000000-0000-0000-0000-000000000005",
+			}))
+
+			page, err := store.QueryCFAuditEvents(db.EventQuery{Limit: 2, Descending: true})
+			Expect(err).NotTo(HaveOccurred())
+			page, err = store.QueryCFAuditEvents(db.EventQuery{Limit: 2, Descending: true, PageToken: page.NextPageToken})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(page.Events)).To(Equal([]string{
+				"00000000-0000-0000-0000-000000000003",
+				"00000000-0000-0000-0000-000000000002",
+			}))
+		})
+
+		It("filters", func() {
+			page, err := store.QueryCFAuditEvents(db.EventQuery{
+				Foundation: "london",
+				From:       start.Add(time.Hour),
+				EventTypes: []string{"audit.app.up*", "audit.app.stop"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(page.Events)).To(Equal([]string{
+				"00000000-0000-0000-0000-000000000003",
+				"00000000-0000-0000-0000-000000000004",
+				"00000000-0000-0000-0000-000000000005",
+			}))
+
+			page, err = store.QueryCFAuditEvents(db.EventQuery{To: start.Add(time.Hour), Actor: "actor-guid", Actee: "app-guid"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(page.Events)).To(Equal([]string{
+				"00000000-0000-0000-0000-000000000001",
+				"00000000-0000-0000-0000-000000000002",
+			}))
+		})
+
+		It("filters by metadata", func() {
+			for _, predicate := range []db.MetadataPredicate{
+				{Path: []string{"request", "state"}, Equals: "STOPPED"},
+				{Path: []string{"request", "tags"}, Equals: []string{"b"}},
+				{Path: []string{"request", "tags", "1"}, Exists: true},
+			} {
+				page, err := store.QueryCFAuditEvents(db.EventQuery{Metadata: []db.MetadataPredicate{predicate}})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(guids(page.Events)).To(Equal([]string{"00000000-0000-0000-0000-000000000005"}), "%+v", predicate)
+			}
+
+			page, err := store.QueryCFAuditEvents(db.EventQuery{
+				Metadata: []db.MetadataPredicate{{Path: []string{"request", "instances"}, Equals: 2}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Events).To(HaveLen(4))
+
+			page, err = store.QueryCFAuditEvents(db.EventQuery{
+				Metadata: []db.MetadataPredicate{{Path: []string{"request"}, Equals: "STOPPED"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Events).To(BeEmpty())
+		})
+
+		It("rejects bad queries", func() {
+			for _, query := range []db.EventQuery{
+				{Limit: db.MaxQueryLimit + 1},
+				{SpaceGUID: "not-a-guid"},
+				{Metadata: []db.MetadataPredicate{{Equals: "x"}}},
+				{PageToken: "not-a-token"},
+			} {
+				_, err := store.QueryCFAuditEvents(query)
+				Expect(err).To(HaveOccurred(), "%+v", query)
+			}
+		})
+
+		It("streams every matching event in order", func() {
+			streamed := []db.CFAuditEvent{}
+			err := store.StreamCFAuditEvents(context.Background(), db.EventQuery{Foundation: "london"}, func(event db.CFAuditEvent) error {
+				streamed = append(streamed, event)
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(streamed)).To(Equal([]string{
+				"00000000-0000-0000-0000-000000000001",
+				"00000000-0000-0000-0000-000000000003",
+				"00000000-0000-0000-0000-000000000004",
+				"00000000-0000-0000-0000-000000000005",
+			}))
+		})
+	})
+
+	Describe("GetUnshippedCFAuditEventsForShipper", func() {
+		It("returns events from the foundation oldest first", func() {
+			_, err := store.StoreCFAuditEvents("london", []cfclient.Event{
+				event(3, start.Add(2*time.Hour)),
+				event(1, start),
+				event(2, start.Add(time.Hour)),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = store.StoreCFAuditEvents("paris", []cfclient.Event{event(4, start)})
+			Expect(err).NotTo(HaveOccurred())
+
+			events, err := store.GetUnshippedCFAuditEventsForShipper("splunk", "london", shipperBatchSize)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(events)).To(Equal([]string{
+				"00000000-0000-0000-0000-000000000001",
+				"00000000-0000-0000-0000-000000000002",
+				"00000000-0000-0000-0000-000000000003",
+			}))
+		})
+
+		It("carries on from the cursor, including other events created at the same time", func() {
+			_, err := store.StoreCFAuditEvents("london", []cfclient.Event{
+				event(1, start),
+				event(2, start.Add(time.Hour)),
+				event(3, start.Add(time.Hour)),
+				event(4, start.Add(2*time.Hour)),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(store.UpdateShipperCursor("splunk", start.Add(time.Hour).Format(time.RFC3339Nano), "00000000-0000-0000-0000-000000000002")).To(Succeed())
+
+			events, err := store.GetUnshippedCFAuditEventsForShipper("splunk", "london", shipperBatchSize)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(events)).To(Equal([]string{
+				"00000000-0000-0000-0000-000000000003",
+				"00000000-0000-0000-0000-000000000004",
+			}))
+
+			By("keeping a cursor for each shipper")
+			events, err = store.GetUnshippedCFAuditEventsForShipper("other", "london", shipperBatchSize)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(HaveLen(4))
+		})
+
+		It("applies the limit before leaving out the event at the cursor", func() {
+			_, err := store.StoreCFAuditEvents("london", []cfclient.Event{
+				event(1, start),
+				event(2, start.Add(time.Hour)),
+				event(3, start.Add(2*time.Hour)),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store.UpdateShipperCursor("splunk", start.Format(time.RFC3339Nano), "00000000-0000-0000-0000-000000000001")).To(Succeed())
+
+			events, err := store.GetUnshippedCFAuditEventsForShipper("splunk", "london", 2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(events)).To(Equal([]string{"00000000-0000-0000-0000-000000000002"}))
+		})
+
+		It("returns a batch at a time", func() {
+			events := []cfclient.Event{}
+			for n := 1; n <= shipperBatchSize+10; n++ {
+				events = append(events, event(n, start.Add(time.Duration(n)*time.Second)))
+			}
+			result, err := store.StoreCFAuditEvents("london", events)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Inserted).To(Equal(shipperBatchSize + 10))
+
+			batch, err := store.GetUnshippedCFAuditEventsForShipper("splunk", "london", shipperBatchSize)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(batch).To(HaveLen(shipperBatchSize))
+			last := batch[len(batch)-1]
+			Expect(last.GUID).To(Equal(fmt.Sprintf("00000000-0000-0000-0000-%012d", shipperBatchSize)))
+
+			Expect(store.UpdateShipperCursor("splunk", last.CreatedAt, last.GUID)).To(Succeed())
+			batch, err = store.GetUnshippedCFAuditEventsForShipper("splunk", "london", shipperBatchSize)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(batch).To(HaveLen(10))
+			Expect(batch[0].GUID).To(Equal(fmt.Sprintf("00000000-0000-0000-0000-%012d", shipperBatchSize+1)))
+		})
+	})
+
+	Describe("backfill checkpoints", func() {
+		It("returns incomplete windows oldest first, updating them in place", func() {
+			later := db.BackfillCheckpoint{Foundation: "london", WindowStart: start.Add(time.Hour), WindowEnd: start.Add(2 * time.Hour), LastPageURL: "/v2/events?page=1"}
+			earlier := db.BackfillCheckpoint{Foundation: "london", WindowStart: start, WindowEnd: start.Add(time.Hour)}
+			Expect(store.UpdateBackfillCheckpoint(later)).To(Succeed())
+			Expect(store.UpdateBackfillCheckpoint(earlier)).To(Succeed())
+			Expect(store.UpdateBackfillCheckpoint(db.BackfillCheckpoint{Foundation: "paris", WindowStart: start, WindowEnd: start.Add(time.Hour)})).To(Succeed())
+
+			later.LastPageURL = "/v2/events?page=2"
+			later.EventCount = 50
+			Expect(store.UpdateBackfillCheckpoint(later)).To(Succeed())
+			earlier.Completed = true
+			Expect(store.UpdateBackfillCheckpoint(earlier)).To(Succeed())
+
+			checkpoints, err := store.GetIncompleteBackfillCheckpoints("london")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checkpoints).To(HaveLen(1))
+			Expect(checkpoints[0].WindowStart).To(BeTemporally("==", later.WindowStart))
+			Expect(checkpoints[0].LastPageURL).To(Equal("/v2/events?page=2"))
+			Expect(checkpoints[0].EventCount).To(BeNumerically("==", 50))
+		})
+
+		It("deletes completed windows which end by the time given", func() {
+			completed := db.BackfillCheckpoint{Foundation: "london", WindowStart: start, WindowEnd: start.Add(time.Hour), Completed: true}
+			completedLater := db.BackfillCheckpoint{Foundation: "london", WindowStart: start.Add(time.Hour), WindowEnd: start.Add(2 * time.Hour), Completed: true}
+			incomplete := db.BackfillCheckpoint{Foundation: "london", WindowStart: start.Add(-time.Hour), WindowEnd: start}
+			otherFoundation := db.BackfillCheckpoint{Foundation: "paris", WindowStart: start, WindowEnd: start.Add(time.Hour), Completed: true}
+			for _, checkpoint := range []db.BackfillCheckpoint{completed, completedLater, incomplete, otherFoundation} {
+				Expect(store.UpdateBackfillCheckpoint(checkpoint)).To(Succeed())
+			}
+
+			deleted, err := store.DeleteCompletedBackfillCheckpoints("london", start.Add(time.Hour))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deleted).To(BeNumerically("==", 1))
+
+			By("keeping the windows which may still be needed")
+			deleted, err = store.DeleteCompletedBackfillCheckpoints("london", start.Add(time.Hour))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deleted).To(BeNumerically("==", 0))
+			checkpoints, err := store.GetIncompleteBackfillCheckpoints("london")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checkpoints).To(HaveLen(1))
+
+			deleted, err = store.DeleteCompletedBackfillCheckpoints("paris", start.Add(time.Hour))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deleted).To(BeNumerically("==", 1))
+		})
+	})
+
+	Describe("collector watermarks", func() {
+		It("is the zero value until it is updated", func() {
+			watermark, err := store.GetCollectorWatermark(db.CFAuditEventsSource, "london")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(watermark.Watermark.IsZero()).To(BeTrue())
+
+			Expect(store.UpdateCollectorWatermark(db.CollectorWatermark{
+				Source: db.CFAuditEventsSource, Foundation: "london", Watermark: start, LastResweep: start.Add(time.Hour),
+			})).To(Succeed())
+
+			watermark, err = store.GetCollectorWatermark(db.CFAuditEventsSource, "london")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(watermark.Watermark).To(BeTemporally("==", start))
+			Expect(watermark.LastResweep).To(BeTemporally("==", start.Add(time.Hour)))
+
+			watermark, err = store.GetCollectorWatermark(db.CFAuditEventsSource, "paris")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(watermark.Watermark.IsZero()).To(BeTrue())
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+func TestDB(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DB Suite")
+}
+
+// newTestEventStore returns an initialised EventStore using a schema of its
+// own in the database at TEST_DATABASE_URL, which is dropped after the spec.
+// The spec is skipped if TEST_DATABASE_URL is not set.
+func newTestEventStore() (*db.EventStore, *sql.DB) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", databaseURL)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(admin.Close)
+
+	schema := fmt.Sprintf("test_%d_%d", GinkgoParallelProcess(), time.Now().UnixNano())
+	_, err = admin.Exec(`create schema ` + schema)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(func() {
+		_, err := admin.Exec(`drop schema ` + schema + ` cascade`)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	u, err := url.Parse(databaseURL)
+	Expect(err).NotTo(HaveOccurred())
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	conn, err := sql.Open("postgres", u.String())
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(conn.Close)
+
+	logger := lager.NewLogger("db-test")
+	logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+	store := db.NewEventStore(context.Background(), conn, logger)
+	Expect(store.Init()).To(Succeed())
+	return store, conn
+}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+const DigestsTable = "digests"
+
+// DigestDB stores a signed digest of the events created on each day
+type DigestDB interface {
+	GetEarliestCFEventTime() (time.Time, error)
+	StreamCFAuditEventHashes(ctx context.Context, from time.Time, to time.Time, fn func(hash EventHash) error) (int64, error)
+
+	GetLatestDigest() (*Digest, error)
+	GetDigest(date time.Time) (*Digest, error)
+	StoreDigest(digest Digest) error
+}
+
+// EventHash is the CFAuditEventHash of a stored event
+type EventHash struct {
+	// ID is the event's id, which is given to events in the order they are
+	// stored
+	ID   int64
+	GUID string
+	Hash []byte
+}
+
+// Digest is a signed statement of the events created on a UTC day
+type Digest struct {
+	// Date is midnight UTC at the start of the day
+	Date       time.Time
+	EventCount int64
+	// FirstGUID and LastGUID are of the first and last events of the day,
+	// ordered by created_at and then guid, or empty if there were none
+	FirstGUID  string
+	LastGUID   string
+	MerkleRoot []byte
+	// MaxEventID is the id of the latest event stored when the digest was
+	// made. Events of the day with larger ids were stored since, and are
+	// not covered by it. It is 0 in digests made before it was recorded,
+	// which cover every event of their day.
+	MaxEventID int64
+	PublicKey  []byte
+	Signature  []byte
+}
+
+// GetEarliestCFEventTime returns when the earliest stored event was
+// created, or the zero time if there are no events
+func (s *EventStore) GetEarliestCFEventTime() (time.Time, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	var earliest sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		select min(created_at) from `+CFAuditEventsTable+`
+	`).Scan(&earliest)
+	if err != nil || !earliest.Valid {
+		return time.Time{}, err
+	}
+	return earliest.Time, nil
+}
+
+// StreamCFAuditEventHashes calls fn with the hash of every event created
+// from from until to, ordered by created_at and then guid, and returns the
+// id of the latest event stored when it started. The events are read through
+// a server-side cursor in a single snapshot, so a day of events is never held
+// at once, and events stored meanwhile are not included. Streaming stops when
+// ctx is cancelled or fn returns an error, which is returned.
+func (s *EventStore) StreamCFAuditEventHashes(ctx context.Context, from time.Time, to time.Time, fn func(hash EventHash) error) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Events are stored one page at a time while the chain is locked, so
+	// every event stored after this snapshot has a larger id
+	var maxEventID int64
+	err = tx.QueryRowContext(ctx, `
+		select coalesce(max(id), 0) from `+CFAuditEventsTable+`
+	`).Scan(&maxEventID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		declare cf_audit_events_hashes no scroll cursor for
+		select
+			`+hashedEventColumns+`
+		from
+			`+CFAuditEventsTable+`
+		where
+			created_at >= $1 and created_at < $2
+		order by
+			created_at, guid
+	`, from, to)
+	if err != nil {
+		return 0, wrapPqError(err, "failed to declare cursor")
+	}
+
+	for {
+		rows, err := tx.QueryContext(ctx, `fetch forward `+strconv.Itoa(streamFetchSize)+` from cf_audit_events_hashes`)
+		if err != nil {
+			return 0, err
+		}
+		events := make([]hashedEvent, 0, streamFetchSize)
+		for rows.Next() {
+			e, err := scanHashedEvent(rows)
+			if err != nil {
+				rows.Close()
+				return 0, err
+			}
+			events = append(events, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		for _, e := range events {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			hash, err := CFAuditEventHash(e.foundation, e.event)
+			if err != nil {
+				return 0, err
+			}
+			if err := fn(EventHash{ID: e.id, GUID: e.event.GUID, Hash: hash}); err != nil {
+				return 0, err
+			}
+		}
+		if len(events) < streamFetchSize {
+			return maxEventID, nil
+		}
+	}
+}
+
+const digestColumns = `
+			date, event_count, coalesce(first_guid::text, ''), coalesce(last_guid::text, ''),
+			merkle_root, max_event_id, public_key, signature`
+
+func scanDigest(row *sql.Row) (*Digest, error) {
+	digest := Digest{}
+	err := row.Scan(
+		&digest.Date, &digest.EventCount, &digest.FirstGUID, &digest.LastGUID,
+		&digest.MerkleRoot, &digest.MaxEventID, &digest.PublicKey, &digest.Signature,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	digest.Date = digest.Date.UTC()
+	return &digest, nil
+}
+
+// GetLatestDigest returns the digest of the latest day, or nil if there are
+// no digests
+func (s *EventStore) GetLatestDigest() (*Digest, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	return scanDigest(s.db.QueryRowContext(ctx, `
+		select `+digestColumns+` from `+DigestsTable+` order by date desc limit 1
+	`))
+}
+
+// GetDigest returns the digest of the day starting at date, or nil if there
+// is not one
+func (s *EventStore) GetDigest(date time.Time) (*Digest, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	return scanDigest(s.db.QueryRowContext(ctx, `
+		select `+digestColumns+` from `+DigestsTable+` where date = $1
+	`, date.UTC().Format("2006-01-02")))
+}
+
+// StoreDigest stores the digest of a day, unless there is already one
+func (s *EventStore) StoreDigest(digest Digest) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		insert into `+DigestsTable+` (
+			date, event_count, first_guid, last_guid, merkle_root, max_event_id, public_key, signature
+		) values (
+			$1, $2, NULLIF($3, '')::uuid, NULLIF($4, '')::uuid, $5, $6, $7, $8
+		) on conflict (date) do nothing
+	`,
+		digest.Date.UTC().Format("2006-01-02"), digest.EventCount, digest.FirstGUID, digest.LastGUID,
+		digest.MerkleRoot, digest.MaxEventID, digest.PublicKey, digest.Signature,
+	)
+	return err
+}
@@ -0,0 +1,92 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("Digests", func() {
+	Context("against Postgres", func() {
+		var store *db.EventStore
+
+		day := time.Date(2019, 10, 31, 0, 0, 0, 0, time.UTC)
+		events := []cfclient.Event{
+			{GUID: "20000000-0000-0000-0000-000000000002", CreatedAt: day.Add(time.Hour).Format(time.RFC3339), Type: "audit.app.update", Metadata: map[string]interface{}{"a": 1.0}},
+			{GUID: "10000000-0000-0000-0000-000000000001", CreatedAt: day.Add(time.Hour).Format(time.RFC3339), Type: "audit.app.create"},
+			{GUID: "30000000-0000-0000-0000-000000000003", CreatedAt: day.Add(-time.Second).Format(time.RFC3339), Type: "audit.app.create"},
+		}
+
+		BeforeEach(func() {
+			store, _ = newTestEventStore()
+			_, err := store.StoreCFAuditEvents("london", events)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("hashes a day's events in order, as they were fetched", func() {
+			earliest, err := store.GetEarliestCFEventTime()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(earliest).To(BeTemporally("==", day.Add(-time.Second)))
+
+			hashes := []db.EventHash{}
+			maxEventID, err := store.StreamCFAuditEventHashes(context.Background(), day, day.AddDate(0, 0, 1), func(hash db.EventHash) error {
+				hashes = append(hashes, hash)
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hashes).To(HaveLen(2))
+			Expect(hashes[0].GUID).To(Equal(events[1].GUID))
+			Expect(hashes[1].GUID).To(Equal(events[0].GUID))
+			Expect(db.CFAuditEventHash("london", events[1])).To(Equal(hashes[0].Hash))
+			Expect(db.CFAuditEventHash("london", events[0])).To(Equal(hashes[1].Hash))
+
+			By("returning the id of the latest event stored, which is of the day before")
+			Expect(hashes[1].ID).To(BeNumerically("<", hashes[0].ID))
+			Expect(maxEventID).To(BeNumerically(">", hashes[0].ID))
+		})
+
+		It("stops streaming when fn fails", func() {
+			calls := 0
+			_, err := store.StreamCFAuditEventHashes(context.Background(), day, day.AddDate(0, 0, 1), func(hash db.EventHash) error {
+				calls++
+				return fmt.Errorf("full")
+			})
+			Expect(err).To(MatchError("full"))
+			Expect(calls).To(Equal(1))
+		})
+
+		It("stores one digest a day", func() {
+			latest, err := store.GetLatestDigest()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(latest).To(BeNil())
+
+			digest := db.Digest{
+				Date:       day,
+				EventCount: 2,
+				FirstGUID:  events[1].GUID,
+				LastGUID:   events[0].GUID,
+				MerkleRoot: []byte("root"),
+				MaxEventID: 3,
+				PublicKey:  []byte("key"),
+				Signature:  []byte("signature"),
+			}
+			Expect(store.StoreDigest(digest)).To(Succeed())
+			Expect(store.StoreDigest(db.Digest{Date: day, MerkleRoot: []byte{}, PublicKey: []byte{}, Signature: []byte{}})).To(Succeed())
+			Expect(store.StoreDigest(db.Digest{Date: day.AddDate(0, 0, -1), MerkleRoot: []byte{}, PublicKey: []byte{}, Signature: []byte{}})).To(Succeed())
+
+			stored, err := store.GetDigest(day)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*stored).To(Equal(digest))
+
+			latest, err = store.GetLatestDigest()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(latest.Date).To(Equal(day))
+		})
+	})
+})
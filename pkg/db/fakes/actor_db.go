@@ -0,0 +1,194 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+type FakeActorDB struct {
+	RecordActorStub        func(string, db.Actor, time.Time) error
+	recordActorMutex       sync.RWMutex
+	recordActorArgsForCall []struct {
+		arg1 string
+		arg2 db.Actor
+		arg3 time.Time
+	}
+	recordActorReturns struct {
+		result1 error
+	}
+	recordActorReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RecordActorDeletedStub        func(string, string, time.Time) error
+	recordActorDeletedMutex       sync.RWMutex
+	recordActorDeletedArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 time.Time
+	}
+	recordActorDeletedReturns struct {
+		result1 error
+	}
+	recordActorDeletedReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeActorDB) RecordActor(arg1 string, arg2 db.Actor, arg3 time.Time) error {
+	fake.recordActorMutex.Lock()
+	ret, specificReturn := fake.recordActorReturnsOnCall[len(fake.recordActorArgsForCall)]
+	fake.recordActorArgsForCall = append(fake.recordActorArgsForCall, struct {
+		arg1 string
+		arg2 db.Actor
+		arg3 time.Time
+	}{arg1, arg2, arg3})
+	stub := fake.RecordActorStub
+	fakeReturns := fake.recordActorReturns
+	fake.recordInvocation("RecordActor", []interface{}{arg1, arg2, arg3})
+	fake.recordActorMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeActorDB) RecordActorCallCount() int {
+	fake.recordActorMutex.RLock()
+	defer fake.recordActorMutex.RUnlock()
+	return len(fake.recordActorArgsForCall)
+}
+
+func (fake *FakeActorDB) RecordActorCalls(stub func(string, db.Actor, time.Time) error) {
+	fake.recordActorMutex.Lock()
+	defer fake.recordActorMutex.Unlock()
+	fake.RecordActorStub = stub
+}
+
+func (fake *FakeActorDB) RecordActorArgsForCall(i int) (string, db.Actor, time.Time) {
+	fake.recordActorMutex.RLock()
+	defer fake.recordActorMutex.RUnlock()
+	argsForCall := fake.recordActorArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeActorDB) RecordActorReturns(result1 error) {
+	fake.recordActorMutex.Lock()
+	defer fake.recordActorMutex.Unlock()
+	fake.RecordActorStub = nil
+	fake.recordActorReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeActorDB) RecordActorReturnsOnCall(i int, result1 error) {
+	fake.recordActorMutex.Lock()
+	defer fake.recordActorMutex.Unlock()
+	fake.RecordActorStub = nil
+	if fake.recordActorReturnsOnCall == nil {
+		fake.recordActorReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.recordActorReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeActorDB) RecordActorDeleted(arg1 string, arg2 string, arg3 time.Time) error {
+	fake.recordActorDeletedMutex.Lock()
+	ret, specificReturn := fake.recordActorDeletedReturnsOnCall[len(fake.recordActorDeletedArgsForCall)]
+	fake.recordActorDeletedArgsForCall = append(fake.recordActorDeletedArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 time.Time
+	}{arg1, arg2, arg3})
+	stub := fake.RecordActorDeletedStub
+	fakeReturns := fake.recordActorDeletedReturns
+	fake.recordInvocation("RecordActorDeleted", []interface{}{arg1, arg2, arg3})
+	fake.recordActorDeletedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeActorDB) RecordActorDeletedCallCount() int {
+	fake.recordActorDeletedMutex.RLock()
+	defer fake.recordActorDeletedMutex.RUnlock()
+	return len(fake.recordActorDeletedArgsForCall)
+}
+
+func (fake *FakeActorDB) RecordActorDeletedCalls(stub func(string, string, time.Time) error) {
+	fake.recordActorDeletedMutex.Lock()
+	defer fake.recordActorDeletedMutex.Unlock()
+	fake.RecordActorDeletedStub = stub
+}
+
+func (fake *FakeActorDB) RecordActorDeletedArgsForCall(i int) (string, string, time.Time) {
+	fake.recordActorDeletedMutex.RLock()
+	defer fake.recordActorDeletedMutex.RUnlock()
+	argsForCall := fake.recordActorDeletedArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeActorDB) RecordActorDeletedReturns(result1 error) {
+	fake.recordActorDeletedMutex.Lock()
+	defer fake.recordActorDeletedMutex.Unlock()
+	fake.RecordActorDeletedStub = nil
+	fake.recordActorDeletedReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeActorDB) RecordActorDeletedReturnsOnCall(i int, result1 error) {
+	fake.recordActorDeletedMutex.Lock()
+	defer fake.recordActorDeletedMutex.Unlock()
+	fake.RecordActorDeletedStub = nil
+	if fake.recordActorDeletedReturnsOnCall == nil {
+		fake.recordActorDeletedReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.recordActorDeletedReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeActorDB) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.recordActorMutex.RLock()
+	defer fake.recordActorMutex.RUnlock()
+	fake.recordActorDeletedMutex.RLock()
+	defer fake.recordActorDeletedMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeActorDB) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ db.ActorDB = new(FakeActorDB)
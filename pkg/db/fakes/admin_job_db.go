@@ -0,0 +1,350 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+type FakeAdminJobDB struct {
+	CreateAdminJobStub        func(db.AdminJob) error
+	createAdminJobMutex       sync.RWMutex
+	createAdminJobArgsForCall []struct {
+		arg1 db.AdminJob
+	}
+	createAdminJobReturns struct {
+		result1 error
+	}
+	createAdminJobReturnsOnCall map[int]struct {
+		result1 error
+	}
+	FailUnfinishedAdminJobsStub        func([]string, string) (int64, error)
+	failUnfinishedAdminJobsMutex       sync.RWMutex
+	failUnfinishedAdminJobsArgsForCall []struct {
+		arg1 []string
+		arg2 string
+	}
+	failUnfinishedAdminJobsReturns struct {
+		result1 int64
+		result2 error
+	}
+	failUnfinishedAdminJobsReturnsOnCall map[int]struct {
+		result1 int64
+		result2 error
+	}
+	GetAdminJobStub        func(string) (*db.AdminJob, error)
+	getAdminJobMutex       sync.RWMutex
+	getAdminJobArgsForCall []struct {
+		arg1 string
+	}
+	getAdminJobReturns struct {
+		result1 *db.AdminJob
+		result2 error
+	}
+	getAdminJobReturnsOnCall map[int]struct {
+		result1 *db.AdminJob
+		result2 error
+	}
+	UpdateAdminJobStub        func(db.AdminJob) error
+	updateAdminJobMutex       sync.RWMutex
+	updateAdminJobArgsForCall []struct {
+		arg1 db.AdminJob
+	}
+	updateAdminJobReturns struct {
+		result1 error
+	}
+	updateAdminJobReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeAdminJobDB) CreateAdminJob(arg1 db.AdminJob) error {
+	fake.createAdminJobMutex.Lock()
+	ret, specificReturn := fake.createAdminJobReturnsOnCall[len(fake.createAdminJobArgsForCall)]
+	fake.createAdminJobArgsForCall = append(fake.createAdminJobArgsForCall, struct {
+		arg1 db.AdminJob
+	}{arg1})
+	stub := fake.CreateAdminJobStub
+	fakeReturns := fake.createAdminJobReturns
+	fake.recordInvocation("CreateAdminJob", []interface{}{arg1})
+	fake.createAdminJobMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeAdminJobDB) CreateAdminJobCallCount() int {
+	fake.createAdminJobMutex.RLock()
+	defer fake.createAdminJobMutex.RUnlock()
+	return len(fake.createAdminJobArgsForCall)
+}
+
+func (fake *FakeAdminJobDB) CreateAdminJobCalls(stub func(db.AdminJob) error) {
+	fake.createAdminJobMutex.Lock()
+	defer fake.createAdminJobMutex.Unlock()
+	fake.CreateAdminJobStub = stub
+}
+
+func (fake *FakeAdminJobDB) CreateAdminJobArgsForCall(i int) db.AdminJob {
+	fake.createAdminJobMutex.RLock()
+	defer fake.createAdminJobMutex.RUnlock()
+	argsForCall := fake.createAdminJobArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeAdminJobDB) CreateAdminJobReturns(result1 error) {
+	fake.createAdminJobMutex.Lock()
+	defer fake.createAdminJobMutex.Unlock()
+	fake.CreateAdminJobStub = nil
+	fake.createAdminJobReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAdminJobDB) CreateAdminJobReturnsOnCall(i int, result1 error) {
+	fake.createAdminJobMutex.Lock()
+	defer fake.createAdminJobMutex.Unlock()
+	fake.CreateAdminJobStub = nil
+	if fake.createAdminJobReturnsOnCall == nil {
+		fake.createAdminJobReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.createAdminJobReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAdminJobDB) FailUnfinishedAdminJobs(arg1 []string, arg2 string) (int64, error) {
+	var arg1Copy []string
+	if arg1 != nil {
+		arg1Copy = make([]string, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	fake.failUnfinishedAdminJobsMutex.Lock()
+	ret, specificReturn := fake.failUnfinishedAdminJobsReturnsOnCall[len(fake.failUnfinishedAdminJobsArgsForCall)]
+	fake.failUnfinishedAdminJobsArgsForCall = append(fake.failUnfinishedAdminJobsArgsForCall, struct {
+		arg1 []string
+		arg2 string
+	}{arg1Copy, arg2})
+	stub := fake.FailUnfinishedAdminJobsStub
+	fakeReturns := fake.failUnfinishedAdminJobsReturns
+	fake.recordInvocation("FailUnfinishedAdminJobs", []interface{}{arg1Copy, arg2})
+	fake.failUnfinishedAdminJobsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeAdminJobDB) FailUnfinishedAdminJobsCallCount() int {
+	fake.failUnfinishedAdminJobsMutex.RLock()
+	defer fake.failUnfinishedAdminJobsMutex.RUnlock()
+	return len(fake.failUnfinishedAdminJobsArgsForCall)
+}
+
+func (fake *FakeAdminJobDB) FailUnfinishedAdminJobsCalls(stub func([]string, string) (int64, error)) {
+	fake.failUnfinishedAdminJobsMutex.Lock()
+	defer fake.failUnfinishedAdminJobsMutex.Unlock()
+	fake.FailUnfinishedAdminJobsStub = stub
+}
+
+func (fake *FakeAdminJobDB) FailUnfinishedAdminJobsArgsForCall(i int) ([]string, string) {
+	fake.failUnfinishedAdminJobsMutex.RLock()
+	defer fake.failUnfinishedAdminJobsMutex.RUnlock()
+	argsForCall := fake.failUnfinishedAdminJobsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeAdminJobDB) FailUnfinishedAdminJobsReturns(result1 int64, result2 error) {
+	fake.failUnfinishedAdminJobsMutex.Lock()
+	defer fake.failUnfinishedAdminJobsMutex.Unlock()
+	fake.FailUnfinishedAdminJobsStub = nil
+	fake.failUnfinishedAdminJobsReturns = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAdminJobDB) FailUnfinishedAdminJobsReturnsOnCall(i int, result1 int64, result2 error) {
+	fake.failUnfinishedAdminJobsMutex.Lock()
+	defer fake.failUnfinishedAdminJobsMutex.Unlock()
+	fake.FailUnfinishedAdminJobsStub = nil
+	if fake.failUnfinishedAdminJobsReturnsOnCall == nil {
+		fake.failUnfinishedAdminJobsReturnsOnCall = make(map[int]struct {
+			result1 int64
+			result2 error
+		})
+	}
+	fake.failUnfinishedAdminJobsReturnsOnCall[i] = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAdminJobDB) GetAdminJob(arg1 string) (*db.AdminJob, error) {
+	fake.getAdminJobMutex.Lock()
+	ret, specificReturn := fake.getAdminJobReturnsOnCall[len(fake.getAdminJobArgsForCall)]
+	fake.getAdminJobArgsForCall = append(fake.getAdminJobArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.GetAdminJobStub
+	fakeReturns := fake.getAdminJobReturns
+	fake.recordInvocation("GetAdminJob", []interface{}{arg1})
+	fake.getAdminJobMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeAdminJobDB) GetAdminJobCallCount() int {
+	fake.getAdminJobMutex.RLock()
+	defer fake.getAdminJobMutex.RUnlock()
+	return len(fake.getAdminJobArgsForCall)
+}
+
+func (fake *FakeAdminJobDB) GetAdminJobCalls(stub func(string) (*db.AdminJob, error)) {
+	fake.getAdminJobMutex.Lock()
+	defer fake.getAdminJobMutex.Unlock()
+	fake.GetAdminJobStub = stub
+}
+
+func (fake *FakeAdminJobDB) GetAdminJobArgsForCall(i int) string {
+	fake.getAdminJobMutex.RLock()
+	defer fake.getAdminJobMutex.RUnlock()
+	argsForCall := fake.getAdminJobArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeAdminJobDB) GetAdminJobReturns(result1 *db.AdminJob, result2 error) {
+	fake.getAdminJobMutex.Lock()
+	defer fake.getAdminJobMutex.Unlock()
+	fake.GetAdminJobStub = nil
+	fake.getAdminJobReturns = struct {
+		result1 *db.AdminJob
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAdminJobDB) GetAdminJobReturnsOnCall(i int, result1 *db.AdminJob, result2 error) {
+	fake.getAdminJobMutex.Lock()
+	defer fake.getAdminJobMutex.Unlock()
+	fake.GetAdminJobStub = nil
+	if fake.getAdminJobReturnsOnCall == nil {
+		fake.getAdminJobReturnsOnCall = make(map[int]struct {
+			result1 *db.AdminJob
+			result2 error
+		})
+	}
+	fake.getAdminJobReturnsOnCall[i] = struct {
+		result1 *db.AdminJob
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAdminJobDB) UpdateAdminJob(arg1 db.AdminJob) error {
+	fake.updateAdminJobMutex.Lock()
+	ret, specificReturn := fake.updateAdminJobReturnsOnCall[len(fake.updateAdminJobArgsForCall)]
+	fake.updateAdminJobArgsForCall = append(fake.updateAdminJobArgsForCall, struct {
+		arg1 db.AdminJob
+	}{arg1})
+	stub := fake.UpdateAdminJobStub
+	fakeReturns := fake.updateAdminJobReturns
+	fake.recordInvocation("UpdateAdminJob", []interface{}{arg1})
+	fake.updateAdminJobMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeAdminJobDB) UpdateAdminJobCallCount() int {
+	fake.updateAdminJobMutex.RLock()
+	defer fake.updateAdminJobMutex.RUnlock()
+	return len(fake.updateAdminJobArgsForCall)
+}
+
+func (fake *FakeAdminJobDB) UpdateAdminJobCalls(stub func(db.AdminJob) error) {
+	fake.updateAdminJobMutex.Lock()
+	defer fake.updateAdminJobMutex.Unlock()
+	fake.UpdateAdminJobStub = stub
+}
+
+func (fake *FakeAdminJobDB) UpdateAdminJobArgsForCall(i int) db.AdminJob {
+	fake.updateAdminJobMutex.RLock()
+	defer fake.updateAdminJobMutex.RUnlock()
+	argsForCall := fake.updateAdminJobArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeAdminJobDB) UpdateAdminJobReturns(result1 error) {
+	fake.updateAdminJobMutex.Lock()
+	defer fake.updateAdminJobMutex.Unlock()
+	fake.UpdateAdminJobStub = nil
+	fake.updateAdminJobReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAdminJobDB) UpdateAdminJobReturnsOnCall(i int, result1 error) {
+	fake.updateAdminJobMutex.Lock()
+	defer fake.updateAdminJobMutex.Unlock()
+	fake.UpdateAdminJobStub = nil
+	if fake.updateAdminJobReturnsOnCall == nil {
+		fake.updateAdminJobReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.updateAdminJobReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAdminJobDB) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.createAdminJobMutex.RLock()
+	defer fake.createAdminJobMutex.RUnlock()
+	fake.failUnfinishedAdminJobsMutex.RLock()
+	defer fake.failUnfinishedAdminJobsMutex.RUnlock()
+	fake.getAdminJobMutex.RLock()
+	defer fake.getAdminJobMutex.RUnlock()
+	fake.updateAdminJobMutex.RLock()
+	defer fake.updateAdminJobMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeAdminJobDB) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ db.AdminJobDB = new(FakeAdminJobDB)
@@ -0,0 +1,344 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+type FakeArchiveDB struct {
+	GetEarliestCFEventTimeStub        func() (time.Time, error)
+	getEarliestCFEventTimeMutex       sync.RWMutex
+	getEarliestCFEventTimeArgsForCall []struct {
+	}
+	getEarliestCFEventTimeReturns struct {
+		result1 time.Time
+		result2 error
+	}
+	getEarliestCFEventTimeReturnsOnCall map[int]struct {
+		result1 time.Time
+		result2 error
+	}
+	GetShipperCursorStub        func(string) (*db.ShipperCursor, error)
+	getShipperCursorMutex       sync.RWMutex
+	getShipperCursorArgsForCall []struct {
+		arg1 string
+	}
+	getShipperCursorReturns struct {
+		result1 *db.ShipperCursor
+		result2 error
+	}
+	getShipperCursorReturnsOnCall map[int]struct {
+		result1 *db.ShipperCursor
+		result2 error
+	}
+	StreamCFAuditEventsStub        func(context.Context, db.EventQuery, func(event db.CFAuditEvent) error) error
+	streamCFAuditEventsMutex       sync.RWMutex
+	streamCFAuditEventsArgsForCall []struct {
+		arg1 context.Context
+		arg2 db.EventQuery
+		arg3 func(event db.CFAuditEvent) error
+	}
+	streamCFAuditEventsReturns struct {
+		result1 error
+	}
+	streamCFAuditEventsReturnsOnCall map[int]struct {
+		result1 error
+	}
+	UpdateShipperCursorStub        func(string, string, string) error
+	updateShipperCursorMutex       sync.RWMutex
+	updateShipperCursorArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}
+	updateShipperCursorReturns struct {
+		result1 error
+	}
+	updateShipperCursorReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeArchiveDB) GetEarliestCFEventTime() (time.Time, error) {
+	fake.getEarliestCFEventTimeMutex.Lock()
+	ret, specificReturn := fake.getEarliestCFEventTimeReturnsOnCall[len(fake.getEarliestCFEventTimeArgsForCall)]
+	fake.getEarliestCFEventTimeArgsForCall = append(fake.getEarliestCFEventTimeArgsForCall, struct {
+	}{})
+	stub := fake.GetEarliestCFEventTimeStub
+	fakeReturns := fake.getEarliestCFEventTimeReturns
+	fake.recordInvocation("GetEarliestCFEventTime", []interface{}{})
+	fake.getEarliestCFEventTimeMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeArchiveDB) GetEarliestCFEventTimeCallCount() int {
+	fake.getEarliestCFEventTimeMutex.RLock()
+	defer fake.getEarliestCFEventTimeMutex.RUnlock()
+	return len(fake.getEarliestCFEventTimeArgsForCall)
+}
+
+func (fake *FakeArchiveDB) GetEarliestCFEventTimeCalls(stub func() (time.Time, error)) {
+	fake.getEarliestCFEventTimeMutex.Lock()
+	defer fake.getEarliestCFEventTimeMutex.Unlock()
+	fake.GetEarliestCFEventTimeStub = stub
+}
+
+func (fake *FakeArchiveDB) GetEarliestCFEventTimeReturns(result1 time.Time, result2 error) {
+	fake.getEarliestCFEventTimeMutex.Lock()
+	defer fake.getEarliestCFEventTimeMutex.Unlock()
+	fake.GetEarliestCFEventTimeStub = nil
+	fake.getEarliestCFEventTimeReturns = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeArchiveDB) GetEarliestCFEventTimeReturnsOnCall(i int, result1 time.Time, result2 error) {
+	fake.getEarliestCFEventTimeMutex.Lock()
+	defer fake.getEarliestCFEventTimeMutex.Unlock()
+	fake.GetEarliestCFEventTimeStub = nil
+	if fake.getEarliestCFEventTimeReturnsOnCall == nil {
+		fake.getEarliestCFEventTimeReturnsOnCall = make(map[int]struct {
+			result1 time.Time
+			result2 error
+		})
+	}
+	fake.getEarliestCFEventTimeReturnsOnCall[i] = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeArchiveDB) GetShipperCursor(arg1 string) (*db.ShipperCursor, error) {
+	fake.getShipperCursorMutex.Lock()
+	ret, specificReturn := fake.getShipperCursorReturnsOnCall[len(fake.getShipperCursorArgsForCall)]
+	fake.getShipperCursorArgsForCall = append(fake.getShipperCursorArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.GetShipperCursorStub
+	fakeReturns := fake.getShipperCursorReturns
+	fake.recordInvocation("GetShipperCursor", []interface{}{arg1})
+	fake.getShipperCursorMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeArchiveDB) GetShipperCursorCallCount() int {
+	fake.getShipperCursorMutex.RLock()
+	defer fake.getShipperCursorMutex.RUnlock()
+	return len(fake.getShipperCursorArgsForCall)
+}
+
+func (fake *FakeArchiveDB) GetShipperCursorCalls(stub func(string) (*db.ShipperCursor, error)) {
+	fake.getShipperCursorMutex.Lock()
+	defer fake.getShipperCursorMutex.Unlock()
+	fake.GetShipperCursorStub = stub
+}
+
+func (fake *FakeArchiveDB) GetShipperCursorArgsForCall(i int) string {
+	fake.getShipperCursorMutex.RLock()
+	defer fake.getShipperCursorMutex.RUnlock()
+	argsForCall := fake.getShipperCursorArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeArchiveDB) GetShipperCursorReturns(result1 *db.ShipperCursor, result2 error) {
+	fake.getShipperCursorMutex.Lock()
+	defer fake.getShipperCursorMutex.Unlock()
+	fake.GetShipperCursorStub = nil
+	fake.getShipperCursorReturns = struct {
+		result1 *db.ShipperCursor
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeArchiveDB) GetShipperCursorReturnsOnCall(i int, result1 *db.ShipperCursor, result2 error) {
+	fake.getShipperCursorMutex.Lock()
+	defer fake.getShipperCursorMutex.Unlock()
+	fake.GetShipperCursorStub = nil
+	if fake.getShipperCursorReturnsOnCall == nil {
+		fake.getShipperCursorReturnsOnCall = make(map[int]struct {
+			result1 *db.ShipperCursor
+			result2 error
+		})
+	}
+	fake.getShipperCursorReturnsOnCall[i] = struct {
+		result1 *db.ShipperCursor
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeArchiveDB) StreamCFAuditEvents(arg1 context.Context, arg2 db.EventQuery, arg3 func(event db.CFAuditEvent) error) error {
+	fake.streamCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.streamCFAuditEventsReturnsOnCall[len(fake.streamCFAuditEventsArgsForCall)]
+	fake.streamCFAuditEventsArgsForCall = append(fake.streamCFAuditEventsArgsForCall, struct {
+		arg1 context.Context
+		arg2 db.EventQuery
+		arg3 func(event db.CFAuditEvent) error
+	}{arg1, arg2, arg3})
+	stub := fake.StreamCFAuditEventsStub
+	fakeReturns := fake.streamCFAuditEventsReturns
+	fake.recordInvocation("StreamCFAuditEvents", []interface{}{arg1, arg2, arg3})
+	fake.streamCFAuditEventsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeArchiveDB) StreamCFAuditEventsCallCount() int {
+	fake.streamCFAuditEventsMutex.RLock()
+	defer fake.streamCFAuditEventsMutex.RUnlock()
+	return len(fake.streamCFAuditEventsArgsForCall)
+}
+
+func (fake *FakeArchiveDB) StreamCFAuditEventsCalls(stub func(context.Context, db.EventQuery, func(event db.CFAuditEvent) error) error) {
+	fake.streamCFAuditEventsMutex.Lock()
+	defer fake.streamCFAuditEventsMutex.Unlock()
+	fake.StreamCFAuditEventsStub = stub
+}
+
+func (fake *FakeArchiveDB) StreamCFAuditEventsArgsForCall(i int) (context.Context, db.EventQuery, func(event db.CFAuditEvent) error) {
+	fake.streamCFAuditEventsMutex.RLock()
+	defer fake.streamCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.streamCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeArchiveDB) StreamCFAuditEventsReturns(result1 error) {
+	fake.streamCFAuditEventsMutex.Lock()
+	defer fake.streamCFAuditEventsMutex.Unlock()
+	fake.StreamCFAuditEventsStub = nil
+	fake.streamCFAuditEventsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeArchiveDB) StreamCFAuditEventsReturnsOnCall(i int, result1 error) {
+	fake.streamCFAuditEventsMutex.Lock()
+	defer fake.streamCFAuditEventsMutex.Unlock()
+	fake.StreamCFAuditEventsStub = nil
+	if fake.streamCFAuditEventsReturnsOnCall == nil {
+		fake.streamCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.streamCFAuditEventsReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeArchiveDB) UpdateShipperCursor(arg1 string, arg2 string, arg3 string) error {
+	fake.updateShipperCursorMutex.Lock()
+	ret, specificReturn := fake.updateShipperCursorReturnsOnCall[len(fake.updateShipperCursorArgsForCall)]
+	fake.updateShipperCursorArgsForCall = append(fake.updateShipperCursorArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}{arg1, arg2, arg3})
+	stub := fake.UpdateShipperCursorStub
+	fakeReturns := fake.updateShipperCursorReturns
+	fake.recordInvocation("UpdateShipperCursor", []interface{}{arg1, arg2, arg3})
+	fake.updateShipperCursorMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeArchiveDB) UpdateShipperCursorCallCount() int {
+	fake.updateShipperCursorMutex.RLock()
+	defer fake.updateShipperCursorMutex.RUnlock()
+	return len(fake.updateShipperCursorArgsForCall)
+}
+
+func (fake *FakeArchiveDB) UpdateShipperCursorCalls(stub func(string, string, string) error) {
+	fake.updateShipperCursorMutex.Lock()
+	defer fake.updateShipperCursorMutex.Unlock()
+	fake.UpdateShipperCursorStub = stub
+}
+
+func (fake *FakeArchiveDB) UpdateShipperCursorArgsForCall(i int) (string, string, string) {
+	fake.updateShipperCursorMutex.RLock()
+	defer fake.updateShipperCursorMutex.RUnlock()
+	argsForCall := fake.updateShipperCursorArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeArchiveDB) UpdateShipperCursorReturns(result1 error) {
+	fake.updateShipperCursorMutex.Lock()
+	defer fake.updateShipperCursorMutex.Unlock()
+	fake.UpdateShipperCursorStub = nil
+	fake.updateShipperCursorReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeArchiveDB) UpdateShipperCursorReturnsOnCall(i int, result1 error) {
+	fake.updateShipperCursorMutex.Lock()
+	defer fake.updateShipperCursorMutex.Unlock()
+	fake.UpdateShipperCursorStub = nil
+	if fake.updateShipperCursorReturnsOnCall == nil {
+		fake.updateShipperCursorReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.updateShipperCursorReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeArchiveDB) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.getEarliestCFEventTimeMutex.RLock()
+	defer fake.getEarliestCFEventTimeMutex.RUnlock()
+	fake.getShipperCursorMutex.RLock()
+	defer fake.getShipperCursorMutex.RUnlock()
+	fake.streamCFAuditEventsMutex.RLock()
+	defer fake.streamCFAuditEventsMutex.RUnlock()
+	fake.updateShipperCursorMutex.RLock()
+	defer fake.updateShipperCursorMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeArchiveDB) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ db.ArchiveDB = new(FakeArchiveDB)
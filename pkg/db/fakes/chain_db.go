@@ -0,0 +1,107 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+type FakeChainDB struct {
+	GetCFAuditEventChainHeadStub        func() (db.ChainHead, error)
+	getCFAuditEventChainHeadMutex       sync.RWMutex
+	getCFAuditEventChainHeadArgsForCall []struct {
+	}
+	getCFAuditEventChainHeadReturns struct {
+		result1 db.ChainHead
+		result2 error
+	}
+	getCFAuditEventChainHeadReturnsOnCall map[int]struct {
+		result1 db.ChainHead
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeChainDB) GetCFAuditEventChainHead() (db.ChainHead, error) {
+	fake.getCFAuditEventChainHeadMutex.Lock()
+	ret, specificReturn := fake.getCFAuditEventChainHeadReturnsOnCall[len(fake.getCFAuditEventChainHeadArgsForCall)]
+	fake.getCFAuditEventChainHeadArgsForCall = append(fake.getCFAuditEventChainHeadArgsForCall, struct {
+	}{})
+	stub := fake.GetCFAuditEventChainHeadStub
+	fakeReturns := fake.getCFAuditEventChainHeadReturns
+	fake.recordInvocation("GetCFAuditEventChainHead", []interface{}{})
+	fake.getCFAuditEventChainHeadMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeChainDB) GetCFAuditEventChainHeadCallCount() int {
+	fake.getCFAuditEventChainHeadMutex.RLock()
+	defer fake.getCFAuditEventChainHeadMutex.RUnlock()
+	return len(fake.getCFAuditEventChainHeadArgsForCall)
+}
+
+func (fake *FakeChainDB) GetCFAuditEventChainHeadCalls(stub func() (db.ChainHead, error)) {
+	fake.getCFAuditEventChainHeadMutex.Lock()
+	defer fake.getCFAuditEventChainHeadMutex.Unlock()
+	fake.GetCFAuditEventChainHeadStub = stub
+}
+
+func (fake *FakeChainDB) GetCFAuditEventChainHeadReturns(result1 db.ChainHead, result2 error) {
+	fake.getCFAuditEventChainHeadMutex.Lock()
+	defer fake.getCFAuditEventChainHeadMutex.Unlock()
+	fake.GetCFAuditEventChainHeadStub = nil
+	fake.getCFAuditEventChainHeadReturns = struct {
+		result1 db.ChainHead
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeChainDB) GetCFAuditEventChainHeadReturnsOnCall(i int, result1 db.ChainHead, result2 error) {
+	fake.getCFAuditEventChainHeadMutex.Lock()
+	defer fake.getCFAuditEventChainHeadMutex.Unlock()
+	fake.GetCFAuditEventChainHeadStub = nil
+	if fake.getCFAuditEventChainHeadReturnsOnCall == nil {
+		fake.getCFAuditEventChainHeadReturnsOnCall = make(map[int]struct {
+			result1 db.ChainHead
+			result2 error
+		})
+	}
+	fake.getCFAuditEventChainHeadReturnsOnCall[i] = struct {
+		result1 db.ChainHead
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeChainDB) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.getCFAuditEventChainHeadMutex.RLock()
+	defer fake.getCFAuditEventChainHeadMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeChainDB) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ db.ChainDB = new(FakeChainDB)
@@ -0,0 +1,417 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+type FakeDigestDB struct {
+	GetDigestStub        func(time.Time) (*db.Digest, error)
+	getDigestMutex       sync.RWMutex
+	getDigestArgsForCall []struct {
+		arg1 time.Time
+	}
+	getDigestReturns struct {
+		result1 *db.Digest
+		result2 error
+	}
+	getDigestReturnsOnCall map[int]struct {
+		result1 *db.Digest
+		result2 error
+	}
+	GetEarliestCFEventTimeStub        func() (time.Time, error)
+	getEarliestCFEventTimeMutex       sync.RWMutex
+	getEarliestCFEventTimeArgsForCall []struct {
+	}
+	getEarliestCFEventTimeReturns struct {
+		result1 time.Time
+		result2 error
+	}
+	getEarliestCFEventTimeReturnsOnCall map[int]struct {
+		result1 time.Time
+		result2 error
+	}
+	GetLatestDigestStub        func() (*db.Digest, error)
+	getLatestDigestMutex       sync.RWMutex
+	getLatestDigestArgsForCall []struct {
+	}
+	getLatestDigestReturns struct {
+		result1 *db.Digest
+		result2 error
+	}
+	getLatestDigestReturnsOnCall map[int]struct {
+		result1 *db.Digest
+		result2 error
+	}
+	StoreDigestStub        func(db.Digest) error
+	storeDigestMutex       sync.RWMutex
+	storeDigestArgsForCall []struct {
+		arg1 db.Digest
+	}
+	storeDigestReturns struct {
+		result1 error
+	}
+	storeDigestReturnsOnCall map[int]struct {
+		result1 error
+	}
+	StreamCFAuditEventHashesStub        func(context.Context, time.Time, time.Time, func(hash db.EventHash) error) (int64, error)
+	streamCFAuditEventHashesMutex       sync.RWMutex
+	streamCFAuditEventHashesArgsForCall []struct {
+		arg1 context.Context
+		arg2 time.Time
+		arg3 time.Time
+		arg4 func(hash db.EventHash) error
+	}
+	streamCFAuditEventHashesReturns struct {
+		result1 int64
+		result2 error
+	}
+	streamCFAuditEventHashesReturnsOnCall map[int]struct {
+		result1 int64
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeDigestDB) GetDigest(arg1 time.Time) (*db.Digest, error) {
+	fake.getDigestMutex.Lock()
+	ret, specificReturn := fake.getDigestReturnsOnCall[len(fake.getDigestArgsForCall)]
+	fake.getDigestArgsForCall = append(fake.getDigestArgsForCall, struct {
+		arg1 time.Time
+	}{arg1})
+	stub := fake.GetDigestStub
+	fakeReturns := fake.getDigestReturns
+	fake.recordInvocation("GetDigest", []interface{}{arg1})
+	fake.getDigestMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeDigestDB) GetDigestCallCount() int {
+	fake.getDigestMutex.RLock()
+	defer fake.getDigestMutex.RUnlock()
+	return len(fake.getDigestArgsForCall)
+}
+
+func (fake *FakeDigestDB) GetDigestCalls(stub func(time.Time) (*db.Digest, error)) {
+	fake.getDigestMutex.Lock()
+	defer fake.getDigestMutex.Unlock()
+	fake.GetDigestStub = stub
+}
+
+func (fake *FakeDigestDB) GetDigestArgsForCall(i int) time.Time {
+	fake.getDigestMutex.RLock()
+	defer fake.getDigestMutex.RUnlock()
+	argsForCall := fake.getDigestArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDigestDB) GetDigestReturns(result1 *db.Digest, result2 error) {
+	fake.getDigestMutex.Lock()
+	defer fake.getDigestMutex.Unlock()
+	fake.GetDigestStub = nil
+	fake.getDigestReturns = struct {
+		result1 *db.Digest
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDigestDB) GetDigestReturnsOnCall(i int, result1 *db.Digest, result2 error) {
+	fake.getDigestMutex.Lock()
+	defer fake.getDigestMutex.Unlock()
+	fake.GetDigestStub = nil
+	if fake.getDigestReturnsOnCall == nil {
+		fake.getDigestReturnsOnCall = make(map[int]struct {
+			result1 *db.Digest
+			result2 error
+		})
+	}
+	fake.getDigestReturnsOnCall[i] = struct {
+		result1 *db.Digest
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDigestDB) GetEarliestCFEventTime() (time.Time, error) {
+	fake.getEarliestCFEventTimeMutex.Lock()
+	ret, specificReturn := fake.getEarliestCFEventTimeReturnsOnCall[len(fake.getEarliestCFEventTimeArgsForCall)]
+	fake.getEarliestCFEventTimeArgsForCall = append(fake.getEarliestCFEventTimeArgsForCall, struct {
+	}{})
+	stub := fake.GetEarliestCFEventTimeStub
+	fakeReturns := fake.getEarliestCFEventTimeReturns
+	fake.recordInvocation("GetEarliestCFEventTime", []interface{}{})
+	fake.getEarliestCFEventTimeMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeDigestDB) GetEarliestCFEventTimeCallCount() int {
+	fake.getEarliestCFEventTimeMutex.RLock()
+	defer fake.getEarliestCFEventTimeMutex.RUnlock()
+	return len(fake.getEarliestCFEventTimeArgsForCall)
+}
+
+func (fake *FakeDigestDB) GetEarliestCFEventTimeCalls(stub func() (time.Time, error)) {
+	fake.getEarliestCFEventTimeMutex.Lock()
+	defer fake.getEarliestCFEventTimeMutex.Unlock()
+	fake.GetEarliestCFEventTimeStub = stub
+}
+
+func (fake *FakeDigestDB) GetEarliestCFEventTimeReturns(result1 time.Time, result2 error) {
+	fake.getEarliestCFEventTimeMutex.Lock()
+	defer fake.getEarliestCFEventTimeMutex.Unlock()
+	fake.GetEarliestCFEventTimeStub = nil
+	fake.getEarliestCFEventTimeReturns = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDigestDB) GetEarliestCFEventTimeReturnsOnCall(i int, result1 time.Time, result2 error) {
+	fake.getEarliestCFEventTimeMutex.Lock()
+	defer fake.getEarliestCFEventTimeMutex.Unlock()
+	fake.GetEarliestCFEventTimeStub = nil
+	if fake.getEarliestCFEventTimeReturnsOnCall == nil {
+		fake.getEarliestCFEventTimeReturnsOnCall = make(map[int]struct {
+			result1 time.Time
+			result2 error
+		})
+	}
+	fake.getEarliestCFEventTimeReturnsOnCall[i] = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDigestDB) GetLatestDigest() (*db.Digest, error) {
+	fake.getLatestDigestMutex.Lock()
+	ret, specificReturn := fake.getLatestDigestReturnsOnCall[len(fake.getLatestDigestArgsForCall)]
+	fake.getLatestDigestArgsForCall = append(fake.getLatestDigestArgsForCall, struct {
+	}{})
+	stub := fake.GetLatestDigestStub
+	fakeReturns := fake.getLatestDigestReturns
+	fake.recordInvocation("GetLatestDigest", []interface{}{})
+	fake.getLatestDigestMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeDigestDB) GetLatestDigestCallCount() int {
+	fake.getLatestDigestMutex.RLock()
+	defer fake.getLatestDigestMutex.RUnlock()
+	return len(fake.getLatestDigestArgsForCall)
+}
+
+func (fake *FakeDigestDB) GetLatestDigestCalls(stub func() (*db.Digest, error)) {
+	fake.getLatestDigestMutex.Lock()
+	defer fake.getLatestDigestMutex.Unlock()
+	fake.GetLatestDigestStub = stub
+}
+
+func (fake *FakeDigestDB) GetLatestDigestReturns(result1 *db.Digest, result2 error) {
+	fake.getLatestDigestMutex.Lock()
+	defer fake.getLatestDigestMutex.Unlock()
+	fake.GetLatestDigestStub = nil
+	fake.getLatestDigestReturns = struct {
+		result1 *db.Digest
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDigestDB) GetLatestDigestReturnsOnCall(i int, result1 *db.Digest, result2 error) {
+	fake.getLatestDigestMutex.Lock()
+	defer fake.getLatestDigestMutex.Unlock()
+	fake.GetLatestDigestStub = nil
+	if fake.getLatestDigestReturnsOnCall == nil {
+		fake.getLatestDigestReturnsOnCall = make(map[int]struct {
+			result1 *db.Digest
+			result2 error
+		})
+	}
+	fake.getLatestDigestReturnsOnCall[i] = struct {
+		result1 *db.Digest
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDigestDB) StoreDigest(arg1 db.Digest) error {
+	fake.storeDigestMutex.Lock()
+	ret, specificReturn := fake.storeDigestReturnsOnCall[len(fake.storeDigestArgsForCall)]
+	fake.storeDigestArgsForCall = append(fake.storeDigestArgsForCall, struct {
+		arg1 db.Digest
+	}{arg1})
+	stub := fake.StoreDigestStub
+	fakeReturns := fake.storeDigestReturns
+	fake.recordInvocation("StoreDigest", []interface{}{arg1})
+	fake.storeDigestMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDigestDB) StoreDigestCallCount() int {
+	fake.storeDigestMutex.RLock()
+	defer fake.storeDigestMutex.RUnlock()
+	return len(fake.storeDigestArgsForCall)
+}
+
+func (fake *FakeDigestDB) StoreDigestCalls(stub func(db.Digest) error) {
+	fake.storeDigestMutex.Lock()
+	defer fake.storeDigestMutex.Unlock()
+	fake.StoreDigestStub = stub
+}
+
+func (fake *FakeDigestDB) StoreDigestArgsForCall(i int) db.Digest {
+	fake.storeDigestMutex.RLock()
+	defer fake.storeDigestMutex.RUnlock()
+	argsForCall := fake.storeDigestArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDigestDB) StoreDigestReturns(result1 error) {
+	fake.storeDigestMutex.Lock()
+	defer fake.storeDigestMutex.Unlock()
+	fake.StoreDigestStub = nil
+	fake.storeDigestReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDigestDB) StoreDigestReturnsOnCall(i int, result1 error) {
+	fake.storeDigestMutex.Lock()
+	defer fake.storeDigestMutex.Unlock()
+	fake.StoreDigestStub = nil
+	if fake.storeDigestReturnsOnCall == nil {
+		fake.storeDigestReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.storeDigestReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDigestDB) StreamCFAuditEventHashes(arg1 context.Context, arg2 time.Time, arg3 time.Time, arg4 func(hash db.EventHash) error) (int64, error) {
+	fake.streamCFAuditEventHashesMutex.Lock()
+	ret, specificReturn := fake.streamCFAuditEventHashesReturnsOnCall[len(fake.streamCFAuditEventHashesArgsForCall)]
+	fake.streamCFAuditEventHashesArgsForCall = append(fake.streamCFAuditEventHashesArgsForCall, struct {
+		arg1 context.Context
+		arg2 time.Time
+		arg3 time.Time
+		arg4 func(hash db.EventHash) error
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.StreamCFAuditEventHashesStub
+	fakeReturns := fake.streamCFAuditEventHashesReturns
+	fake.recordInvocation("StreamCFAuditEventHashes", []interface{}{arg1, arg2, arg3, arg4})
+	fake.streamCFAuditEventHashesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeDigestDB) StreamCFAuditEventHashesCallCount() int {
+	fake.streamCFAuditEventHashesMutex.RLock()
+	defer fake.streamCFAuditEventHashesMutex.RUnlock()
+	return len(fake.streamCFAuditEventHashesArgsForCall)
+}
+
+func (fake *FakeDigestDB) StreamCFAuditEventHashesCalls(stub func(context.Context, time.Time, time.Time, func(hash db.EventHash) error) (int64, error)) {
+	fake.streamCFAuditEventHashesMutex.Lock()
+	defer fake.streamCFAuditEventHashesMutex.Unlock()
+	fake.StreamCFAuditEventHashesStub = stub
+}
+
+func (fake *FakeDigestDB) StreamCFAuditEventHashesArgsForCall(i int) (context.Context, time.Time, time.Time, func(hash db.EventHash) error) {
+	fake.streamCFAuditEventHashesMutex.RLock()
+	defer fake.streamCFAuditEventHashesMutex.RUnlock()
+	argsForCall := fake.streamCFAuditEventHashesArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeDigestDB) StreamCFAuditEventHashesReturns(result1 int64, result2 error) {
+	fake.streamCFAuditEventHashesMutex.Lock()
+	defer fake.streamCFAuditEventHashesMutex.Unlock()
+	fake.StreamCFAuditEventHashesStub = nil
+	fake.streamCFAuditEventHashesReturns = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDigestDB) StreamCFAuditEventHashesReturnsOnCall(i int, result1 int64, result2 error) {
+	fake.streamCFAuditEventHashesMutex.Lock()
+	defer fake.streamCFAuditEventHashesMutex.Unlock()
+	fake.StreamCFAuditEventHashesStub = nil
+	if fake.streamCFAuditEventHashesReturnsOnCall == nil {
+		fake.streamCFAuditEventHashesReturnsOnCall = make(map[int]struct {
+			result1 int64
+			result2 error
+		})
+	}
+	fake.streamCFAuditEventHashesReturnsOnCall[i] = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDigestDB) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.getDigestMutex.RLock()
+	defer fake.getDigestMutex.RUnlock()
+	fake.getEarliestCFEventTimeMutex.RLock()
+	defer fake.getEarliestCFEventTimeMutex.RUnlock()
+	fake.getLatestDigestMutex.RLock()
+	defer fake.getLatestDigestMutex.RUnlock()
+	fake.storeDigestMutex.RLock()
+	defer fake.storeDigestMutex.RUnlock()
+	fake.streamCFAuditEventHashesMutex.RLock()
+	defer fake.streamCFAuditEventHashesMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeDigestDB) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ db.DigestDB = new(FakeDigestDB)
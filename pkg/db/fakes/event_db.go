@@ -2,6 +2,7 @@
 package fakes
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -10,17 +11,31 @@ import (
 )
 
 type FakeEventDB struct {
-	GetCFAuditEventsStub        func(db.RawEventFilter) ([]cfclient.Event, error)
+	DeleteCompletedBackfillCheckpointsStub        func(string, time.Time) (int64, error)
+	deleteCompletedBackfillCheckpointsMutex       sync.RWMutex
+	deleteCompletedBackfillCheckpointsArgsForCall []struct {
+		arg1 string
+		arg2 time.Time
+	}
+	deleteCompletedBackfillCheckpointsReturns struct {
+		result1 int64
+		result2 error
+	}
+	deleteCompletedBackfillCheckpointsReturnsOnCall map[int]struct {
+		result1 int64
+		result2 error
+	}
+	GetCFAuditEventsStub        func(db.RawEventFilter) ([]db.CFAuditEvent, error)
 	getCFAuditEventsMutex       sync.RWMutex
 	getCFAuditEventsArgsForCall []struct {
 		arg1 db.RawEventFilter
 	}
 	getCFAuditEventsReturns struct {
-		result1 []cfclient.Event
+		result1 []db.CFAuditEvent
 		result2 error
 	}
 	getCFAuditEventsReturnsOnCall map[int]struct {
-		result1 []cfclient.Event
+		result1 []db.CFAuditEvent
 		result2 error
 	}
 	GetCFEventCountStub        func() (int64, error)
@@ -35,9 +50,37 @@ type FakeEventDB struct {
 		result1 int64
 		result2 error
 	}
-	GetLatestCFEventTimeStub        func() (time.Time, error)
+	GetCollectorWatermarkStub        func(string, string) (db.CollectorWatermark, error)
+	getCollectorWatermarkMutex       sync.RWMutex
+	getCollectorWatermarkArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	getCollectorWatermarkReturns struct {
+		result1 db.CollectorWatermark
+		result2 error
+	}
+	getCollectorWatermarkReturnsOnCall map[int]struct {
+		result1 db.CollectorWatermark
+		result2 error
+	}
+	GetIncompleteBackfillCheckpointsStub        func(string) ([]db.BackfillCheckpoint, error)
+	getIncompleteBackfillCheckpointsMutex       sync.RWMutex
+	getIncompleteBackfillCheckpointsArgsForCall []struct {
+		arg1 string
+	}
+	getIncompleteBackfillCheckpointsReturns struct {
+		result1 []db.BackfillCheckpoint
+		result2 error
+	}
+	getIncompleteBackfillCheckpointsReturnsOnCall map[int]struct {
+		result1 []db.BackfillCheckpoint
+		result2 error
+	}
+	GetLatestCFEventTimeStub        func(string) (time.Time, error)
 	getLatestCFEventTimeMutex       sync.RWMutex
 	getLatestCFEventTimeArgsForCall []struct {
+		arg1 string
 	}
 	getLatestCFEventTimeReturns struct {
 		result1 time.Time
@@ -47,17 +90,32 @@ type FakeEventDB struct {
 		result1 time.Time
 		result2 error
 	}
-	GetUnshippedCFAuditEventsForShipperStub        func(string) ([]cfclient.Event, error)
+	GetQuarantinedCFAuditEventsStub        func(string) ([]db.QuarantinedCFAuditEvent, error)
+	getQuarantinedCFAuditEventsMutex       sync.RWMutex
+	getQuarantinedCFAuditEventsArgsForCall []struct {
+		arg1 string
+	}
+	getQuarantinedCFAuditEventsReturns struct {
+		result1 []db.QuarantinedCFAuditEvent
+		result2 error
+	}
+	getQuarantinedCFAuditEventsReturnsOnCall map[int]struct {
+		result1 []db.QuarantinedCFAuditEvent
+		result2 error
+	}
+	GetUnshippedCFAuditEventsForShipperStub        func(string, string, int) ([]db.CFAuditEvent, error)
 	getUnshippedCFAuditEventsForShipperMutex       sync.RWMutex
 	getUnshippedCFAuditEventsForShipperArgsForCall []struct {
 		arg1 string
+		arg2 string
+		arg3 int
 	}
 	getUnshippedCFAuditEventsForShipperReturns struct {
-		result1 []cfclient.Event
+		result1 []db.CFAuditEvent
 		result2 error
 	}
 	getUnshippedCFAuditEventsForShipperReturnsOnCall map[int]struct {
-		result1 []cfclient.Event
+		result1 []db.CFAuditEvent
 		result2 error
 	}
 	InitStub        func() error
@@ -70,15 +128,89 @@ type FakeEventDB struct {
 	initReturnsOnCall map[int]struct {
 		result1 error
 	}
-	StoreCFAuditEventsStub        func([]cfclient.Event) error
+	MarkCFAuditEventsReprocessedStub        func([]int64) error
+	markCFAuditEventsReprocessedMutex       sync.RWMutex
+	markCFAuditEventsReprocessedArgsForCall []struct {
+		arg1 []int64
+	}
+	markCFAuditEventsReprocessedReturns struct {
+		result1 error
+	}
+	markCFAuditEventsReprocessedReturnsOnCall map[int]struct {
+		result1 error
+	}
+	QuarantineCFAuditEventsStub        func(string, []db.QuarantinedCFAuditEvent) error
+	quarantineCFAuditEventsMutex       sync.RWMutex
+	quarantineCFAuditEventsArgsForCall []struct {
+		arg1 string
+		arg2 []db.QuarantinedCFAuditEvent
+	}
+	quarantineCFAuditEventsReturns struct {
+		result1 error
+	}
+	quarantineCFAuditEventsReturnsOnCall map[int]struct {
+		result1 error
+	}
+	QueryCFAuditEventsStub        func(db.EventQuery) (db.EventPage, error)
+	queryCFAuditEventsMutex       sync.RWMutex
+	queryCFAuditEventsArgsForCall []struct {
+		arg1 db.EventQuery
+	}
+	queryCFAuditEventsReturns struct {
+		result1 db.EventPage
+		result2 error
+	}
+	queryCFAuditEventsReturnsOnCall map[int]struct {
+		result1 db.EventPage
+		result2 error
+	}
+	StoreCFAuditEventsStub        func(string, []cfclient.Event) (db.StoreResult, error)
 	storeCFAuditEventsMutex       sync.RWMutex
 	storeCFAuditEventsArgsForCall []struct {
-		arg1 []cfclient.Event
+		arg1 string
+		arg2 []cfclient.Event
 	}
 	storeCFAuditEventsReturns struct {
-		result1 error
+		result1 db.StoreResult
+		result2 error
 	}
 	storeCFAuditEventsReturnsOnCall map[int]struct {
+		result1 db.StoreResult
+		result2 error
+	}
+	StreamCFAuditEventsStub        func(context.Context, db.EventQuery, func(event db.CFAuditEvent) error) error
+	streamCFAuditEventsMutex       sync.RWMutex
+	streamCFAuditEventsArgsForCall []struct {
+		arg1 context.Context
+		arg2 db.EventQuery
+		arg3 func(event db.CFAuditEvent) error
+	}
+	streamCFAuditEventsReturns struct {
+		result1 error
+	}
+	streamCFAuditEventsReturnsOnCall map[int]struct {
+		result1 error
+	}
+	UpdateBackfillCheckpointStub        func(db.BackfillCheckpoint) error
+	updateBackfillCheckpointMutex       sync.RWMutex
+	updateBackfillCheckpointArgsForCall []struct {
+		arg1 db.BackfillCheckpoint
+	}
+	updateBackfillCheckpointReturns struct {
+		result1 error
+	}
+	updateBackfillCheckpointReturnsOnCall map[int]struct {
+		result1 error
+	}
+	UpdateCollectorWatermarkStub        func(db.CollectorWatermark) error
+	updateCollectorWatermarkMutex       sync.RWMutex
+	updateCollectorWatermarkArgsForCall []struct {
+		arg1 db.CollectorWatermark
+	}
+	updateCollectorWatermarkReturns struct {
+		result1 error
+	}
+	updateCollectorWatermarkReturnsOnCall map[int]struct {
 		result1 error
 	}
 	UpdateShipperCursorStub        func(string, string, string) error
@@ -98,7 +230,72 @@ type FakeEventDB struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeEventDB) GetCFAuditEvents(arg1 db.RawEventFilter) ([]cfclient.Event, error) {
+func (fake *FakeEventDB) DeleteCompletedBackfillCheckpoints(arg1 string, arg2 time.Time) (int64, error) {
+	fake.deleteCompletedBackfillCheckpointsMutex.Lock()
+	ret, specificReturn := fake.deleteCompletedBackfillCheckpointsReturnsOnCall[len(fake.deleteCompletedBackfillCheckpointsArgsForCall)]
+	fake.deleteCompletedBackfillCheckpointsArgsForCall = append(fake.deleteCompletedBackfillCheckpointsArgsForCall, struct {
+		arg1 string
+		arg2 time.Time
+	}{arg1, arg2})
+	stub := fake.DeleteCompletedBackfillCheckpointsStub
+	fakeReturns := fake.deleteCompletedBackfillCheckpointsReturns
+	fake.recordInvocation("DeleteCompletedBackfillCheckpoints", []interface{}{arg1, arg2})
+	fake.deleteCompletedBackfillCheckpointsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) DeleteCompletedBackfillCheckpointsCallCount() int {
+	fake.deleteCompletedBackfillCheckpointsMutex.RLock()
+	defer fake.deleteCompletedBackfillCheckpointsMutex.RUnlock()
+	return len(fake.deleteCompletedBackfillCheckpointsArgsForCall)
+}
+
+func (fake *FakeEventDB) DeleteCompletedBackfillCheckpointsCalls(stub func(string, time.Time) (int64, error)) {
+	fake.deleteCompletedBackfillCheckpointsMutex.Lock()
+	defer fake.deleteCompletedBackfillCheckpointsMutex.Unlock()
+	fake.DeleteCompletedBackfillCheckpointsStub = stub
+}
+
+func (fake *FakeEventDB) DeleteCompletedBackfillCheckpointsArgsForCall(i int) (string, time.Time) {
+	fake.deleteCompletedBackfillCheckpointsMutex.RLock()
+	defer fake.deleteCompletedBackfillCheckpointsMutex.RUnlock()
+	argsForCall := fake.deleteCompletedBackfillCheckpointsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeEventDB) DeleteCompletedBackfillCheckpointsReturns(result1 int64, result2 error) {
+	fake.deleteCompletedBackfillCheckpointsMutex.Lock()
+	defer fake.deleteCompletedBackfillCheckpointsMutex.Unlock()
+	fake.DeleteCompletedBackfillCheckpointsStub = nil
+	fake.deleteCompletedBackfillCheckpointsReturns = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) DeleteCompletedBackfillCheckpointsReturnsOnCall(i int, result1 int64, result2 error) {
+	fake.deleteCompletedBackfillCheckpointsMutex.Lock()
+	defer fake.deleteCompletedBackfillCheckpointsMutex.Unlock()
+	fake.DeleteCompletedBackfillCheckpointsStub = nil
+	if fake.deleteCompletedBackfillCheckpointsReturnsOnCall == nil {
+		fake.deleteCompletedBackfillCheckpointsReturnsOnCall = make(map[int]struct {
+			result1 int64
+			result2 error
+		})
+	}
+	fake.deleteCompletedBackfillCheckpointsReturnsOnCall[i] = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFAuditEvents(arg1 db.RawEventFilter) ([]db.CFAuditEvent, error) {
 	fake.getCFAuditEventsMutex.Lock()
 	ret, specificReturn := fake.getCFAuditEventsReturnsOnCall[len(fake.getCFAuditEventsArgsForCall)]
 	fake.getCFAuditEventsArgsForCall = append(fake.getCFAuditEventsArgsForCall, struct {
@@ -123,7 +320,7 @@ func (fake *FakeEventDB) GetCFAuditEventsCallCount() int {
 	return len(fake.getCFAuditEventsArgsForCall)
 }
 
-func (fake *FakeEventDB) GetCFAuditEventsCalls(stub func(db.RawEventFilter) ([]cfclient.Event, error)) {
+func (fake *FakeEventDB) GetCFAuditEventsCalls(stub func(db.RawEventFilter) ([]db.CFAuditEvent, error)) {
 	fake.getCFAuditEventsMutex.Lock()
 	defer fake.getCFAuditEventsMutex.Unlock()
 	fake.GetCFAuditEventsStub = stub
@@ -136,28 +333,28 @@ func (fake *FakeEventDB) GetCFAuditEventsArgsForCall(i int) db.RawEventFilter {
 	return argsForCall.arg1
 }
 
-func (fake *FakeEventDB) GetCFAuditEventsReturns(result1 []cfclient.Event, result2 error) {
+func (fake *FakeEventDB) GetCFAuditEventsReturns(result1 []db.CFAuditEvent, result2 error) {
 	fake.getCFAuditEventsMutex.Lock()
 	defer fake.getCFAuditEventsMutex.Unlock()
 	fake.GetCFAuditEventsStub = nil
 	fake.getCFAuditEventsReturns = struct {
-		result1 []cfclient.Event
+		result1 []db.CFAuditEvent
 		result2 error
 	}{result1, result2}
 }
 
-func (fake *FakeEventDB) GetCFAuditEventsReturnsOnCall(i int, result1 []cfclient.Event, result2 error) {
+func (fake *FakeEventDB) GetCFAuditEventsReturnsOnCall(i int, result1 []db.CFAuditEvent, result2 error) {
 	fake.getCFAuditEventsMutex.Lock()
 	defer fake.getCFAuditEventsMutex.Unlock()
 	fake.GetCFAuditEventsStub = nil
 	if fake.getCFAuditEventsReturnsOnCall == nil {
 		fake.getCFAuditEventsReturnsOnCall = make(map[int]struct {
-			result1 []cfclient.Event
+			result1 []db.CFAuditEvent
 			result2 error
 		})
 	}
 	fake.getCFAuditEventsReturnsOnCall[i] = struct {
-		result1 []cfclient.Event
+		result1 []db.CFAuditEvent
 		result2 error
 	}{result1, result2}
 }
@@ -218,17 +415,147 @@ func (fake *FakeEventDB) GetCFEventCountReturnsOnCall(i int, result1 int64, resu
 	}{result1, result2}
 }
 
-func (fake *FakeEventDB) GetLatestCFEventTime() (time.Time, error) {
+func (fake *FakeEventDB) GetCollectorWatermark(arg1 string, arg2 string) (db.CollectorWatermark, error) {
+	fake.getCollectorWatermarkMutex.Lock()
+	ret, specificReturn := fake.getCollectorWatermarkReturnsOnCall[len(fake.getCollectorWatermarkArgsForCall)]
+	fake.getCollectorWatermarkArgsForCall = append(fake.getCollectorWatermarkArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.GetCollectorWatermarkStub
+	fakeReturns := fake.getCollectorWatermarkReturns
+	fake.recordInvocation("GetCollectorWatermark", []interface{}{arg1, arg2})
+	fake.getCollectorWatermarkMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetCollectorWatermarkCallCount() int {
+	fake.getCollectorWatermarkMutex.RLock()
+	defer fake.getCollectorWatermarkMutex.RUnlock()
+	return len(fake.getCollectorWatermarkArgsForCall)
+}
+
+func (fake *FakeEventDB) GetCollectorWatermarkCalls(stub func(string, string) (db.CollectorWatermark, error)) {
+	fake.getCollectorWatermarkMutex.Lock()
+	defer fake.getCollectorWatermarkMutex.Unlock()
+	fake.GetCollectorWatermarkStub = stub
+}
+
+func (fake *FakeEventDB) GetCollectorWatermarkArgsForCall(i int) (string, string) {
+	fake.getCollectorWatermarkMutex.RLock()
+	defer fake.getCollectorWatermarkMutex.RUnlock()
+	argsForCall := fake.getCollectorWatermarkArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeEventDB) GetCollectorWatermarkReturns(result1 db.CollectorWatermark, result2 error) {
+	fake.getCollectorWatermarkMutex.Lock()
+	defer fake.getCollectorWatermarkMutex.Unlock()
+	fake.GetCollectorWatermarkStub = nil
+	fake.getCollectorWatermarkReturns = struct {
+		result1 db.CollectorWatermark
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCollectorWatermarkReturnsOnCall(i int, result1 db.CollectorWatermark, result2 error) {
+	fake.getCollectorWatermarkMutex.Lock()
+	defer fake.getCollectorWatermarkMutex.Unlock()
+	fake.GetCollectorWatermarkStub = nil
+	if fake.getCollectorWatermarkReturnsOnCall == nil {
+		fake.getCollectorWatermarkReturnsOnCall = make(map[int]struct {
+			result1 db.CollectorWatermark
+			result2 error
+		})
+	}
+	fake.getCollectorWatermarkReturnsOnCall[i] = struct {
+		result1 db.CollectorWatermark
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetIncompleteBackfillCheckpoints(arg1 string) ([]db.BackfillCheckpoint, error) {
+	fake.getIncompleteBackfillCheckpointsMutex.Lock()
+	ret, specificReturn := fake.getIncompleteBackfillCheckpointsReturnsOnCall[len(fake.getIncompleteBackfillCheckpointsArgsForCall)]
+	fake.getIncompleteBackfillCheckpointsArgsForCall = append(fake.getIncompleteBackfillCheckpointsArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.GetIncompleteBackfillCheckpointsStub
+	fakeReturns := fake.getIncompleteBackfillCheckpointsReturns
+	fake.recordInvocation("GetIncompleteBackfillCheckpoints", []interface{}{arg1})
+	fake.getIncompleteBackfillCheckpointsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetIncompleteBackfillCheckpointsCallCount() int {
+	fake.getIncompleteBackfillCheckpointsMutex.RLock()
+	defer fake.getIncompleteBackfillCheckpointsMutex.RUnlock()
+	return len(fake.getIncompleteBackfillCheckpointsArgsForCall)
+}
+
+func (fake *FakeEventDB) GetIncompleteBackfillCheckpointsCalls(stub func(string) ([]db.BackfillCheckpoint, error)) {
+	fake.getIncompleteBackfillCheckpointsMutex.Lock()
+	defer fake.getIncompleteBackfillCheckpointsMutex.Unlock()
+	fake.GetIncompleteBackfillCheckpointsStub = stub
+}
+
+func (fake *FakeEventDB) GetIncompleteBackfillCheckpointsArgsForCall(i int) string {
+	fake.getIncompleteBackfillCheckpointsMutex.RLock()
+	defer fake.getIncompleteBackfillCheckpointsMutex.RUnlock()
+	argsForCall := fake.getIncompleteBackfillCheckpointsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) GetIncompleteBackfillCheckpointsReturns(result1 []db.BackfillCheckpoint, result2 error) {
+	fake.getIncompleteBackfillCheckpointsMutex.Lock()
+	defer fake.getIncompleteBackfillCheckpointsMutex.Unlock()
+	fake.GetIncompleteBackfillCheckpointsStub = nil
+	fake.getIncompleteBackfillCheckpointsReturns = struct {
+		result1 []db.BackfillCheckpoint
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetIncompleteBackfillCheckpointsReturnsOnCall(i int, result1 []db.BackfillCheckpoint, result2 error) {
+	fake.getIncompleteBackfillCheckpointsMutex.Lock()
+	defer fake.getIncompleteBackfillCheckpointsMutex.Unlock()
+	fake.GetIncompleteBackfillCheckpointsStub = nil
+	if fake.getIncompleteBackfillCheckpointsReturnsOnCall == nil {
+		fake.getIncompleteBackfillCheckpointsReturnsOnCall = make(map[int]struct {
+			result1 []db.BackfillCheckpoint
+			result2 error
+		})
+	}
+	fake.getIncompleteBackfillCheckpointsReturnsOnCall[i] = struct {
+		result1 []db.BackfillCheckpoint
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetLatestCFEventTime(arg1 string) (time.Time, error) {
 	fake.getLatestCFEventTimeMutex.Lock()
 	ret, specificReturn := fake.getLatestCFEventTimeReturnsOnCall[len(fake.getLatestCFEventTimeArgsForCall)]
 	fake.getLatestCFEventTimeArgsForCall = append(fake.getLatestCFEventTimeArgsForCall, struct {
-	}{})
+		arg1 string
+	}{arg1})
 	stub := fake.GetLatestCFEventTimeStub
 	fakeReturns := fake.getLatestCFEventTimeReturns
-	fake.recordInvocation("GetLatestCFEventTime", []interface{}{})
+	fake.recordInvocation("GetLatestCFEventTime", []interface{}{arg1})
 	fake.getLatestCFEventTimeMutex.Unlock()
 	if stub != nil {
-		return stub()
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -242,12 +569,19 @@ func (fake *FakeEventDB) GetLatestCFEventTimeCallCount() int {
 	return len(fake.getLatestCFEventTimeArgsForCall)
 }
 
-func (fake *FakeEventDB) GetLatestCFEventTimeCalls(stub func() (time.Time, error)) {
+func (fake *FakeEventDB) GetLatestCFEventTimeCalls(stub func(string) (time.Time, error)) {
 	fake.getLatestCFEventTimeMutex.Lock()
 	defer fake.getLatestCFEventTimeMutex.Unlock()
 	fake.GetLatestCFEventTimeStub = stub
 }
 
+func (fake *FakeEventDB) GetLatestCFEventTimeArgsForCall(i int) string {
+	fake.getLatestCFEventTimeMutex.RLock()
+	defer fake.getLatestCFEventTimeMutex.RUnlock()
+	argsForCall := fake.getLatestCFEventTimeArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeEventDB) GetLatestCFEventTimeReturns(result1 time.Time, result2 error) {
 	fake.getLatestCFEventTimeMutex.Lock()
 	defer fake.getLatestCFEventTimeMutex.Unlock()
@@ -274,18 +608,84 @@ func (fake *FakeEventDB) GetLatestCFEventTimeReturnsOnCall(i int, result1 time.T
 	}{result1, result2}
 }
 
-func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipper(arg1 string) ([]cfclient.Event, error) {
+func (fake *FakeEventDB) GetQuarantinedCFAuditEvents(arg1 string) ([]db.QuarantinedCFAuditEvent, error) {
+	fake.getQuarantinedCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.getQuarantinedCFAuditEventsReturnsOnCall[len(fake.getQuarantinedCFAuditEventsArgsForCall)]
+	fake.getQuarantinedCFAuditEventsArgsForCall = append(fake.getQuarantinedCFAuditEventsArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.GetQuarantinedCFAuditEventsStub
+	fakeReturns := fake.getQuarantinedCFAuditEventsReturns
+	fake.recordInvocation("GetQuarantinedCFAuditEvents", []interface{}{arg1})
+	fake.getQuarantinedCFAuditEventsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetQuarantinedCFAuditEventsCallCount() int {
+	fake.getQuarantinedCFAuditEventsMutex.RLock()
+	defer fake.getQuarantinedCFAuditEventsMutex.RUnlock()
+	return len(fake.getQuarantinedCFAuditEventsArgsForCall)
+}
+
+func (fake *FakeEventDB) GetQuarantinedCFAuditEventsCalls(stub func(string) ([]db.QuarantinedCFAuditEvent, error)) {
+	fake.getQuarantinedCFAuditEventsMutex.Lock()
+	defer fake.getQuarantinedCFAuditEventsMutex.Unlock()
+	fake.GetQuarantinedCFAuditEventsStub = stub
+}
+
+func (fake *FakeEventDB) GetQuarantinedCFAuditEventsArgsForCall(i int) string {
+	fake.getQuarantinedCFAuditEventsMutex.RLock()
+	defer fake.getQuarantinedCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.getQuarantinedCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) GetQuarantinedCFAuditEventsReturns(result1 []db.QuarantinedCFAuditEvent, result2 error) {
+	fake.getQuarantinedCFAuditEventsMutex.Lock()
+	defer fake.getQuarantinedCFAuditEventsMutex.Unlock()
+	fake.GetQuarantinedCFAuditEventsStub = nil
+	fake.getQuarantinedCFAuditEventsReturns = struct {
+		result1 []db.QuarantinedCFAuditEvent
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetQuarantinedCFAuditEventsReturnsOnCall(i int, result1 []db.QuarantinedCFAuditEvent, result2 error) {
+	fake.getQuarantinedCFAuditEventsMutex.Lock()
+	defer fake.getQuarantinedCFAuditEventsMutex.Unlock()
+	fake.GetQuarantinedCFAuditEventsStub = nil
+	if fake.getQuarantinedCFAuditEventsReturnsOnCall == nil {
+		fake.getQuarantinedCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 []db.QuarantinedCFAuditEvent
+			result2 error
+		})
+	}
+	fake.getQuarantinedCFAuditEventsReturnsOnCall[i] = struct {
+		result1 []db.QuarantinedCFAuditEvent
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipper(arg1 string, arg2 string, arg3 int) ([]db.CFAuditEvent, error) {
 	fake.getUnshippedCFAuditEventsForShipperMutex.Lock()
 	ret, specificReturn := fake.getUnshippedCFAuditEventsForShipperReturnsOnCall[len(fake.getUnshippedCFAuditEventsForShipperArgsForCall)]
 	fake.getUnshippedCFAuditEventsForShipperArgsForCall = append(fake.getUnshippedCFAuditEventsForShipperArgsForCall, struct {
 		arg1 string
-	}{arg1})
+		arg2 string
+		arg3 int
+	}{arg1, arg2, arg3})
 	stub := fake.GetUnshippedCFAuditEventsForShipperStub
 	fakeReturns := fake.getUnshippedCFAuditEventsForShipperReturns
-	fake.recordInvocation("GetUnshippedCFAuditEventsForShipper", []interface{}{arg1})
+	fake.recordInvocation("GetUnshippedCFAuditEventsForShipper", []interface{}{arg1, arg2, arg3})
 	fake.getUnshippedCFAuditEventsForShipperMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2, arg3)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -299,41 +699,41 @@ func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperCallCount() int {
 	return len(fake.getUnshippedCFAuditEventsForShipperArgsForCall)
 }
 
-func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperCalls(stub func(string) ([]cfclient.Event, error)) {
+func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperCalls(stub func(string, string, int) ([]db.CFAuditEvent, error)) {
 	fake.getUnshippedCFAuditEventsForShipperMutex.Lock()
 	defer fake.getUnshippedCFAuditEventsForShipperMutex.Unlock()
 	fake.GetUnshippedCFAuditEventsForShipperStub = stub
 }
 
-func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperArgsForCall(i int) string {
+func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperArgsForCall(i int) (string, string, int) {
 	fake.getUnshippedCFAuditEventsForShipperMutex.RLock()
 	defer fake.getUnshippedCFAuditEventsForShipperMutex.RUnlock()
 	argsForCall := fake.getUnshippedCFAuditEventsForShipperArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
 }
 
-func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperReturns(result1 []cfclient.Event, result2 error) {
+func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperReturns(result1 []db.CFAuditEvent, result2 error) {
 	fake.getUnshippedCFAuditEventsForShipperMutex.Lock()
 	defer fake.getUnshippedCFAuditEventsForShipperMutex.Unlock()
 	fake.GetUnshippedCFAuditEventsForShipperStub = nil
 	fake.getUnshippedCFAuditEventsForShipperReturns = struct {
-		result1 []cfclient.Event
+		result1 []db.CFAuditEvent
 		result2 error
 	}{result1, result2}
 }
 
-func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperReturnsOnCall(i int, result1 []cfclient.Event, result2 error) {
+func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperReturnsOnCall(i int, result1 []db.CFAuditEvent, result2 error) {
 	fake.getUnshippedCFAuditEventsForShipperMutex.Lock()
 	defer fake.getUnshippedCFAuditEventsForShipperMutex.Unlock()
 	fake.GetUnshippedCFAuditEventsForShipperStub = nil
 	if fake.getUnshippedCFAuditEventsForShipperReturnsOnCall == nil {
 		fake.getUnshippedCFAuditEventsForShipperReturnsOnCall = make(map[int]struct {
-			result1 []cfclient.Event
+			result1 []db.CFAuditEvent
 			result2 error
 		})
 	}
 	fake.getUnshippedCFAuditEventsForShipperReturnsOnCall[i] = struct {
-		result1 []cfclient.Event
+		result1 []db.CFAuditEvent
 		result2 error
 	}{result1, result2}
 }
@@ -391,28 +791,226 @@ func (fake *FakeEventDB) InitReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeEventDB) StoreCFAuditEvents(arg1 []cfclient.Event) error {
-	var arg1Copy []cfclient.Event
+func (fake *FakeEventDB) MarkCFAuditEventsReprocessed(arg1 []int64) error {
+	var arg1Copy []int64
 	if arg1 != nil {
-		arg1Copy = make([]cfclient.Event, len(arg1))
+		arg1Copy = make([]int64, len(arg1))
 		copy(arg1Copy, arg1)
 	}
+	fake.markCFAuditEventsReprocessedMutex.Lock()
+	ret, specificReturn := fake.markCFAuditEventsReprocessedReturnsOnCall[len(fake.markCFAuditEventsReprocessedArgsForCall)]
+	fake.markCFAuditEventsReprocessedArgsForCall = append(fake.markCFAuditEventsReprocessedArgsForCall, struct {
+		arg1 []int64
+	}{arg1Copy})
+	stub := fake.MarkCFAuditEventsReprocessedStub
+	fakeReturns := fake.markCFAuditEventsReprocessedReturns
+	fake.recordInvocation("MarkCFAuditEventsReprocessed", []interface{}{arg1Copy})
+	fake.markCFAuditEventsReprocessedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeEventDB) MarkCFAuditEventsReprocessedCallCount() int {
+	fake.markCFAuditEventsReprocessedMutex.RLock()
+	defer fake.markCFAuditEventsReprocessedMutex.RUnlock()
+	return len(fake.markCFAuditEventsReprocessedArgsForCall)
+}
+
+func (fake *FakeEventDB) MarkCFAuditEventsReprocessedCalls(stub func([]int64) error) {
+	fake.markCFAuditEventsReprocessedMutex.Lock()
+	defer fake.markCFAuditEventsReprocessedMutex.Unlock()
+	fake.MarkCFAuditEventsReprocessedStub = stub
+}
+
+func (fake *FakeEventDB) MarkCFAuditEventsReprocessedArgsForCall(i int) []int64 {
+	fake.markCFAuditEventsReprocessedMutex.RLock()
+	defer fake.markCFAuditEventsReprocessedMutex.RUnlock()
+	argsForCall := fake.markCFAuditEventsReprocessedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) MarkCFAuditEventsReprocessedReturns(result1 error) {
+	fake.markCFAuditEventsReprocessedMutex.Lock()
+	defer fake.markCFAuditEventsReprocessedMutex.Unlock()
+	fake.MarkCFAuditEventsReprocessedStub = nil
+	fake.markCFAuditEventsReprocessedReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) MarkCFAuditEventsReprocessedReturnsOnCall(i int, result1 error) {
+	fake.markCFAuditEventsReprocessedMutex.Lock()
+	defer fake.markCFAuditEventsReprocessedMutex.Unlock()
+	fake.MarkCFAuditEventsReprocessedStub = nil
+	if fake.markCFAuditEventsReprocessedReturnsOnCall == nil {
+		fake.markCFAuditEventsReprocessedReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.markCFAuditEventsReprocessedReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) QuarantineCFAuditEvents(arg1 string, arg2 []db.QuarantinedCFAuditEvent) error {
+	var arg2Copy []db.QuarantinedCFAuditEvent
+	if arg2 != nil {
+		arg2Copy = make([]db.QuarantinedCFAuditEvent, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.quarantineCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.quarantineCFAuditEventsReturnsOnCall[len(fake.quarantineCFAuditEventsArgsForCall)]
+	fake.quarantineCFAuditEventsArgsForCall = append(fake.quarantineCFAuditEventsArgsForCall, struct {
+		arg1 string
+		arg2 []db.QuarantinedCFAuditEvent
+	}{arg1, arg2Copy})
+	stub := fake.QuarantineCFAuditEventsStub
+	fakeReturns := fake.quarantineCFAuditEventsReturns
+	fake.recordInvocation("QuarantineCFAuditEvents", []interface{}{arg1, arg2Copy})
+	fake.quarantineCFAuditEventsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeEventDB) QuarantineCFAuditEventsCallCount() int {
+	fake.quarantineCFAuditEventsMutex.RLock()
+	defer fake.quarantineCFAuditEventsMutex.RUnlock()
+	return len(fake.quarantineCFAuditEventsArgsForCall)
+}
+
+func (fake *FakeEventDB) QuarantineCFAuditEventsCalls(stub func(string, []db.QuarantinedCFAuditEvent) error) {
+	fake.quarantineCFAuditEventsMutex.Lock()
+	defer fake.quarantineCFAuditEventsMutex.Unlock()
+	fake.QuarantineCFAuditEventsStub = stub
+}
+
+func (fake *FakeEventDB) QuarantineCFAuditEventsArgsForCall(i int) (string, []db.QuarantinedCFAuditEvent) {
+	fake.quarantineCFAuditEventsMutex.RLock()
+	defer fake.quarantineCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.quarantineCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeEventDB) QuarantineCFAuditEventsReturns(result1 error) {
+	fake.quarantineCFAuditEventsMutex.Lock()
+	defer fake.quarantineCFAuditEventsMutex.Unlock()
+	fake.QuarantineCFAuditEventsStub = nil
+	fake.quarantineCFAuditEventsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) QuarantineCFAuditEventsReturnsOnCall(i int, result1 error) {
+	fake.quarantineCFAuditEventsMutex.Lock()
+	defer fake.quarantineCFAuditEventsMutex.Unlock()
+	fake.QuarantineCFAuditEventsStub = nil
+	if fake.quarantineCFAuditEventsReturnsOnCall == nil {
+		fake.quarantineCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.quarantineCFAuditEventsReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) QueryCFAuditEvents(arg1 db.EventQuery) (db.EventPage, error) {
+	fake.queryCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.queryCFAuditEventsReturnsOnCall[len(fake.queryCFAuditEventsArgsForCall)]
+	fake.queryCFAuditEventsArgsForCall = append(fake.queryCFAuditEventsArgsForCall, struct {
+		arg1 db.EventQuery
+	}{arg1})
+	stub := fake.QueryCFAuditEventsStub
+	fakeReturns := fake.queryCFAuditEventsReturns
+	fake.recordInvocation("QueryCFAuditEvents", []interface{}{arg1})
+	fake.queryCFAuditEventsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) QueryCFAuditEventsCallCount() int {
+	fake.queryCFAuditEventsMutex.RLock()
+	defer fake.queryCFAuditEventsMutex.RUnlock()
+	return len(fake.queryCFAuditEventsArgsForCall)
+}
+
+func (fake *FakeEventDB) QueryCFAuditEventsCalls(stub func(db.EventQuery) (db.EventPage, error)) {
+	fake.queryCFAuditEventsMutex.Lock()
+	defer fake.queryCFAuditEventsMutex.Unlock()
+	fake.QueryCFAuditEventsStub = stub
+}
+
+func (fake *FakeEventDB) QueryCFAuditEventsArgsForCall(i int) db.EventQuery {
+	fake.queryCFAuditEventsMutex.RLock()
+	defer fake.queryCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.queryCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) QueryCFAuditEventsReturns(result1 db.EventPage, result2 error) {
+	fake.queryCFAuditEventsMutex.Lock()
+	defer fake.queryCFAuditEventsMutex.Unlock()
+	fake.QueryCFAuditEventsStub = nil
+	fake.queryCFAuditEventsReturns = struct {
+		result1 db.EventPage
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) QueryCFAuditEventsReturnsOnCall(i int, result1 db.EventPage, result2 error) {
+	fake.queryCFAuditEventsMutex.Lock()
+	defer fake.queryCFAuditEventsMutex.Unlock()
+	fake.QueryCFAuditEventsStub = nil
+	if fake.queryCFAuditEventsReturnsOnCall == nil {
+		fake.queryCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 db.EventPage
+			result2 error
+		})
+	}
+	fake.queryCFAuditEventsReturnsOnCall[i] = struct {
+		result1 db.EventPage
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) StoreCFAuditEvents(arg1 string, arg2 []cfclient.Event) (db.StoreResult, error) {
+	var arg2Copy []cfclient.Event
+	if arg2 != nil {
+		arg2Copy = make([]cfclient.Event, len(arg2))
+		copy(arg2Copy, arg2)
+	}
 	fake.storeCFAuditEventsMutex.Lock()
 	ret, specificReturn := fake.storeCFAuditEventsReturnsOnCall[len(fake.storeCFAuditEventsArgsForCall)]
 	fake.storeCFAuditEventsArgsForCall = append(fake.storeCFAuditEventsArgsForCall, struct {
-		arg1 []cfclient.Event
-	}{arg1Copy})
+		arg1 string
+		arg2 []cfclient.Event
+	}{arg1, arg2Copy})
 	stub := fake.StoreCFAuditEventsStub
 	fakeReturns := fake.storeCFAuditEventsReturns
-	fake.recordInvocation("StoreCFAuditEvents", []interface{}{arg1Copy})
+	fake.recordInvocation("StoreCFAuditEvents", []interface{}{arg1, arg2Copy})
 	fake.storeCFAuditEventsMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
-		return ret.result1
+		return ret.result1, ret.result2
 	}
-	return fakeReturns.result1
+	return fakeReturns.result1, fakeReturns.result2
 }
 
 func (fake *FakeEventDB) StoreCFAuditEventsCallCount() int {
@@ -421,38 +1019,226 @@ func (fake *FakeEventDB) StoreCFAuditEventsCallCount() int {
 	return len(fake.storeCFAuditEventsArgsForCall)
 }
 
-func (fake *FakeEventDB) StoreCFAuditEventsCalls(stub func([]cfclient.Event) error) {
+func (fake *FakeEventDB) StoreCFAuditEventsCalls(stub func(string, []cfclient.Event) (db.StoreResult, error)) {
 	fake.storeCFAuditEventsMutex.Lock()
 	defer fake.storeCFAuditEventsMutex.Unlock()
 	fake.StoreCFAuditEventsStub = stub
 }
 
-func (fake *FakeEventDB) StoreCFAuditEventsArgsForCall(i int) []cfclient.Event {
+func (fake *FakeEventDB) StoreCFAuditEventsArgsForCall(i int) (string, []cfclient.Event) {
 	fake.storeCFAuditEventsMutex.RLock()
 	defer fake.storeCFAuditEventsMutex.RUnlock()
 	argsForCall := fake.storeCFAuditEventsArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
-func (fake *FakeEventDB) StoreCFAuditEventsReturns(result1 error) {
+func (fake *FakeEventDB) StoreCFAuditEventsReturns(result1 db.StoreResult, result2 error) {
 	fake.storeCFAuditEventsMutex.Lock()
 	defer fake.storeCFAuditEventsMutex.Unlock()
 	fake.StoreCFAuditEventsStub = nil
 	fake.storeCFAuditEventsReturns = struct {
-		result1 error
-	}{result1}
+		result1 db.StoreResult
+		result2 error
+	}{result1, result2}
 }
 
-func (fake *FakeEventDB) StoreCFAuditEventsReturnsOnCall(i int, result1 error) {
+func (fake *FakeEventDB) StoreCFAuditEventsReturnsOnCall(i int, result1 db.StoreResult, result2 error) {
 	fake.storeCFAuditEventsMutex.Lock()
 	defer fake.storeCFAuditEventsMutex.Unlock()
 	fake.StoreCFAuditEventsStub = nil
 	if fake.storeCFAuditEventsReturnsOnCall == nil {
 		fake.storeCFAuditEventsReturnsOnCall = make(map[int]struct {
-			result1 error
+			result1 db.StoreResult
+			result2 error
 		})
 	}
 	fake.storeCFAuditEventsReturnsOnCall[i] = struct {
+		result1 db.StoreResult
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) StreamCFAuditEvents(arg1 context.Context, arg2 db.EventQuery, arg3 func(event db.CFAuditEvent) error) error {
+	fake.streamCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.streamCFAuditEventsReturnsOnCall[len(fake.streamCFAuditEventsArgsForCall)]
+	fake.streamCFAuditEventsArgsForCall = append(fake.streamCFAuditEventsArgsForCall, struct {
+		arg1 context.Context
+		arg2 db.EventQuery
+		arg3 func(event db.CFAuditEvent) error
+	}{arg1, arg2, arg3})
+	stub := fake.StreamCFAuditEventsStub
+	fakeReturns := fake.streamCFAuditEventsReturns
+	fake.recordInvocation("StreamCFAuditEvents", []interface{}{arg1, arg2, arg3})
+	fake.streamCFAuditEventsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeEventDB) StreamCFAuditEventsCallCount() int {
+	fake.streamCFAuditEventsMutex.RLock()
+	defer fake.streamCFAuditEventsMutex.RUnlock()
+	return len(fake.streamCFAuditEventsArgsForCall)
+}
+
+func (fake *FakeEventDB) StreamCFAuditEventsCalls(stub func(context.Context, db.EventQuery, func(event db.CFAuditEvent) error) error) {
+	fake.streamCFAuditEventsMutex.Lock()
+	defer fake.streamCFAuditEventsMutex.Unlock()
+	fake.StreamCFAuditEventsStub = stub
+}
+
+func (fake *FakeEventDB) StreamCFAuditEventsArgsForCall(i int) (context.Context, db.EventQuery, func(event db.CFAuditEvent) error) {
+	fake.streamCFAuditEventsMutex.RLock()
+	defer fake.streamCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.streamCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeEventDB) StreamCFAuditEventsReturns(result1 error) {
+	fake.streamCFAuditEventsMutex.Lock()
+	defer fake.streamCFAuditEventsMutex.Unlock()
+	fake.StreamCFAuditEventsStub = nil
+	fake.streamCFAuditEventsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) StreamCFAuditEventsReturnsOnCall(i int, result1 error) {
+	fake.streamCFAuditEventsMutex.Lock()
+	defer fake.streamCFAuditEventsMutex.Unlock()
+	fake.StreamCFAuditEventsStub = nil
+	if fake.streamCFAuditEventsReturnsOnCall == nil {
+		fake.streamCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.streamCFAuditEventsReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) UpdateBackfillCheckpoint(arg1 db.BackfillCheckpoint) error {
+	fake.updateBackfillCheckpointMutex.Lock()
+	ret, specificReturn := fake.updateBackfillCheckpointReturnsOnCall[len(fake.updateBackfillCheckpointArgsForCall)]
+	fake.updateBackfillCheckpointArgsForCall = append(fake.updateBackfillCheckpointArgsForCall, struct {
+		arg1 db.BackfillCheckpoint
+	}{arg1})
+	stub := fake.UpdateBackfillCheckpointStub
+	fakeReturns := fake.updateBackfillCheckpointReturns
+	fake.recordInvocation("UpdateBackfillCheckpoint", []interface{}{arg1})
+	fake.updateBackfillCheckpointMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeEventDB) UpdateBackfillCheckpointCallCount() int {
+	fake.updateBackfillCheckpointMutex.RLock()
+	defer fake.updateBackfillCheckpointMutex.RUnlock()
+	return len(fake.updateBackfillCheckpointArgsForCall)
+}
+
+func (fake *FakeEventDB) UpdateBackfillCheckpointCalls(stub func(db.BackfillCheckpoint) error) {
+	fake.updateBackfillCheckpointMutex.Lock()
+	defer fake.updateBackfillCheckpointMutex.Unlock()
+	fake.UpdateBackfillCheckpointStub = stub
+}
+
+func (fake *FakeEventDB) UpdateBackfillCheckpointArgsForCall(i int) db.BackfillCheckpoint {
+	fake.updateBackfillCheckpointMutex.RLock()
+	defer fake.updateBackfillCheckpointMutex.RUnlock()
+	argsForCall := fake.updateBackfillCheckpointArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) UpdateBackfillCheckpointReturns(result1 error) {
+	fake.updateBackfillCheckpointMutex.Lock()
+	defer fake.updateBackfillCheckpointMutex.Unlock()
+	fake.UpdateBackfillCheckpointStub = nil
+	fake.updateBackfillCheckpointReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) UpdateBackfillCheckpointReturnsOnCall(i int, result1 error) {
+	fake.updateBackfillCheckpointMutex.Lock()
+	defer fake.updateBackfillCheckpointMutex.Unlock()
+	fake.UpdateBackfillCheckpointStub = nil
+	if fake.updateBackfillCheckpointReturnsOnCall == nil {
+		fake.updateBackfillCheckpointReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.updateBackfillCheckpointReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) UpdateCollectorWatermark(arg1 db.CollectorWatermark) error {
+	fake.updateCollectorWatermarkMutex.Lock()
+	ret, specificReturn := fake.updateCollectorWatermarkReturnsOnCall[len(fake.updateCollectorWatermarkArgsForCall)]
+	fake.updateCollectorWatermarkArgsForCall = append(fake.updateCollectorWatermarkArgsForCall, struct {
+		arg1 db.CollectorWatermark
+	}{arg1})
+	stub := fake.UpdateCollectorWatermarkStub
+	fakeReturns := fake.updateCollectorWatermarkReturns
+	fake.recordInvocation("UpdateCollectorWatermark", []interface{}{arg1})
+	fake.updateCollectorWatermarkMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeEventDB) UpdateCollectorWatermarkCallCount() int {
+	fake.updateCollectorWatermarkMutex.RLock()
+	defer fake.updateCollectorWatermarkMutex.RUnlock()
+	return len(fake.updateCollectorWatermarkArgsForCall)
+}
+
+func (fake *FakeEventDB) UpdateCollectorWatermarkCalls(stub func(db.CollectorWatermark) error) {
+	fake.updateCollectorWatermarkMutex.Lock()
+	defer fake.updateCollectorWatermarkMutex.Unlock()
+	fake.UpdateCollectorWatermarkStub = stub
+}
+
+func (fake *FakeEventDB) UpdateCollectorWatermarkArgsForCall(i int) db.CollectorWatermark {
+	fake.updateCollectorWatermarkMutex.RLock()
+	defer fake.updateCollectorWatermarkMutex.RUnlock()
+	argsForCall := fake.updateCollectorWatermarkArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) UpdateCollectorWatermarkReturns(result1 error) {
+	fake.updateCollectorWatermarkMutex.Lock()
+	defer fake.updateCollectorWatermarkMutex.Unlock()
+	fake.UpdateCollectorWatermarkStub = nil
+	fake.updateCollectorWatermarkReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) UpdateCollectorWatermarkReturnsOnCall(i int, result1 error) {
+	fake.updateCollectorWatermarkMutex.Lock()
+	defer fake.updateCollectorWatermarkMutex.Unlock()
+	fake.UpdateCollectorWatermarkStub = nil
+	if fake.updateCollectorWatermarkReturnsOnCall == nil {
+		fake.updateCollectorWatermarkReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.updateCollectorWatermarkReturnsOnCall[i] = struct {
 		result1 error
 	}{result1}
 }
@@ -523,18 +1309,38 @@ func (fake *FakeEventDB) UpdateShipperCursorReturnsOnCall(i int, result1 error)
 func (fake *FakeEventDB) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.deleteCompletedBackfillCheckpointsMutex.RLock()
+	defer fake.deleteCompletedBackfillCheckpointsMutex.RUnlock()
 	fake.getCFAuditEventsMutex.RLock()
 	defer fake.getCFAuditEventsMutex.RUnlock()
 	fake.getCFEventCountMutex.RLock()
 	defer fake.getCFEventCountMutex.RUnlock()
+	fake.getCollectorWatermarkMutex.RLock()
+	defer fake.getCollectorWatermarkMutex.RUnlock()
+	fake.getIncompleteBackfillCheckpointsMutex.RLock()
+	defer fake.getIncompleteBackfillCheckpointsMutex.RUnlock()
 	fake.getLatestCFEventTimeMutex.RLock()
 	defer fake.getLatestCFEventTimeMutex.RUnlock()
+	fake.getQuarantinedCFAuditEventsMutex.RLock()
+	defer fake.getQuarantinedCFAuditEventsMutex.RUnlock()
 	fake.getUnshippedCFAuditEventsForShipperMutex.RLock()
 	defer fake.getUnshippedCFAuditEventsForShipperMutex.RUnlock()
 	fake.initMutex.RLock()
 	defer fake.initMutex.RUnlock()
+	fake.markCFAuditEventsReprocessedMutex.RLock()
+	defer fake.markCFAuditEventsReprocessedMutex.RUnlock()
+	fake.quarantineCFAuditEventsMutex.RLock()
+	defer fake.quarantineCFAuditEventsMutex.RUnlock()
+	fake.queryCFAuditEventsMutex.RLock()
+	defer fake.queryCFAuditEventsMutex.RUnlock()
 	fake.storeCFAuditEventsMutex.RLock()
 	defer fake.storeCFAuditEventsMutex.RUnlock()
+	fake.streamCFAuditEventsMutex.RLock()
+	defer fake.streamCFAuditEventsMutex.RUnlock()
+	fake.updateBackfillCheckpointMutex.RLock()
+	defer fake.updateBackfillCheckpointMutex.RUnlock()
+	fake.updateCollectorWatermarkMutex.RLock()
+	defer fake.updateCollectorWatermarkMutex.RUnlock()
 	fake.updateShipperCursorMutex.RLock()
 	defer fake.updateShipperCursorMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
@@ -0,0 +1,198 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+type FakeNameHistoryDB struct {
+	RecordOrganizationNameStub        func(string, string, string, time.Time) error
+	recordOrganizationNameMutex       sync.RWMutex
+	recordOrganizationNameArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 string
+		arg4 time.Time
+	}
+	recordOrganizationNameReturns struct {
+		result1 error
+	}
+	recordOrganizationNameReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RecordSpaceNameStub        func(string, string, string, time.Time) error
+	recordSpaceNameMutex       sync.RWMutex
+	recordSpaceNameArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 string
+		arg4 time.Time
+	}
+	recordSpaceNameReturns struct {
+		result1 error
+	}
+	recordSpaceNameReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeNameHistoryDB) RecordOrganizationName(arg1 string, arg2 string, arg3 string, arg4 time.Time) error {
+	fake.recordOrganizationNameMutex.Lock()
+	ret, specificReturn := fake.recordOrganizationNameReturnsOnCall[len(fake.recordOrganizationNameArgsForCall)]
+	fake.recordOrganizationNameArgsForCall = append(fake.recordOrganizationNameArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 string
+		arg4 time.Time
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.RecordOrganizationNameStub
+	fakeReturns := fake.recordOrganizationNameReturns
+	fake.recordInvocation("RecordOrganizationName", []interface{}{arg1, arg2, arg3, arg4})
+	fake.recordOrganizationNameMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeNameHistoryDB) RecordOrganizationNameCallCount() int {
+	fake.recordOrganizationNameMutex.RLock()
+	defer fake.recordOrganizationNameMutex.RUnlock()
+	return len(fake.recordOrganizationNameArgsForCall)
+}
+
+func (fake *FakeNameHistoryDB) RecordOrganizationNameCalls(stub func(string, string, string, time.Time) error) {
+	fake.recordOrganizationNameMutex.Lock()
+	defer fake.recordOrganizationNameMutex.Unlock()
+	fake.RecordOrganizationNameStub = stub
+}
+
+func (fake *FakeNameHistoryDB) RecordOrganizationNameArgsForCall(i int) (string, string, string, time.Time) {
+	fake.recordOrganizationNameMutex.RLock()
+	defer fake.recordOrganizationNameMutex.RUnlock()
+	argsForCall := fake.recordOrganizationNameArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeNameHistoryDB) RecordOrganizationNameReturns(result1 error) {
+	fake.recordOrganizationNameMutex.Lock()
+	defer fake.recordOrganizationNameMutex.Unlock()
+	fake.RecordOrganizationNameStub = nil
+	fake.recordOrganizationNameReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeNameHistoryDB) RecordOrganizationNameReturnsOnCall(i int, result1 error) {
+	fake.recordOrganizationNameMutex.Lock()
+	defer fake.recordOrganizationNameMutex.Unlock()
+	fake.RecordOrganizationNameStub = nil
+	if fake.recordOrganizationNameReturnsOnCall == nil {
+		fake.recordOrganizationNameReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.recordOrganizationNameReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeNameHistoryDB) RecordSpaceName(arg1 string, arg2 string, arg3 string, arg4 time.Time) error {
+	fake.recordSpaceNameMutex.Lock()
+	ret, specificReturn := fake.recordSpaceNameReturnsOnCall[len(fake.recordSpaceNameArgsForCall)]
+	fake.recordSpaceNameArgsForCall = append(fake.recordSpaceNameArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 string
+		arg4 time.Time
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.RecordSpaceNameStub
+	fakeReturns := fake.recordSpaceNameReturns
+	fake.recordInvocation("RecordSpaceName", []interface{}{arg1, arg2, arg3, arg4})
+	fake.recordSpaceNameMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeNameHistoryDB) RecordSpaceNameCallCount() int {
+	fake.recordSpaceNameMutex.RLock()
+	defer fake.recordSpaceNameMutex.RUnlock()
+	return len(fake.recordSpaceNameArgsForCall)
+}
+
+func (fake *FakeNameHistoryDB) RecordSpaceNameCalls(stub func(string, string, string, time.Time) error) {
+	fake.recordSpaceNameMutex.Lock()
+	defer fake.recordSpaceNameMutex.Unlock()
+	fake.RecordSpaceNameStub = stub
+}
+
+func (fake *FakeNameHistoryDB) RecordSpaceNameArgsForCall(i int) (string, string, string, time.Time) {
+	fake.recordSpaceNameMutex.RLock()
+	defer fake.recordSpaceNameMutex.RUnlock()
+	argsForCall := fake.recordSpaceNameArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeNameHistoryDB) RecordSpaceNameReturns(result1 error) {
+	fake.recordSpaceNameMutex.Lock()
+	defer fake.recordSpaceNameMutex.Unlock()
+	fake.RecordSpaceNameStub = nil
+	fake.recordSpaceNameReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeNameHistoryDB) RecordSpaceNameReturnsOnCall(i int, result1 error) {
+	fake.recordSpaceNameMutex.Lock()
+	defer fake.recordSpaceNameMutex.Unlock()
+	fake.RecordSpaceNameStub = nil
+	if fake.recordSpaceNameReturnsOnCall == nil {
+		fake.recordSpaceNameReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.recordSpaceNameReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeNameHistoryDB) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.recordOrganizationNameMutex.RLock()
+	defer fake.recordOrganizationNameMutex.RUnlock()
+	fake.recordSpaceNameMutex.RLock()
+	defer fake.recordSpaceNameMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeNameHistoryDB) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ db.NameHistoryDB = new(FakeNameHistoryDB)
@@ -0,0 +1,342 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+type FakePartitionDB struct {
+	CreateCFAuditEventPartitionStub        func(time.Time) (bool, error)
+	createCFAuditEventPartitionMutex       sync.RWMutex
+	createCFAuditEventPartitionArgsForCall []struct {
+		arg1 time.Time
+	}
+	createCFAuditEventPartitionReturns struct {
+		result1 bool
+		result2 error
+	}
+	createCFAuditEventPartitionReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
+	GetCFAuditEventPartitionsStub        func() ([]db.Partition, error)
+	getCFAuditEventPartitionsMutex       sync.RWMutex
+	getCFAuditEventPartitionsArgsForCall []struct {
+	}
+	getCFAuditEventPartitionsReturns struct {
+		result1 []db.Partition
+		result2 error
+	}
+	getCFAuditEventPartitionsReturnsOnCall map[int]struct {
+		result1 []db.Partition
+		result2 error
+	}
+	RecordRetentionRunStub        func(db.RetentionRun) error
+	recordRetentionRunMutex       sync.RWMutex
+	recordRetentionRunArgsForCall []struct {
+		arg1 db.RetentionRun
+	}
+	recordRetentionRunReturns struct {
+		result1 error
+	}
+	recordRetentionRunReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RetireCFAuditEventPartitionStub        func(db.Partition, db.RetentionAction) (int64, error)
+	retireCFAuditEventPartitionMutex       sync.RWMutex
+	retireCFAuditEventPartitionArgsForCall []struct {
+		arg1 db.Partition
+		arg2 db.RetentionAction
+	}
+	retireCFAuditEventPartitionReturns struct {
+		result1 int64
+		result2 error
+	}
+	retireCFAuditEventPartitionReturnsOnCall map[int]struct {
+		result1 int64
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakePartitionDB) CreateCFAuditEventPartition(arg1 time.Time) (bool, error) {
+	fake.createCFAuditEventPartitionMutex.Lock()
+	ret, specificReturn := fake.createCFAuditEventPartitionReturnsOnCall[len(fake.createCFAuditEventPartitionArgsForCall)]
+	fake.createCFAuditEventPartitionArgsForCall = append(fake.createCFAuditEventPartitionArgsForCall, struct {
+		arg1 time.Time
+	}{arg1})
+	stub := fake.CreateCFAuditEventPartitionStub
+	fakeReturns := fake.createCFAuditEventPartitionReturns
+	fake.recordInvocation("CreateCFAuditEventPartition", []interface{}{arg1})
+	fake.createCFAuditEventPartitionMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakePartitionDB) CreateCFAuditEventPartitionCallCount() int {
+	fake.createCFAuditEventPartitionMutex.RLock()
+	defer fake.createCFAuditEventPartitionMutex.RUnlock()
+	return len(fake.createCFAuditEventPartitionArgsForCall)
+}
+
+func (fake *FakePartitionDB) CreateCFAuditEventPartitionCalls(stub func(time.Time) (bool, error)) {
+	fake.createCFAuditEventPartitionMutex.Lock()
+	defer fake.createCFAuditEventPartitionMutex.Unlock()
+	fake.CreateCFAuditEventPartitionStub = stub
+}
+
+func (fake *FakePartitionDB) CreateCFAuditEventPartitionArgsForCall(i int) time.Time {
+	fake.createCFAuditEventPartitionMutex.RLock()
+	defer fake.createCFAuditEventPartitionMutex.RUnlock()
+	argsForCall := fake.createCFAuditEventPartitionArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakePartitionDB) CreateCFAuditEventPartitionReturns(result1 bool, result2 error) {
+	fake.createCFAuditEventPartitionMutex.Lock()
+	defer fake.createCFAuditEventPartitionMutex.Unlock()
+	fake.CreateCFAuditEventPartitionStub = nil
+	fake.createCFAuditEventPartitionReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePartitionDB) CreateCFAuditEventPartitionReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.createCFAuditEventPartitionMutex.Lock()
+	defer fake.createCFAuditEventPartitionMutex.Unlock()
+	fake.CreateCFAuditEventPartitionStub = nil
+	if fake.createCFAuditEventPartitionReturnsOnCall == nil {
+		fake.createCFAuditEventPartitionReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.createCFAuditEventPartitionReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePartitionDB) GetCFAuditEventPartitions() ([]db.Partition, error) {
+	fake.getCFAuditEventPartitionsMutex.Lock()
+	ret, specificReturn := fake.getCFAuditEventPartitionsReturnsOnCall[len(fake.getCFAuditEventPartitionsArgsForCall)]
+	fake.getCFAuditEventPartitionsArgsForCall = append(fake.getCFAuditEventPartitionsArgsForCall, struct {
+	}{})
+	stub := fake.GetCFAuditEventPartitionsStub
+	fakeReturns := fake.getCFAuditEventPartitionsReturns
+	fake.recordInvocation("GetCFAuditEventPartitions", []interface{}{})
+	fake.getCFAuditEventPartitionsMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakePartitionDB) GetCFAuditEventPartitionsCallCount() int {
+	fake.getCFAuditEventPartitionsMutex.RLock()
+	defer fake.getCFAuditEventPartitionsMutex.RUnlock()
+	return len(fake.getCFAuditEventPartitionsArgsForCall)
+}
+
+func (fake *FakePartitionDB) GetCFAuditEventPartitionsCalls(stub func() ([]db.Partition, error)) {
+	fake.getCFAuditEventPartitionsMutex.Lock()
+	defer fake.getCFAuditEventPartitionsMutex.Unlock()
+	fake.GetCFAuditEventPartitionsStub = stub
+}
+
+func (fake *FakePartitionDB) GetCFAuditEventPartitionsReturns(result1 []db.Partition, result2 error) {
+	fake.getCFAuditEventPartitionsMutex.Lock()
+	defer fake.getCFAuditEventPartitionsMutex.Unlock()
+	fake.GetCFAuditEventPartitionsStub = nil
+	fake.getCFAuditEventPartitionsReturns = struct {
+		result1 []db.Partition
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePartitionDB) GetCFAuditEventPartitionsReturnsOnCall(i int, result1 []db.Partition, result2 error) {
+	fake.getCFAuditEventPartitionsMutex.Lock()
+	defer fake.getCFAuditEventPartitionsMutex.Unlock()
+	fake.GetCFAuditEventPartitionsStub = nil
+	if fake.getCFAuditEventPartitionsReturnsOnCall == nil {
+		fake.getCFAuditEventPartitionsReturnsOnCall = make(map[int]struct {
+			result1 []db.Partition
+			result2 error
+		})
+	}
+	fake.getCFAuditEventPartitionsReturnsOnCall[i] = struct {
+		result1 []db.Partition
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePartitionDB) RecordRetentionRun(arg1 db.RetentionRun) error {
+	fake.recordRetentionRunMutex.Lock()
+	ret, specificReturn := fake.recordRetentionRunReturnsOnCall[len(fake.recordRetentionRunArgsForCall)]
+	fake.recordRetentionRunArgsForCall = append(fake.recordRetentionRunArgsForCall, struct {
+		arg1 db.RetentionRun
+	}{arg1})
+	stub := fake.RecordRetentionRunStub
+	fakeReturns := fake.recordRetentionRunReturns
+	fake.recordInvocation("RecordRetentionRun", []interface{}{arg1})
+	fake.recordRetentionRunMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakePartitionDB) RecordRetentionRunCallCount() int {
+	fake.recordRetentionRunMutex.RLock()
+	defer fake.recordRetentionRunMutex.RUnlock()
+	return len(fake.recordRetentionRunArgsForCall)
+}
+
+func (fake *FakePartitionDB) RecordRetentionRunCalls(stub func(db.RetentionRun) error) {
+	fake.recordRetentionRunMutex.Lock()
+	defer fake.recordRetentionRunMutex.Unlock()
+	fake.RecordRetentionRunStub = stub
+}
+
+func (fake *FakePartitionDB) RecordRetentionRunArgsForCall(i int) db.RetentionRun {
+	fake.recordRetentionRunMutex.RLock()
+	defer fake.recordRetentionRunMutex.RUnlock()
+	argsForCall := fake.recordRetentionRunArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakePartitionDB) RecordRetentionRunReturns(result1 error) {
+	fake.recordRetentionRunMutex.Lock()
+	defer fake.recordRetentionRunMutex.Unlock()
+	fake.RecordRetentionRunStub = nil
+	fake.recordRetentionRunReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakePartitionDB) RecordRetentionRunReturnsOnCall(i int, result1 error) {
+	fake.recordRetentionRunMutex.Lock()
+	defer fake.recordRetentionRunMutex.Unlock()
+	fake.RecordRetentionRunStub = nil
+	if fake.recordRetentionRunReturnsOnCall == nil {
+		fake.recordRetentionRunReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.recordRetentionRunReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakePartitionDB) RetireCFAuditEventPartition(arg1 db.Partition, arg2 db.RetentionAction) (int64, error) {
+	fake.retireCFAuditEventPartitionMutex.Lock()
+	ret, specificReturn := fake.retireCFAuditEventPartitionReturnsOnCall[len(fake.retireCFAuditEventPartitionArgsForCall)]
+	fake.retireCFAuditEventPartitionArgsForCall = append(fake.retireCFAuditEventPartitionArgsForCall, struct {
+		arg1 db.Partition
+		arg2 db.RetentionAction
+	}{arg1, arg2})
+	stub := fake.RetireCFAuditEventPartitionStub
+	fakeReturns := fake.retireCFAuditEventPartitionReturns
+	fake.recordInvocation("RetireCFAuditEventPartition", []interface{}{arg1, arg2})
+	fake.retireCFAuditEventPartitionMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakePartitionDB) RetireCFAuditEventPartitionCallCount() int {
+	fake.retireCFAuditEventPartitionMutex.RLock()
+	defer fake.retireCFAuditEventPartitionMutex.RUnlock()
+	return len(fake.retireCFAuditEventPartitionArgsForCall)
+}
+
+func (fake *FakePartitionDB) RetireCFAuditEventPartitionCalls(stub func(db.Partition, db.RetentionAction) (int64, error)) {
+	fake.retireCFAuditEventPartitionMutex.Lock()
+	defer fake.retireCFAuditEventPartitionMutex.Unlock()
+	fake.RetireCFAuditEventPartitionStub = stub
+}
+
+func (fake *FakePartitionDB) RetireCFAuditEventPartitionArgsForCall(i int) (db.Partition, db.RetentionAction) {
+	fake.retireCFAuditEventPartitionMutex.RLock()
+	defer fake.retireCFAuditEventPartitionMutex.RUnlock()
+	argsForCall := fake.retireCFAuditEventPartitionArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakePartitionDB) RetireCFAuditEventPartitionReturns(result1 int64, result2 error) {
+	fake.retireCFAuditEventPartitionMutex.Lock()
+	defer fake.retireCFAuditEventPartitionMutex.Unlock()
+	fake.RetireCFAuditEventPartitionStub = nil
+	fake.retireCFAuditEventPartitionReturns = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePartitionDB) RetireCFAuditEventPartitionReturnsOnCall(i int, result1 int64, result2 error) {
+	fake.retireCFAuditEventPartitionMutex.Lock()
+	defer fake.retireCFAuditEventPartitionMutex.Unlock()
+	fake.RetireCFAuditEventPartitionStub = nil
+	if fake.retireCFAuditEventPartitionReturnsOnCall == nil {
+		fake.retireCFAuditEventPartitionReturnsOnCall = make(map[int]struct {
+			result1 int64
+			result2 error
+		})
+	}
+	fake.retireCFAuditEventPartitionReturnsOnCall[i] = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePartitionDB) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.createCFAuditEventPartitionMutex.RLock()
+	defer fake.createCFAuditEventPartitionMutex.RUnlock()
+	fake.getCFAuditEventPartitionsMutex.RLock()
+	defer fake.getCFAuditEventPartitionsMutex.RUnlock()
+	fake.recordRetentionRunMutex.RLock()
+	defer fake.recordRetentionRunMutex.RUnlock()
+	fake.retireCFAuditEventPartitionMutex.RLock()
+	defer fake.retireCFAuditEventPartitionMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakePartitionDB) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ db.PartitionDB = new(FakePartitionDB)
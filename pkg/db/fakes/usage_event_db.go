@@ -0,0 +1,525 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+type FakeUsageEventDB struct {
+	GetLatestUsageEventTimeStub        func(db.UsageEventKind, string) (time.Time, error)
+	getLatestUsageEventTimeMutex       sync.RWMutex
+	getLatestUsageEventTimeArgsForCall []struct {
+		arg1 db.UsageEventKind
+		arg2 string
+	}
+	getLatestUsageEventTimeReturns struct {
+		result1 time.Time
+		result2 error
+	}
+	getLatestUsageEventTimeReturnsOnCall map[int]struct {
+		result1 time.Time
+		result2 error
+	}
+	GetUnshippedUsageEventsForShipperStub        func(db.UsageEventKind, string, string, int) ([]db.UsageEvent, error)
+	getUnshippedUsageEventsForShipperMutex       sync.RWMutex
+	getUnshippedUsageEventsForShipperArgsForCall []struct {
+		arg1 db.UsageEventKind
+		arg2 string
+		arg3 string
+		arg4 int
+	}
+	getUnshippedUsageEventsForShipperReturns struct {
+		result1 []db.UsageEvent
+		result2 error
+	}
+	getUnshippedUsageEventsForShipperReturnsOnCall map[int]struct {
+		result1 []db.UsageEvent
+		result2 error
+	}
+	GetUsageEventCountStub        func(db.UsageEventKind) (int64, error)
+	getUsageEventCountMutex       sync.RWMutex
+	getUsageEventCountArgsForCall []struct {
+		arg1 db.UsageEventKind
+	}
+	getUsageEventCountReturns struct {
+		result1 int64
+		result2 error
+	}
+	getUsageEventCountReturnsOnCall map[int]struct {
+		result1 int64
+		result2 error
+	}
+	GetUsageEventCursorStub        func(db.UsageEventKind, string) (string, error)
+	getUsageEventCursorMutex       sync.RWMutex
+	getUsageEventCursorArgsForCall []struct {
+		arg1 db.UsageEventKind
+		arg2 string
+	}
+	getUsageEventCursorReturns struct {
+		result1 string
+		result2 error
+	}
+	getUsageEventCursorReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	StoreUsageEventsStub        func(db.UsageEventKind, string, []db.UsageEvent) error
+	storeUsageEventsMutex       sync.RWMutex
+	storeUsageEventsArgsForCall []struct {
+		arg1 db.UsageEventKind
+		arg2 string
+		arg3 []db.UsageEvent
+	}
+	storeUsageEventsReturns struct {
+		result1 error
+	}
+	storeUsageEventsReturnsOnCall map[int]struct {
+		result1 error
+	}
+	UpdateShipperCursorStub        func(string, string, string) error
+	updateShipperCursorMutex       sync.RWMutex
+	updateShipperCursorArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}
+	updateShipperCursorReturns struct {
+		result1 error
+	}
+	updateShipperCursorReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeUsageEventDB) GetLatestUsageEventTime(arg1 db.UsageEventKind, arg2 string) (time.Time, error) {
+	fake.getLatestUsageEventTimeMutex.Lock()
+	ret, specificReturn := fake.getLatestUsageEventTimeReturnsOnCall[len(fake.getLatestUsageEventTimeArgsForCall)]
+	fake.getLatestUsageEventTimeArgsForCall = append(fake.getLatestUsageEventTimeArgsForCall, struct {
+		arg1 db.UsageEventKind
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.GetLatestUsageEventTimeStub
+	fakeReturns := fake.getLatestUsageEventTimeReturns
+	fake.recordInvocation("GetLatestUsageEventTime", []interface{}{arg1, arg2})
+	fake.getLatestUsageEventTimeMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeUsageEventDB) GetLatestUsageEventTimeCallCount() int {
+	fake.getLatestUsageEventTimeMutex.RLock()
+	defer fake.getLatestUsageEventTimeMutex.RUnlock()
+	return len(fake.getLatestUsageEventTimeArgsForCall)
+}
+
+func (fake *FakeUsageEventDB) GetLatestUsageEventTimeCalls(stub func(db.UsageEventKind, string) (time.Time, error)) {
+	fake.getLatestUsageEventTimeMutex.Lock()
+	defer fake.getLatestUsageEventTimeMutex.Unlock()
+	fake.GetLatestUsageEventTimeStub = stub
+}
+
+func (fake *FakeUsageEventDB) GetLatestUsageEventTimeArgsForCall(i int) (db.UsageEventKind, string) {
+	fake.getLatestUsageEventTimeMutex.RLock()
+	defer fake.getLatestUsageEventTimeMutex.RUnlock()
+	argsForCall := fake.getLatestUsageEventTimeArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeUsageEventDB) GetLatestUsageEventTimeReturns(result1 time.Time, result2 error) {
+	fake.getLatestUsageEventTimeMutex.Lock()
+	defer fake.getLatestUsageEventTimeMutex.Unlock()
+	fake.GetLatestUsageEventTimeStub = nil
+	fake.getLatestUsageEventTimeReturns = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeUsageEventDB) GetLatestUsageEventTimeReturnsOnCall(i int, result1 time.Time, result2 error) {
+	fake.getLatestUsageEventTimeMutex.Lock()
+	defer fake.getLatestUsageEventTimeMutex.Unlock()
+	fake.GetLatestUsageEventTimeStub = nil
+	if fake.getLatestUsageEventTimeReturnsOnCall == nil {
+		fake.getLatestUsageEventTimeReturnsOnCall = make(map[int]struct {
+			result1 time.Time
+			result2 error
+		})
+	}
+	fake.getLatestUsageEventTimeReturnsOnCall[i] = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeUsageEventDB) GetUnshippedUsageEventsForShipper(arg1 db.UsageEventKind, arg2 string, arg3 string, arg4 int) ([]db.UsageEvent, error) {
+	fake.getUnshippedUsageEventsForShipperMutex.Lock()
+	ret, specificReturn := fake.getUnshippedUsageEventsForShipperReturnsOnCall[len(fake.getUnshippedUsageEventsForShipperArgsForCall)]
+	fake.getUnshippedUsageEventsForShipperArgsForCall = append(fake.getUnshippedUsageEventsForShipperArgsForCall, struct {
+		arg1 db.UsageEventKind
+		arg2 string
+		arg3 string
+		arg4 int
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.GetUnshippedUsageEventsForShipperStub
+	fakeReturns := fake.getUnshippedUsageEventsForShipperReturns
+	fake.recordInvocation("GetUnshippedUsageEventsForShipper", []interface{}{arg1, arg2, arg3, arg4})
+	fake.getUnshippedUsageEventsForShipperMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeUsageEventDB) GetUnshippedUsageEventsForShipperCallCount() int {
+	fake.getUnshippedUsageEventsForShipperMutex.RLock()
+	defer fake.getUnshippedUsageEventsForShipperMutex.RUnlock()
+	return len(fake.getUnshippedUsageEventsForShipperArgsForCall)
+}
+
+func (fake *FakeUsageEventDB) GetUnshippedUsageEventsForShipperCalls(stub func(db.UsageEventKind, string, string, int) ([]db.UsageEvent, error)) {
+	fake.getUnshippedUsageEventsForShipperMutex.Lock()
+	defer fake.getUnshippedUsageEventsForShipperMutex.Unlock()
+	fake.GetUnshippedUsageEventsForShipperStub = stub
+}
+
+func (fake *FakeUsageEventDB) GetUnshippedUsageEventsForShipperArgsForCall(i int) (db.UsageEventKind, string, string, int) {
+	fake.getUnshippedUsageEventsForShipperMutex.RLock()
+	defer fake.getUnshippedUsageEventsForShipperMutex.RUnlock()
+	argsForCall := fake.getUnshippedUsageEventsForShipperArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeUsageEventDB) GetUnshippedUsageEventsForShipperReturns(result1 []db.UsageEvent, result2 error) {
+	fake.getUnshippedUsageEventsForShipperMutex.Lock()
+	defer fake.getUnshippedUsageEventsForShipperMutex.Unlock()
+	fake.GetUnshippedUsageEventsForShipperStub = nil
+	fake.getUnshippedUsageEventsForShipperReturns = struct {
+		result1 []db.UsageEvent
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeUsageEventDB) GetUnshippedUsageEventsForShipperReturnsOnCall(i int, result1 []db.UsageEvent, result2 error) {
+	fake.getUnshippedUsageEventsForShipperMutex.Lock()
+	defer fake.getUnshippedUsageEventsForShipperMutex.Unlock()
+	fake.GetUnshippedUsageEventsForShipperStub = nil
+	if fake.getUnshippedUsageEventsForShipperReturnsOnCall == nil {
+		fake.getUnshippedUsageEventsForShipperReturnsOnCall = make(map[int]struct {
+			result1 []db.UsageEvent
+			result2 error
+		})
+	}
+	fake.getUnshippedUsageEventsForShipperReturnsOnCall[i] = struct {
+		result1 []db.UsageEvent
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeUsageEventDB) GetUsageEventCount(arg1 db.UsageEventKind) (int64, error) {
+	fake.getUsageEventCountMutex.Lock()
+	ret, specificReturn := fake.getUsageEventCountReturnsOnCall[len(fake.getUsageEventCountArgsForCall)]
+	fake.getUsageEventCountArgsForCall = append(fake.getUsageEventCountArgsForCall, struct {
+		arg1 db.UsageEventKind
+	}{arg1})
+	stub := fake.GetUsageEventCountStub
+	fakeReturns := fake.getUsageEventCountReturns
+	fake.recordInvocation("GetUsageEventCount", []interface{}{arg1})
+	fake.getUsageEventCountMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeUsageEventDB) GetUsageEventCountCallCount() int {
+	fake.getUsageEventCountMutex.RLock()
+	defer fake.getUsageEventCountMutex.RUnlock()
+	return len(fake.getUsageEventCountArgsForCall)
+}
+
+func (fake *FakeUsageEventDB) GetUsageEventCountCalls(stub func(db.UsageEventKind) (int64, error)) {
+	fake.getUsageEventCountMutex.Lock()
+	defer fake.getUsageEventCountMutex.Unlock()
+	fake.GetUsageEventCountStub = stub
+}
+
+func (fake *FakeUsageEventDB) GetUsageEventCountArgsForCall(i int) db.UsageEventKind {
+	fake.getUsageEventCountMutex.RLock()
+	defer fake.getUsageEventCountMutex.RUnlock()
+	argsForCall := fake.getUsageEventCountArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeUsageEventDB) GetUsageEventCountReturns(result1 int64, result2 error) {
+	fake.getUsageEventCountMutex.Lock()
+	defer fake.getUsageEventCountMutex.Unlock()
+	fake.GetUsageEventCountStub = nil
+	fake.getUsageEventCountReturns = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeUsageEventDB) GetUsageEventCountReturnsOnCall(i int, result1 int64, result2 error) {
+	fake.getUsageEventCountMutex.Lock()
+	defer fake.getUsageEventCountMutex.Unlock()
+	fake.GetUsageEventCountStub = nil
+	if fake.getUsageEventCountReturnsOnCall == nil {
+		fake.getUsageEventCountReturnsOnCall = make(map[int]struct {
+			result1 int64
+			result2 error
+		})
+	}
+	fake.getUsageEventCountReturnsOnCall[i] = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeUsageEventDB) GetUsageEventCursor(arg1 db.UsageEventKind, arg2 string) (string, error) {
+	fake.getUsageEventCursorMutex.Lock()
+	ret, specificReturn := fake.getUsageEventCursorReturnsOnCall[len(fake.getUsageEventCursorArgsForCall)]
+	fake.getUsageEventCursorArgsForCall = append(fake.getUsageEventCursorArgsForCall, struct {
+		arg1 db.UsageEventKind
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.GetUsageEventCursorStub
+	fakeReturns := fake.getUsageEventCursorReturns
+	fake.recordInvocation("GetUsageEventCursor", []interface{}{arg1, arg2})
+	fake.getUsageEventCursorMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeUsageEventDB) GetUsageEventCursorCallCount() int {
+	fake.getUsageEventCursorMutex.RLock()
+	defer fake.getUsageEventCursorMutex.RUnlock()
+	return len(fake.getUsageEventCursorArgsForCall)
+}
+
+func (fake *FakeUsageEventDB) GetUsageEventCursorCalls(stub func(db.UsageEventKind, string) (string, error)) {
+	fake.getUsageEventCursorMutex.Lock()
+	defer fake.getUsageEventCursorMutex.Unlock()
+	fake.GetUsageEventCursorStub = stub
+}
+
+func (fake *FakeUsageEventDB) GetUsageEventCursorArgsForCall(i int) (db.UsageEventKind, string) {
+	fake.getUsageEventCursorMutex.RLock()
+	defer fake.getUsageEventCursorMutex.RUnlock()
+	argsForCall := fake.getUsageEventCursorArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeUsageEventDB) GetUsageEventCursorReturns(result1 string, result2 error) {
+	fake.getUsageEventCursorMutex.Lock()
+	defer fake.getUsageEventCursorMutex.Unlock()
+	fake.GetUsageEventCursorStub = nil
+	fake.getUsageEventCursorReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeUsageEventDB) GetUsageEventCursorReturnsOnCall(i int, result1 string, result2 error) {
+	fake.getUsageEventCursorMutex.Lock()
+	defer fake.getUsageEventCursorMutex.Unlock()
+	fake.GetUsageEventCursorStub = nil
+	if fake.getUsageEventCursorReturnsOnCall == nil {
+		fake.getUsageEventCursorReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.getUsageEventCursorReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeUsageEventDB) StoreUsageEvents(arg1 db.UsageEventKind, arg2 string, arg3 []db.UsageEvent) error {
+	var arg3Copy []db.UsageEvent
+	if arg3 != nil {
+		arg3Copy = make([]db.UsageEvent, len(arg3))
+		copy(arg3Copy, arg3)
+	}
+	fake.storeUsageEventsMutex.Lock()
+	ret, specificReturn := fake.storeUsageEventsReturnsOnCall[len(fake.storeUsageEventsArgsForCall)]
+	fake.storeUsageEventsArgsForCall = append(fake.storeUsageEventsArgsForCall, struct {
+		arg1 db.UsageEventKind
+		arg2 string
+		arg3 []db.UsageEvent
+	}{arg1, arg2, arg3Copy})
+	stub := fake.StoreUsageEventsStub
+	fakeReturns := fake.storeUsageEventsReturns
+	fake.recordInvocation("StoreUsageEvents", []interface{}{arg1, arg2, arg3Copy})
+	fake.storeUsageEventsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeUsageEventDB) StoreUsageEventsCallCount() int {
+	fake.storeUsageEventsMutex.RLock()
+	defer fake.storeUsageEventsMutex.RUnlock()
+	return len(fake.storeUsageEventsArgsForCall)
+}
+
+func (fake *FakeUsageEventDB) StoreUsageEventsCalls(stub func(db.UsageEventKind, string, []db.UsageEvent) error) {
+	fake.storeUsageEventsMutex.Lock()
+	defer fake.storeUsageEventsMutex.Unlock()
+	fake.StoreUsageEventsStub = stub
+}
+
+func (fake *FakeUsageEventDB) StoreUsageEventsArgsForCall(i int) (db.UsageEventKind, string, []db.UsageEvent) {
+	fake.storeUsageEventsMutex.RLock()
+	defer fake.storeUsageEventsMutex.RUnlock()
+	argsForCall := fake.storeUsageEventsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeUsageEventDB) StoreUsageEventsReturns(result1 error) {
+	fake.storeUsageEventsMutex.Lock()
+	defer fake.storeUsageEventsMutex.Unlock()
+	fake.StoreUsageEventsStub = nil
+	fake.storeUsageEventsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeUsageEventDB) StoreUsageEventsReturnsOnCall(i int, result1 error) {
+	fake.storeUsageEventsMutex.Lock()
+	defer fake.storeUsageEventsMutex.Unlock()
+	fake.StoreUsageEventsStub = nil
+	if fake.storeUsageEventsReturnsOnCall == nil {
+		fake.storeUsageEventsReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.storeUsageEventsReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeUsageEventDB) UpdateShipperCursor(arg1 string, arg2 string, arg3 string) error {
+	fake.updateShipperCursorMutex.Lock()
+	ret, specificReturn := fake.updateShipperCursorReturnsOnCall[len(fake.updateShipperCursorArgsForCall)]
+	fake.updateShipperCursorArgsForCall = append(fake.updateShipperCursorArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}{arg1, arg2, arg3})
+	stub := fake.UpdateShipperCursorStub
+	fakeReturns := fake.updateShipperCursorReturns
+	fake.recordInvocation("UpdateShipperCursor", []interface{}{arg1, arg2, arg3})
+	fake.updateShipperCursorMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeUsageEventDB) UpdateShipperCursorCallCount() int {
+	fake.updateShipperCursorMutex.RLock()
+	defer fake.updateShipperCursorMutex.RUnlock()
+	return len(fake.updateShipperCursorArgsForCall)
+}
+
+func (fake *FakeUsageEventDB) UpdateShipperCursorCalls(stub func(string, string, string) error) {
+	fake.updateShipperCursorMutex.Lock()
+	defer fake.updateShipperCursorMutex.Unlock()
+	fake.UpdateShipperCursorStub = stub
+}
+
+func (fake *FakeUsageEventDB) UpdateShipperCursorArgsForCall(i int) (string, string, string) {
+	fake.updateShipperCursorMutex.RLock()
+	defer fake.updateShipperCursorMutex.RUnlock()
+	argsForCall := fake.updateShipperCursorArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeUsageEventDB) UpdateShipperCursorReturns(result1 error) {
+	fake.updateShipperCursorMutex.Lock()
+	defer fake.updateShipperCursorMutex.Unlock()
+	fake.UpdateShipperCursorStub = nil
+	fake.updateShipperCursorReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeUsageEventDB) UpdateShipperCursorReturnsOnCall(i int, result1 error) {
+	fake.updateShipperCursorMutex.Lock()
+	defer fake.updateShipperCursorMutex.Unlock()
+	fake.UpdateShipperCursorStub = nil
+	if fake.updateShipperCursorReturnsOnCall == nil {
+		fake.updateShipperCursorReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.updateShipperCursorReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeUsageEventDB) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.getLatestUsageEventTimeMutex.RLock()
+	defer fake.getLatestUsageEventTimeMutex.RUnlock()
+	fake.getUnshippedUsageEventsForShipperMutex.RLock()
+	defer fake.getUnshippedUsageEventsForShipperMutex.RUnlock()
+	fake.getUsageEventCountMutex.RLock()
+	defer fake.getUsageEventCountMutex.RUnlock()
+	fake.getUsageEventCursorMutex.RLock()
+	defer fake.getUsageEventCursorMutex.RUnlock()
+	fake.storeUsageEventsMutex.RLock()
+	defer fake.storeUsageEventsMutex.RUnlock()
+	fake.updateShipperCursorMutex.RLock()
+	defer fake.updateShipperCursorMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeUsageEventDB) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ db.UsageEventDB = new(FakeUsageEventDB)
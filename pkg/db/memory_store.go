@@ -0,0 +1,642 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+)
+
+// MemoryEventStore is an EventDB which keeps everything in memory, for
+// testing the collectors and shippers against something which behaves like
+// EventStore. Events are stored and returned as Postgres would: GUIDs are
+// lowercased and unique, created_at is rounded to microseconds and in UTC,
+// and metadata goes through JSON. It does not know the names of
+// organizations and spaces or the details of actors, does not keep a hash
+// chain, and counts events exactly rather than estimating. It is safe for
+// concurrent use.
+type MemoryEventStore struct {
+	mu sync.Mutex
+
+	events      []memoryEvent
+	guids       map[string]bool
+	cursors     map[string]ShipperCursor
+	checkpoints map[string]BackfillCheckpoint
+	quarantine  []memoryQuarantinedEvent
+	watermarks  map[string]CollectorWatermark
+}
+
+var _ EventDB = &MemoryEventStore{}
+
+// memoryEvent is a stored event, with its created_at parsed for ordering
+type memoryEvent struct {
+	id        int64
+	createdAt time.Time
+	event     CFAuditEvent
+}
+
+type memoryQuarantinedEvent struct {
+	QuarantinedCFAuditEvent
+	rawSHA256   [sha256.Size]byte
+	reprocessed bool
+}
+
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{
+		guids:       map[string]bool{},
+		cursors:     map[string]ShipperCursor{},
+		checkpoints: map[string]BackfillCheckpoint{},
+		watermarks:  map[string]CollectorWatermark{},
+	}
+}
+
+// Init does nothing, as there is no schema
+func (s *MemoryEventStore) Init() error {
+	return nil
+}
+
+// memoryTime is a time as Postgres stores a timestamptz
+func memoryTime(t time.Time) time.Time {
+	return t.UTC().Round(time.Microsecond)
+}
+
+// StoreCFAuditEvents stores a page of events, ignoring any which are already
+// stored or repeated in the page, and quarantining any which are invalid
+func (s *MemoryEventStore) StoreCFAuditEvents(foundation string, events []cfclient.Event) (StoreResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := StoreResult{}
+	stored := []memoryEvent{}
+	seen := map[string]bool{}
+	for _, event := range events {
+		if reason := ValidateCFAuditEvent(event); reason != nil {
+			b, err := json.Marshal(event)
+			if err != nil {
+				return StoreResult{}, err
+			}
+			s.quarantineCFAuditEvent(foundation, event.GUID, b, reason.Error())
+			result.Quarantined++
+			continue
+		}
+
+		guid := strings.ToLower(event.GUID)
+		if s.guids[guid] || seen[guid] {
+			result.Duplicates++
+			continue
+		}
+		seen[guid] = true
+
+		// Already validated
+		createdAt, _ := time.Parse(time.RFC3339Nano, event.CreatedAt)
+		createdAt = memoryTime(createdAt)
+
+		e := CFAuditEvent{Event: event, Foundation: foundation}
+		e.GUID = guid
+		e.CreatedAt = createdAt.Format(time.RFC3339Nano)
+		e.OrganizationGUID = strings.ToLower(event.OrganizationGUID)
+		e.SpaceGUID = strings.ToLower(event.SpaceGUID)
+		metadataJSON, err := json.Marshal(&event.Metadata)
+		if err != nil {
+			return StoreResult{}, err
+		}
+		e.Metadata = nil
+		if err := json.Unmarshal(metadataJSON, &e.Metadata); err != nil {
+			return StoreResult{}, err
+		}
+
+		stored = append(stored, memoryEvent{
+			id:        int64(len(s.events) + len(stored) + 1),
+			createdAt: createdAt,
+			event:     e,
+		})
+	}
+
+	// Nothing is stored unless the whole page can be, as in a transaction
+	for _, e := range stored {
+		s.events = append(s.events, e)
+		s.guids[e.event.GUID] = true
+	}
+	result.Inserted = len(stored)
+	return result, nil
+}
+
+// QuarantineCFAuditEvents records events which could not be stored, as they
+// were fetched, along with why. Events which are already quarantined are
+// ignored.
+func (s *MemoryEventStore) QuarantineCFAuditEvents(foundation string, events []QuarantinedCFAuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range events {
+		s.quarantineCFAuditEvent(foundation, event.GUID, event.Event, event.Reason)
+	}
+	return nil
+}
+
+func (s *MemoryEventStore) quarantineCFAuditEvent(foundation string, guid string, event []byte, reason string) {
+	sum := sha256.Sum256(event)
+	for _, q := range s.quarantine {
+		if q.Foundation == foundation && q.rawSHA256 == sum {
+			return
+		}
+	}
+	s.quarantine = append(s.quarantine, memoryQuarantinedEvent{
+		QuarantinedCFAuditEvent: QuarantinedCFAuditEvent{
+			ID:            int64(len(s.quarantine) + 1),
+			Foundation:    foundation,
+			GUID:          strings.ReplaceAll(guid, "\x00", ""),
+			Event:         append(json.RawMessage{}, event...),
+			Reason:        reason,
+			QuarantinedAt: memoryTime(time.Now()),
+		},
+		rawSHA256: sum,
+	})
+}
+
+// GetCFAuditEvents returns events in the order they were stored, newest
+// first unless filter.Reverse is set
+func (s *MemoryEventStore) GetCFAuditEvents(filter RawEventFilter) ([]CFAuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []CFAuditEvent{}
+	for i := range s.events {
+		e := s.events[len(s.events)-1-i]
+		if filter.Reverse {
+			e = s.events[i]
+		}
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+		events = append(events, e.event)
+	}
+	return events, nil
+}
+
+// queryCFAuditEvents returns the events matching a query, in order, after
+// its page token
+func (s *MemoryEventStore) queryCFAuditEvents(query EventQuery) ([]CFAuditEvent, error) {
+	// The query is checked the same way as by EventStore, so that the same
+	// queries are rejected
+	if _, _, err := buildEventQuery(query, 0); err != nil {
+		return nil, err
+	}
+	var token *pageToken
+	if query.PageToken != "" {
+		t, err := decodePageToken(query.PageToken)
+		if err != nil {
+			return nil, err
+		}
+		token = &t
+	}
+	predicates := make([]func(interface{}) bool, 0, len(query.Metadata))
+	for _, predicate := range query.Metadata {
+		match, err := matchMetadata(predicate)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, match)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matching := []memoryEvent{}
+	for _, e := range s.events {
+		if !matchesEventQuery(e, query) {
+			continue
+		}
+		if token != nil && !afterPageToken(e, *token) {
+			continue
+		}
+		var metadata interface{} = e.event.Metadata
+		matchesMetadata := true
+		for _, match := range predicates {
+			if !match(metadata) {
+				matchesMetadata = false
+				break
+			}
+		}
+		if matchesMetadata {
+			matching = append(matching, e)
+		}
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		if query.Descending {
+			i, j = j, i
+		}
+		return compareEventKeys(matching[i], matching[j].createdAt, matching[j].event.GUID) < 0
+	})
+
+	events := make([]CFAuditEvent, 0, len(matching))
+	for _, e := range matching {
+		events = append(events, e.event)
+	}
+	return events, nil
+}
+
+// compareEventKeys compares an event's (created_at, guid) with another's, as
+// Postgres compares rows
+func compareEventKeys(e memoryEvent, createdAt time.Time, guid string) int {
+	if c := e.createdAt.Compare(createdAt); c != 0 {
+		return c
+	}
+	return strings.Compare(e.event.GUID, strings.ToLower(guid))
+}
+
+func afterPageToken(e memoryEvent, token pageToken) bool {
+	c := compareEventKeys(e, memoryTime(token.CreatedAt), token.GUID)
+	if token.Descending {
+		return c < 0
+	}
+	return c > 0
+}
+
+func matchesEventQuery(e memoryEvent, query EventQuery) bool {
+	event := e.event
+	if query.Foundation != "" && event.Foundation != query.Foundation {
+		return false
+	}
+	if !query.From.IsZero() && e.createdAt.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !e.createdAt.Before(query.To) {
+		return false
+	}
+	if query.OrganizationGUID != "" && event.OrganizationGUID != strings.ToLower(query.OrganizationGUID) {
+		return false
+	}
+	if query.SpaceGUID != "" && event.SpaceGUID != strings.ToLower(query.SpaceGUID) {
+		return false
+	}
+	if query.Actor != "" && event.Actor != query.Actor && event.ActorName != query.Actor && event.ActorUsername != query.Actor {
+		return false
+	}
+	if query.Actee != "" && event.Actee != query.Actee && event.ActeeName != query.Actee {
+		return false
+	}
+	if len(query.EventTypes) > 0 {
+		matchesType := false
+		for _, eventType := range query.EventTypes {
+			if prefix, ok := strings.CutSuffix(eventType, "*"); ok {
+				matchesType = strings.HasPrefix(event.Type, prefix)
+			} else {
+				matchesType = event.Type == eventType
+			}
+			if matchesType {
+				break
+			}
+		}
+		if !matchesType {
+			return false
+		}
+	}
+	return true
+}
+
+// matchMetadata returns a test of a metadata predicate which behaves like
+// the jsonb operators EventStore uses
+func matchMetadata(predicate MetadataPredicate) (func(metadata interface{}) bool, error) {
+	if predicate.Exists {
+		return func(metadata interface{}) bool {
+			_, ok := jsonPath(metadata, predicate.Path)
+			return ok
+		}, nil
+	}
+
+	var document interface{} = predicate.Equals
+	for i := len(predicate.Path) - 1; i >= 0; i-- {
+		document = map[string]interface{}{predicate.Path[i]: document}
+	}
+	// Through JSON, so that numbers are compared as they are in metadata
+	documentJSON, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(documentJSON, &document); err != nil {
+		return nil, err
+	}
+	return func(metadata interface{}) bool {
+		return jsonContains(metadata, document)
+	}, nil
+}
+
+// jsonPath returns the value at a path, like the #> operator, which indexes
+// arrays by number
+func jsonPath(v interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		switch container := v.(type) {
+		case map[string]interface{}:
+			value, ok := container[key]
+			if !ok {
+				return nil, false
+			}
+			v = value
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, false
+			}
+			if i < 0 {
+				i += len(container)
+			}
+			if i < 0 || i >= len(container) {
+				return nil, false
+			}
+			v = container[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonContains is true if container contains contained, like the @>
+// operator: objects contain objects with a subset of their keys, arrays
+// contain arrays whose every element they contain, and other values contain
+// only themselves
+func jsonContains(container interface{}, contained interface{}) bool {
+	switch contained := contained.(type) {
+	case map[string]interface{}:
+		object, ok := container.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range contained {
+			if v, ok := object[key]; !ok || !jsonContains(v, value) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		array, ok := container.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, value := range contained {
+			found := false
+			for _, v := range array {
+				if jsonContains(v, value) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	default:
+		switch container.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+		return container == contained
+	}
+}
+
+// QueryCFAuditEvents returns a page of the events matching query, ordered by
+// when they were created
+func (s *MemoryEventStore) QueryCFAuditEvents(query EventQuery) (EventPage, error) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = DefaultQueryLimit
+	}
+	if limit < 0 || limit > MaxQueryLimit {
+		return EventPage{}, fmt.Errorf("limit must be between 1 and %d", MaxQueryLimit)
+	}
+
+	events, err := s.queryCFAuditEvents(query)
+	if err != nil {
+		return EventPage{}, err
+	}
+
+	page := EventPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		last := page.Events[limit-1]
+		createdAt, err := time.Parse(time.RFC3339Nano, last.CreatedAt)
+		if err != nil {
+			return EventPage{}, err
+		}
+		page.NextPageToken = pageToken{
+			CreatedAt:  createdAt,
+			GUID:       last.GUID,
+			Descending: query.Descending,
+		}.encode()
+	}
+	return page, nil
+}
+
+// StreamCFAuditEvents calls fn with each event matching query, in order. The
+// events are those stored when it was called, and fn may store more.
+func (s *MemoryEventStore) StreamCFAuditEvents(ctx context.Context, query EventQuery, fn func(event CFAuditEvent) error) error {
+	events, err := s.queryCFAuditEvents(query)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLatestCFEventTime returns when the most recent event from a foundation
+// was created, or the epoch if there are none
+func (s *MemoryEventStore) GetLatestCFEventTime(foundation string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latest := time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+	found := false
+	for _, e := range s.events {
+		if e.event.Foundation == foundation && (!found || e.createdAt.After(latest)) {
+			latest = e.createdAt
+			found = true
+		}
+	}
+	return latest, nil
+}
+
+// GetCFEventCount returns how many events are stored
+func (s *MemoryEventStore) GetCFEventCount() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.events)), nil
+}
+
+// GetUnshippedCFAuditEventsForShipper returns events from a foundation after
+// the named shipper's cursor, oldest first, the same way as EventStore: the
+// first limit events created at or after the cursor's time are selected,
+// and then the event with the cursor's GUID is left out, so fewer than limit
+// may be returned even if there are more.
+func (s *MemoryEventStore) GetUnshippedCFAuditEventsForShipper(shipperName string, foundation string, limit int) ([]CFAuditEvent, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("LIMIT must not be negative")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursor, ok := s.cursors[shipperName]
+	if !ok {
+		cursor.UpdatedAt = time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	recent := []memoryEvent{}
+	for _, e := range s.events {
+		if e.event.Foundation == foundation && !e.createdAt.Before(cursor.UpdatedAt) {
+			recent = append(recent, e)
+		}
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].createdAt.Before(recent[j].createdAt)
+	})
+	if len(recent) > limit {
+		recent = recent[:limit]
+	}
+
+	events := []CFAuditEvent{}
+	for _, e := range recent {
+		if e.event.GUID != cursor.ShippedID {
+			events = append(events, e.event)
+		}
+	}
+	return events, nil
+}
+
+// UpdateShipperCursor saves how far the named shipper has got. shipperTime is
+// parsed as Postgres would parse a timestamptz in RFC 3339.
+func (s *MemoryEventStore) UpdateShipperCursor(shipperName string, shipperTime string, shippedID string) error {
+	updatedAt, err := time.Parse(time.RFC3339Nano, shipperTime)
+	if err != nil {
+		return fmt.Errorf("invalid input syntax for type timestamp with time zone: %q", shipperTime)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursors[shipperName] = ShipperCursor{
+		Name:      shipperName,
+		UpdatedAt: memoryTime(updatedAt),
+		ShippedID: shippedID,
+	}
+	return nil
+}
+
+func backfillCheckpointKey(checkpoint BackfillCheckpoint) string {
+	return fmt.Sprintf(
+		"%s/%d/%d", checkpoint.Foundation,
+		memoryTime(checkpoint.WindowStart).UnixMicro(), memoryTime(checkpoint.WindowEnd).UnixMicro(),
+	)
+}
+
+// GetIncompleteBackfillCheckpoints returns the checkpoints of windows which
+// have not been completely fetched, oldest first
+func (s *MemoryEventStore) GetIncompleteBackfillCheckpoints(foundation string) ([]BackfillCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoints := []BackfillCheckpoint{}
+	for _, checkpoint := range s.checkpoints {
+		if checkpoint.Foundation == foundation && !checkpoint.Completed {
+			checkpoints = append(checkpoints, checkpoint)
+		}
+	}
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].WindowStart.Before(checkpoints[j].WindowStart)
+	})
+	return checkpoints, nil
+}
+
+// UpdateBackfillCheckpoint creates or updates the checkpoint for a window
+func (s *MemoryEventStore) UpdateBackfillCheckpoint(checkpoint BackfillCheckpoint) error {
+	checkpoint.WindowStart = memoryTime(checkpoint.WindowStart)
+	checkpoint.WindowEnd = memoryTime(checkpoint.WindowEnd)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints[backfillCheckpointKey(checkpoint)] = checkpoint
+	return nil
+}
+
+// DeleteCompletedBackfillCheckpoints deletes the checkpoints of completed
+// windows which end at or before until, and returns how many there were
+func (s *MemoryEventStore) DeleteCompletedBackfillCheckpoints(foundation string, until time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := int64(0)
+	for key, checkpoint := range s.checkpoints {
+		if checkpoint.Foundation == foundation && checkpoint.Completed && !checkpoint.WindowEnd.After(until) {
+			delete(s.checkpoints, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// GetQuarantinedCFAuditEvents returns the quarantined events for a
+// foundation which have not been reprocessed, oldest first
+func (s *MemoryEventStore) GetQuarantinedCFAuditEvents(foundation string) ([]QuarantinedCFAuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []QuarantinedCFAuditEvent{}
+	for _, q := range s.quarantine {
+		if q.Foundation == foundation && !q.reprocessed {
+			events = append(events, q.QuarantinedCFAuditEvent)
+		}
+	}
+	return events, nil
+}
+
+// MarkCFAuditEventsReprocessed records that quarantined events have since
+// been stored
+func (s *MemoryEventStore) MarkCFAuditEventsReprocessed(ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		if id >= 1 && id <= int64(len(s.quarantine)) {
+			s.quarantine[id-1].reprocessed = true
+		}
+	}
+	return nil
+}
+
+// GetCollectorWatermark returns the watermark for a source, which is the zero
+// value if the collector has never completed a pass
+func (s *MemoryEventStore) GetCollectorWatermark(source string, foundation string) (CollectorWatermark, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	watermark, ok := s.watermarks[source+"/"+foundation]
+	if !ok {
+		return CollectorWatermark{Source: source, Foundation: foundation}, nil
+	}
+	return watermark, nil
+}
+
+// UpdateCollectorWatermark creates or updates the watermark for a source
+func (s *MemoryEventStore) UpdateCollectorWatermark(watermark CollectorWatermark) error {
+	watermark.Watermark = memoryTime(watermark.Watermark)
+	watermark.LastResweep = memoryTime(watermark.LastResweep)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watermarks[watermark.Source+"/"+watermark.Foundation] = watermark
+	return nil
+}
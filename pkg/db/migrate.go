@@ -0,0 +1,323 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+const SchemaMigrationsTable = "schema_migrations"
+
+// MigrationLockKey is the Postgres advisory lock held while migrating, so
+// that instances starting at the same time do not migrate at the same time
+const MigrationLockKey int64 = 0x7061617341756470 // "paasAudp"
+
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+// Migrations are the schema migrations built into the binary
+var Migrations = mustLoadMigrations(embeddedMigrations, "migrations")
+
+var migrationFilename = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered change to the schema. Up makes the change and
+// Down undoes it.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus says whether a migration has been applied. Migrations
+// which have been applied but are not known to this binary, because it is
+// older than the one which applied them, have Unknown set.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+// LoadMigrations reads migrations from files in dir named like
+// 0001_create_things.up.sql and 0001_create_things.down.sql. Every
+// migration must have both.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := migrationFilename.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s is not named like 0001_name.up.sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %s", entry.Name(), err)
+		}
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %04d is named both %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(a, b int) bool {
+		return migrations[a].Version < migrations[b].Version
+	})
+	return migrations, nil
+}
+
+func mustLoadMigrations(fsys fs.FS, dir string) []Migration {
+	migrations, err := LoadMigrations(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
+
+// Migrator applies and rolls back migrations, recording which have been
+// applied in the schema_migrations table. Each migration is run in its own
+// transaction while holding MigrationLockKey.
+type Migrator struct {
+	db         *sql.DB
+	logger     lager.Logger
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, logger lager.Logger, migrations []Migration) *Migrator {
+	return &Migrator{
+		db:         db,
+		logger:     logger.Session("migrator"),
+		migrations: migrations,
+	}
+}
+
+// Status returns every migration, known or applied, in order
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if a, ok := applied[migration.Version]; ok {
+				status.AppliedAt = a.AppliedAt
+				delete(applied, migration.Version)
+			}
+			statuses = append(statuses, status)
+		}
+		for _, a := range applied {
+			a.Unknown = true
+			statuses = append(statuses, a)
+		}
+		sort.Slice(statuses, func(a, b int) bool {
+			return statuses[a].Version < statuses[b].Version
+		})
+		return nil
+	})
+	return statuses, err
+}
+
+// Up applies every migration which has not been applied, in order, and
+// returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			err := m.run(ctx, conn, migration, "up", migration.Up,
+				fmt.Sprintf(`INSERT INTO %s (version, name) VALUES ($1, $2)`, SchemaMigrationsTable),
+				migration.Version, migration.Name,
+			)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down rolls back the last steps migrations to be applied, most recent
+// first, and returns how many were rolled back. It stops with an error at a
+// migration which is not known to this binary.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	byVersion := map[int64]Migration{}
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int64, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(a, b int) bool { return versions[a] > versions[b] })
+
+		for _, version := range versions {
+			if count == steps {
+				break
+			}
+			migration, ok := byVersion[version]
+			if !ok {
+				return fmt.Errorf(
+					"migration %04d_%s is not known to this version of the auditor, so cannot be rolled back",
+					version, applied[version].Name,
+				)
+			}
+			err := m.run(ctx, conn, migration, "down", migration.Down,
+				fmt.Sprintf(`DELETE FROM %s WHERE version = $1`, SchemaMigrationsTable),
+				migration.Version,
+			)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// run runs one direction of a migration and records it in the same
+// transaction, so that a failed migration leaves nothing behind
+func (m *Migrator) run(
+	ctx context.Context,
+	conn *sql.Conn,
+	migration Migration,
+	direction string,
+	migrationSQL string,
+	recordSQL string,
+	recordArgs ...interface{},
+) error {
+	name := fmt.Sprintf("%04d_%s.%s.sql", migration.Version, migration.Name, direction)
+	startTime := time.Now()
+	m.logger.Info("run-migration", lager.Data{"migration": name})
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migrationSQL); err != nil {
+		return wrapPqError(err, name)
+	}
+	if _, err := tx.ExecContext(ctx, recordSQL, recordArgs...); err != nil {
+		return wrapPqError(err, name)
+	}
+	if err := tx.Commit(); err != nil {
+		return wrapPqError(err, name)
+	}
+
+	m.logger.Info("finish-migration", lager.Data{
+		"migration": name,
+		"elapsed":   time.Since(startTime),
+	})
+	return nil
+}
+
+// applied returns the migrations recorded as applied, by version
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]MigrationStatus, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf(
+		`SELECT version, name, applied_at FROM %s`, SchemaMigrationsTable,
+	))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]MigrationStatus{}
+	for rows.Next() {
+		var status MigrationStatus
+		var appliedAt time.Time
+		if err := rows.Scan(&status.Version, &status.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		status.AppliedAt = &appliedAt
+		applied[status.Version] = status
+	}
+	return applied, rows.Err()
+}
+
+// withLock runs f on a connection holding MigrationLockKey, waiting for
+// anybody else migrating to finish. The schema_migrations table is created
+// first if there is not one.
+func (m *Migrator) withLock(ctx context.Context, f func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, MigrationLockKey); err != nil {
+		return fmt.Errorf("failed to lock for migrating: %s", err)
+	}
+	defer func() {
+		// The lock is released when the connection is closed anyway, so
+		// failing to unlock is only worth logging
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, MigrationLockKey); err != nil {
+			m.logger.Error("err-unlock", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`, SchemaMigrationsTable))
+	if err != nil {
+		return wrapPqError(err, "failed to create "+SchemaMigrationsTable)
+	}
+
+	return f(conn)
+}
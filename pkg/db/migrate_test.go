@@ -0,0 +1,60 @@
+package db_test
+
+import (
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("LoadMigrations", func() {
+	file := func(contents string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(contents)}
+	}
+
+	It("loads migrations in order", func() {
+		migrations, err := db.LoadMigrations(fstest.MapFS{
+			"m/0010_add_things_index.up.sql":   file("CREATE INDEX things_idx ON things (id);"),
+			"m/0010_add_things_index.down.sql": file("DROP INDEX things_idx;"),
+			"m/0002_create_things.up.sql":      file("CREATE TABLE things (id int);"),
+			"m/0002_create_things.down.sql":    file("DROP TABLE things;"),
+		}, "m")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrations).To(Equal([]db.Migration{
+			{Version: 2, Name: "create_things", Up: "CREATE TABLE things (id int);", Down: "DROP TABLE things;"},
+			{Version: 10, Name: "add_things_index", Up: "CREATE INDEX things_idx ON things (id);", Down: "DROP INDEX things_idx;"},
+		}))
+	})
+
+	It("requires both an up and a down file", func() {
+		_, err := db.LoadMigrations(fstest.MapFS{
+			"m/0001_create_things.up.sql": file("CREATE TABLE things (id int);"),
+		}, "m")
+		Expect(err).To(MatchError(ContainSubstring("0001_create_things must have both")))
+	})
+
+	It("rejects badly named files", func() {
+		_, err := db.LoadMigrations(fstest.MapFS{
+			"m/create_things.sql": file("CREATE TABLE things (id int);"),
+		}, "m")
+		Expect(err).To(MatchError(ContainSubstring("is not named like")))
+	})
+
+	It("rejects two migrations with the same version", func() {
+		_, err := db.LoadMigrations(fstest.MapFS{
+			"m/0001_create_things.up.sql":   file("CREATE TABLE things (id int);"),
+			"m/0001_create_things.down.sql": file("DROP TABLE things;"),
+			"m/0001_create_others.up.sql":   file("CREATE TABLE others (id int);"),
+		}, "m")
+		Expect(err).To(MatchError(ContainSubstring("is named both")))
+	})
+
+	It("builds the migrations into the binary, numbered from 1 without gaps", func() {
+		Expect(db.Migrations).NotTo(BeEmpty())
+		for i, migration := range db.Migrations {
+			Expect(migration.Version).To(BeNumerically("==", i+1), migration.Name)
+		}
+	})
+})
@@ -30,3 +30,6 @@ EXCEPTION
 END; $$;
 
 ALTER TABLE cf_audit_events ADD COLUMN IF NOT EXISTS metadata JSONB;
+
+ALTER TABLE cf_audit_events ADD COLUMN IF NOT EXISTS foundation text NOT NULL DEFAULT 'default';
+CREATE INDEX IF NOT EXISTS cf_audit_events_foundation_created_at_idx ON cf_audit_events (foundation, created_at);
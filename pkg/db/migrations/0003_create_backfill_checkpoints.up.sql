@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS backfill_checkpoints (
+	foundation text NOT NULL,
+	window_start timestamptz NOT NULL,
+	window_end timestamptz NOT NULL,
+	last_page_url text NOT NULL,
+	event_count bigint NOT NULL,
+	completed boolean NOT NULL,
+	updated_at timestamptz NOT NULL,
+
+	PRIMARY KEY (foundation, window_start, window_end)
+);
+
+-- Checkpoints created before collecting from multiple foundations
+ALTER TABLE backfill_checkpoints ADD COLUMN IF NOT EXISTS foundation text NOT NULL DEFAULT 'default';
+
+DO $$ BEGIN
+	IF NOT EXISTS (
+		SELECT 1 FROM information_schema.key_column_usage
+		WHERE table_name = 'backfill_checkpoints'
+		AND constraint_name = 'backfill_checkpoints_pkey'
+		AND column_name = 'foundation'
+	) THEN
+		ALTER TABLE backfill_checkpoints DROP CONSTRAINT backfill_checkpoints_pkey;
+		ALTER TABLE backfill_checkpoints ADD PRIMARY KEY (foundation, window_start, window_end);
+	END IF;
+END; $$;
+
+DROP INDEX IF EXISTS backfill_checkpoints_incomplete_idx;
+CREATE INDEX IF NOT EXISTS backfill_checkpoints_foundation_incomplete_idx ON backfill_checkpoints (foundation, window_start) WHERE NOT completed;
+
+DO $$ BEGIN
+	ALTER TABLE backfill_checkpoints ADD CONSTRAINT window_end_after_window_start CHECK (window_end > window_start);
+EXCEPTION
+	WHEN duplicate_object THEN RAISE NOTICE 'constraint already exists';
+END; $$;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS usage_event_cursors;
+DROP TABLE IF EXISTS cf_service_usage_events;
+DROP TABLE IF EXISTS cf_app_usage_events;
@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS cf_app_usage_events (
+	id SERIAL,
+	guid uuid UNIQUE NOT NULL,
+	foundation text NOT NULL,
+	created_at timestamptz NOT NULL,
+	state text NOT NULL,
+	organization_guid uuid,
+	space_guid uuid,
+	raw JSONB NOT NULL,
+
+	PRIMARY KEY (guid)
+);
+
+CREATE INDEX IF NOT EXISTS cf_app_usage_events_id_idx ON cf_app_usage_events (id);
+CREATE INDEX IF NOT EXISTS cf_app_usage_events_foundation_created_at_idx ON cf_app_usage_events (foundation, created_at);
+
+CREATE TABLE IF NOT EXISTS cf_service_usage_events (
+	id SERIAL,
+	guid uuid UNIQUE NOT NULL,
+	foundation text NOT NULL,
+	created_at timestamptz NOT NULL,
+	state text NOT NULL,
+	organization_guid uuid,
+	space_guid uuid,
+	raw JSONB NOT NULL,
+
+	PRIMARY KEY (guid)
+);
+
+CREATE INDEX IF NOT EXISTS cf_service_usage_events_id_idx ON cf_service_usage_events (id);
+CREATE INDEX IF NOT EXISTS cf_service_usage_events_foundation_created_at_idx ON cf_service_usage_events (foundation, created_at);
+
+-- The GUID of the last usage event collected from each foundation. Cloud
+-- Controller returns the usage events after this GUID, so it is advanced in
+-- the same transaction as the events are stored.
+CREATE TABLE IF NOT EXISTS usage_event_cursors (
+	kind text NOT NULL,
+	foundation text NOT NULL,
+	last_guid uuid NOT NULL,
+	updated_at timestamptz NOT NULL DEFAULT now(),
+
+	PRIMARY KEY (kind, foundation)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS cf_space_names;
+DROP TABLE IF EXISTS cf_organization_names;
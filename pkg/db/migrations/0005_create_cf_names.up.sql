@@ -0,0 +1,33 @@
+-- The names organizations and spaces have been seen with, so that they can
+-- still be identified after they have been renamed or deleted
+CREATE TABLE IF NOT EXISTS cf_organization_names (
+	guid uuid NOT NULL,
+	name text NOT NULL,
+	foundation text NOT NULL,
+	first_seen timestamptz NOT NULL,
+	last_seen timestamptz NOT NULL,
+
+	PRIMARY KEY (guid, name)
+);
+
+CREATE TABLE IF NOT EXISTS cf_space_names (
+	guid uuid NOT NULL,
+	name text NOT NULL,
+	foundation text NOT NULL,
+	first_seen timestamptz NOT NULL,
+	last_seen timestamptz NOT NULL,
+
+	PRIMARY KEY (guid, name)
+);
+
+DO $$ BEGIN
+	ALTER TABLE cf_organization_names ADD CONSTRAINT last_seen_after_first_seen CHECK (last_seen >= first_seen);
+EXCEPTION
+	WHEN duplicate_object THEN RAISE NOTICE 'constraint already exists';
+END; $$;
+
+DO $$ BEGIN
+	ALTER TABLE cf_space_names ADD CONSTRAINT last_seen_after_first_seen CHECK (last_seen >= first_seen);
+EXCEPTION
+	WHEN duplicate_object THEN RAISE NOTICE 'constraint already exists';
+END; $$;
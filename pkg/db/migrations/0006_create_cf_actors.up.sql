@@ -0,0 +1,16 @@
+-- Details of the UAA users who made changes, so that they can be identified
+-- when actor_username is empty or ambiguous. Joined to cf_audit_events on
+-- actor where actor_type is user.
+CREATE TABLE IF NOT EXISTS cf_actors (
+	guid text NOT NULL,
+	foundation text NOT NULL,
+	username text NOT NULL,
+	origin text NOT NULL,
+	email text NOT NULL,
+	active boolean NOT NULL,
+	deleted boolean NOT NULL DEFAULT false,
+	first_seen timestamptz NOT NULL,
+	last_seen timestamptz NOT NULL,
+
+	PRIMARY KEY (guid)
+);
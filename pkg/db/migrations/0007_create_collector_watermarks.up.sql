@@ -0,0 +1,12 @@
+-- How far each collector has got. The watermark only moves forward once
+-- every event before it has been collected, and last_resweep is when the
+-- collector last looked again for events Cloud Controller committed late.
+CREATE TABLE IF NOT EXISTS collector_watermarks (
+	source text NOT NULL,
+	foundation text NOT NULL,
+	watermark timestamptz NOT NULL,
+	last_resweep timestamptz NOT NULL,
+	updated_at timestamptz NOT NULL,
+
+	PRIMARY KEY (source, foundation)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS cf_audit_events_quarantine;
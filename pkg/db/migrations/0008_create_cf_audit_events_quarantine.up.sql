@@ -0,0 +1,18 @@
+-- Events which could not be stored in cf_audit_events, kept as fetched along
+-- with why, so that they can be fixed and stored later. Each distinct event
+-- is only quarantined once.
+CREATE TABLE IF NOT EXISTS cf_audit_events_quarantine (
+	id bigserial NOT NULL,
+	foundation text NOT NULL,
+	guid text NOT NULL,
+	raw jsonb NOT NULL,
+	raw_sha256 text NOT NULL,
+	reason text NOT NULL,
+	quarantined_at timestamptz NOT NULL,
+	reprocessed_at timestamptz,
+
+	PRIMARY KEY (id),
+	UNIQUE (foundation, raw_sha256)
+);
+
+CREATE INDEX IF NOT EXISTS cf_audit_events_quarantine_unprocessed_idx ON cf_audit_events_quarantine (foundation, id) WHERE reprocessed_at IS NULL;
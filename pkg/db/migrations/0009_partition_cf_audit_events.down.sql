@@ -0,0 +1,52 @@
+-- Put every partition's rows back into a single table. Partitions which have
+-- been archived are not partitions any more, so their rows are not included.
+
+ALTER SEQUENCE cf_audit_events_id_seq OWNED BY NONE;
+ALTER TABLE cf_audit_events RENAME TO cf_audit_events_partitioned;
+ALTER TABLE cf_audit_events_partitioned RENAME CONSTRAINT cf_audit_events_pkey TO cf_audit_events_partitioned_pkey;
+ALTER INDEX cf_audit_events_id_idx RENAME TO cf_audit_events_partitioned_id_idx;
+ALTER INDEX cf_audit_events_created_at_idx RENAME TO cf_audit_events_partitioned_created_at_idx;
+ALTER INDEX cf_audit_events_state_organization_guid_idx RENAME TO cf_audit_events_partitioned_organization_guid_idx;
+ALTER INDEX cf_audit_events_state_space_guid_idx RENAME TO cf_audit_events_partitioned_space_guid_idx;
+ALTER INDEX cf_audit_events_state_event_type_idx RENAME TO cf_audit_events_partitioned_event_type_idx;
+ALTER INDEX cf_audit_events_foundation_created_at_idx RENAME TO cf_audit_events_partitioned_foundation_created_at_idx;
+
+CREATE TABLE cf_audit_events (
+	id integer NOT NULL DEFAULT nextval('cf_audit_events_id_seq'),
+	guid uuid UNIQUE NOT NULL,
+	created_at timestamptz NOT NULL,
+	event_type text NOT NULL,
+	actor text NOT NULL,
+	actor_type text NOT NULL,
+	actor_name text NOT NULL,
+	actor_username text NOT NULL,
+	actee text NOT NULL,
+	actee_type text NOT NULL,
+	actee_name text NOT NULL,
+	organization_guid uuid,
+	space_guid uuid,
+	metadata jsonb,
+	foundation text NOT NULL DEFAULT 'default',
+
+	PRIMARY KEY (guid),
+	CONSTRAINT created_at_not_zero_value CHECK (created_at > 'epoch'::timestamptz)
+);
+
+INSERT INTO cf_audit_events SELECT
+	id, guid, created_at, event_type,
+	actor, actor_type, actor_name, actor_username,
+	actee, actee_type, actee_name,
+	organization_guid, space_guid, metadata, foundation
+FROM cf_audit_events_partitioned;
+
+DROP TABLE cf_audit_events_partitioned;
+DROP FUNCTION create_cf_audit_events_partition(timestamptz);
+ALTER SEQUENCE cf_audit_events_id_seq OWNED BY cf_audit_events.id;
+
+CREATE INDEX cf_audit_events_id_idx ON cf_audit_events (id);
+CREATE INDEX cf_audit_events_guid_idx ON cf_audit_events (guid);
+CREATE INDEX cf_audit_events_created_at_idx ON cf_audit_events (created_at);
+CREATE INDEX cf_audit_events_state_organization_guid_idx ON cf_audit_events (organization_guid);
+CREATE INDEX cf_audit_events_state_space_guid_idx ON cf_audit_events (space_guid);
+CREATE INDEX cf_audit_events_state_event_type_idx ON cf_audit_events (event_type);
+CREATE INDEX cf_audit_events_foundation_created_at_idx ON cf_audit_events (foundation, created_at);
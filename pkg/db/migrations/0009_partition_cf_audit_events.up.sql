@@ -0,0 +1,84 @@
+-- Partition cf_audit_events by month of created_at, so that old months can be
+-- dropped without deleting rows one by one. The primary key of a partitioned
+-- table must include the partition key, so guid is only unique along with
+-- created_at. That is enough to ignore duplicates, as an event's created_at
+-- never changes.
+--
+-- The existing rows are copied into the new table, which takes a while for
+-- a large table but is done in this migration's transaction.
+
+ALTER SEQUENCE cf_audit_events_id_seq OWNED BY NONE;
+ALTER TABLE cf_audit_events RENAME TO cf_audit_events_unpartitioned;
+
+CREATE TABLE cf_audit_events (
+	id integer NOT NULL DEFAULT nextval('cf_audit_events_id_seq'),
+	guid uuid NOT NULL,
+	created_at timestamptz NOT NULL,
+	event_type text NOT NULL,
+	actor text NOT NULL,
+	actor_type text NOT NULL,
+	actor_name text NOT NULL,
+	actor_username text NOT NULL,
+	actee text NOT NULL,
+	actee_type text NOT NULL,
+	actee_name text NOT NULL,
+	organization_guid uuid,
+	space_guid uuid,
+	metadata jsonb,
+	foundation text NOT NULL DEFAULT 'default',
+
+	CONSTRAINT created_at_not_zero_value CHECK (created_at > 'epoch'::timestamptz)
+) PARTITION BY RANGE (created_at);
+
+-- create_cf_audit_events_partition creates the partition for the UTC month
+-- containing month, named like cf_audit_events_y2019m10, unless it exists.
+-- It returns whether it was created.
+CREATE OR REPLACE FUNCTION create_cf_audit_events_partition(month timestamptz) RETURNS boolean AS $$
+DECLARE
+	month_start timestamp := date_trunc('month', month AT TIME ZONE 'UTC');
+	partition text := 'cf_audit_events_' || to_char(month_start, '"y"YYYY"m"MM');
+BEGIN
+	IF to_regclass(partition) IS NOT NULL THEN
+		RETURN false;
+	END IF;
+	EXECUTE format(
+		'CREATE TABLE %I PARTITION OF cf_audit_events FOR VALUES FROM (%L) TO (%L)',
+		partition,
+		month_start AT TIME ZONE 'UTC',
+		(month_start + interval '1 month') AT TIME ZONE 'UTC'
+	);
+	RETURN true;
+END; $$ LANGUAGE plpgsql;
+
+SELECT count(create_cf_audit_events_partition(month)) FROM (
+	SELECT DISTINCT date_trunc('month', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS month
+	FROM cf_audit_events_unpartitioned
+	UNION
+	SELECT now()
+) months;
+
+INSERT INTO cf_audit_events (
+	id, guid, created_at, event_type,
+	actor, actor_type, actor_name, actor_username,
+	actee, actee_type, actee_name,
+	organization_guid, space_guid, metadata, foundation
+)
+SELECT
+	id, guid, created_at, event_type,
+	actor, actor_type, actor_name, actor_username,
+	actee, actee_type, actee_name,
+	organization_guid, space_guid, metadata, foundation
+FROM cf_audit_events_unpartitioned;
+
+DROP TABLE cf_audit_events_unpartitioned;
+ALTER SEQUENCE cf_audit_events_id_seq OWNED BY cf_audit_events.id;
+
+-- Indexes are created after copying, which is quicker, and once the old
+-- table's indexes have gone so that the names are free
+ALTER TABLE cf_audit_events ADD CONSTRAINT cf_audit_events_pkey PRIMARY KEY (guid, created_at);
+CREATE INDEX cf_audit_events_id_idx ON cf_audit_events (id);
+CREATE INDEX cf_audit_events_created_at_idx ON cf_audit_events (created_at);
+CREATE INDEX cf_audit_events_state_organization_guid_idx ON cf_audit_events (organization_guid);
+CREATE INDEX cf_audit_events_state_space_guid_idx ON cf_audit_events (space_guid);
+CREATE INDEX cf_audit_events_state_event_type_idx ON cf_audit_events (event_type);
+CREATE INDEX cf_audit_events_foundation_created_at_idx ON cf_audit_events (foundation, created_at);
@@ -0,0 +1,14 @@
+-- A record of each run of the retention policy, and the partitions it
+-- removed from cf_audit_events. cutoff is null when nothing is retired.
+CREATE TABLE IF NOT EXISTS retention_runs (
+	id bigserial PRIMARY KEY,
+	started_at timestamptz NOT NULL,
+	finished_at timestamptz NOT NULL,
+	retention_months integer NOT NULL,
+	action text NOT NULL,
+	cutoff timestamptz,
+	partitions_created text[] NOT NULL DEFAULT '{}',
+	partitions_retired text[] NOT NULL DEFAULT '{}',
+	events_retired bigint NOT NULL DEFAULT 0,
+	error text
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS cf_audit_events_chain;
+ALTER TABLE cf_audit_events DROP COLUMN IF EXISTS chain_hash;
+ALTER TABLE cf_audit_events DROP COLUMN IF EXISTS chain_prev_hash;
@@ -0,0 +1,17 @@
+-- Each event stored from now on is hashed along with the hash of the event
+-- stored before it, so that changing or deleting an event breaks the chain.
+-- Events stored before this migration are not part of the chain.
+ALTER TABLE cf_audit_events ADD COLUMN IF NOT EXISTS chain_prev_hash bytea;
+ALTER TABLE cf_audit_events ADD COLUMN IF NOT EXISTS chain_hash bytea;
+
+-- The single row of cf_audit_events_chain is the head of the chain. It is
+-- locked while events are stored, so that events are added to the chain one
+-- page at a time.
+CREATE TABLE IF NOT EXISTS cf_audit_events_chain (
+	id boolean PRIMARY KEY DEFAULT true CHECK (id),
+	length bigint NOT NULL DEFAULT 0,
+	head_hash bytea NOT NULL,
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+INSERT INTO cf_audit_events_chain (head_hash) VALUES (decode(repeat('00', 32), 'hex')) ON CONFLICT DO NOTHING;
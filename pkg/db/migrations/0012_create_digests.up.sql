@@ -0,0 +1,11 @@
+-- A signed statement of the events created on each UTC day
+CREATE TABLE IF NOT EXISTS digests (
+	date date PRIMARY KEY,
+	event_count bigint NOT NULL,
+	first_guid uuid,
+	last_guid uuid,
+	merkle_root bytea NOT NULL,
+	public_key bytea NOT NULL,
+	signature bytea NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
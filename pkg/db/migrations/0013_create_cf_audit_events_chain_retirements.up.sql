@@ -0,0 +1,14 @@
+-- Each run of events in the hash chain which was retired with a partition.
+-- Events are chained in the order they were stored, so a partition's events
+-- can be interleaved with newer ones. Verifying the chain follows it from
+-- prev_hash, the hash of the event before the run, to last_hash, the hash of
+-- the last event in the run, which the next event carries on from.
+CREATE TABLE IF NOT EXISTS cf_audit_events_chain_retirements (
+	first_id bigint PRIMARY KEY,
+	last_id bigint NOT NULL,
+	event_count bigint NOT NULL,
+	prev_hash bytea NOT NULL,
+	last_hash bytea NOT NULL,
+	partition text NOT NULL,
+	retired_at timestamptz NOT NULL DEFAULT now()
+);
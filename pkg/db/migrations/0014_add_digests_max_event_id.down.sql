@@ -0,0 +1 @@
+ALTER TABLE digests DROP COLUMN IF EXISTS max_event_id;
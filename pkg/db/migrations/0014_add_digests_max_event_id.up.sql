@@ -0,0 +1,5 @@
+-- The id of the latest event stored when each digest was made, so that
+-- events of the day stored later can be told apart from changed ones. It is
+-- 0 for digests made before it was recorded, which cover every event of
+-- their day.
+ALTER TABLE digests ADD COLUMN IF NOT EXISTS max_event_id bigint NOT NULL DEFAULT 0;
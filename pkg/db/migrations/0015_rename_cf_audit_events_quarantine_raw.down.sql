@@ -0,0 +1,3 @@
+ALTER TABLE cf_audit_events_quarantine ALTER COLUMN event TYPE jsonb USING event::jsonb;
+ALTER TABLE cf_audit_events_quarantine RENAME COLUMN event_sha256 TO raw_sha256;
+ALTER TABLE cf_audit_events_quarantine RENAME COLUMN event TO raw;
@@ -0,0 +1,8 @@
+-- The quarantine holds each event as it was decoded from Cloud Controller's
+-- response and encoded as JSON again, not the response itself, so the
+-- columns are named for what they hold. The event is text rather than jsonb
+-- so that events which jsonb cannot hold, such as those with \u0000 in their
+-- metadata, can be quarantined.
+ALTER TABLE cf_audit_events_quarantine RENAME COLUMN raw TO event;
+ALTER TABLE cf_audit_events_quarantine RENAME COLUMN raw_sha256 TO event_sha256;
+ALTER TABLE cf_audit_events_quarantine ALTER COLUMN event TYPE text;
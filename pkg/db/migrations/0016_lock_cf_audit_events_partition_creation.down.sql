@@ -0,0 +1,16 @@
+CREATE OR REPLACE FUNCTION create_cf_audit_events_partition(month timestamptz) RETURNS boolean AS $$
+DECLARE
+	month_start timestamp := date_trunc('month', month AT TIME ZONE 'UTC');
+	partition text := 'cf_audit_events_' || to_char(month_start, '"y"YYYY"m"MM');
+BEGIN
+	IF to_regclass(partition) IS NOT NULL THEN
+		RETURN false;
+	END IF;
+	EXECUTE format(
+		'CREATE TABLE %I PARTITION OF cf_audit_events FOR VALUES FROM (%L) TO (%L)',
+		partition,
+		month_start AT TIME ZONE 'UTC',
+		(month_start + interval '1 month') AT TIME ZONE 'UTC'
+	);
+	RETURN true;
+END; $$ LANGUAGE plpgsql;
@@ -0,0 +1,26 @@
+-- create_cf_audit_events_partition could be called for the same month by two
+-- transactions at once, for example by the partition maintainer and a
+-- backfill, and both find the partition missing before either creates it.
+-- An advisory lock on the partition, held until the end of the transaction,
+-- makes the second wait and then find the partition made by the first.
+CREATE OR REPLACE FUNCTION create_cf_audit_events_partition(month timestamptz) RETURNS boolean AS $$
+DECLARE
+	month_start timestamp := date_trunc('month', month AT TIME ZONE 'UTC');
+	partition text := 'cf_audit_events_' || to_char(month_start, '"y"YYYY"m"MM');
+BEGIN
+	IF to_regclass(partition) IS NOT NULL THEN
+		RETURN false;
+	END IF;
+	-- 1885434484 is "part"
+	PERFORM pg_advisory_xact_lock(1885434484, hashtext(partition));
+	IF to_regclass(partition) IS NOT NULL THEN
+		RETURN false;
+	END IF;
+	EXECUTE format(
+		'CREATE TABLE %I PARTITION OF cf_audit_events FOR VALUES FROM (%L) TO (%L)',
+		partition,
+		month_start AT TIME ZONE 'UTC',
+		(month_start + interval '1 month') AT TIME ZONE 'UTC'
+	);
+	RETURN true;
+END; $$ LANGUAGE plpgsql;
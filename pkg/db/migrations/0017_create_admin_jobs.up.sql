@@ -0,0 +1,17 @@
+-- Jobs asked for through the admin endpoints, so that any instance can report
+-- on a job, and jobs outlive the instance which ran them
+CREATE TABLE IF NOT EXISTS admin_jobs (
+	id text PRIMARY KEY,
+	kind text NOT NULL,
+	foundation text NOT NULL,
+	window_from timestamptz,
+	window_to timestamptz,
+	status text NOT NULL,
+	events_collected bigint NOT NULL DEFAULT 0,
+	error text,
+	created_at timestamptz NOT NULL,
+	started_at timestamptz,
+	finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS admin_jobs_unfinished_idx ON admin_jobs (created_at) WHERE finished_at IS NULL;
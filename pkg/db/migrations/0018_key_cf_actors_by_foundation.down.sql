@@ -0,0 +1,5 @@
+-- Only the most recently seen actor with each guid can be kept
+DELETE FROM cf_actors a USING cf_actors b
+	WHERE a.guid = b.guid AND (a.last_seen, a.foundation) < (b.last_seen, b.foundation);
+ALTER TABLE cf_actors DROP CONSTRAINT IF EXISTS cf_actors_pkey;
+ALTER TABLE cf_actors ADD PRIMARY KEY (guid);
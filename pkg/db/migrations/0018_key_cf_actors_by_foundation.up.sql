@@ -0,0 +1,4 @@
+-- UAA user GUIDs are only unique within a foundation, so actors are keyed by
+-- foundation as well, as events are joined to them
+ALTER TABLE cf_actors DROP CONSTRAINT IF EXISTS cf_actors_pkey;
+ALTER TABLE cf_actors ADD PRIMARY KEY (foundation, guid);
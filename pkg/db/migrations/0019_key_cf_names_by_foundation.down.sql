@@ -0,0 +1,10 @@
+-- Only one foundation's record of each name can be kept
+DELETE FROM cf_organization_names a USING cf_organization_names b
+	WHERE a.guid = b.guid AND a.name = b.name AND a.foundation > b.foundation;
+ALTER TABLE cf_organization_names DROP CONSTRAINT IF EXISTS cf_organization_names_pkey;
+ALTER TABLE cf_organization_names ADD PRIMARY KEY (guid, name);
+
+DELETE FROM cf_space_names a USING cf_space_names b
+	WHERE a.guid = b.guid AND a.name = b.name AND a.foundation > b.foundation;
+ALTER TABLE cf_space_names DROP CONSTRAINT IF EXISTS cf_space_names_pkey;
+ALTER TABLE cf_space_names ADD PRIMARY KEY (guid, name);
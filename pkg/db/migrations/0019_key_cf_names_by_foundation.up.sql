@@ -0,0 +1,7 @@
+-- Organization and space GUIDs are only unique within a foundation, so names
+-- are keyed by foundation as well, as events are joined to them
+ALTER TABLE cf_organization_names DROP CONSTRAINT IF EXISTS cf_organization_names_pkey;
+ALTER TABLE cf_organization_names ADD PRIMARY KEY (foundation, guid, name);
+
+ALTER TABLE cf_space_names DROP CONSTRAINT IF EXISTS cf_space_names_pkey;
+ALTER TABLE cf_space_names ADD PRIMARY KEY (foundation, guid, name);
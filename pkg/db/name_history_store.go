@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	OrganizationNamesTable = "cf_organization_names"
+	SpaceNamesTable        = "cf_space_names"
+)
+
+type NameHistoryDB interface {
+	RecordOrganizationName(foundation string, guid string, name string, seenAt time.Time) error
+	RecordSpaceName(foundation string, guid string, name string, seenAt time.Time) error
+}
+
+// cfAuditEventNamesJoin joins the names of each event's organization and
+// space from when the event happened. If the name at the time is unknown the
+// earliest name seen afterwards is used. Only names seen in the event's
+// foundation are used. It expects cf_audit_events to be aliased as e.
+const cfAuditEventNamesJoin = `
+	left join lateral (
+		select name from ` + OrganizationNamesTable + ` n
+		where n.foundation = e.foundation and n.guid = e.organization_guid
+		order by
+			n.first_seen <= e.created_at desc,
+			abs(extract(epoch from n.first_seen - e.created_at)) asc
+		limit 1
+	) organization_name on true
+	left join lateral (
+		select name from ` + SpaceNamesTable + ` n
+		where n.foundation = e.foundation and n.guid = e.space_guid
+		order by
+			n.first_seen <= e.created_at desc,
+			abs(extract(epoch from n.first_seen - e.created_at)) asc
+		limit 1
+	) space_name on true
+`
+
+// RecordOrganizationName records that an organization had a name at seenAt
+func (s *EventStore) RecordOrganizationName(foundation string, guid string, name string, seenAt time.Time) error {
+	return s.recordName(OrganizationNamesTable, foundation, guid, name, seenAt)
+}
+
+// RecordSpaceName records that a space had a name at seenAt
+func (s *EventStore) RecordSpaceName(foundation string, guid string, name string, seenAt time.Time) error {
+	return s.recordName(SpaceNamesTable, foundation, guid, name, seenAt)
+}
+
+func (s *EventStore) recordName(table string, foundation string, guid string, name string, seenAt time.Time) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	stmt := fmt.Sprintf(
+		`insert into %s (guid, name, foundation, first_seen, last_seen) values (
+				$1, $2, $3, $4, $4
+			) on conflict (foundation, guid, name) do
+			update set
+				first_seen = least(%s.first_seen, excluded.first_seen),
+				last_seen = greatest(%s.last_seen, excluded.last_seen)`,
+		table, table, table,
+	)
+
+	_, err := s.db.ExecContext(ctx, stmt, guid, name, foundation, seenAt)
+	return err
+}
@@ -0,0 +1,66 @@
+package db_test
+
+import (
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("Name history", func() {
+	Context("against Postgres", func() {
+		var store *db.EventStore
+
+		const (
+			orgGUID   = "a0000000-0000-0000-0000-000000000000"
+			spaceGUID = "b0000000-0000-0000-0000-000000000000"
+		)
+		createdAt := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+
+		BeforeEach(func() {
+			store, _ = newTestEventStore()
+
+			for foundation, guid := range map[string]string{
+				"london":  "10000000-0000-0000-0000-000000000001",
+				"ireland": "20000000-0000-0000-0000-000000000002",
+			} {
+				_, err := store.StoreCFAuditEvents(foundation, []cfclient.Event{{
+					GUID:             guid,
+					CreatedAt:        createdAt.Format(time.RFC3339),
+					Type:             "audit.app.create",
+					OrganizationGUID: orgGUID,
+					SpaceGUID:        spaceGUID,
+				}})
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		names := func(foundation string) []string {
+			page, err := store.QueryCFAuditEvents(db.EventQuery{
+				Foundation: foundation,
+				To:         createdAt.Add(time.Hour),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			names := []string{}
+			for _, event := range page.Events {
+				names = append(names, event.OrganizationName+"/"+event.SpaceName)
+			}
+			return names
+		}
+
+		It("only joins events to the names seen in their own foundation", func() {
+			Expect(store.RecordOrganizationName("london", orgGUID, "london-org", createdAt)).To(Succeed())
+			Expect(store.RecordSpaceName("london", spaceGUID, "london-space", createdAt)).To(Succeed())
+
+			Expect(names("london")).To(Equal([]string{"london-org/london-space"}))
+			Expect(names("ireland")).To(Equal([]string{"/"}))
+
+			By("recording the same name separately for each foundation")
+			Expect(store.RecordOrganizationName("ireland", orgGUID, "london-org", createdAt)).To(Succeed())
+			Expect(names("ireland")).To(Equal([]string{"london-org/"}))
+		})
+	})
+})
@@ -0,0 +1,266 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const RetentionRunsTable = "retention_runs"
+
+// RetentionAction is what is done with partitions older than the retention
+// period
+type RetentionAction string
+
+const (
+	// RetentionDrop detaches and drops old partitions, deleting their events
+	RetentionDrop RetentionAction = "drop"
+	// RetentionArchive detaches old partitions and keeps them as tables named
+	// like cf_audit_events_archived_y2019m10, so that they can be exported
+	// and dropped by hand
+	RetentionArchive RetentionAction = "archive"
+)
+
+type PartitionDB interface {
+	CreateCFAuditEventPartition(month time.Time) (bool, error)
+	GetCFAuditEventPartitions() ([]Partition, error)
+	RetireCFAuditEventPartition(partition Partition, action RetentionAction) (int64, error)
+	RecordRetentionRun(run RetentionRun) error
+}
+
+// Partition is the partition of cf_audit_events holding a UTC month of
+// events
+type Partition struct {
+	Name  string
+	Month time.Time
+}
+
+// End is when the month after the partition's starts
+func (p Partition) End() time.Time {
+	return p.Month.AddDate(0, 1, 0)
+}
+
+// RetentionRun records what a run of the retention policy did
+type RetentionRun struct {
+	StartedAt       time.Time
+	FinishedAt      time.Time
+	RetentionMonths int
+	Action          RetentionAction
+	// Cutoff is when partitions must end by to be retired, or zero if
+	// partitions are kept forever
+	Cutoff            time.Time
+	PartitionsCreated []string
+	PartitionsRetired []string
+	EventsRetired     int64
+	Error             error
+}
+
+var partitionName = regexp.MustCompile(`^` + CFAuditEventsTable + `_y(\d{4})m(\d{2})$`)
+
+// PartitionMonth returns the start of the UTC month containing t
+func PartitionMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// CreateCFAuditEventPartition creates the partition for the UTC month
+// containing month, unless it exists, and returns whether it was created
+func (s *EventStore) CreateCFAuditEventPartition(month time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	var created bool
+	err := s.db.QueryRowContext(ctx,
+		`select create_cf_audit_events_partition($1)`, PartitionMonth(month),
+	).Scan(&created)
+	return created, err
+}
+
+// GetCFAuditEventPartitions returns the partitions of cf_audit_events,
+// oldest first
+func (s *EventStore) GetCFAuditEventPartitions() ([]Partition, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		select
+			c.relname
+		from
+			pg_inherits i
+			join pg_class c on c.oid = i.inhrelid
+		where
+			i.inhparent = $1::regclass
+	`, CFAuditEventsTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := []Partition{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		match := partitionName.FindStringSubmatch(name)
+		if match == nil {
+			// Not created by create_cf_audit_events_partition, so not
+			// something to manage
+			continue
+		}
+		year, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+		partitions = append(partitions, Partition{
+			Name:  name,
+			Month: time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(partitions, func(a, b int) bool {
+		return partitions[a].Month.Before(partitions[b].Month)
+	})
+	return partitions, nil
+}
+
+// RetireCFAuditEventPartition detaches a partition from cf_audit_events and
+// then drops or archives it, returning how many events it held
+func (s *EventStore) RetireCFAuditEventPartition(partition Partition, action RetentionAction) (int64, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	table := pq.QuoteIdentifier(partition.Name)
+
+	var count int64
+	if err := tx.QueryRowContext(ctx, `select count(*) from `+table).Scan(&count); err != nil {
+		return 0, err
+	}
+	if err := retireCFAuditEventChainLinks(ctx, tx, partition); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `alter table `+CFAuditEventsTable+` detach partition `+table); err != nil {
+		return 0, wrapPqError(err, "detach "+partition.Name)
+	}
+
+	switch action {
+	case RetentionDrop:
+		_, err = tx.ExecContext(ctx, `drop table `+table)
+	case RetentionArchive:
+		archived := pq.QuoteIdentifier(fmt.Sprintf(
+			"%s_archived_%s", CFAuditEventsTable, partition.Month.Format("y2006m01"),
+		))
+		_, err = tx.ExecContext(ctx, `alter table `+table+` rename to `+archived)
+	default:
+		return 0, fmt.Errorf("unknown retention action %q", action)
+	}
+	if err != nil {
+		return 0, wrapPqError(err, string(action)+" "+partition.Name)
+	}
+
+	return count, tx.Commit()
+}
+
+// retireCFAuditEventChainLinks records each run of a partition's events which
+// are next to each other in the hash chain, so that the chain can be followed
+// across them once they are gone. A run ends where the next event in the
+// partition does not carry on from the one before it, because events from
+// other months were stored between them.
+func retireCFAuditEventChainLinks(ctx context.Context, tx *sql.Tx, partition Partition) error {
+	_, err := tx.ExecContext(ctx, `
+		insert into `+CFAuditEventsChainRetirementsTable+` (
+			first_id, last_id, event_count, prev_hash, last_hash, partition
+		)
+		select
+			min(id),
+			max(id),
+			count(*),
+			(array_agg(chain_prev_hash order by id asc))[1],
+			(array_agg(chain_hash order by id desc))[1],
+			$1
+		from (
+			select
+				id, chain_prev_hash, chain_hash,
+				sum(starts_run::int) over (order by id) as run
+			from (
+				select
+					id, chain_prev_hash, chain_hash,
+					chain_prev_hash is distinct from lag(chain_hash) over (order by id) as starts_run
+				from
+					`+pq.QuoteIdentifier(partition.Name)+`
+				where
+					chain_hash is not null
+			) links
+		) runs
+		group by
+			run
+	`, partition.Name)
+	if err != nil {
+		return wrapPqError(err, "failed to record retired chain links of "+partition.Name)
+	}
+	return nil
+}
+
+// RecordRetentionRun records a run of the retention policy in the
+// retention_runs table
+func (s *EventStore) RecordRetentionRun(run RetentionRun) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	created, retired := run.PartitionsCreated, run.PartitionsRetired
+	if created == nil {
+		created = []string{}
+	}
+	if retired == nil {
+		retired = []string{}
+	}
+
+	var cutoff *time.Time
+	if !run.Cutoff.IsZero() {
+		cutoff = &run.Cutoff
+	}
+
+	var runErr *string
+	if run.Error != nil {
+		msg := run.Error.Error()
+		runErr = &msg
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		insert into `+RetentionRunsTable+` (
+			started_at,
+			finished_at,
+			retention_months,
+			action,
+			cutoff,
+			partitions_created,
+			partitions_retired,
+			events_retired,
+			error
+		) values (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9
+		)
+	`,
+		run.StartedAt,
+		run.FinishedAt,
+		run.RetentionMonths,
+		string(run.Action),
+		cutoff,
+		pq.Array(created),
+		pq.Array(retired),
+		run.EventsRetired,
+		runErr,
+	)
+	return err
+}
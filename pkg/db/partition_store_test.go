@@ -0,0 +1,54 @@
+package db_test
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("Partitions", func() {
+	Context("against Postgres", func() {
+		var store *db.EventStore
+
+		BeforeEach(func() {
+			store, _ = newTestEventStore()
+		})
+
+		It("creates a partition once when it is asked for at the same time", func() {
+			month := time.Date(2001, 1, 15, 0, 0, 0, 0, time.UTC)
+
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				created int
+			)
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					ok, err := store.CreateCFAuditEventPartition(month)
+					Expect(err).NotTo(HaveOccurred())
+					if ok {
+						mu.Lock()
+						created++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			Expect(created).To(Equal(1))
+
+			partitions, err := store.GetCFAuditEventPartitions()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(partitions).To(ContainElement(db.Partition{
+				Name:  "cf_audit_events_y2001m01",
+				Month: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC),
+			}))
+		})
+	})
+})
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	"github.com/lib/pq"
+)
+
+const CFAuditEventsQuarantineTable = "cf_audit_events_quarantine"
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// QuarantinedCFAuditEvent is an event which could not be stored
+type QuarantinedCFAuditEvent struct {
+	ID         int64
+	Foundation string
+	// GUID is the event's GUID, if it is known, for finding the event
+	GUID string
+	// Event is the item of Cloud Controller's response which the event was
+	// fetched as. Events which were not fetched, for example those which were
+	// imported, are held as their cfclient.Event encoded as JSON.
+	Event         json.RawMessage
+	Reason        string
+	QuarantinedAt time.Time
+}
+
+// ValidateCFAuditEvent returns why an event cannot be stored in
+// cf_audit_events, or nil if it can
+func ValidateCFAuditEvent(event cfclient.Event) error {
+	if !uuidPattern.MatchString(event.GUID) {
+		return fmt.Errorf("guid %q is not a UUID", event.GUID)
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("created_at %q is not a time: %s", event.CreatedAt, err)
+	}
+	if !createdAt.After(time.Unix(0, 0)) {
+		return fmt.Errorf("created_at %q is not after the epoch", event.CreatedAt)
+	}
+
+	if event.OrganizationGUID != "" && !uuidPattern.MatchString(event.OrganizationGUID) {
+		return fmt.Errorf("organization_guid %q is not a UUID", event.OrganizationGUID)
+	}
+	if event.SpaceGUID != "" && !uuidPattern.MatchString(event.SpaceGUID) {
+		return fmt.Errorf("space_guid %q is not a UUID", event.SpaceGUID)
+	}
+
+	// Postgres cannot store NUL in text, nor \u0000 in jsonb
+	fields := map[string]string{
+		"type":           event.Type,
+		"actor":          event.Actor,
+		"actor_type":     event.ActorType,
+		"actor_name":     event.ActorName,
+		"actor_username": event.ActorUsername,
+		"actee":          event.Actee,
+		"actee_type":     event.ActeeType,
+		"actee_name":     event.ActeeName,
+	}
+	for name, value := range fields {
+		if strings.ContainsRune(value, 0) {
+			return fmt.Errorf("%s contains NUL", name)
+		}
+	}
+	if path, ok := findNUL("metadata", event.Metadata); ok {
+		return fmt.Errorf("%s contains NUL", path)
+	}
+	return nil
+}
+
+// findNUL returns the path of a key or string in v, which was decoded from
+// JSON, which contains NUL
+func findNUL(path string, v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return path, strings.ContainsRune(v, 0)
+	case map[string]interface{}:
+		for key, value := range v {
+			if strings.ContainsRune(key, 0) {
+				return path, true
+			}
+			if found, ok := findNUL(path+"."+key, value); ok {
+				return found, true
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			if found, ok := findNUL(fmt.Sprintf("%s[%d]", path, i), value); ok {
+				return found, true
+			}
+		}
+	}
+	return "", false
+}
+
+// QuarantineCFAuditEvents records events which could not be stored, as they
+// were fetched, along with why. Events which are already quarantined are
+// ignored.
+func (s *EventStore) QuarantineCFAuditEvents(foundation string, events []QuarantinedCFAuditEvent) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, event := range events {
+		if err := quarantineCFAuditEvent(ctx, tx, foundation, event.GUID, event.Event, event.Reason); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// quarantineCFAuditEvent records an event which could not be stored, unless
+// it is already quarantined
+func quarantineCFAuditEvent(ctx context.Context, tx *sql.Tx, foundation string, guid string, event []byte, reason string) error {
+	sum := sha256.Sum256(event)
+
+	// The event column is text, which cannot hold invalid UTF-8, so it is
+	// replaced, but the event is still identified by what was sent. The guid
+	// column is only for finding the event, so NUL is left out of it.
+	_, err := tx.ExecContext(ctx, `
+		insert into `+CFAuditEventsQuarantineTable+` (
+			foundation, guid, event, event_sha256, reason, quarantined_at
+		) values (
+			$1, $2, $3, $4, $5, now()
+		) on conflict (foundation, event_sha256) do nothing
+	`,
+		foundation,
+		strings.ReplaceAll(guid, "\x00", ""),
+		strings.ToValidUTF8(string(event), "\uFFFD"),
+		hex.EncodeToString(sum[:]),
+		reason,
+	)
+	return err
+}
+
+// GetQuarantinedCFAuditEvents returns the quarantined events for a
+// foundation which have not been reprocessed, oldest first
+func (s *EventStore) GetQuarantinedCFAuditEvents(foundation string) ([]QuarantinedCFAuditEvent, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		select
+			id,
+			foundation,
+			guid,
+			event,
+			reason,
+			quarantined_at
+		from
+			`+CFAuditEventsQuarantineTable+`
+		where
+			foundation = $1
+			and reprocessed_at is null
+		order by
+			id asc
+	`, foundation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []QuarantinedCFAuditEvent{}
+	for rows.Next() {
+		event := QuarantinedCFAuditEvent{}
+		var b []byte
+		err := rows.Scan(&event.ID, &event.Foundation, &event.GUID, &b, &event.Reason, &event.QuarantinedAt)
+		if err != nil {
+			return nil, err
+		}
+		event.Event = b
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// MarkCFAuditEventsReprocessed records that quarantined events have since
+// been stored
+func (s *EventStore) MarkCFAuditEventsReprocessed(ids []int64) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		update `+CFAuditEventsQuarantineTable+`
+		set reprocessed_at = now()
+		where id = any($1)
+	`, pq.Array(ids))
+	return err
+}
@@ -0,0 +1,49 @@
+package db_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("ValidateCFAuditEvent", func() {
+	var event cfclient.Event
+
+	BeforeEach(func() {
+		event = cfclient.Event{
+			GUID:             "2c1b4b21-7be8-4f38-a4dd-ac7d5b6ad4b7",
+			CreatedAt:        "2019-10-04T12:40:43Z",
+			OrganizationGUID: "9d8a3b1c-1111-4c4c-8f8f-000000000001",
+			SpaceGUID:        "",
+		}
+	})
+
+	It("accepts valid events", func() {
+		Expect(db.ValidateCFAuditEvent(event)).To(Succeed())
+	})
+
+	It("rejects events which are not UUIDs", func() {
+		event.GUID = "not-a-guid"
+		Expect(db.ValidateCFAuditEvent(event)).To(MatchError(ContainSubstring(`guid "not-a-guid" is not a UUID`)))
+	})
+
+	It("rejects events with a missing or zero created_at", func() {
+		event.CreatedAt = ""
+		Expect(db.ValidateCFAuditEvent(event)).To(MatchError(ContainSubstring("created_at")))
+
+		event.CreatedAt = "0001-01-01T00:00:00Z"
+		Expect(db.ValidateCFAuditEvent(event)).To(MatchError(ContainSubstring("not after the epoch")))
+	})
+
+	It("rejects organization and space GUIDs which are not UUIDs", func() {
+		event.OrganizationGUID = "london"
+		Expect(db.ValidateCFAuditEvent(event)).To(MatchError(ContainSubstring("organization_guid")))
+
+		event.OrganizationGUID = ""
+		event.SpaceGUID = "dev"
+		Expect(db.ValidateCFAuditEvent(event)).To(MatchError(ContainSubstring("space_guid")))
+	})
+})
@@ -0,0 +1,328 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultQueryLimit = 100
+	MaxQueryLimit     = 1000
+
+	// streamFetchSize is how many events StreamCFAuditEvents reads at a time
+	streamFetchSize = 1000
+)
+
+// EventQuery selects stored audit events. Every field is optional, and the
+// events returned match all of those which are set.
+type EventQuery struct {
+	Foundation string
+	// From and To select events created at or after From and before To
+	From time.Time
+	To   time.Time
+
+	OrganizationGUID string
+	SpaceGUID        string
+	// Actor matches the actor's GUID, name or username
+	Actor string
+	// Actee matches the actee's GUID or name
+	Actee string
+	// EventTypes match events of any of the types. A type ending in * matches
+	// every type starting with what comes before it, like audit.app.*
+	EventTypes []string
+	// Metadata predicates must all be true of the event's metadata
+	Metadata []MetadataPredicate
+
+	// Descending returns the newest events first, rather than the oldest
+	Descending bool
+	// Limit is the most events returned in a page, DefaultQueryLimit if it
+	// is zero and at most MaxQueryLimit
+	Limit int
+	// PageToken is the NextPageToken of the previous page, for the rest of
+	// the events. The rest of the query must be the same.
+	PageToken string
+}
+
+// MetadataPredicate is a test of the value at Path in an event's metadata,
+// for example {"request", "name"}. If Exists is set it tests that there is a
+// value there, otherwise that the value equals Equals.
+type MetadataPredicate struct {
+	Path   []string
+	Equals interface{}
+	Exists bool
+}
+
+// EventPage is a page of events matching an EventQuery. NextPageToken is
+// empty if there are no more events.
+type EventPage struct {
+	Events        []CFAuditEvent
+	NextPageToken string
+}
+
+// pageToken is where a page ended. Events are ordered by created_at and then
+// guid, so the next page starts after the last event of this one, however
+// many events have been stored since.
+type pageToken struct {
+	CreatedAt  time.Time `json:"c"`
+	GUID       string    `json:"g"`
+	Descending bool      `json:"d"`
+}
+
+func (t pageToken) encode() string {
+	b, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePageToken(s string) (pageToken, error) {
+	var t pageToken
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return t, fmt.Errorf("invalid page token")
+	}
+	if err := json.Unmarshal(b, &t); err != nil || !uuidPattern.MatchString(t.GUID) {
+		return t, fmt.Errorf("invalid page token")
+	}
+	return t, nil
+}
+
+// queryBuilder builds the where clause of a query. Conditions are written
+// with ? for each argument, which are replaced by numbered parameters, so
+// that values are never put in the SQL itself.
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (b *queryBuilder) where(condition string, args ...interface{}) {
+	var sb strings.Builder
+	for _, r := range condition {
+		if r == '?' {
+			b.args = append(b.args, args[0])
+			args = args[1:]
+			sb.WriteString("$" + strconv.Itoa(len(b.args)))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	b.conditions = append(b.conditions, sb.String())
+}
+
+func (b *queryBuilder) whereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return "where " + strings.Join(b.conditions, " and ")
+}
+
+// buildEventQuery returns the SQL and arguments selecting the events
+// matching a query, in order, after its page token. At most limit events are
+// selected, or every event if limit is zero. query.Limit is not used.
+func buildEventQuery(query EventQuery, limit int) (string, []interface{}, error) {
+	b := &queryBuilder{}
+	if query.Foundation != "" {
+		b.where("e.foundation = ?", query.Foundation)
+	}
+	if !query.From.IsZero() {
+		b.where("e.created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		b.where("e.created_at < ?", query.To)
+	}
+	if query.OrganizationGUID != "" {
+		if !uuidPattern.MatchString(query.OrganizationGUID) {
+			return "", nil, fmt.Errorf("organization GUID %q is not a UUID", query.OrganizationGUID)
+		}
+		b.where("e.organization_guid = ?::uuid", query.OrganizationGUID)
+	}
+	if query.SpaceGUID != "" {
+		if !uuidPattern.MatchString(query.SpaceGUID) {
+			return "", nil, fmt.Errorf("space GUID %q is not a UUID", query.SpaceGUID)
+		}
+		b.where("e.space_guid = ?::uuid", query.SpaceGUID)
+	}
+	if query.Actor != "" {
+		b.where("(e.actor = ? or e.actor_name = ? or e.actor_username = ?)", query.Actor, query.Actor, query.Actor)
+	}
+	if query.Actee != "" {
+		b.where("(e.actee = ? or e.actee_name = ?)", query.Actee, query.Actee)
+	}
+	if len(query.EventTypes) > 0 {
+		exact, prefixes := []string{}, []string{}
+		for _, eventType := range query.EventTypes {
+			if prefix, ok := strings.CutSuffix(eventType, "*"); ok {
+				prefixes = append(prefixes, escapeLike(prefix)+"%")
+			} else {
+				exact = append(exact, eventType)
+			}
+		}
+		b.where("(e.event_type = any(?) or e.event_type like any(?))", pq.Array(exact), pq.Array(prefixes))
+	}
+	for _, predicate := range query.Metadata {
+		if len(predicate.Path) == 0 {
+			return "", nil, fmt.Errorf("metadata predicates need a path")
+		}
+		if predicate.Exists {
+			b.where("e.metadata #> ? is not null", pq.Array(predicate.Path))
+			continue
+		}
+		// Containment of a document with just the value at the path, which
+		// is true when the value there equals it
+		var document interface{} = predicate.Equals
+		for i := len(predicate.Path) - 1; i >= 0; i-- {
+			document = map[string]interface{}{predicate.Path[i]: document}
+		}
+		documentJSON, err := json.Marshal(document)
+		if err != nil {
+			return "", nil, fmt.Errorf("metadata predicate for %s: %s", strings.Join(predicate.Path, "."), err)
+		}
+		b.where("e.metadata @> ?::jsonb", string(documentJSON))
+	}
+
+	order := "asc"
+	if query.Descending {
+		order = "desc"
+	}
+	if query.PageToken != "" {
+		token, err := decodePageToken(query.PageToken)
+		if err != nil {
+			return "", nil, err
+		}
+		if token.Descending != query.Descending {
+			return "", nil, fmt.Errorf("page token is for the other order")
+		}
+		if query.Descending {
+			b.where("(e.created_at, e.guid) < (?, ?::uuid)", token.CreatedAt, token.GUID)
+		} else {
+			b.where("(e.created_at, e.guid) > (?, ?::uuid)", token.CreatedAt, token.GUID)
+		}
+	}
+
+	limitClause := ""
+	if limit > 0 {
+		b.args = append(b.args, limit)
+		limitClause = "limit $" + strconv.Itoa(len(b.args))
+	}
+	return `
+		select
+			` + cfAuditEventColumns + `
+		from (
+			select * from ` + CFAuditEventsTable + ` e
+			` + b.whereClause() + `
+			order by e.created_at ` + order + `, e.guid ` + order + `
+			` + limitClause + `
+		) e
+		` + cfAuditEventNamesJoin + `
+		` + cfAuditEventActorsJoin + `
+		order by e.created_at ` + order + `, e.guid ` + order, b.args, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// QueryCFAuditEvents returns a page of the events matching query, ordered by
+// when they were created
+func (s *EventStore) QueryCFAuditEvents(query EventQuery) (EventPage, error) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = DefaultQueryLimit
+	}
+	if limit < 0 || limit > MaxQueryLimit {
+		return EventPage{}, fmt.Errorf("limit must be between 1 and %d", MaxQueryLimit)
+	}
+
+	// One more event than the limit is selected, to tell if there is
+	// another page
+	stmt, args, err := buildEventQuery(query, limit+1)
+	if err != nil {
+		return EventPage{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return EventPage{}, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return EventPage{}, err
+	}
+	defer rows.Close()
+	events, err := scanCFAuditEvents(rows)
+	if err != nil {
+		return EventPage{}, err
+	}
+
+	page := EventPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		last := page.Events[limit-1]
+		createdAt, err := time.Parse(time.RFC3339Nano, last.CreatedAt)
+		if err != nil {
+			return EventPage{}, err
+		}
+		page.NextPageToken = pageToken{
+			CreatedAt:  createdAt,
+			GUID:       last.GUID,
+			Descending: query.Descending,
+		}.encode()
+	}
+	return page, nil
+}
+
+// StreamCFAuditEvents calls fn with each event matching query, in order,
+// however many there are. The events are read through a server-side cursor a
+// batch at a time, so memory use does not grow with the number of events.
+// query.Limit is not used. Streaming stops when ctx is cancelled or fn
+// returns an error, which is returned.
+func (s *EventStore) StreamCFAuditEvents(ctx context.Context, query EventQuery, fn func(event CFAuditEvent) error) error {
+	stmt, args, err := buildEventQuery(query, 0)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `declare cf_audit_events_stream no scroll cursor for `+stmt, args...); err != nil {
+		return wrapPqError(err, "failed to declare cursor")
+	}
+
+	for {
+		rows, err := tx.QueryContext(ctx, `fetch forward `+strconv.Itoa(streamFetchSize)+` from cf_audit_events_stream`)
+		if err != nil {
+			return err
+		}
+		events, err := scanCFAuditEvents(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+		if len(events) < streamFetchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("QueryCFAuditEvents", func() {
+	It("rejects bad queries without querying the database", func() {
+		store := db.NewEventStore(context.Background(), nil, lager.NewLogger("db-test"))
+
+		for _, query := range []db.EventQuery{
+			{Limit: db.MaxQueryLimit + 1},
+			{Limit: -1},
+			{OrganizationGUID: "'; drop table cf_audit_events; --"},
+			{SpaceGUID: "not-a-guid"},
+			{Metadata: []db.MetadataPredicate{{Equals: "x"}}},
+			{PageToken: "not-a-token"},
+		} {
+			_, err := store.QueryCFAuditEvents(query)
+			Expect(err).To(HaveOccurred(), "%+v", query)
+		}
+	})
+
+	Context("against Postgres", func() {
+		var store *db.EventStore
+
+		const (
+			orgA = "a0000000-0000-0000-0000-000000000000"
+			orgB = "b0000000-0000-0000-0000-000000000000"
+		)
+
+		event := func(guid string, createdAt time.Time, eventType string, org string) cfclient.Event {
+			return cfclient.Event{
+				GUID:             guid,
+				CreatedAt:        createdAt.Format(time.RFC3339Nano),
+				Type:             eventType,
+				Actor:            "actor-guid",
+				ActorType:        "user",
+				ActorName:        "admin",
+				ActorUsername:    "admin@example.com",
+				Actee:            "app-" + guid[:1],
+				ActeeType:        "app",
+				ActeeName:        "my-app",
+				OrganizationGUID: org,
+				Metadata:         map[string]interface{}{"request": map[string]interface{}{"state": "STARTED"}},
+			}
+		}
+
+		guids := func(page db.EventPage) []string {
+			guids := []string{}
+			for _, event := range page.Events {
+				guids = append(guids, event.GUID)
+			}
+			return guids
+		}
+
+		start := time.Date(2019, 10, 30, 23, 0, 0, 0, time.UTC)
+
+		BeforeEach(func() {
+			store, _ = newTestEventStore()
+
+			stopped := event("50000000-0000-0000-0000-000000000005", start.Add(4*time.Hour), "audit.app.stop", orgB)
+			stopped.Metadata = map[string]interface{}{"request": map[string]interface{}{"state": "STOPPED"}}
+
+			_, err := store.StoreCFAuditEvents("london", []cfclient.Event{
+				event("10000000-0000-0000-0000-000000000001", start, "audit.app.create", orgA),
+				event("20000000-0000-0000-0000-000000000002", start.Add(1*time.Hour), "audit.app.update", orgA),
+				event("30000000-0000-0000-0000-000000000003", start.Add(1*time.Hour), "audit.space.create", orgA),
+				event("40000000-0000-0000-0000-000000000004", start.Add(3*time.Hour), "audit.app.ssh-authorized", orgB),
+				stopped,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = store.StoreCFAuditEvents("paris", []cfclient.Event{
+				event("60000000-0000-0000-0000-000000000006", start.Add(2*time.Hour), "audit.app.create", orgA),
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("pages through every event in order, across partitions", func() {
+			page, err := store.QueryCFAuditEvents(db.EventQuery{Limit: 2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(page)).To(Equal([]string{
+				"10000000-0000-0000-0000-000000000001",
+				"20000000-0000-0000-0000-000000000002",
+			}))
+
+			page, err = store.QueryCFAuditEvents(db.EventQuery{Limit: 2, PageToken: page.NextPageToken})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(page)).To(Equal([]string{
+				"30000000-0000-0000-0000-000000000003",
+				"60000000-0000-0000-0000-000000000006",
+			}))
+
+			page, err = store.QueryCFAuditEvents(db.EventQuery{Limit: 2, PageToken: page.NextPageToken})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(page)).To(Equal([]string{
+				"40000000-0000-0000-0000-000000000004",
+				"50000000-0000-0000-0000-000000000005",
+			}))
+			Expect(page.NextPageToken).To(BeEmpty())
+		})
+
+		It("pages newest first", func() {
+			page, err := store.QueryCFAuditEvents(db.EventQuery{Limit: 4, Descending: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(page)).To(HaveLen(4))
+			Expect(guids(page)[0]).To(Equal("50000000-0000-0000-0000-000000000005"))
+
+			page, err = store.QueryCFAuditEvents(db.EventQuery{Limit: 4, Descending: true, PageToken: page.NextPageToken})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(page)).To(Equal([]string{
+				"20000000-0000-0000-0000-000000000002",
+				"10000000-0000-0000-0000-000000000001",
+			}))
+
+			_, err = store.QueryCFAuditEvents(db.EventQuery{PageToken: page.NextPageToken})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("filters by foundation, time and organization", func() {
+			page, err := store.QueryCFAuditEvents(db.EventQuery{
+				Foundation:       "london",
+				From:             start.Add(1 * time.Hour),
+				To:               start.Add(4 * time.Hour),
+				OrganizationGUID: orgA,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(page)).To(Equal([]string{
+				"20000000-0000-0000-0000-000000000002",
+				"30000000-0000-0000-0000-000000000003",
+			}))
+		})
+
+		It("filters by event type, exactly or by prefix", func() {
+			page, err := store.QueryCFAuditEvents(db.EventQuery{
+				EventTypes: []string{"audit.space.create", "audit.app.ssh-*"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(page)).To(Equal([]string{
+				"30000000-0000-0000-0000-000000000003",
+				"40000000-0000-0000-0000-000000000004",
+			}))
+
+			page, err = store.QueryCFAuditEvents(db.EventQuery{EventTypes: []string{"audit.app_*"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Events).To(BeEmpty(), "_ is not a wildcard")
+		})
+
+		It("filters by actor, actee and metadata", func() {
+			page, err := store.QueryCFAuditEvents(db.EventQuery{
+				Actor: "admin@example.com",
+				Actee: "app-5",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(page)).To(Equal([]string{"50000000-0000-0000-0000-000000000005"}))
+
+			page, err = store.QueryCFAuditEvents(db.EventQuery{
+				Metadata: []db.MetadataPredicate{{Path: []string{"request", "state"}, Equals: "STOPPED"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guids(page)).To(Equal([]string{"50000000-0000-0000-0000-000000000005"}))
+
+			page, err = store.QueryCFAuditEvents(db.EventQuery{
+				Metadata: []db.MetadataPredicate{{Path: []string{"request", "name"}, Exists: true}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Events).To(BeEmpty())
+		})
+
+		It("streams every matching event in order", func() {
+			streamed := []string{}
+			err := store.StreamCFAuditEvents(context.Background(), db.EventQuery{Foundation: "london", Limit: 1}, func(event db.CFAuditEvent) error {
+				streamed = append(streamed, event.GUID)
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(streamed).To(Equal([]string{
+				"10000000-0000-0000-0000-000000000001",
+				"20000000-0000-0000-0000-000000000002",
+				"30000000-0000-0000-0000-000000000003",
+				"40000000-0000-0000-0000-000000000004",
+				"50000000-0000-0000-0000-000000000005",
+			}))
+		})
+
+		It("stops streaming when the callback fails or the context is cancelled", func() {
+			streamed := 0
+			err := store.StreamCFAuditEvents(context.Background(), db.EventQuery{}, func(event db.CFAuditEvent) error {
+				streamed++
+				return fmt.Errorf("splunk is down")
+			})
+			Expect(err).To(MatchError("splunk is down"))
+			Expect(streamed).To(Equal(1))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			streamed = 0
+			err = store.StreamCFAuditEvents(ctx, db.EventQuery{}, func(event db.CFAuditEvent) error {
+				streamed++
+				cancel()
+				return nil
+			})
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(streamed).To(Equal(1))
+		})
+
+		It("says which foundation each event is from", func() {
+			page, err := store.QueryCFAuditEvents(db.EventQuery{EventTypes: []string{"audit.app.create"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Events).To(HaveLen(2))
+			Expect(page.Events[0].Foundation).To(Equal("london"))
+			Expect(page.Events[1].Foundation).To(Equal("paris"))
+		})
+
+		It("treats values as values, not SQL", func() {
+			page, err := store.QueryCFAuditEvents(db.EventQuery{Actor: "' or '1'='1"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Events).To(BeEmpty())
+		})
+	})
+})
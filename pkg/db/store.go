@@ -3,11 +3,10 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/lager"
@@ -17,8 +16,13 @@ import (
 )
 
 const (
-	CFAuditEventsTable  = "cf_audit_events"
-	ShipperCursorsTable = "shipper_cursors"
+	CFAuditEventsTable       = "cf_audit_events"
+	ShipperCursorsTable      = "shipper_cursors"
+	BackfillCheckpointsTable = "backfill_checkpoints"
+
+	// DefaultFoundation is the name of the foundation events were collected
+	// from before the auditor supported collecting from more than one
+	DefaultFoundation = "default"
 
 	DefaultInitTimeout  = 15 * time.Minute
 	DefaultStoreTimeout = 10 * time.Minute
@@ -28,13 +32,55 @@ const (
 type EventDB interface {
 	Init() error
 
-	StoreCFAuditEvents(events []cfclient.Event) error
-	GetCFAuditEvents(filter RawEventFilter) ([]cfclient.Event, error)
-	GetLatestCFEventTime() (time.Time, error)
+	StoreCFAuditEvents(foundation string, events []cfclient.Event) (StoreResult, error)
+	GetCFAuditEvents(filter RawEventFilter) ([]CFAuditEvent, error)
+	QueryCFAuditEvents(query EventQuery) (EventPage, error)
+	GetLatestCFEventTime(foundation string) (time.Time, error)
 	GetCFEventCount() (int64, error)
 
-	GetUnshippedCFAuditEventsForShipper(shipperName string) ([]cfclient.Event, error)
+	StreamCFAuditEvents(ctx context.Context, query EventQuery, fn func(event CFAuditEvent) error) error
+
+	GetUnshippedCFAuditEventsForShipper(shipperName string, foundation string, limit int) ([]CFAuditEvent, error)
 	UpdateShipperCursor(shipperName string, shipperTime string, shippedID string) error
+
+	GetIncompleteBackfillCheckpoints(foundation string) ([]BackfillCheckpoint, error)
+	UpdateBackfillCheckpoint(checkpoint BackfillCheckpoint) error
+	DeleteCompletedBackfillCheckpoints(foundation string, until time.Time) (int64, error)
+
+	QuarantineCFAuditEvents(foundation string, events []QuarantinedCFAuditEvent) error
+	GetQuarantinedCFAuditEvents(foundation string) ([]QuarantinedCFAuditEvent, error)
+	MarkCFAuditEventsReprocessed(ids []int64) error
+
+	GetCollectorWatermark(source string, foundation string) (CollectorWatermark, error)
+	UpdateCollectorWatermark(watermark CollectorWatermark) error
+}
+
+// CFAuditEvent is an audit event as stored, along with the names of its
+// organization and space at the time of the event, and the UAA details of
+// the user who made it, if they are known
+type CFAuditEvent struct {
+	cfclient.Event
+
+	// Foundation is not shipped as part of the event, but as a field
+	Foundation string `json:"-"`
+
+	OrganizationName string `json:"organization_name,omitempty"`
+	SpaceName        string `json:"space_name,omitempty"`
+
+	ActorOrigin string `json:"actor_origin,omitempty"`
+	ActorEmail  string `json:"actor_email,omitempty"`
+	ActorActive *bool  `json:"actor_active,omitempty"`
+}
+
+// BackfillCheckpoint records how far the collector has got through fetching
+// the events in a window of time, so that it can resume after a restart
+type BackfillCheckpoint struct {
+	Foundation  string
+	WindowStart time.Time
+	WindowEnd   time.Time
+	LastPageURL string
+	EventCount  int64
+	Completed   bool
 }
 
 type EventStore struct {
@@ -51,52 +97,270 @@ func NewEventStore(ctx context.Context, db *sql.DB, logger lager.Logger) *EventS
 	}
 }
 
-// Init initialises the database tables and functions
+// Init brings the schema up to date by applying any migrations which have
+// not been applied
 func (s *EventStore) Init() error {
 	s.logger.Info("initializing")
 	ctx, cancel := context.WithTimeout(s.ctx, DefaultInitTimeout)
 	defer cancel()
 
-	for _, filename := range []string{
-		"create_cf_audit_events.sql",
-		"create_shipper_cursors.sql",
-	} {
-		if err := s.runSQLFilesInTransaction(ctx, filename); err != nil {
-			return err
-		}
+	applied, err := NewMigrator(s.db, s.logger, Migrations).Up(ctx)
+	if err != nil {
+		return err
 	}
 
-	s.logger.Info("initialized")
+	s.logger.Info("initialized", lager.Data{"migrations-applied": applied})
 	return nil
 }
 
-func (s *EventStore) StoreCFAuditEvents(events []cfclient.Event) error {
+// StoreResult says what happened to a page of events which was stored
+type StoreResult struct {
+	// Inserted is how many events were new
+	Inserted int
+	// Duplicates is how many events were already stored, so were ignored
+	Duplicates int
+	// Quarantined is how many events were invalid, so were quarantined
+	// rather than stored
+	Quarantined int
+}
+
+// StoreCFAuditEvents stores a page of events, ignoring any which are already
+// stored. The page is copied into a temporary table and then merged in a
+// single statement, which is much quicker than inserting each event. Events
+// which are invalid are quarantined instead, so that they do not stop the
+// rest of the page being stored. New events are added to the hash chain in
+// the order they were fetched.
+func (s *EventStore) StoreCFAuditEvents(foundation string, events []cfclient.Event) (StoreResult, error) {
 	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
 	defer cancel()
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return StoreResult{}, err
 	}
 	defer tx.Rollback()
+
+	validEvents := make([]cfclient.Event, 0, len(events))
 	for _, event := range events {
+		if reason := ValidateCFAuditEvent(event); reason != nil {
+			b, err := json.Marshal(event)
+			if err != nil {
+				return StoreResult{}, err
+			}
+			if err := quarantineCFAuditEvent(ctx, tx, foundation, event.GUID, b, reason.Error()); err != nil {
+				return StoreResult{}, err
+			}
+			continue
+		}
+		validEvents = append(validEvents, event)
+	}
+	result := StoreResult{Quarantined: len(events) - len(validEvents)}
+
+	// The page is copied in before the chain is locked, so that other pages
+	// only wait for the events to be hashed and inserted
+	_, err = tx.ExecContext(ctx, `
+		create temporary table cf_audit_events_staging (
+			position integer NOT NULL,
+			guid text NOT NULL,
+			created_at timestamptz NOT NULL,
+			event_type text NOT NULL,
+			actor text NOT NULL,
+			actor_type text NOT NULL,
+			actor_name text NOT NULL,
+			actor_username text NOT NULL,
+			actee text NOT NULL,
+			actee_type text NOT NULL,
+			actee_name text NOT NULL,
+			organization_guid text NOT NULL,
+			space_guid text NOT NULL,
+			metadata text NOT NULL
+		) on commit drop
+	`)
+	if err != nil {
+		return StoreResult{}, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(
+		"cf_audit_events_staging",
+		"position", "guid", "created_at", "event_type",
+		"actor", "actor_type", "actor_name", "actor_username",
+		"actee", "actee_type", "actee_name",
+		"organization_guid", "space_guid", "metadata",
+	))
+	if err != nil {
+		return StoreResult{}, err
+	}
+	for i, event := range validEvents {
 		eventMetadataJSON, err := json.Marshal(&event.Metadata)
 		if err != nil {
-			return err
+			return StoreResult{}, err
+		}
+		_, err = stmt.ExecContext(
+			ctx,
+			i, event.GUID, event.CreatedAt, event.Type,
+			event.Actor, event.ActorType, event.ActorName, event.ActorUsername,
+			event.Actee, event.ActeeType, event.ActeeName,
+			event.OrganizationGUID, event.SpaceGUID, string(eventMetadataJSON),
+		)
+		if err != nil {
+			return StoreResult{}, err
 		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return StoreResult{}, err
+	}
+	if err := stmt.Close(); err != nil {
+		return StoreResult{}, err
+	}
 
-		stmt := fmt.Sprintf(`
-			insert into %s (
-				guid, created_at, event_type, actor, actor_type, actor_name, actor_username, actee, actee_type, actee_name, organization_guid, space_guid, metadata
-			) values (
-				$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, '')::uuid, NULLIF($12, '')::uuid, $13
-			) on conflict do nothing
-		`, CFAuditEventsTable)
-		_, err = tx.Exec(stmt, event.GUID, event.CreatedAt, event.Type, event.Actor, event.ActorType, event.ActorName, event.ActorUsername, event.Actee, event.ActeeType, event.ActeeName, event.OrganizationGUID, event.SpaceGUID, eventMetadataJSON)
+	// The chain is locked before looking for events which are already
+	// stored, so that no other page can be stored in between, and every new
+	// event is hashed after the one stored before it. The lock is held until
+	// the transaction ends, as events are given ids in the order they are
+	// chained.
+	head, err := lockCFAuditEventChain(ctx, tx)
+	if err != nil {
+		return StoreResult{}, err
+	}
+	positions, err := s.newCFAuditEvents(ctx, tx, validEvents)
+	if err != nil {
+		return StoreResult{}, err
+	}
+	prevHashes := make([]string, len(positions))
+	hashes := make([]string, len(positions))
+	prevHash := head.Hash
+	for i, position := range positions {
+		hash, err := ChainHash(prevHash, foundation, validEvents[position])
 		if err != nil {
-			return err
+			return StoreResult{}, err
 		}
+		prevHashes[i], hashes[i] = hex.EncodeToString(prevHash), hex.EncodeToString(hash)
+		prevHash = hash
 	}
-	return tx.Commit()
+
+	// Partitions are usually created ahead of time, but events can be from
+	// any month, for example when backfilling. Creating one locks the whole
+	// table, so only missing partitions are created. That is done once the
+	// chain is locked, as otherwise this page could hold the table while
+	// waiting for the page holding the chain, which needs the table.
+	_, err = tx.ExecContext(ctx, `
+		select
+			count(create_cf_audit_events_partition(month))
+		from (
+			select distinct
+				date_trunc('month', created_at at time zone 'UTC') at time zone 'UTC' as month
+			from
+				cf_audit_events_staging
+			where
+				position = any($1::integer[])
+		) months
+	`, pq.Array(positions))
+	if err != nil {
+		return StoreResult{}, wrapPqError(err, "failed to create partitions")
+	}
+
+	// Ordered so that events are given ids in the order they were fetched
+	res, err := tx.ExecContext(ctx, `
+		insert into `+CFAuditEventsTable+` (
+			guid, created_at, event_type, actor, actor_type, actor_name, actor_username, actee, actee_type, actee_name, organization_guid, space_guid, metadata, foundation, chain_prev_hash, chain_hash
+		)
+		select
+			guid::uuid, created_at, event_type, actor, actor_type, actor_name, actor_username, actee, actee_type, actee_name, NULLIF(organization_guid, '')::uuid, NULLIF(space_guid, '')::uuid, metadata::jsonb, $1, decode(chain.prev_hash, 'hex'), decode(chain.hash, 'hex')
+		from
+			cf_audit_events_staging
+			join unnest($2::integer[], $3::text[], $4::text[]) as chain (position, prev_hash, hash) using (position)
+		order by
+			position
+		on conflict do nothing
+	`, foundation, pq.Array(positions), pq.Array(prevHashes), pq.Array(hashes))
+	if err != nil {
+		return StoreResult{}, err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return StoreResult{}, err
+	}
+	// Every event was new, so if any were not inserted the chain would skip
+	// them, and it is better to fail
+	if int(inserted) != len(positions) {
+		return StoreResult{}, fmt.Errorf("stored %d of %d new events, so the chain would not match them", inserted, len(positions))
+	}
+
+	if len(positions) > 0 {
+		head.Length += inserted
+		head.Hash = prevHash
+		if err := updateCFAuditEventChain(ctx, tx, head); err != nil {
+			return StoreResult{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return StoreResult{}, err
+	}
+	result.Inserted = int(inserted)
+	result.Duplicates = len(validEvents) - int(inserted)
+	return result, nil
+}
+
+// newCFAuditEvents returns the positions in events of those which are not
+// already stored, without any repeated in the page, in the order they were
+// fetched
+func (s *EventStore) newCFAuditEvents(ctx context.Context, tx *sql.Tx, events []cfclient.Event) ([]int, error) {
+	if len(events) == 0 {
+		return []int{}, nil
+	}
+
+	guids := make([]string, 0, len(events))
+	var from, to time.Time
+	for i, event := range events {
+		guids = append(guids, event.GUID)
+		// Already validated
+		createdAt, _ := time.Parse(time.RFC3339Nano, event.CreatedAt)
+		if i == 0 || createdAt.Before(from) {
+			from = createdAt
+		}
+		if i == 0 || createdAt.After(to) {
+			to = createdAt
+		}
+	}
+
+	// The times let Postgres look only in the partitions the page is in
+	rows, err := tx.QueryContext(ctx, `
+		select
+			guid::text
+		from
+			`+CFAuditEventsTable+`
+		where
+			guid = any($1::uuid[])
+			and created_at >= $2
+			and created_at <= $3
+	`, pq.Array(guids), from.Add(-time.Microsecond), to.Add(time.Microsecond))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := map[string]bool{}
+	for rows.Next() {
+		var guid string
+		if err := rows.Scan(&guid); err != nil {
+			return nil, err
+		}
+		seen[guid] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	positions := make([]int, 0, len(events))
+	for i, event := range events {
+		guid := strings.ToLower(event.GUID)
+		if seen[guid] {
+			continue
+		}
+		seen[guid] = true
+		positions = append(positions, i)
+	}
+	return positions, nil
 }
 
 type RawEventFilter struct {
@@ -105,8 +369,7 @@ type RawEventFilter struct {
 	Kind    string
 }
 
-func (s *EventStore) GetCFAuditEvents(filter RawEventFilter) ([]cfclient.Event, error) {
-	events := []cfclient.Event{}
+func (s *EventStore) GetCFAuditEvents(filter RawEventFilter) ([]CFAuditEvent, error) {
 	sortDirection := "desc"
 	if filter.Reverse {
 		sortDirection = "asc"
@@ -124,33 +387,53 @@ func (s *EventStore) GetCFAuditEvents(filter RawEventFilter) ([]cfclient.Event,
 	defer tx.Rollback()
 	rows, err := tx.Query(`
 		select
-			guid,
-			created_at,
-			event_type,
-			actor,
-			actor_type,
-			actor_name,
-			actor_username,
-			actee,
-			actee_type,
-			actee_name,
-			coalesce(organization_guid::text, ''),
-			coalesce(space_guid::text, ''),
-			metadata
+			` + cfAuditEventColumns + `
 		from
-			` + CFAuditEventsTable + `
+			` + CFAuditEventsTable + ` e
+		` + cfAuditEventNamesJoin + `
+		` + cfAuditEventActorsJoin + `
 		order by
-			id ` + sortDirection + `
+			e.id ` + sortDirection + `
 		` + limit + `
 	`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	return scanCFAuditEvents(rows)
+}
+
+// cfAuditEventColumns are the columns scanned by scanCFAuditEvents, from
+// cf_audit_events aliased as e, cfAuditEventNamesJoin and
+// cfAuditEventActorsJoin
+const cfAuditEventColumns = `
+			e.guid,
+			e.created_at,
+			e.event_type,
+			e.actor,
+			e.actor_type,
+			e.actor_name,
+			e.actor_username,
+			e.actee,
+			e.actee_type,
+			e.actee_name,
+			coalesce(e.organization_guid::text, ''),
+			coalesce(e.space_guid::text, ''),
+			e.metadata,
+			e.foundation,
+			coalesce(organization_name.name, ''),
+			coalesce(space_name.name, ''),
+			coalesce(actor.origin, ''),
+			coalesce(actor.email, ''),
+			actor.active`
+
+func scanCFAuditEvents(rows *sql.Rows) ([]CFAuditEvent, error) {
+	events := []CFAuditEvent{}
 	for rows.Next() {
-		event := cfclient.Event{}
+		event := CFAuditEvent{}
 		bytesOfMetadataJSON := []byte{}
-		err = rows.Scan(
+		actorActive := sql.NullBool{}
+		err := rows.Scan(
 			&event.GUID,
 			&event.CreatedAt,
 			&event.Type,
@@ -164,10 +447,19 @@ func (s *EventStore) GetCFAuditEvents(filter RawEventFilter) ([]cfclient.Event,
 			&event.OrganizationGUID,
 			&event.SpaceGUID,
 			&bytesOfMetadataJSON,
+			&event.Foundation,
+			&event.OrganizationName,
+			&event.SpaceName,
+			&event.ActorOrigin,
+			&event.ActorEmail,
+			&actorActive,
 		)
 		if err != nil {
 			return nil, err
 		}
+		if actorActive.Valid {
+			event.ActorActive = &actorActive.Bool
+		}
 		if len(bytesOfMetadataJSON) > 0 {
 			err = json.Unmarshal(bytesOfMetadataJSON, &event.Metadata)
 			if err != nil {
@@ -176,11 +468,14 @@ func (s *EventStore) GetCFAuditEvents(filter RawEventFilter) ([]cfclient.Event,
 		}
 		events = append(events, event)
 	}
-	return events, nil
+	return events, rows.Err()
 }
 
-func (s *EventStore) GetUnshippedCFAuditEventsForShipper(shipperName string) ([]cfclient.Event, error) {
-	events := []cfclient.Event{}
+// GetUnshippedCFAuditEventsForShipper returns up to limit events from a
+// foundation after the named shipper's cursor, oldest first. The cursor is read first
+// so that it is a parameter of the query, which lets Postgres skip the
+// partitions of cf_audit_events from before it.
+func (s *EventStore) GetUnshippedCFAuditEventsForShipper(shipperName string, foundation string, limit int) ([]CFAuditEvent, error) {
 	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
 	defer cancel()
 	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
@@ -188,75 +483,66 @@ func (s *EventStore) GetUnshippedCFAuditEventsForShipper(shipperName string) ([]
 		return nil, err
 	}
 	defer tx.Rollback()
-	rows, err := tx.Query(`
-		with last_shipped_event as (
-			select updated_at, shipped_id
-			from
-				` + ShipperCursorsTable + ` where name = '` + shipperName + `'
-			union
-				select (date '1970 1 1')::timestamptz, ''
-			order by updated_at desc
-			limit 1
-		),
-		recent_cf_audit_events as (
+
+	shippedTime := time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+	shippedID := ""
+	err = tx.QueryRowContext(ctx, `
+		select updated_at, shipped_id
+		from `+ShipperCursorsTable+`
+		where name = $1
+	`, shipperName).Scan(&shippedTime, &shippedID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		with recent_cf_audit_events as (
 			select *
-			from ` + CFAuditEventsTable + `
-			where created_at >= (select updated_at from last_shipped_event)
+			from `+CFAuditEventsTable+`
+			where created_at >= $1
+			and foundation = $2
 			order by created_at asc
-			limit 8192
+			limit $4
 		)
 		select
-			guid,
-			created_at,
-			event_type,
-			actor,
-			actor_type,
-			actor_name,
-			actor_username,
-			actee,
-			actee_type,
-			actee_name,
-			coalesce(organization_guid::text, ''),
-			coalesce(space_guid::text, ''),
-			metadata
-		from recent_cf_audit_events
-		where guid::text != (select shipped_id from last_shipped_event)
-		order by created_at asc
-	`)
+			`+cfAuditEventColumns+`
+		from recent_cf_audit_events e
+		`+cfAuditEventNamesJoin+`
+		`+cfAuditEventActorsJoin+`
+		where e.guid::text != $3
+		order by e.created_at asc
+	`, shippedTime, foundation, shippedID, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	for rows.Next() {
-		event := cfclient.Event{}
-		bytesOfMetadataJSON := []byte{}
-		err = rows.Scan(
-			&event.GUID,
-			&event.CreatedAt,
-			&event.Type,
-			&event.Actor,
-			&event.ActorType,
-			&event.ActorName,
-			&event.ActorUsername,
-			&event.Actee,
-			&event.ActeeType,
-			&event.ActeeName,
-			&event.OrganizationGUID,
-			&event.SpaceGUID,
-			&bytesOfMetadataJSON,
-		)
-		if err != nil {
-			return nil, err
-		}
-		if len(bytesOfMetadataJSON) > 0 {
-			err = json.Unmarshal(bytesOfMetadataJSON, &event.Metadata)
-			if err != nil {
-				return nil, err
-			}
-		}
-		events = append(events, event)
+	return scanCFAuditEvents(rows)
+}
+
+// ShipperCursor is how far a shipper has got
+type ShipperCursor struct {
+	Name      string
+	UpdatedAt time.Time
+	ShippedID string
+}
+
+// GetShipperCursor returns the named cursor, or nil if it has not been saved
+func (s *EventStore) GetShipperCursor(shipperName string) (*ShipperCursor, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	cursor := ShipperCursor{Name: shipperName}
+	err := s.db.QueryRowContext(ctx, `
+		select updated_at, shipped_id
+		from `+ShipperCursorsTable+`
+		where name = $1
+	`, shipperName).Scan(&cursor.UpdatedAt, &cursor.ShippedID)
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-	return events, nil
+	if err != nil {
+		return nil, err
+	}
+	return &cursor, nil
 }
 
 func (s *EventStore) UpdateShipperCursor(shipperName string, shipperTime string, shippedID string) error {
@@ -286,7 +572,100 @@ func (s *EventStore) UpdateShipperCursor(shipperName string, shipperTime string,
 	return tx.Commit()
 }
 
-func (s *EventStore) GetLatestCFEventTime() (time.Time, error) {
+// GetIncompleteBackfillCheckpoints returns the checkpoints of windows which
+// have not been completely fetched, oldest first
+func (s *EventStore) GetIncompleteBackfillCheckpoints(foundation string) ([]BackfillCheckpoint, error) {
+	checkpoints := []BackfillCheckpoint{}
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		select
+			foundation,
+			window_start,
+			window_end,
+			last_page_url,
+			event_count,
+			completed
+		from
+			`+BackfillCheckpointsTable+`
+		where
+			foundation = $1
+			and not completed
+		order by
+			window_start asc
+	`, foundation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		checkpoint := BackfillCheckpoint{}
+		err = rows.Scan(
+			&checkpoint.Foundation,
+			&checkpoint.WindowStart,
+			&checkpoint.WindowEnd,
+			&checkpoint.LastPageURL,
+			&checkpoint.EventCount,
+			&checkpoint.Completed,
+		)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	return checkpoints, rows.Err()
+}
+
+// UpdateBackfillCheckpoint creates or updates the checkpoint for a window
+func (s *EventStore) UpdateBackfillCheckpoint(checkpoint BackfillCheckpoint) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	stmt := fmt.Sprintf(
+		`insert into %s (
+				foundation, window_start, window_end, last_page_url, event_count, completed, updated_at
+			) values (
+				$1, $2, $3, $4, $5, $6, now()
+			) on conflict (foundation, window_start, window_end) do
+			update set
+				last_page_url = excluded.last_page_url,
+				event_count = excluded.event_count,
+				completed = excluded.completed,
+				updated_at = excluded.updated_at`,
+		BackfillCheckpointsTable,
+	)
+
+	_, err := s.db.ExecContext(
+		ctx, stmt,
+		checkpoint.Foundation, checkpoint.WindowStart, checkpoint.WindowEnd,
+		checkpoint.LastPageURL, checkpoint.EventCount, checkpoint.Completed,
+	)
+	return err
+}
+
+// DeleteCompletedBackfillCheckpoints deletes the checkpoints of completed
+// windows which end at or before until, and returns how many there were
+func (s *EventStore) DeleteCompletedBackfillCheckpoints(foundation string, until time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `
+		delete from
+			`+BackfillCheckpointsTable+`
+		where
+			foundation = $1
+			and completed
+			and window_end <= $2
+	`, foundation, until)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetLatestCFEventTime returns when the most recent event from a foundation
+// was created. cf_audit_events is partitioned by created_at, so Postgres
+// scans the partitions newest first and stops at the first event found.
+func (s *EventStore) GetLatestCFEventTime(foundation string) (time.Time, error) {
 	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
 	defer cancel()
 	row := s.db.QueryRowContext(ctx, `
@@ -294,10 +673,12 @@ func (s *EventStore) GetLatestCFEventTime() (time.Time, error) {
 			created_at
 		from
 			`+CFAuditEventsTable+`
+		where
+			foundation = $1
 		order by
 			created_at DESC
 		limit 1
-	`)
+	`, foundation)
 
 	createdAt := time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
 	err := row.Scan(&createdAt)
@@ -307,66 +688,28 @@ func (s *EventStore) GetLatestCFEventTime() (time.Time, error) {
 	return createdAt, nil // if no rows, return 1st Jan 1970
 }
 
+// GetCFEventCount estimates how many events are stored from the statistics
+// of each partition of cf_audit_events
 func (s *EventStore) GetCFEventCount() (int64, error) {
 	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
 	defer cancel()
-	row := s.db.QueryRowContext(
-		ctx,
-		fmt.Sprintf(
-			`SELECT reltuples::numeric FROM pg_class WHERE relname = '%s';`,
-			CFAuditEventsTable,
-		),
-	)
+	row := s.db.QueryRowContext(ctx, `
+		select
+			coalesce(sum(greatest(c.reltuples, 0)), 0)::bigint
+		from
+			pg_inherits i
+			join pg_class c on c.oid = i.inhrelid
+		where
+			i.inhparent = $1::regclass
+	`, CFAuditEventsTable)
 
 	var cfEventCount int64
-	err := row.Scan(&cfEventCount)
-	if err == sql.ErrNoRows {
-		return int64(0), nil
-	} else if err != nil {
+	if err := row.Scan(&cfEventCount); err != nil {
 		return int64(0), err
 	}
 	return cfEventCount, nil
 }
 
-func (s *EventStore) runSQLFilesInTransaction(ctx context.Context, filenames ...string) error {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-	for _, filename := range filenames {
-		if err := s.runSQLFile(tx, filename); err != nil {
-			return err
-		}
-	}
-	return tx.Commit()
-}
-
-func (s *EventStore) runSQLFile(tx *sql.Tx, filename string) error {
-	startTime := time.Now()
-	s.logger.Info("run-sql-file", map[string]interface{}{"sqlFile": filename})
-
-	defer func() {
-		s.logger.Info("finish-sql-file", lager.Data{
-			"sqlFile": filename,
-			"elapsed": time.Since(startTime),
-		})
-	}()
-
-	schemaFilename := schemaFile(filename)
-	sql, err := ioutil.ReadFile(schemaFilename)
-	if err != nil {
-		return fmt.Errorf("failed to execute sql file %s: %s", schemaFilename, err)
-	}
-
-	_, err = tx.Exec(string(sql))
-	if err != nil {
-		return wrapPqError(err, schemaFilename)
-	}
-
-	return nil
-}
-
 func wrapPqError(err error, prefix string) error {
 	msg := err.Error()
 	if err, ok := err.(*pq.Error); ok {
@@ -383,18 +726,3 @@ func wrapPqError(err error, prefix string) error {
 	}
 	return fmt.Errorf("%s: %s", prefix, msg)
 }
-
-func schemaDir() string {
-	root := os.Getenv("APP_ROOT")
-	if root == "" {
-		root = os.Getenv("PWD")
-	}
-	if root == "" {
-		root, _ = os.Getwd()
-	}
-	return filepath.Join(root, "pkg", "db", "sql")
-}
-
-func schemaFile(filename string) string {
-	return filepath.Join(schemaDir(), filename)
-}
@@ -0,0 +1,299 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	AppUsageEventsTable     = "cf_app_usage_events"
+	ServiceUsageEventsTable = "cf_service_usage_events"
+	UsageEventCursorsTable  = "usage_event_cursors"
+)
+
+// UsageEventKind is which of Cloud Controller's usage event streams an event
+// came from
+type UsageEventKind string
+
+const (
+	AppUsageEvents     UsageEventKind = "app"
+	ServiceUsageEvents UsageEventKind = "service"
+)
+
+func (k UsageEventKind) table() (string, error) {
+	switch k {
+	case AppUsageEvents:
+		return AppUsageEventsTable, nil
+	case ServiceUsageEvents:
+		return ServiceUsageEventsTable, nil
+	default:
+		return "", fmt.Errorf("unknown usage event kind %q", k)
+	}
+}
+
+type UsageEventDB interface {
+	StoreUsageEvents(kind UsageEventKind, foundation string, events []UsageEvent) error
+	GetUsageEventCursor(kind UsageEventKind, foundation string) (string, error)
+	GetLatestUsageEventTime(kind UsageEventKind, foundation string) (time.Time, error)
+	GetUsageEventCount(kind UsageEventKind) (int64, error)
+
+	GetUnshippedUsageEventsForShipper(kind UsageEventKind, shipperName string, foundation string, limit int) ([]UsageEvent, error)
+	UpdateShipperCursor(shipperName string, shipperTime string, shippedID string) error
+}
+
+// UsageEvent is an app or service usage event. Raw is the event as returned
+// by Cloud Controller.
+type UsageEvent struct {
+	GUID             string
+	CreatedAt        string
+	State            string
+	SpaceGUID        string
+	OrganizationGUID string
+	Raw              json.RawMessage
+}
+
+// StoreUsageEvents stores events and advances the foundation's usage event
+// cursor to the last of them, in a single transaction. The events are copied
+// into a temporary table and then inserted in a single statement, as audit
+// events are.
+func (s *EventStore) StoreUsageEvents(kind UsageEventKind, foundation string, events []UsageEvent) error {
+	table, err := kind.table()
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		create temporary table usage_events_staging (
+			position integer NOT NULL,
+			guid text NOT NULL,
+			created_at text NOT NULL,
+			state text NOT NULL,
+			organization_guid text NOT NULL,
+			space_guid text NOT NULL,
+			raw text NOT NULL
+		) on commit drop
+	`)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(
+		"usage_events_staging",
+		"position", "guid", "created_at", "state", "organization_guid", "space_guid", "raw",
+	))
+	if err != nil {
+		return err
+	}
+	for i, event := range events {
+		_, err = stmt.ExecContext(
+			ctx, i, event.GUID, event.CreatedAt, event.State, event.OrganizationGUID, event.SpaceGUID, string(event.Raw),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+
+	// Events are inserted in the order they were fetched, so that their ids
+	// are too
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		insert into %s (
+			guid, foundation, created_at, state, organization_guid, space_guid, raw
+		)
+		select
+			guid::uuid,
+			$1,
+			created_at::timestamptz,
+			state,
+			NULLIF(organization_guid, '')::uuid,
+			NULLIF(space_guid, '')::uuid,
+			raw::jsonb
+		from
+			usage_events_staging
+		order by
+			position
+		on conflict do nothing
+	`, table), foundation)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		insert into %s (kind, foundation, last_guid, updated_at) values (
+			$1, $2, $3, now()
+		) on conflict (kind, foundation) do
+		update set
+			last_guid = excluded.last_guid,
+			updated_at = excluded.updated_at
+	`, UsageEventCursorsTable), string(kind), foundation, events[len(events)-1].GUID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetUsageEventCursor returns the GUID of the last usage event collected from
+// a foundation, or an empty string if none have been collected
+func (s *EventStore) GetUsageEventCursor(kind UsageEventKind, foundation string) (string, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	row := s.db.QueryRowContext(ctx, `
+		select
+			last_guid::text
+		from
+			`+UsageEventCursorsTable+`
+		where
+			kind = $1
+			and foundation = $2
+	`, string(kind), foundation)
+
+	var lastGUID string
+	err := row.Scan(&lastGUID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return lastGUID, nil
+}
+
+func (s *EventStore) GetLatestUsageEventTime(kind UsageEventKind, foundation string) (time.Time, error) {
+	createdAt := time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+	table, err := kind.table()
+	if err != nil {
+		return createdAt, err
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	row := s.db.QueryRowContext(ctx, `
+		select
+			created_at
+		from
+			`+table+`
+		where
+			foundation = $1
+		order by
+			created_at DESC
+		limit 1
+	`, foundation)
+
+	err = row.Scan(&createdAt)
+	if err != nil && err != sql.ErrNoRows {
+		return createdAt, err
+	}
+	return createdAt, nil // if no rows, return 1st Jan 1970
+}
+
+func (s *EventStore) GetUsageEventCount(kind UsageEventKind) (int64, error) {
+	table, err := kind.table()
+	if err != nil {
+		return int64(0), err
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT reltuples::numeric FROM pg_class WHERE relname = $1;`,
+		table,
+	)
+
+	var count int64
+	err = row.Scan(&count)
+	if err == sql.ErrNoRows {
+		return int64(0), nil
+	} else if err != nil {
+		return int64(0), err
+	}
+	return count, nil
+}
+
+// GetUnshippedUsageEventsForShipper returns up to limit usage events from a
+// foundation after the named shipper's cursor, oldest first
+func (s *EventStore) GetUnshippedUsageEventsForShipper(kind UsageEventKind, shipperName string, foundation string, limit int) ([]UsageEvent, error) {
+	table, err := kind.table()
+	if err != nil {
+		return nil, err
+	}
+
+	events := []UsageEvent{}
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(`
+		with last_shipped_event as (
+			select updated_at, shipped_id
+			from
+				`+ShipperCursorsTable+` where name = $1
+			union
+				select (date '1970 1 1')::timestamptz, ''
+			order by updated_at desc
+			limit 1
+		),
+		recent_usage_events as (
+			select *
+			from `+table+`
+			where created_at >= (select updated_at from last_shipped_event)
+			and foundation = $2
+			order by created_at asc
+			limit $3
+		)
+		select
+			guid,
+			created_at,
+			state,
+			coalesce(organization_guid::text, ''),
+			coalesce(space_guid::text, ''),
+			raw
+		from recent_usage_events
+		where guid::text != (select shipped_id from last_shipped_event)
+		order by created_at asc
+	`, shipperName, foundation, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		event := UsageEvent{}
+		raw := []byte{}
+		err = rows.Scan(
+			&event.GUID,
+			&event.CreatedAt,
+			&event.State,
+			&event.OrganizationGUID,
+			&event.SpaceGUID,
+			&raw,
+		)
+		if err != nil {
+			return nil, err
+		}
+		event.Raw = raw
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,58 @@
+package db_test
+
+import (
+	"encoding/json"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("Usage events", func() {
+	Context("against Postgres", func() {
+		var store *db.EventStore
+
+		event := func(n int, state string) db.UsageEvent {
+			guid := fmt.Sprintf("%d0000000-0000-0000-0000-00000000000%d", n, n)
+			return db.UsageEvent{
+				GUID:             guid,
+				CreatedAt:        fmt.Sprintf("2019-10-04T12:40:4%dZ", n),
+				State:            state,
+				OrganizationGUID: "a0000000-0000-0000-0000-000000000000",
+				Raw:              json.RawMessage(fmt.Sprintf(`{"metadata":{"guid":%q},"entity":{"state":%q}}`, guid, state)),
+			}
+		}
+
+		BeforeEach(func() {
+			store, _ = newTestEventStore()
+		})
+
+		It("stores a page of events in order, once, and advances the cursor", func() {
+			Expect(store.StoreUsageEvents(db.AppUsageEvents, "london", []db.UsageEvent{
+				event(1, "STARTED"), event(2, "STOPPED"), event(2, "STOPPED"),
+			})).To(Succeed())
+			Expect(store.StoreUsageEvents(db.AppUsageEvents, "london", []db.UsageEvent{
+				event(2, "STOPPED"), event(3, "STARTED"),
+			})).To(Succeed())
+
+			cursor, err := store.GetUsageEventCursor(db.AppUsageEvents, "london")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cursor).To(Equal(event(3, "STARTED").GUID))
+
+			events, err := store.GetUnshippedUsageEventsForShipper(db.AppUsageEvents, "splunk", "london", 10)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(HaveLen(3))
+			for i, state := range []string{"STARTED", "STOPPED", "STARTED"} {
+				Expect(events[i].GUID).To(Equal(event(i+1, state).GUID))
+				Expect(events[i].State).To(Equal(state))
+				Expect(events[i].OrganizationGUID).To(Equal("a0000000-0000-0000-0000-000000000000"))
+				Expect(events[i].SpaceGUID).To(BeEmpty())
+				Expect(events[i].Raw).To(MatchJSON(event(i+1, state).Raw))
+			}
+
+			Expect(store.GetUnshippedUsageEventsForShipper(db.ServiceUsageEvents, "splunk", "london", 10)).To(BeEmpty())
+		})
+	})
+})
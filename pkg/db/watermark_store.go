@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	CollectorWatermarksTable = "collector_watermarks"
+
+	// CFAuditEventsSource is the watermark source of the audit event collector
+	CFAuditEventsSource = "cf_audit_events"
+)
+
+// CollectorWatermark records the time before which a collector has collected
+// every event from a source, and when it last re-swept for late events
+type CollectorWatermark struct {
+	Source      string
+	Foundation  string
+	Watermark   time.Time
+	LastResweep time.Time
+}
+
+// GetCollectorWatermark returns the watermark for a source, which is the zero
+// value if the collector has never completed a pass
+func (s *EventStore) GetCollectorWatermark(source string, foundation string) (CollectorWatermark, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	watermark := CollectorWatermark{Source: source, Foundation: foundation}
+	err := s.db.QueryRowContext(ctx, `
+		select
+			watermark,
+			last_resweep
+		from
+			`+CollectorWatermarksTable+`
+		where
+			source = $1
+			and foundation = $2
+	`, source, foundation).Scan(&watermark.Watermark, &watermark.LastResweep)
+	if err != nil && err != sql.ErrNoRows {
+		return watermark, err
+	}
+	return watermark, nil
+}
+
+// UpdateCollectorWatermark creates or updates the watermark for a source
+func (s *EventStore) UpdateCollectorWatermark(watermark CollectorWatermark) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	stmt := fmt.Sprintf(
+		`insert into %s (
+				source, foundation, watermark, last_resweep, updated_at
+			) values (
+				$1, $2, $3, $4, now()
+			) on conflict (source, foundation) do
+			update set
+				watermark = excluded.watermark,
+				last_resweep = excluded.last_resweep,
+				updated_at = excluded.updated_at`,
+		CollectorWatermarksTable,
+	)
+
+	_, err := s.db.ExecContext(
+		ctx, stmt,
+		watermark.Source, watermark.Foundation, watermark.Watermark, watermark.LastResweep,
+	)
+	return err
+}
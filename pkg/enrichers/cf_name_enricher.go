@@ -0,0 +1,150 @@
+package enrichers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+)
+
+const (
+	nameKindOrganization = "organization"
+	nameKindSpace        = "space"
+
+	lookupResultCached   = "cached"
+	lookupResultFound    = "found"
+	lookupResultNotFound = "not_found"
+	lookupResultError    = "error"
+)
+
+// NameLookup returns the current name of an organization or space from
+// Cloud Controller, or fetchers.ErrNotFound if it no longer exists
+type NameLookup = func(ctx context.Context, guid string) (string, error)
+
+// CFNameEnricher records the names of the organizations and spaces that
+// events belong to, while they still exist, so that they can be identified
+// after they have been renamed or deleted. Names are looked up in Cloud
+// Controller at most once per cacheTTL, and recorded with the time they were
+// seen.
+type CFNameEnricher struct {
+	foundation             string
+	logger                 lager.Logger
+	lookupOrganizationName NameLookup
+	lookupSpaceName        NameLookup
+	nameDB                 db.NameHistoryDB
+
+	organizations *ttlCache[string]
+	spaces        *ttlCache[string]
+}
+
+func NewCFNameEnricher(
+	foundation string,
+	logger lager.Logger,
+	lookupOrganizationName NameLookup,
+	lookupSpaceName NameLookup,
+	nameDB db.NameHistoryDB,
+	cacheTTL time.Duration,
+) *CFNameEnricher {
+	logger = logger.Session("cf-name-enricher", lager.Data{"foundation": foundation})
+	return &CFNameEnricher{
+		foundation:             foundation,
+		logger:                 logger,
+		lookupOrganizationName: lookupOrganizationName,
+		lookupSpaceName:        lookupSpaceName,
+		nameDB:                 nameDB,
+		organizations:          newTTLCache[string](cacheTTL, time.Now),
+		spaces:                 newTTLCache[string](cacheTTL, time.Now),
+	}
+}
+
+func (e *CFNameEnricher) Enrich(ctx context.Context, events []cfclient.Event) {
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Events about an organization or space name it themselves, which
+		// is the only record we have of anything deleted before its events
+		// were collected
+		switch event.ActeeType {
+		case nameKindOrganization:
+			e.recordFromEvent(nameKindOrganization, event.Actee, event.ActeeName, event.CreatedAt)
+		case nameKindSpace:
+			e.recordFromEvent(nameKindSpace, event.Actee, event.ActeeName, event.CreatedAt)
+		}
+
+		if event.OrganizationGUID != "" {
+			e.resolve(ctx, nameKindOrganization, event.OrganizationGUID)
+		}
+		if event.SpaceGUID != "" {
+			e.resolve(ctx, nameKindSpace, event.SpaceGUID)
+		}
+	}
+}
+
+// resolve looks up and records the current name of an organization or space,
+// unless it has been looked up recently
+func (e *CFNameEnricher) resolve(ctx context.Context, kind string, guid string) {
+	cache, lookup := e.organizations, e.lookupOrganizationName
+	if kind == nameKindSpace {
+		cache, lookup = e.spaces, e.lookupSpaceName
+	}
+
+	if _, ok := cache.get(guid); ok {
+		CFNameEnricherLookupsTotal.WithLabelValues(e.foundation, kind, lookupResultCached).Inc()
+		return
+	}
+
+	name, err := lookup(ctx, guid)
+	if errors.Is(err, fetchers.ErrNotFound) {
+		// Already deleted, so there is nothing more to learn about it
+		CFNameEnricherLookupsTotal.WithLabelValues(e.foundation, kind, lookupResultNotFound).Inc()
+		cache.set(guid, "")
+		return
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			e.logger.Error("err-lookup-name", err, lager.Data{"kind": kind, "guid": guid})
+			CFNameEnricherLookupsTotal.WithLabelValues(e.foundation, kind, lookupResultError).Inc()
+		}
+		return
+	}
+	CFNameEnricherLookupsTotal.WithLabelValues(e.foundation, kind, lookupResultFound).Inc()
+
+	if err := e.record(kind, guid, name, time.Now()); err != nil {
+		return
+	}
+	cache.set(guid, name)
+}
+
+func (e *CFNameEnricher) recordFromEvent(kind string, guid string, name string, createdAt string) {
+	if guid == "" || name == "" {
+		return
+	}
+	seenAt, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		e.logger.Error("err-parse-event-time", err, lager.Data{"raw-created-at": createdAt})
+		CFNameEnricherErrorsTotal.WithLabelValues(e.foundation).Inc()
+		return
+	}
+	_ = e.record(kind, guid, name, seenAt)
+}
+
+func (e *CFNameEnricher) record(kind string, guid string, name string, seenAt time.Time) error {
+	var err error
+	if kind == nameKindSpace {
+		err = e.nameDB.RecordSpaceName(e.foundation, guid, name, seenAt)
+	} else {
+		err = e.nameDB.RecordOrganizationName(e.foundation, guid, name, seenAt)
+	}
+	if err != nil {
+		e.logger.Error("err-record-name", err, lager.Data{"kind": kind, "guid": guid})
+		CFNameEnricherErrorsTotal.WithLabelValues(e.foundation).Inc()
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package enrichers_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/enrichers"
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("CFNameEnricher", func() {
+	var (
+		logger lager.Logger
+		nameDB *dbfakes.FakeNameHistoryDB
+
+		lookupsMu           sync.Mutex
+		organizationLookups []string
+		spaceLookups        []string
+
+		lookupOrganizationName enrichers.NameLookup
+		lookupSpaceName        enrichers.NameLookup
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("enricher-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		nameDB = &dbfakes.FakeNameHistoryDB{}
+
+		organizationLookups = nil
+		spaceLookups = nil
+
+		lookupOrganizationName = func(_ context.Context, guid string) (string, error) {
+			lookupsMu.Lock()
+			defer lookupsMu.Unlock()
+			organizationLookups = append(organizationLookups, guid)
+			if guid == "deleted-org-guid" {
+				return "", fmt.Errorf("wrapped: %w", fetchers.ErrNotFound)
+			}
+			return "org-" + guid, nil
+		}
+		lookupSpaceName = func(_ context.Context, guid string) (string, error) {
+			lookupsMu.Lock()
+			defer lookupsMu.Unlock()
+			spaceLookups = append(spaceLookups, guid)
+			return "space-" + guid, nil
+		}
+	})
+
+	It("looks up and records names, using the cache for repeated GUIDs", func() {
+		enricher := enrichers.NewCFNameEnricher(
+			"test-foundation", logger,
+			lookupOrganizationName, lookupSpaceName,
+			nameDB, time.Hour,
+		)
+
+		cachedBefore := h.CurrentMetricValue(
+			enrichers.CFNameEnricherLookupsTotal.WithLabelValues("test-foundation", "organization", "cached"),
+		)
+
+		enricher.Enrich(context.Background(), []cfclient.Event{
+			{OrganizationGUID: "o1", SpaceGUID: "s1"},
+			{OrganizationGUID: "o1", SpaceGUID: "s2"},
+			{OrganizationGUID: "o1"},
+		})
+
+		Expect(organizationLookups).To(Equal([]string{"o1"}))
+		Expect(spaceLookups).To(Equal([]string{"s1", "s2"}))
+
+		Expect(nameDB.RecordOrganizationNameCallCount()).To(Equal(1))
+		foundation, guid, name, seenAt := nameDB.RecordOrganizationNameArgsForCall(0)
+		Expect(foundation).To(Equal("test-foundation"))
+		Expect(guid).To(Equal("o1"))
+		Expect(name).To(Equal("org-o1"))
+		Expect(seenAt).To(BeTemporally("~", time.Now(), time.Second))
+
+		Expect(nameDB.RecordSpaceNameCallCount()).To(Equal(2))
+		_, guid, name, _ = nameDB.RecordSpaceNameArgsForCall(1)
+		Expect(guid).To(Equal("s2"))
+		Expect(name).To(Equal("space-s2"))
+
+		Expect(enrichers.CFNameEnricherLookupsTotal.WithLabelValues("test-foundation", "organization", "cached")).To(
+			h.MetricIncrementedBy(cachedBefore, "==", 2),
+		)
+	})
+
+	It("looks names up again once the cache has expired", func() {
+		enricher := enrichers.NewCFNameEnricher(
+			"test-foundation", logger,
+			lookupOrganizationName, lookupSpaceName,
+			nameDB, 10*time.Millisecond,
+		)
+
+		events := []cfclient.Event{{OrganizationGUID: "o1"}}
+		enricher.Enrich(context.Background(), events)
+		enricher.Enrich(context.Background(), events)
+		Expect(organizationLookups).To(HaveLen(1))
+
+		time.Sleep(20 * time.Millisecond)
+		enricher.Enrich(context.Background(), events)
+		Expect(organizationLookups).To(HaveLen(2))
+		Expect(nameDB.RecordOrganizationNameCallCount()).To(Equal(2))
+	})
+
+	It("does not record anything for deleted organizations, and does not look them up again", func() {
+		enricher := enrichers.NewCFNameEnricher(
+			"test-foundation", logger,
+			lookupOrganizationName, lookupSpaceName,
+			nameDB, time.Hour,
+		)
+
+		events := []cfclient.Event{{OrganizationGUID: "deleted-org-guid"}}
+		enricher.Enrich(context.Background(), events)
+		enricher.Enrich(context.Background(), events)
+
+		Expect(organizationLookups).To(HaveLen(1))
+		Expect(nameDB.RecordOrganizationNameCallCount()).To(Equal(0))
+	})
+
+	It("records the names of organizations and spaces which events are about", func() {
+		enricher := enrichers.NewCFNameEnricher(
+			"test-foundation", logger,
+			lookupOrganizationName, lookupSpaceName,
+			nameDB, time.Hour,
+		)
+
+		enricher.Enrich(context.Background(), []cfclient.Event{{
+			Type:      "audit.organization.delete-request",
+			CreatedAt: "2020-01-02T03:04:05Z",
+			Actee:     "deleted-org-guid",
+			ActeeType: "organization",
+			ActeeName: "old-org-name",
+		}})
+
+		Expect(nameDB.RecordOrganizationNameCallCount()).To(Equal(1))
+		_, guid, name, seenAt := nameDB.RecordOrganizationNameArgsForCall(0)
+		Expect(guid).To(Equal("deleted-org-guid"))
+		Expect(name).To(Equal("old-org-name"))
+		Expect(seenAt).To(Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+	})
+
+	It("retries lookups which failed to be recorded", func() {
+		nameDB.RecordOrganizationNameReturns(fmt.Errorf("database unavailable"))
+		errorsBefore := h.CurrentMetricValue(
+			enrichers.CFNameEnricherErrorsTotal.WithLabelValues("test-foundation"),
+		)
+
+		enricher := enrichers.NewCFNameEnricher(
+			"test-foundation", logger,
+			lookupOrganizationName, lookupSpaceName,
+			nameDB, time.Hour,
+		)
+
+		events := []cfclient.Event{{OrganizationGUID: "o1"}}
+		enricher.Enrich(context.Background(), events)
+		enricher.Enrich(context.Background(), events)
+
+		Expect(organizationLookups).To(HaveLen(2))
+		Expect(enrichers.CFNameEnricherErrorsTotal.WithLabelValues("test-foundation")).To(
+			h.MetricIncrementedBy(errorsBefore, "==", 2),
+		)
+	})
+})
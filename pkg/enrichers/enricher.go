@@ -0,0 +1,23 @@
+package enrichers
+
+import (
+	"context"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+)
+
+// Enricher records extra details about events as they are collected, before
+// they are stored. Enrichment is best effort: failures are logged and counted
+// but never stop events being stored.
+type Enricher interface {
+	Enrich(ctx context.Context, events []cfclient.Event)
+}
+
+// Chain is an Enricher which runs each of its enrichers in turn
+type Chain []Enricher
+
+func (c Chain) Enrich(ctx context.Context, events []cfclient.Event) {
+	for _, enricher := range c {
+		enricher.Enrich(ctx, events)
+	}
+}
@@ -0,0 +1,13 @@
+package enrichers_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestEnrichers(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Enrichers Suite")
+}
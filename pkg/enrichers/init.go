@@ -0,0 +1,5 @@
+package enrichers
+
+func init() {
+	initMetrics()
+}
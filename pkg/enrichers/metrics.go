@@ -0,0 +1,34 @@
+package enrichers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	CFNameEnricherLookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_name_enricher_lookups_total",
+		Help: "Number of organization and space names looked up by CF Name Enricher, by result",
+	}, []string{"foundation", "kind", "result"})
+
+	CFNameEnricherErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_name_enricher_errors_total",
+		Help: "Number of errors encountered by CF Name Enricher",
+	}, []string{"foundation"})
+
+	UAAActorEnricherLookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "uaa_actor_enricher_lookups_total",
+		Help: "Number of users looked up by UAA Actor Enricher, by result",
+	}, []string{"foundation", "result"})
+
+	UAAActorEnricherErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "uaa_actor_enricher_errors_total",
+		Help: "Number of errors encountered by UAA Actor Enricher",
+	}, []string{"foundation"})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(CFNameEnricherLookupsTotal)
+	prometheus.MustRegister(CFNameEnricherErrorsTotal)
+	prometheus.MustRegister(UAAActorEnricherLookupsTotal)
+	prometheus.MustRegister(UAAActorEnricherErrorsTotal)
+}
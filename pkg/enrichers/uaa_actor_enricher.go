@@ -0,0 +1,98 @@
+package enrichers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+)
+
+const actorTypeUser = "user"
+
+// UserLookup returns a user from UAA, or fetchers.ErrNotFound if they no
+// longer exist
+type UserLookup = func(ctx context.Context, guid string) (fetchers.UAAUser, error)
+
+// UAAActorEnricher records the UAA details of the users who made changes, so
+// that they can be identified when actor_username is empty or ambiguous.
+// Users are looked up in UAA at most once per cacheTTL.
+type UAAActorEnricher struct {
+	foundation string
+	logger     lager.Logger
+	lookupUser UserLookup
+	actorDB    db.ActorDB
+
+	actors *ttlCache[struct{}]
+}
+
+func NewUAAActorEnricher(
+	foundation string,
+	logger lager.Logger,
+	lookupUser UserLookup,
+	actorDB db.ActorDB,
+	cacheTTL time.Duration,
+) *UAAActorEnricher {
+	logger = logger.Session("uaa-actor-enricher", lager.Data{"foundation": foundation})
+	return &UAAActorEnricher{
+		foundation: foundation,
+		logger:     logger,
+		lookupUser: lookupUser,
+		actorDB:    actorDB,
+		actors:     newTTLCache[struct{}](cacheTTL, time.Now),
+	}
+}
+
+func (e *UAAActorEnricher) Enrich(ctx context.Context, events []cfclient.Event) {
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return
+		}
+		if event.ActorType != actorTypeUser || event.Actor == "" {
+			continue
+		}
+		e.resolve(ctx, event.Actor)
+	}
+}
+
+// resolve looks up and records the details of a user, unless they have been
+// looked up recently
+func (e *UAAActorEnricher) resolve(ctx context.Context, guid string) {
+	if _, ok := e.actors.get(guid); ok {
+		UAAActorEnricherLookupsTotal.WithLabelValues(e.foundation, lookupResultCached).Inc()
+		return
+	}
+
+	user, err := e.lookupUser(ctx, guid)
+	if errors.Is(err, fetchers.ErrNotFound) {
+		UAAActorEnricherLookupsTotal.WithLabelValues(e.foundation, lookupResultNotFound).Inc()
+		err = e.actorDB.RecordActorDeleted(e.foundation, guid, time.Now())
+		if err != nil {
+			e.logger.Error("err-record-actor-deleted", err, lager.Data{"guid": guid})
+			UAAActorEnricherErrorsTotal.WithLabelValues(e.foundation).Inc()
+			return
+		}
+		e.actors.set(guid, struct{}{})
+		return
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			e.logger.Error("err-lookup-user", err, lager.Data{"guid": guid})
+			UAAActorEnricherLookupsTotal.WithLabelValues(e.foundation, lookupResultError).Inc()
+		}
+		return
+	}
+	UAAActorEnricherLookupsTotal.WithLabelValues(e.foundation, lookupResultFound).Inc()
+
+	err = e.actorDB.RecordActor(e.foundation, db.Actor(user), time.Now())
+	if err != nil {
+		e.logger.Error("err-record-actor", err, lager.Data{"guid": guid})
+		UAAActorEnricherErrorsTotal.WithLabelValues(e.foundation).Inc()
+		return
+	}
+	e.actors.set(guid, struct{}{})
+}
@@ -0,0 +1,124 @@
+package enrichers_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/enrichers"
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("UAAActorEnricher", func() {
+	var (
+		logger  lager.Logger
+		actorDB *dbfakes.FakeActorDB
+
+		userLookups []string
+		lookupUser  enrichers.UserLookup
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("enricher-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		actorDB = &dbfakes.FakeActorDB{}
+
+		userLookups = nil
+		lookupUser = func(_ context.Context, guid string) (fetchers.UAAUser, error) {
+			userLookups = append(userLookups, guid)
+			switch guid {
+			case "deleted-user-guid":
+				return fetchers.UAAUser{}, fmt.Errorf("wrapped: %w", fetchers.ErrNotFound)
+			case "unavailable-user-guid":
+				return fetchers.UAAUser{}, fmt.Errorf("uaa unavailable")
+			}
+			return fetchers.UAAUser{
+				GUID:     guid,
+				Username: "someone@example.com",
+				Origin:   "google",
+				Email:    "someone@example.com",
+				Active:   true,
+			}, nil
+		}
+	})
+
+	It("looks up and records users once, ignoring other actors", func() {
+		enricher := enrichers.NewUAAActorEnricher(
+			"test-foundation", logger, lookupUser, actorDB, time.Hour,
+		)
+
+		cachedBefore := h.CurrentMetricValue(
+			enrichers.UAAActorEnricherLookupsTotal.WithLabelValues("test-foundation", "cached"),
+		)
+
+		enricher.Enrich(context.Background(), []cfclient.Event{
+			{Actor: "user-guid", ActorType: "user"},
+			{Actor: "user-guid", ActorType: "user"},
+			{Actor: "some-client", ActorType: "system"},
+			{Actor: "app-guid", ActorType: "app"},
+		})
+
+		Expect(userLookups).To(Equal([]string{"user-guid"}))
+		Expect(actorDB.RecordActorCallCount()).To(Equal(1))
+		foundation, actor, seenAt := actorDB.RecordActorArgsForCall(0)
+		Expect(foundation).To(Equal("test-foundation"))
+		Expect(actor).To(Equal(db.Actor{
+			GUID:     "user-guid",
+			Username: "someone@example.com",
+			Origin:   "google",
+			Email:    "someone@example.com",
+			Active:   true,
+		}))
+		Expect(seenAt).To(BeTemporally("~", time.Now(), time.Second))
+
+		Expect(enrichers.UAAActorEnricherLookupsTotal.WithLabelValues("test-foundation", "cached")).To(
+			h.MetricIncrementedBy(cachedBefore, "==", 1),
+		)
+	})
+
+	It("records users who have been deleted", func() {
+		enricher := enrichers.NewUAAActorEnricher(
+			"test-foundation", logger, lookupUser, actorDB, time.Hour,
+		)
+
+		events := []cfclient.Event{{Actor: "deleted-user-guid", ActorType: "user"}}
+		enricher.Enrich(context.Background(), events)
+		enricher.Enrich(context.Background(), events)
+
+		Expect(userLookups).To(HaveLen(1))
+		Expect(actorDB.RecordActorCallCount()).To(Equal(0))
+		Expect(actorDB.RecordActorDeletedCallCount()).To(Equal(1))
+		foundation, guid, _ := actorDB.RecordActorDeletedArgsForCall(0)
+		Expect(foundation).To(Equal("test-foundation"))
+		Expect(guid).To(Equal("deleted-user-guid"))
+	})
+
+	It("does not cache failed lookups", func() {
+		errorsBefore := h.CurrentMetricValue(
+			enrichers.UAAActorEnricherLookupsTotal.WithLabelValues("test-foundation", "error"),
+		)
+
+		enricher := enrichers.NewUAAActorEnricher(
+			"test-foundation", logger, lookupUser, actorDB, time.Hour,
+		)
+
+		events := []cfclient.Event{{Actor: "unavailable-user-guid", ActorType: "user"}}
+		enricher.Enrich(context.Background(), events)
+		enricher.Enrich(context.Background(), events)
+
+		Expect(userLookups).To(HaveLen(2))
+		Expect(actorDB.RecordActorCallCount()).To(Equal(0))
+		Expect(enrichers.UAAActorEnricherLookupsTotal.WithLabelValues("test-foundation", "error")).To(
+			h.MetricIncrementedBy(errorsBefore, "==", 2),
+		)
+	})
+})
@@ -0,0 +1,73 @@
+package fetchers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// ErrNotFound is returned when Cloud Controller or UAA says that the
+// requested resource does not exist
+var ErrNotFound = errors.New("not found")
+
+// doRequest makes an authenticated GET request to cfg.APIAddress, usually
+// Cloud Controller, returning a retryableError for responses and failures
+// which are likely to be transient
+func doRequest(ctx context.Context, cfg *FetcherConfig, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", cfg.APIAddress+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %s", err)
+	}
+
+	token, err := cfg.CFClient.GetToken()
+	if err != nil {
+		return nil, &retryableError{
+			err:   fmt.Errorf("error getting token: %s", err),
+			cause: retryCauseTokenError,
+		}
+	}
+	req.Header.Set("Authorization", token)
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &retryableError{
+			err:   fmt.Errorf("error requesting events: %s", err),
+			cause: retryCauseNetworkError,
+		}
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	err = fmt.Errorf("request failed with status code %d: %s", resp.StatusCode, body)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, err)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, &retryableError{
+			err:        err,
+			cause:      retryCauseRateLimited,
+			retryAfter: retryAfter(resp.Header),
+		}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, &retryableError{
+			err:        err,
+			cause:      retryCauseServerError,
+			retryAfter: retryAfter(resp.Header),
+		}
+	default:
+		return nil, err
+	}
+}
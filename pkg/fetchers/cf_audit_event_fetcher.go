@@ -1,84 +1,254 @@
 package fetchers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/lager"
 	cfclient "github.com/cloudfoundry-community/go-cfclient"
 )
 
-type CFAuditEventFetcher = func(pullEventsSince time.Time, resultsChan chan CFAuditEventResult)
+// CFAuditEventFetcher sends pages of events to resultsChan, closing it when
+// there are no more pages, after an error, or when ctx is cancelled
+type CFAuditEventFetcher = func(ctx context.Context, query CFAuditEventQuery, resultsChan chan CFAuditEventResult)
+
+// CFAuditEventQuery describes which events to fetch
+type CFAuditEventQuery struct {
+	// Since is the time from which events should be fetched. It is
+	// inclusive, to the second, so that an event on the boundary between
+	// two windows is fetched by the later one, and the event stored last is
+	// fetched again and ignored as a duplicate.
+	Since time.Time
+	// Until is the time before which events should be fetched, if set
+	Until time.Time
+	// StartPageURL resumes fetching from a page returned in a previous
+	// CFAuditEventResult, in which case Since and Until are ignored
+	StartPageURL string
+}
 
-func FetchCFAuditEvents(cfg *FetcherConfig, pullEventsSince time.Time, resultsChan chan CFAuditEventResult) {
-	fetchEvents(cfg, startPageURL(pullEventsSince), resultsChan)
+func FetchCFAuditEvents(ctx context.Context, cfg *FetcherConfig, query CFAuditEventQuery, resultsChan chan CFAuditEventResult) {
+	fetchEvents(ctx, cfg, startPageURL(query, cfg.EventTypes), getPage, resultsChan)
 }
 
 type CFAuditEventResult struct {
 	Events []cfclient.Event
-	Err    error
+	// Raw holds the item of Cloud Controller's response which each event was
+	// decoded from, in the same order as Events
+	Raw []json.RawMessage
+	// Undecodable holds the items of the page which could not be decoded as
+	// events
+	Undecodable []UndecodableCFAuditEvent
+	Err         error
+
+	// PageURL is the URL of the page the events were fetched from, which can
+	// be used to resume fetching later
+	PageURL string
+}
+
+// UndecodableCFAuditEvent is an item of a page of events which could not be
+// decoded as an event, for example because a field has the wrong type
+type UndecodableCFAuditEvent struct {
+	// GUID is the event's GUID, if it could be found
+	GUID string
+	Raw  json.RawMessage
+	Err  error
+}
+
+// cfAuditEventPage is a page of events. Each item of the page is decoded on
+// its own, so that one which cannot be decoded does not fail the page.
+type cfAuditEventPage struct {
+	// NextPageURL is the URL of the next page, or an empty string if there
+	// are no more pages
+	NextPageURL string
+	Events      []cfclient.Event
+	Raw         []json.RawMessage
+	Undecodable []UndecodableCFAuditEvent
 }
 
-func startPageURL(pullEventsSince time.Time) string {
-	timestamp := fmt.Sprintf("timestamp>%s", pullEventsSince.Format("2006-01-02T15:04:05Z"))
+// add decodes an item of the page with decode, adding it to Events or, if it
+// cannot be decoded, Undecodable
+func (p *cfAuditEventPage) add(raw json.RawMessage, decode func(raw json.RawMessage) (cfclient.Event, error)) {
+	event, err := decode(raw)
+	if err != nil {
+		p.Undecodable = append(p.Undecodable, UndecodableCFAuditEvent{
+			GUID: findGUID(raw),
+			Raw:  raw,
+			Err:  fmt.Errorf("error unmarshaling event: %s", err),
+		})
+		return
+	}
+	p.Events = append(p.Events, event)
+	p.Raw = append(p.Raw, raw)
+}
+
+// pageGetter fetches a single page of events
+type pageGetter = func(ctx context.Context, cfg *FetcherConfig, url string) (cfAuditEventPage, error)
+
+func startPageURL(query CFAuditEventQuery, eventTypes EventTypeFilter) string {
+	if query.StartPageURL != "" {
+		return query.StartPageURL
+	}
 	q := url.Values{}
-	q.Set("q", timestamp)
+	q.Add("q", fmt.Sprintf("timestamp>=%s", query.Since.Format("2006-01-02T15:04:05Z")))
+	if !query.Until.IsZero() {
+		q.Add("q", fmt.Sprintf("timestamp<%s", query.Until.Format("2006-01-02T15:04:05Z")))
+	}
+	if types := eventTypes.ServerSideTypes(); len(types) > 0 {
+		q.Add("q", fmt.Sprintf("type IN %s", strings.Join(types, ",")))
+	}
 	q.Set("results-per-page", "100")
 	return fmt.Sprintf("/v2/events?%s", q.Encode())
 }
 
-func fetchEvents(cfg *FetcherConfig, startPageURL string, resultsChan chan CFAuditEventResult) {
+func fetchEvents(ctx context.Context, cfg *FetcherConfig, startPageURL string, getPage pageGetter, resultsChan chan CFAuditEventResult) {
 	defer close(resultsChan)
 
 	logger := cfg.Logger.WithData(lager.Data{"start_page_url": startPageURL})
 	logger.Info("fetching")
 
 	nextPageURL := startPageURL
-	var events []cfclient.Event
-	var err error
 
 	for nextPageURL != "" {
-		logger = logger.WithData(lager.Data{"page_url": nextPageURL})
+		pageURL := nextPageURL
+		logger = logger.WithData(lager.Data{"page_url": pageURL})
 
-		nextPageURL, events, err = getPage(cfg.CFClient, nextPageURL)
+		page, err := getPageWithRetries(ctx, cfg, logger, getPage, pageURL)
+		if ctx.Err() != nil {
+			logger.Info("fetched.page.cancelled")
+			return
+		}
 		if err != nil {
 			logger.Error("fetched.page.error", err)
-			resultsChan <- CFAuditEventResult{Err: err}
+			sendResult(ctx, resultsChan, CFAuditEventResult{Err: err})
+			return
+		}
+		nextPageURL = page.NextPageURL
+		fetchedCount := len(page.Events)
+		events, raw := cfg.EventTypes.filterEvents(cfg.Foundation, page.Events, page.Raw)
+		logger.Info("fetched.page.ok", lager.Data{
+			"event_count":       fetchedCount,
+			"filtered_count":    fetchedCount - len(events),
+			"undecodable_count": len(page.Undecodable),
+		})
+		result := CFAuditEventResult{
+			Events:      events,
+			Raw:         raw,
+			Undecodable: page.Undecodable,
+			PageURL:     pageURL,
+		}
+		if !sendResult(ctx, resultsChan, result) {
+			logger.Info("fetched.page.cancelled")
 			return
 		}
-		logger.Info("fetched.page.ok", lager.Data{"event_count": len(events)})
-		resultsChan <- CFAuditEventResult{Events: events}
 
-		time.Sleep(cfg.PaginationWaitTime)
+		if nextPageURL != "" && !sleep(ctx, cfg.PaginationWaitTime) {
+			logger.Info("fetched.page.cancelled")
+			return
+		}
 	}
 }
 
-func getPage(cfClient cfclient.CloudFoundryClient, url string) (string, []cfclient.Event, error) {
-	resp, err := cfClient.DoRequest(cfClient.NewRequest("GET", url))
+// sendResult sends result to resultsChan unless ctx is cancelled first,
+// returning whether the result was sent
+func sendResult(ctx context.Context, resultsChan chan CFAuditEventResult, result CFAuditEventResult) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case resultsChan <- result:
+		return true
+	}
+}
+
+// sleep waits for d unless ctx is cancelled first, returning whether it
+// waited for the whole duration
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func getPage(ctx context.Context, cfg *FetcherConfig, url string) (cfAuditEventPage, error) {
+	resp, err := doRequest(ctx, cfg, url)
 	if err != nil {
-		return "", nil, fmt.Errorf("error requesting events: %s", err)
+		return cfAuditEventPage{}, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		// This only occurs when the status code is < 400
-		return "", nil, fmt.Errorf("request failed with status code %d", resp.StatusCode)
+	var eventResp struct {
+		NextURL   string            `json:"next_url"`
+		Resources []json.RawMessage `json:"resources"`
 	}
-
-	var eventResp cfclient.EventsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&eventResp); err != nil {
-		return "", nil, fmt.Errorf("error unmarshaling events: %s", err)
+		return cfAuditEventPage{}, fmt.Errorf("error unmarshaling events: %s", err)
 	}
 
-	events := make([]cfclient.Event, len(eventResp.Resources))
-	for i, e := range eventResp.Resources {
-		e.Entity.GUID = e.Meta.Guid
-		e.Entity.CreatedAt = e.Meta.CreatedAt
-		events[i] = e.Entity
+	page := cfAuditEventPage{NextPageURL: eventResp.NextURL}
+	for _, raw := range eventResp.Resources {
+		page.add(raw, decodeV2Event)
 	}
+	return page, nil
+}
 
-	return eventResp.NextURL, events, nil
+func decodeV2Event(raw json.RawMessage) (cfclient.Event, error) {
+	var resource cfclient.EventResource
+	if err := json.Unmarshal(raw, &resource); err != nil {
+		return cfclient.Event{}, err
+	}
+	event := resource.Entity
+	event.GUID = resource.Meta.Guid
+	event.CreatedAt = resource.Meta.CreatedAt
+	return event, nil
+}
+
+// findGUID returns the GUID of an item of a page of events from either API,
+// which could not be decoded, or an empty string if it has none
+func findGUID(raw json.RawMessage) string {
+	var item struct {
+		GUID     interface{} `json:"guid"`
+		Metadata struct {
+			GUID interface{} `json:"guid"`
+		} `json:"metadata"`
+	}
+	// Decoding carries on past fields of the wrong type, so the error is
+	// ignored
+	_ = json.Unmarshal(raw, &item)
+	for _, guid := range []interface{}{item.Metadata.GUID, item.GUID} {
+		if guid, ok := guid.(string); ok && guid != "" {
+			return guid
+		}
+	}
+	return ""
+}
+
+// DecodeCFAuditEvent decodes an item of a page of events from either API, as
+// held in CFAuditEventResult.Raw. An event which was encoded from a
+// cfclient.Event, as quarantined events used to be, is decoded too.
+func DecodeCFAuditEvent(raw json.RawMessage) (cfclient.Event, error) {
+	var item struct {
+		Entity json.RawMessage `json:"entity"`
+		Actor  json.RawMessage `json:"actor"`
+	}
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return cfclient.Event{}, err
+	}
+	switch {
+	case item.Entity != nil:
+		return decodeV2Event(raw)
+	case strings.HasPrefix(string(item.Actor), "{"):
+		return decodeV3Event(raw)
+	default:
+		var event cfclient.Event
+		err := json.Unmarshal(raw, &event)
+		return event, err
+	}
 }
@@ -1,11 +1,13 @@
 package fetchers_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/satori/go.uuid"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/lager"
@@ -16,6 +18,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/alphagov/paas-auditor/pkg/fetchers"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
 )
 
 const (
@@ -65,9 +68,17 @@ var _ = Describe("CFAuditEvents Fetcher", func() {
 		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
 
 		cfg = &fetchers.FetcherConfig{
+			Foundation:         "test-foundation",
 			CFClient:           cfClient,
 			Logger:             logger,
 			PaginationWaitTime: 10 * time.Millisecond,
+
+			APIAddress: cfAPIURL,
+			HTTPClient: httpclient,
+
+			MaxRetries:          2,
+			RetryInitialBackoff: 1 * time.Millisecond,
+			RetryMaxBackoff:     2 * time.Millisecond,
 		}
 	})
 
@@ -81,13 +92,34 @@ var _ = Describe("CFAuditEvents Fetcher", func() {
 			eventPages  [][]cfclient.Event
 		)
 
+		var (
+			networkErrorRetriesTotal          float64
+			networkErrorRetriesExhaustedTotal float64
+			serverErrorRetriesTotal           float64
+			rateLimitedRetriesTotal           float64
+		)
+
 		BeforeEach(func() {
 			resultsChan = make(chan fetchers.CFAuditEventResult, numberOfPages)
 			eventPages = randomEventPages(numberOfPages, 5)
+
+			By("checking the value of the metrics to test against them later")
+			networkErrorRetriesTotal = h.CurrentMetricValue(
+				fetchers.CFAuditEventFetcherRetriesTotal.WithLabelValues("test-foundation", "network_error"),
+			)
+			networkErrorRetriesExhaustedTotal = h.CurrentMetricValue(
+				fetchers.CFAuditEventFetcherRetriesExhaustedTotal.WithLabelValues("test-foundation", "network_error"),
+			)
+			serverErrorRetriesTotal = h.CurrentMetricValue(
+				fetchers.CFAuditEventFetcherRetriesTotal.WithLabelValues("test-foundation", "server_error"),
+			)
+			rateLimitedRetriesTotal = h.CurrentMetricValue(
+				fetchers.CFAuditEventFetcherRetriesTotal.WithLabelValues("test-foundation", "rate_limited"),
+			)
 		})
 
 		It("appears to work", func() {
-			expectedQ := "timestamp>2019-10-04T12:40:43Z"
+			expectedQ := "timestamp>=2019-10-04T12:40:43Z"
 			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
 
 			By("registering mocks")
@@ -104,13 +136,15 @@ var _ = Describe("CFAuditEvents Fetcher", func() {
 			By("fetching events")
 			go func() {
 				defer GinkgoRecover()
-				fetchers.FetchCFAuditEvents(cfg, pullEventsSince, resultsChan)
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{Since: pullEventsSince}, resultsChan)
 			}()
 
 			By("expecting results via the channel")
 			for page := 1; page <= numberOfPages; page++ {
 				Eventually(resultsChan, "100ms", "1ms").Should(Receive(
-					Equal(fetchers.CFAuditEventResult{Events: eventPages[page-1]}),
+					WithTransform(withoutRaw, Equal(fetchers.CFAuditEventResult{
+						Events: eventPages[page-1], PageURL: v2PageURL(expectedQ, page),
+					})),
 				))
 
 				Expect(httpmock.GetTotalCallCount()).To(Equal(page))
@@ -121,8 +155,8 @@ var _ = Describe("CFAuditEvents Fetcher", func() {
 			Eventually(httpmock.GetTotalCallCount).Should(Equal(numberOfPages))
 		})
 
-		It("returns an error and closes the chan when there is an error", func() {
-			expectedQ := "timestamp>2019-10-04T12:40:43Z"
+		It("returns an error and closes the chan when an error persists after retrying", func() {
+			expectedQ := "timestamp>=2019-10-04T12:40:43Z"
 			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
 
 			By("registering mocks")
@@ -141,13 +175,15 @@ var _ = Describe("CFAuditEvents Fetcher", func() {
 			By("fetching events")
 			go func() {
 				defer GinkgoRecover()
-				fetchers.FetchCFAuditEvents(cfg, pullEventsSince, resultsChan)
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{Since: pullEventsSince}, resultsChan)
 			}()
 
 			By("expecting results via the channel")
 			for p := 1; p <= 2; p++ {
 				Eventually(resultsChan, "100ms", "1ms").Should(Receive(
-					Equal(fetchers.CFAuditEventResult{Events: eventPages[p]}),
+					WithTransform(withoutRaw, Equal(fetchers.CFAuditEventResult{
+						Events: eventPages[p], PageURL: v2PageURL(expectedQ, p),
+					})),
 				))
 			}
 			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
@@ -157,11 +193,333 @@ var _ = Describe("CFAuditEvents Fetcher", func() {
 
 			By("checking we are finished")
 			Eventually(resultsChan).Should(BeClosed())
-			Eventually(httpmock.GetTotalCallCount).Should(Equal(3))
+			Eventually(httpmock.GetTotalCallCount).Should(Equal(3 + cfg.MaxRetries))
+
+			By("checking the metrics")
+			Expect(fetchers.CFAuditEventFetcherRetriesTotal.WithLabelValues("test-foundation", "network_error")).To(
+				h.MetricIncrementedBy(networkErrorRetriesTotal, "==", float64(cfg.MaxRetries)),
+			)
+			Expect(fetchers.CFAuditEventFetcherRetriesExhaustedTotal.WithLabelValues("test-foundation", "network_error")).To(
+				h.MetricIncrementedBy(networkErrorRetriesExhaustedTotal, "==", 1),
+			)
+		})
+
+		It("retries server errors and rate limiting and then carries on", func() {
+			expectedQ := "timestamp>=2019-10-04T12:40:43Z"
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+
+			By("registering mocks")
+			mockEventPageResponse(1, 2, true, expectedQ, eventPages[0])
+
+			secondPageRequests := 0
+			secondPage := httpmock.NewJsonResponderOrPanic(
+				200, wrapEventsForResponse(2, "", eventPages[1]),
+			)
+			httpmock.RegisterResponderWithQuery(
+				"GET", fmt.Sprintf("%s/v2/events", cfAPIURL),
+				url.Values{
+					"q":                []string{expectedQ},
+					"results-per-page": []string{"100"},
+					"page":             []string{"2"},
+				},
+				func(req *http.Request) (*http.Response, error) {
+					secondPageRequests++
+					switch secondPageRequests {
+					case 1:
+						return httpmock.NewStringResponse(503, "Service Unavailable"), nil
+					case 2:
+						resp := httpmock.NewStringResponse(429, `{"code":10013}`)
+						resp.Header.Set("Retry-After", "0")
+						return resp, nil
+					default:
+						return secondPage(req)
+					}
+				},
+			)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{Since: pullEventsSince}, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			for page := 1; page <= 2; page++ {
+				Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+					WithTransform(withoutRaw, Equal(fetchers.CFAuditEventResult{
+						Events: eventPages[page-1], PageURL: v2PageURL(expectedQ, page),
+					})),
+				))
+			}
+
+			By("checking we are finished")
+			Eventually(resultsChan).Should(BeClosed())
+			Expect(httpmock.GetTotalCallCount()).To(Equal(4))
+
+			By("checking the metrics")
+			Expect(fetchers.CFAuditEventFetcherRetriesTotal.WithLabelValues("test-foundation", "server_error")).To(
+				h.MetricIncrementedBy(serverErrorRetriesTotal, "==", 1),
+			)
+			Expect(fetchers.CFAuditEventFetcherRetriesTotal.WithLabelValues("test-foundation", "rate_limited")).To(
+				h.MetricIncrementedBy(rateLimitedRetriesTotal, "==", 1),
+			)
+		})
+
+		It("fetches events within a window", func() {
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+			pullEventsUntil := time.Date(2019, 10, 5, 12, 40, 43, 0, time.UTC)
+
+			By("registering mocks")
+			httpmock.RegisterResponderWithQuery(
+				"GET", fmt.Sprintf("%s/v2/events", cfAPIURL),
+				url.Values{
+					"q": []string{
+						"timestamp>=2019-10-04T12:40:43Z",
+						"timestamp<2019-10-05T12:40:43Z",
+					},
+					"results-per-page": []string{"100"},
+				},
+				httpmock.NewJsonResponderOrPanic(
+					200, wrapEventsForResponse(1, "", eventPages[0]),
+				),
+			)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{
+					Since: pullEventsSince,
+					Until: pullEventsUntil,
+				}, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
+				func(res fetchers.CFAuditEventResult) []cfclient.Event { return res.Events },
+				Equal(eventPages[0]),
+			)))
+			Eventually(resultsChan).Should(BeClosed())
+		})
+
+		It("asks Cloud Controller to filter to exact event types", func() {
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+			cfg.EventTypes = fetchers.EventTypeFilter{
+				Include: []string{"audit.app.ssh-authorized", "audit.user.space_developer_add"},
+			}
+
+			By("registering mocks")
+			httpmock.RegisterResponderWithQuery(
+				"GET", fmt.Sprintf("%s/v2/events", cfAPIURL),
+				url.Values{
+					"q": []string{
+						"timestamp>=2019-10-04T12:40:43Z",
+						"type IN audit.app.ssh-authorized,audit.user.space_developer_add",
+					},
+					"results-per-page": []string{"100"},
+				},
+				httpmock.NewJsonResponderOrPanic(
+					200, wrapEventsForResponse(1, "", nil),
+				),
+			)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{
+					Since: pullEventsSince,
+				}, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
+				func(res fetchers.CFAuditEventResult) error { return res.Err },
+				BeNil(),
+			)))
+			Eventually(resultsChan).Should(BeClosed())
+		})
+
+		It("filters wildcard event types after fetching, counting the events dropped", func() {
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+			cfg.EventTypes = fetchers.EventTypeFilter{
+				Include: []string{"audit.user.*", "audit.app.ssh-*"},
+				Exclude: []string{"audit.user.organization_user_add"},
+			}
+
+			events := randomEvents(4)
+			events[0].Type = "audit.user.space_developer_add"
+			events[1].Type = "audit.user.organization_user_add"
+			events[2].Type = "audit.app.ssh-authorized"
+			events[3].Type = "audit.app.update"
+
+			droppedUpdates := h.CurrentMetricValue(
+				fetchers.CFAuditEventFetcherEventsFilteredTotal.WithLabelValues("test-foundation", "audit.app.update"),
+			)
+			droppedUserAdds := h.CurrentMetricValue(
+				fetchers.CFAuditEventFetcherEventsFilteredTotal.WithLabelValues("test-foundation", "audit.user.organization_user_add"),
+			)
+
+			By("registering mocks")
+			httpmock.RegisterResponderWithQuery(
+				"GET", fmt.Sprintf("%s/v2/events", cfAPIURL),
+				url.Values{
+					"q":                []string{"timestamp>=2019-10-04T12:40:43Z"},
+					"results-per-page": []string{"100"},
+				},
+				httpmock.NewJsonResponderOrPanic(
+					200, wrapEventsForResponse(1, "", events),
+				),
+			)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{
+					Since: pullEventsSince,
+				}, resultsChan)
+			}()
+
+			By("expecting only the kept events via the channel")
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
+				func(res fetchers.CFAuditEventResult) []cfclient.Event { return res.Events },
+				Equal([]cfclient.Event{events[0], events[2]}),
+			)))
+			Eventually(resultsChan).Should(BeClosed())
+
+			By("checking the metrics")
+			Expect(fetchers.CFAuditEventFetcherEventsFilteredTotal.WithLabelValues("test-foundation", "audit.app.update")).To(
+				h.MetricIncrementedBy(droppedUpdates, "==", 1),
+			)
+			Expect(fetchers.CFAuditEventFetcherEventsFilteredTotal.WithLabelValues("test-foundation", "audit.user.organization_user_add")).To(
+				h.MetricIncrementedBy(droppedUserAdds, "==", 1),
+			)
+		})
+
+		It("resumes fetching from a page URL", func() {
+			expectedQ := "timestamp>=2019-10-04T12:40:43Z"
+
+			By("registering mocks")
+			for page := 1; page <= numberOfPages; page++ {
+				mockEventPageResponse(
+					page, numberOfPages, page != numberOfPages,
+					expectedQ,
+					eventPages[page-1],
+				)
+			}
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{
+					StartPageURL: v2PageURL(expectedQ, 8),
+				}, resultsChan)
+			}()
+
+			By("expecting results from the resumed page onwards")
+			for page := 8; page <= numberOfPages; page++ {
+				Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+					WithTransform(withoutRaw, Equal(fetchers.CFAuditEventResult{
+						Events: eventPages[page-1], PageURL: v2PageURL(expectedQ, page),
+					})),
+				))
+			}
+
+			By("checking we are finished")
+			Eventually(resultsChan).Should(BeClosed())
+			Expect(httpmock.GetTotalCallCount()).To(Equal(3))
+		})
+
+		It("stops paging and closes the chan when the context is cancelled", func() {
+			expectedQ := "timestamp>=2019-10-04T12:40:43Z"
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+
+			cfg.PaginationWaitTime = 1 * time.Hour
+
+			By("registering mocks")
+			for page := 1; page <= numberOfPages; page++ {
+				mockEventPageResponse(
+					page, numberOfPages, page != numberOfPages,
+					expectedQ,
+					eventPages[page-1],
+				)
+			}
+
+			By("fetching events")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(ctx, cfg, fetchers.CFAuditEventQuery{Since: pullEventsSince}, resultsChan)
+			}()
+
+			By("expecting the first page via the channel")
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+				WithTransform(withoutRaw, Equal(fetchers.CFAuditEventResult{
+					Events: eventPages[0], PageURL: v2PageURL(expectedQ, 1),
+				})),
+			))
+
+			By("cancelling while waiting to fetch the next page")
+			cancel()
+
+			By("checking we are finished without an error")
+			Eventually(resultsChan, "100ms", "1ms").Should(BeClosed())
+			Expect(httpmock.GetTotalCallCount()).To(Equal(1))
+		})
+
+		It("cancels in-flight requests when the context is cancelled", func() {
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			By("registering mocks")
+			httpmock.RegisterResponder(
+				"GET", fmt.Sprintf(`=~^%s.*\z`, cfAPIURL),
+				func(req *http.Request) (*http.Response, error) {
+					cancel()
+					<-req.Context().Done()
+					return nil, req.Context().Err()
+				},
+			)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(ctx, cfg, fetchers.CFAuditEventQuery{Since: pullEventsSince}, resultsChan)
+			}()
+
+			By("checking we are finished without an error or retrying")
+			Eventually(resultsChan, "100ms", "1ms").Should(BeClosed())
+			Expect(httpmock.GetTotalCallCount()).To(Equal(1))
+		})
+
+		It("does not retry client errors", func() {
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+
+			By("registering mocks")
+			httpmock.RegisterResponder(
+				"GET", fmt.Sprintf(`=~^%s.*\z`, cfAPIURL),
+				httpmock.NewStringResponder(404, `{"code":10000}`),
+			)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{Since: pullEventsSince}, resultsChan)
+			}()
+
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
+				func(res fetchers.CFAuditEventResult) error { return res.Err },
+				MatchError(ContainSubstring("with status code 404")),
+			)))
+
+			By("checking we are finished")
+			Eventually(resultsChan).Should(BeClosed())
+			Expect(httpmock.GetTotalCallCount()).To(Equal(1))
 		})
 
 		It("returns an error and closes the chan when there is an non-200 response", func() {
-			expectedQ := "timestamp>2019-10-04T12:40:43Z"
+			expectedQ := "timestamp>=2019-10-04T12:40:43Z"
 			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
 
 			By("registering mocks")
@@ -178,13 +536,15 @@ var _ = Describe("CFAuditEvents Fetcher", func() {
 			By("fetching events")
 			go func() {
 				defer GinkgoRecover()
-				fetchers.FetchCFAuditEvents(cfg, pullEventsSince, resultsChan)
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{Since: pullEventsSince}, resultsChan)
 			}()
 
 			By("expecting results via the channel")
 			for p := 1; p <= 2; p++ {
 				Eventually(resultsChan, "100ms", "1ms").Should(Receive(
-					Equal(fetchers.CFAuditEventResult{Events: eventPages[p]}),
+					WithTransform(withoutRaw, Equal(fetchers.CFAuditEventResult{
+						Events: eventPages[p], PageURL: v2PageURL(expectedQ, p),
+					})),
 				))
 			}
 			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
@@ -196,6 +556,92 @@ var _ = Describe("CFAuditEvents Fetcher", func() {
 			Eventually(resultsChan).Should(BeClosed())
 			Eventually(httpmock.GetTotalCallCount).Should(Equal(3))
 		})
+
+		It("fetches an event on the boundary between two windows once", func() {
+			boundary := time.Date(2019, 10, 4, 12, 0, 0, 0, time.UTC)
+			events := []cfclient.Event{
+				{GUID: "00000000-0000-0000-0000-000000000001", CreatedAt: "2019-10-04T11:59:59Z"},
+				{GUID: "00000000-0000-0000-0000-000000000002", CreatedAt: "2019-10-04T12:00:00Z"},
+				{GUID: "00000000-0000-0000-0000-000000000003", CreatedAt: "2019-10-04T12:00:01Z"},
+			}
+
+			By("filtering events by timestamp as Cloud Controller does")
+			httpmock.RegisterResponder("GET", fmt.Sprintf("%s/v2/events", cfAPIURL), func(req *http.Request) (*http.Response, error) {
+				matching := []cfclient.Event{}
+				for _, event := range events {
+					if matchesV2Filters(event.CreatedAt, req.URL.Query()["q"]) {
+						matching = append(matching, event)
+					}
+				}
+				return httpmock.NewJsonResponse(200, wrapEventsForResponse(1, "", matching))
+			})
+
+			fetched := []string{}
+			for _, query := range []fetchers.CFAuditEventQuery{
+				{Since: boundary.Add(-time.Hour), Until: boundary},
+				{Since: boundary, Until: boundary.Add(time.Hour)},
+			} {
+				resultsChan := make(chan fetchers.CFAuditEventResult, 1)
+				go fetchers.FetchCFAuditEvents(context.Background(), cfg, query, resultsChan)
+				for result := range resultsChan {
+					Expect(result.Err).NotTo(HaveOccurred())
+					for _, event := range result.Events {
+						fetched = append(fetched, event.GUID)
+					}
+				}
+			}
+			Expect(fetched).To(Equal([]string{
+				"00000000-0000-0000-0000-000000000001",
+				"00000000-0000-0000-0000-000000000002",
+				"00000000-0000-0000-0000-000000000003",
+			}))
+		})
+
+		It("keeps each event as it was sent and sets aside events it cannot decode", func() {
+			httpmock.RegisterResponder("GET", fmt.Sprintf("%s/v2/events", cfAPIURL), httpmock.NewStringResponder(200, `{
+				"next_url": null,
+				"resources": [
+					{"metadata": {"guid": "00000000-0000-0000-0000-000000000001", "created_at": "2019-10-04T12:00:00Z"}, "entity": {"type": "audit.app.update", "unknown_field": "kept"}},
+					{"metadata": {"guid": "00000000-0000-0000-0000-000000000002", "created_at": 1570190400}, "entity": {"type": "audit.app.update"}}
+				]
+			}`))
+
+			resultsChan := make(chan fetchers.CFAuditEventResult, 1)
+			go fetchers.FetchCFAuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{}, resultsChan)
+
+			var result fetchers.CFAuditEventResult
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(&result))
+			Expect(result.Err).NotTo(HaveOccurred())
+			Expect(result.Events).To(HaveLen(1))
+			Expect(result.Events[0].GUID).To(Equal("00000000-0000-0000-0000-000000000001"))
+			Expect(result.Raw).To(HaveLen(1))
+			Expect(string(result.Raw[0])).To(ContainSubstring(`"unknown_field": "kept"`))
+
+			By("decoding the event again as it was sent")
+			event, err := fetchers.DecodeCFAuditEvent(result.Raw[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(event).To(Equal(result.Events[0]))
+
+			Expect(result.Undecodable).To(HaveLen(1))
+			Expect(result.Undecodable[0].GUID).To(Equal("00000000-0000-0000-0000-000000000002"))
+			Expect(string(result.Undecodable[0].Raw)).To(ContainSubstring(`"created_at": 1570190400`))
+			Expect(result.Undecodable[0].Err).To(MatchError(ContainSubstring("error unmarshaling event")))
+			Eventually(resultsChan).Should(BeClosed())
+		})
+	})
+
+	Describe("DecodeCFAuditEvent", func() {
+		It("decodes events encoded from a cfclient.Event", func() {
+			event, err := fetchers.DecodeCFAuditEvent([]byte(`{"guid": "00000000-0000-0000-0000-000000000001", "actor": "actor-guid", "type": "audit.app.update"}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(event.GUID).To(Equal("00000000-0000-0000-0000-000000000001"))
+			Expect(event.Actor).To(Equal("actor-guid"))
+		})
+
+		It("fails to decode anything but an object", func() {
+			_, err := fetchers.DecodeCFAuditEvent([]byte(`"an event"`))
+			Expect(err).To(HaveOccurred())
+		})
 	})
 })
 
@@ -217,16 +663,7 @@ func mockEventPageResponse(
 	}
 
 	if addNextURL {
-		nextURLQuery := url.Values{
-			"q":                []string{expectedQ},
-			"results-per-page": []string{"100"},
-		}
-
-		nextURLQuery["page"] = []string{fmt.Sprintf("%d", page+1)}
-
-		nextURL = fmt.Sprintf(
-			"/v2/events?%s", nextURLQuery.Encode(),
-		)
+		nextURL = v2PageURL(expectedQ, page+1)
 	}
 
 	resp := httpmock.NewJsonResponderOrPanic(
@@ -235,6 +672,41 @@ func mockEventPageResponse(
 	httpmock.RegisterResponderWithQuery("GET", mockURL, expectedQuery, resp)
 }
 
+// matchesV2Filters is true if an event created at createdAt matches the
+// timestamp filters of a v2 query, which compare times as strings
+func matchesV2Filters(createdAt string, filters []string) bool {
+	for _, filter := range filters {
+		for _, op := range []string{">=", "<=", ">", "<"} {
+			value, ok := strings.CutPrefix(filter, "timestamp"+op)
+			if !ok {
+				continue
+			}
+			switch {
+			case op == ">=" && createdAt < value,
+				op == "<=" && createdAt > value,
+				op == ">" && createdAt <= value,
+				op == "<" && createdAt >= value:
+				return false
+			}
+			break
+		}
+	}
+	return true
+}
+
+// v2PageURL is the URL of a page of events, as it appears in the next_url of
+// the previous page
+func v2PageURL(expectedQ string, page int) string {
+	query := url.Values{
+		"q":                []string{expectedQ},
+		"results-per-page": []string{"100"},
+	}
+	if page > 1 {
+		query["page"] = []string{fmt.Sprintf("%d", page)}
+	}
+	return fmt.Sprintf("/v2/events?%s", query.Encode())
+}
+
 func wrapEventsForResponse(
 	pages int,
 	nextURL string,
@@ -301,6 +773,14 @@ func randomEvents(n int) []cfclient.Event {
 	return events
 }
 
+// withoutRaw drops the items of the page which the events were decoded from,
+// which depend on how the response was encoded
+func withoutRaw(result fetchers.CFAuditEventResult) fetchers.CFAuditEventResult {
+	Expect(result.Raw).To(HaveLen(len(result.Events)))
+	result.Raw = nil
+	return result
+}
+
 func randomEventPages(numberOfPages, eventsPerPage int) [][]cfclient.Event {
 	eventPages := make([][]cfclient.Event, numberOfPages)
 	for page := 0; page < numberOfPages; page++ {
@@ -0,0 +1,431 @@
+package fetchers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	"github.com/jarcoal/httpmock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+)
+
+var _ = Describe("CFV3AuditEvents Fetcher", func() {
+	var cfg *fetchers.FetcherConfig
+
+	BeforeEach(func() {
+		httpclient := &http.Client{Transport: &http.Transport{}}
+		httpmock.ActivateNonDefault(httpclient)
+
+		httpmock.RegisterResponder(
+			"GET",
+			fmt.Sprintf("%s/v2/info", cfAPIURL),
+			httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+				"token_endpoint": fmt.Sprintf("%s", uaaAPIURL),
+			}),
+		)
+
+		httpmock.RegisterResponder(
+			"POST",
+			fmt.Sprintf("%s/oauth/token", uaaAPIURL),
+			httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+				"access_token": "acb6803a48114d9fb4761e403c17f812",
+				"token_type":   "bearer",
+				"expires_in":   43199,
+			}),
+		)
+
+		cfClient, err := cfclient.NewClient(&cfclient.Config{
+			ApiAddress: cfAPIURL,
+			HttpClient: httpclient,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		httpmock.Reset() // Reset mock after client creation to clear call count
+
+		logger := lager.NewLogger("fetcher-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		cfg = &fetchers.FetcherConfig{
+			CFClient:           cfClient,
+			Logger:             logger,
+			PaginationWaitTime: 10 * time.Millisecond,
+
+			APIAddress: cfAPIURL,
+			HTTPClient: httpclient,
+
+			MaxRetries:          2,
+			RetryInitialBackoff: 1 * time.Millisecond,
+			RetryMaxBackoff:     2 * time.Millisecond,
+		}
+	})
+
+	Describe("FetchCFV3AuditEvents", func() {
+		const (
+			numberOfPages = 10
+		)
+
+		var (
+			resultsChan chan fetchers.CFAuditEventResult
+			eventPages  [][]cfclient.Event
+		)
+
+		BeforeEach(func() {
+			resultsChan = make(chan fetchers.CFAuditEventResult, numberOfPages)
+			eventPages = randomV3EventPages(numberOfPages, 5)
+		})
+
+		It("appears to work", func() {
+			expectedCreatedAt := "2019-10-04T12:40:43Z"
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+
+			By("registering mocks")
+			for page := 1; page <= numberOfPages; page++ {
+				thereAreMorePages := page != numberOfPages
+
+				mockV3EventPageResponse(
+					page, numberOfPages, thereAreMorePages,
+					expectedCreatedAt,
+					eventPages[page-1],
+				)
+			}
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFV3AuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{Since: pullEventsSince}, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			for page := 1; page <= numberOfPages; page++ {
+				Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+					WithTransform(withoutRaw, Equal(fetchers.CFAuditEventResult{
+						Events: eventPages[page-1], PageURL: v3PageURL(expectedCreatedAt, page),
+					})),
+				))
+
+				Expect(httpmock.GetTotalCallCount()).To(Equal(page))
+			}
+
+			By("checking we are finished")
+			Eventually(resultsChan).Should(BeClosed())
+			Eventually(httpmock.GetTotalCallCount).Should(Equal(numberOfPages))
+		})
+
+		It("fetches events within a window", func() {
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+			pullEventsUntil := time.Date(2019, 10, 5, 12, 40, 43, 0, time.UTC)
+
+			By("registering mocks")
+			httpmock.RegisterResponderWithQuery(
+				"GET", fmt.Sprintf("%s/v3/audit_events", cfAPIURL),
+				url.Values{
+					"created_ats[gte]": []string{"2019-10-04T12:40:43Z"},
+					"created_ats[lt]":  []string{"2019-10-05T12:40:43Z"},
+					"order_by":         []string{"created_at"},
+					"per_page":         []string{"100"},
+				},
+				httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+					"pagination": map[string]interface{}{"next": nil},
+					"resources":  []interface{}{wrapV3Event(eventPages[0][0])},
+				}),
+			)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFV3AuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{
+					Since: pullEventsSince,
+					Until: pullEventsUntil,
+				}, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
+				func(res fetchers.CFAuditEventResult) []cfclient.Event { return res.Events },
+				Equal(eventPages[0][:1]),
+			)))
+			Eventually(resultsChan).Should(BeClosed())
+		})
+
+		It("asks Cloud Controller to filter to exact event types", func() {
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+			cfg.EventTypes = fetchers.EventTypeFilter{
+				Include: []string{"audit.app.ssh-authorized", "audit.user.space_developer_add"},
+			}
+
+			By("registering mocks")
+			httpmock.RegisterResponderWithQuery(
+				"GET", fmt.Sprintf("%s/v3/audit_events", cfAPIURL),
+				url.Values{
+					"created_ats[gte]": []string{"2019-10-04T12:40:43Z"},
+					"types":            []string{"audit.app.ssh-authorized,audit.user.space_developer_add"},
+					"order_by":         []string{"created_at"},
+					"per_page":         []string{"100"},
+				},
+				httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+					"pagination": map[string]interface{}{"next": nil},
+					"resources":  []interface{}{},
+				}),
+			)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFV3AuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{
+					Since: pullEventsSince,
+				}, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
+				func(res fetchers.CFAuditEventResult) error { return res.Err },
+				BeNil(),
+			)))
+			Eventually(resultsChan).Should(BeClosed())
+		})
+
+		It("maps events without a space or organization", func() {
+			expectedCreatedAt := "2019-10-04T12:40:43Z"
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+
+			event := eventPages[0][0]
+			event.SpaceGUID = ""
+			event.OrganizationGUID = ""
+			event.ActorType = "process"
+			event.ActorUsername = ""
+
+			By("registering mocks")
+			mockV3EventPageResponse(1, 1, false, expectedCreatedAt, []cfclient.Event{event})
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFV3AuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{Since: pullEventsSince}, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+				WithTransform(withoutRaw, Equal(fetchers.CFAuditEventResult{
+					Events: []cfclient.Event{event}, PageURL: v3PageURL(expectedCreatedAt, 1),
+				})),
+			))
+			Eventually(resultsChan).Should(BeClosed())
+		})
+
+		It("keeps each event as it was sent and sets aside events it cannot decode", func() {
+			httpmock.RegisterResponder("GET", fmt.Sprintf("%s/v3/audit_events", cfAPIURL), httpmock.NewStringResponder(200, `{
+				"pagination": {"total_results": 2, "total_pages": 1, "next": null},
+				"resources": [
+					{"guid": "00000000-0000-0000-0000-000000000001", "created_at": "2019-10-04T12:00:00Z", "type": "audit.app.update", "actor": {"guid": "actor-guid", "type": "user", "name": "admin"}, "target": {"guid": "app-guid", "type": "app", "name": "my-app"}, "data": {}},
+					{"guid": "00000000-0000-0000-0000-000000000002", "created_at": "2019-10-04T12:00:00Z", "type": "audit.app.update", "actor": "actor-guid"}
+				]
+			}`))
+
+			resultsChan := make(chan fetchers.CFAuditEventResult, 1)
+			go fetchers.FetchCFV3AuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{}, resultsChan)
+
+			var result fetchers.CFAuditEventResult
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(&result))
+			Expect(result.Err).NotTo(HaveOccurred())
+			Expect(result.Events).To(HaveLen(1))
+			Expect(result.Events[0].ActorUsername).To(Equal("admin"))
+
+			By("decoding the event again as it was sent")
+			Expect(result.Raw).To(HaveLen(1))
+			event, err := fetchers.DecodeCFAuditEvent(result.Raw[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(event).To(Equal(result.Events[0]))
+
+			Expect(result.Undecodable).To(HaveLen(1))
+			Expect(result.Undecodable[0].GUID).To(Equal("00000000-0000-0000-0000-000000000002"))
+			Expect(result.Undecodable[0].Err).To(MatchError(ContainSubstring("error unmarshaling event")))
+			Eventually(resultsChan).Should(BeClosed())
+		})
+
+		It("returns an error and closes the chan when there is an error", func() {
+			expectedCreatedAt := "2019-10-04T12:40:43Z"
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+
+			By("registering mocks")
+			// Mock the first two pages
+			for p := 1; p <= 2; p++ {
+				mockV3EventPageResponse(p, numberOfPages, true, expectedCreatedAt, eventPages[p])
+			}
+			// The next request will fail
+			httpmock.RegisterResponder(
+				"GET", fmt.Sprintf(`=~^%s.*\z`, cfAPIURL),
+				httpmock.NewJsonResponderOrPanic(201, `{"error": "sadpanda"}`),
+			)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFV3AuditEvents(context.Background(), cfg, fetchers.CFAuditEventQuery{Since: pullEventsSince}, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			for p := 1; p <= 2; p++ {
+				Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+					WithTransform(withoutRaw, Equal(fetchers.CFAuditEventResult{
+						Events: eventPages[p], PageURL: v3PageURL(expectedCreatedAt, p),
+					})),
+				))
+			}
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
+				func(res fetchers.CFAuditEventResult) error { return res.Err },
+				MatchError(ContainSubstring("with status code 201")),
+			)))
+
+			By("checking we are finished")
+			Eventually(resultsChan).Should(BeClosed())
+			Eventually(httpmock.GetTotalCallCount).Should(Equal(3))
+		})
+
+		It("fetches an event on the boundary between two windows once", func() {
+			boundary := time.Date(2019, 10, 4, 12, 0, 0, 0, time.UTC)
+			events := []cfclient.Event{
+				{GUID: "00000000-0000-0000-0000-000000000001", CreatedAt: "2019-10-04T11:59:59Z"},
+				{GUID: "00000000-0000-0000-0000-000000000002", CreatedAt: "2019-10-04T12:00:00Z"},
+				{GUID: "00000000-0000-0000-0000-000000000003", CreatedAt: "2019-10-04T12:00:01Z"},
+			}
+
+			By("filtering events by created_at as Cloud Controller does")
+			httpmock.RegisterResponder("GET", fmt.Sprintf("%s/v3/audit_events", cfAPIURL), func(req *http.Request) (*http.Response, error) {
+				query := req.URL.Query()
+				resources := []map[string]interface{}{}
+				for _, event := range events {
+					if (query.Get("created_ats[gte]") == "" || event.CreatedAt >= query.Get("created_ats[gte]")) &&
+						(query.Get("created_ats[gt]") == "" || event.CreatedAt > query.Get("created_ats[gt]")) &&
+						(query.Get("created_ats[lt]") == "" || event.CreatedAt < query.Get("created_ats[lt]")) {
+						resources = append(resources, wrapV3Event(event))
+					}
+				}
+				return httpmock.NewJsonResponse(200, map[string]interface{}{
+					"pagination": map[string]interface{}{"total_results": len(resources), "total_pages": 1, "next": nil},
+					"resources":  resources,
+				})
+			})
+
+			fetched := []string{}
+			for _, query := range []fetchers.CFAuditEventQuery{
+				{Since: boundary.Add(-time.Hour), Until: boundary},
+				{Since: boundary, Until: boundary.Add(time.Hour)},
+			} {
+				resultsChan := make(chan fetchers.CFAuditEventResult, 1)
+				go fetchers.FetchCFV3AuditEvents(context.Background(), cfg, query, resultsChan)
+				for result := range resultsChan {
+					Expect(result.Err).NotTo(HaveOccurred())
+					for _, event := range result.Events {
+						fetched = append(fetched, event.GUID)
+					}
+				}
+			}
+			Expect(fetched).To(Equal([]string{
+				"00000000-0000-0000-0000-000000000001",
+				"00000000-0000-0000-0000-000000000002",
+				"00000000-0000-0000-0000-000000000003",
+			}))
+		})
+	})
+})
+
+func mockV3EventPageResponse(
+	page int, totalPages int, addNextURL bool,
+	expectedCreatedAt string,
+	events []cfclient.Event,
+) {
+	mockURL := fmt.Sprintf("%s/v3/audit_events", cfAPIURL)
+
+	expectedQuery := url.Values{
+		"created_ats[gte]": []string{expectedCreatedAt},
+		"order_by":         []string{"created_at"},
+		"per_page":         []string{"100"},
+	}
+
+	if page > 1 {
+		expectedQuery["page"] = []string{fmt.Sprintf("%d", page)}
+	}
+
+	var next interface{}
+	if addNextURL {
+		next = map[string]interface{}{
+			"href": cfAPIURL + v3PageURL(expectedCreatedAt, page+1),
+		}
+	}
+
+	resources := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		resources[i] = wrapV3Event(event)
+	}
+
+	resp := httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+		"pagination": map[string]interface{}{
+			"total_results": len(events) * totalPages,
+			"total_pages":   totalPages,
+			"next":          next,
+		},
+		"resources": resources,
+	})
+	httpmock.RegisterResponderWithQuery("GET", mockURL, expectedQuery, resp)
+}
+
+// v3PageURL is the URL of a page of events, relative to the API address
+func v3PageURL(expectedCreatedAt string, page int) string {
+	query := url.Values{
+		"created_ats[gte]": []string{expectedCreatedAt},
+		"order_by":         []string{"created_at"},
+		"per_page":         []string{"100"},
+	}
+	if page > 1 {
+		query["page"] = []string{fmt.Sprintf("%d", page)}
+	}
+	return fmt.Sprintf("/v3/audit_events?%s", query.Encode())
+}
+
+func wrapV3Event(event cfclient.Event) map[string]interface{} {
+	resource := map[string]interface{}{
+		"guid":       event.GUID,
+		"created_at": event.CreatedAt,
+		"updated_at": event.CreatedAt,
+		"type":       event.Type,
+		"actor": map[string]interface{}{
+			"guid": event.Actor,
+			"type": event.ActorType,
+			"name": event.ActorName,
+		},
+		"target": map[string]interface{}{
+			"guid": event.Actee,
+			"type": event.ActeeType,
+			"name": event.ActeeName,
+		},
+		"data":         event.Metadata,
+		"space":        nil,
+		"organization": nil,
+	}
+	if event.SpaceGUID != "" {
+		resource["space"] = map[string]interface{}{"guid": event.SpaceGUID}
+	}
+	if event.OrganizationGUID != "" {
+		resource["organization"] = map[string]interface{}{"guid": event.OrganizationGUID}
+	}
+	return resource
+}
+
+func randomV3EventPages(numberOfPages, eventsPerPage int) [][]cfclient.Event {
+	eventPages := randomEventPages(numberOfPages, eventsPerPage)
+	for _, events := range eventPages {
+		for i := range events {
+			// v3 only reports the username of users, as the actor name
+			events[i].ActorType = "user"
+			events[i].ActorUsername = events[i].ActorName
+		}
+	}
+	return eventPages
+}
@@ -0,0 +1,49 @@
+package fetchers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"code.cloudfoundry.org/lager"
+)
+
+type v3NamedResource struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+// GetCFOrganizationName looks up the current name of an organization,
+// returning ErrNotFound if it no longer exists
+func GetCFOrganizationName(ctx context.Context, cfg *FetcherConfig, guid string) (string, error) {
+	return getV3ResourceName(ctx, cfg, "/v3/organizations/"+url.PathEscape(guid))
+}
+
+// GetCFSpaceName looks up the current name of a space, returning ErrNotFound
+// if it no longer exists
+func GetCFSpaceName(ctx context.Context, cfg *FetcherConfig, guid string) (string, error) {
+	return getV3ResourceName(ctx, cfg, "/v3/spaces/"+url.PathEscape(guid))
+}
+
+func getV3ResourceName(ctx context.Context, cfg *FetcherConfig, path string) (string, error) {
+	logger := cfg.Logger.WithData(lager.Data{"path": path})
+
+	var resource v3NamedResource
+	err := withRetries(ctx, cfg, logger, func() error {
+		resp, err := doRequest(ctx, cfg, path)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if err := json.NewDecoder(resp.Body).Decode(&resource); err != nil {
+			return fmt.Errorf("error unmarshaling %s: %s", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return resource.Name, nil
+}
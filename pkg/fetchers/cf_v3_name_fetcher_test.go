@@ -0,0 +1,112 @@
+package fetchers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	"github.com/jarcoal/httpmock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+)
+
+var _ = Describe("CFV3 name fetchers", func() {
+	var cfg *fetchers.FetcherConfig
+
+	BeforeEach(func() {
+		httpclient := &http.Client{Transport: &http.Transport{}}
+		httpmock.ActivateNonDefault(httpclient)
+
+		httpmock.RegisterResponder(
+			"GET",
+			fmt.Sprintf("%s/v2/info", cfAPIURL),
+			httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+				"token_endpoint": fmt.Sprintf("%s", uaaAPIURL),
+			}),
+		)
+
+		httpmock.RegisterResponder(
+			"POST",
+			fmt.Sprintf("%s/oauth/token", uaaAPIURL),
+			httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+				"access_token": "acb6803a48114d9fb4761e403c17f812",
+				"token_type":   "bearer",
+				"expires_in":   43199,
+			}),
+		)
+
+		cfClient, err := cfclient.NewClient(&cfclient.Config{
+			ApiAddress: cfAPIURL,
+			HttpClient: httpclient,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		httpmock.Reset() // Reset mock after client creation to clear call count
+
+		logger := lager.NewLogger("fetcher-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		cfg = &fetchers.FetcherConfig{
+			Foundation: "test-foundation",
+			CFClient:   cfClient,
+			Logger:     logger,
+
+			APIAddress: cfAPIURL,
+			HTTPClient: httpclient,
+
+			MaxRetries:          2,
+			RetryInitialBackoff: 1 * time.Millisecond,
+			RetryMaxBackoff:     2 * time.Millisecond,
+		}
+	})
+
+	It("looks up organization names", func() {
+		httpmock.RegisterResponder(
+			"GET", fmt.Sprintf("%s/v3/organizations/org-guid", cfAPIURL),
+			httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+				"guid": "org-guid", "name": "my-org",
+			}),
+		)
+
+		name, err := fetchers.GetCFOrganizationName(context.Background(), cfg, "org-guid")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("my-org"))
+	})
+
+	It("looks up space names, retrying server errors", func() {
+		calls := 0
+		httpmock.RegisterResponder(
+			"GET", fmt.Sprintf("%s/v3/spaces/space-guid", cfAPIURL),
+			func(req *http.Request) (*http.Response, error) {
+				calls++
+				if calls == 1 {
+					return httpmock.NewStringResponse(502, "bad gateway"), nil
+				}
+				return httpmock.NewJsonResponse(200, map[string]interface{}{
+					"guid": "space-guid", "name": "my-space",
+				})
+			},
+		)
+
+		name, err := fetchers.GetCFSpaceName(context.Background(), cfg, "space-guid")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("my-space"))
+		Expect(calls).To(Equal(2))
+	})
+
+	It("returns ErrNotFound for deleted resources", func() {
+		httpmock.RegisterResponder(
+			"GET", fmt.Sprintf("%s/v3/organizations/deleted-guid", cfAPIURL),
+			httpmock.NewStringResponder(404, `{"errors":[{"code":10010}]}`),
+		)
+
+		_, err := fetchers.GetCFOrganizationName(context.Background(), cfg, "deleted-guid")
+		Expect(err).To(MatchError(fetchers.ErrNotFound))
+		Expect(httpmock.GetTotalCallCount()).To(Equal(1))
+	})
+})
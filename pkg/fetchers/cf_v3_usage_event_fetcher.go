@@ -0,0 +1,161 @@
+package fetchers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	AppUsageEventsPath     = "/v3/app_usage_events"
+	ServiceUsageEventsPath = "/v3/service_usage_events"
+)
+
+// UsageEventFetcher sends pages of usage events to resultsChan, closing it
+// when there are no more pages, after an error, or when ctx is cancelled
+type UsageEventFetcher = func(ctx context.Context, query UsageEventQuery, resultsChan chan UsageEventResult)
+
+// UsageEventQuery describes which usage events to fetch
+type UsageEventQuery struct {
+	// AfterGUID is the GUID of the last event already collected. Only events
+	// after it are fetched. If empty all events are fetched.
+	AfterGUID string
+}
+
+type UsageEventResult struct {
+	Events []UsageEvent
+	Err    error
+}
+
+// UsageEvent is an app or service usage event. The fields needed to store and
+// ship the event are picked out, the rest of it is kept as Raw.
+type UsageEvent struct {
+	GUID             string
+	CreatedAt        string
+	State            string
+	SpaceGUID        string
+	OrganizationGUID string
+
+	// Raw is the event exactly as Cloud Controller returned it
+	Raw json.RawMessage
+}
+
+type v3UsageEventsResponse struct {
+	Pagination v3Pagination      `json:"pagination"`
+	Resources  []json.RawMessage `json:"resources"`
+}
+
+type v3UsageEventResource struct {
+	GUID      string `json:"guid"`
+	CreatedAt string `json:"created_at"`
+	State     struct {
+		Current string `json:"current"`
+	} `json:"state"`
+	Space        *v3Relationship `json:"space"`
+	Organization *v3Relationship `json:"organization"`
+}
+
+// FetchCFV3UsageEvents fetches usage events from a v3 usage events endpoint,
+// such as AppUsageEventsPath, oldest first
+func FetchCFV3UsageEvents(ctx context.Context, cfg *FetcherConfig, path string, query UsageEventQuery, resultsChan chan UsageEventResult) {
+	defer close(resultsChan)
+
+	startPageURL := v3UsageEventsStartPageURL(path, query)
+	logger := cfg.Logger.WithData(lager.Data{"start_page_url": startPageURL})
+	logger.Info("fetching")
+
+	nextPageURL := startPageURL
+	for nextPageURL != "" {
+		pageURL := nextPageURL
+		logger = logger.WithData(lager.Data{"page_url": pageURL})
+
+		var events []UsageEvent
+		err := withRetries(ctx, cfg, logger, func() error {
+			var err error
+			nextPageURL, events, err = getV3UsageEventsPage(ctx, cfg, pageURL)
+			return err
+		})
+		if ctx.Err() != nil {
+			logger.Info("fetched.page.cancelled")
+			return
+		}
+		if err != nil {
+			logger.Error("fetched.page.error", err)
+			sendUsageEventResult(ctx, resultsChan, UsageEventResult{Err: err})
+			return
+		}
+		logger.Info("fetched.page.ok", lager.Data{"event_count": len(events)})
+		if !sendUsageEventResult(ctx, resultsChan, UsageEventResult{Events: events}) {
+			logger.Info("fetched.page.cancelled")
+			return
+		}
+
+		if nextPageURL != "" && !sleep(ctx, cfg.PaginationWaitTime) {
+			logger.Info("fetched.page.cancelled")
+			return
+		}
+	}
+}
+
+func v3UsageEventsStartPageURL(path string, query UsageEventQuery) string {
+	q := url.Values{}
+	if query.AfterGUID != "" {
+		q.Set("after_guid", query.AfterGUID)
+	}
+	q.Set("order_by", "created_at")
+	q.Set("per_page", "100")
+	return fmt.Sprintf("%s?%s", path, q.Encode())
+}
+
+func sendUsageEventResult(ctx context.Context, resultsChan chan UsageEventResult, result UsageEventResult) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case resultsChan <- result:
+		return true
+	}
+}
+
+func getV3UsageEventsPage(ctx context.Context, cfg *FetcherConfig, url string) (string, []UsageEvent, error) {
+	resp, err := doRequest(ctx, cfg, url)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	var eventResp v3UsageEventsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&eventResp); err != nil {
+		return "", nil, fmt.Errorf("error unmarshaling usage events: %s", err)
+	}
+
+	events := make([]UsageEvent, len(eventResp.Resources))
+	for i, raw := range eventResp.Resources {
+		var resource v3UsageEventResource
+		if err := json.Unmarshal(raw, &resource); err != nil {
+			return "", nil, fmt.Errorf("error unmarshaling usage event: %s", err)
+		}
+
+		events[i] = UsageEvent{
+			GUID:      resource.GUID,
+			CreatedAt: resource.CreatedAt,
+			State:     resource.State.Current,
+			Raw:       raw,
+		}
+		if resource.Space != nil {
+			events[i].SpaceGUID = resource.Space.GUID
+		}
+		if resource.Organization != nil {
+			events[i].OrganizationGUID = resource.Organization.GUID
+		}
+	}
+
+	nextPageURL, err := v3NextPageURL(eventResp.Pagination)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return nextPageURL, events, nil
+}
@@ -0,0 +1,171 @@
+package fetchers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	"github.com/jarcoal/httpmock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+)
+
+var _ = Describe("CFV3UsageEvents Fetcher", func() {
+	var (
+		cfg         *fetchers.FetcherConfig
+		resultsChan chan fetchers.UsageEventResult
+	)
+
+	BeforeEach(func() {
+		httpclient := &http.Client{Transport: &http.Transport{}}
+		httpmock.ActivateNonDefault(httpclient)
+
+		httpmock.RegisterResponder(
+			"GET",
+			fmt.Sprintf("%s/v2/info", cfAPIURL),
+			httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+				"token_endpoint": fmt.Sprintf("%s", uaaAPIURL),
+			}),
+		)
+
+		httpmock.RegisterResponder(
+			"POST",
+			fmt.Sprintf("%s/oauth/token", uaaAPIURL),
+			httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+				"access_token": "acb6803a48114d9fb4761e403c17f812",
+				"token_type":   "bearer",
+				"expires_in":   43199,
+			}),
+		)
+
+		cfClient, err := cfclient.NewClient(&cfclient.Config{
+			ApiAddress: cfAPIURL,
+			HttpClient: httpclient,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		httpmock.Reset() // Reset mock after client creation to clear call count
+
+		logger := lager.NewLogger("fetcher-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		cfg = &fetchers.FetcherConfig{
+			Foundation:         "test-foundation",
+			CFClient:           cfClient,
+			Logger:             logger,
+			PaginationWaitTime: 10 * time.Millisecond,
+
+			APIAddress: cfAPIURL,
+			HTTPClient: httpclient,
+
+			MaxRetries:          2,
+			RetryInitialBackoff: 1 * time.Millisecond,
+			RetryMaxBackoff:     2 * time.Millisecond,
+		}
+
+		resultsChan = make(chan fetchers.UsageEventResult, 10)
+	})
+
+	It("fetches every page of app usage events after the cursor", func() {
+		firstEvent := `{"guid":"b1b0a1a6-0000-4000-8000-000000000001","created_at":"2020-01-01T00:00:00Z","state":{"current":"STARTED","previous":"STOPPED"},"space":{"guid":"space-guid","name":"space"},"organization":{"guid":"org-guid"}}`
+		secondEvent := `{"guid":"b1b0a1a6-0000-4000-8000-000000000002","created_at":"2020-01-01T00:00:01Z","state":{"current":"STOPPED","previous":"STARTED"},"space":null,"organization":null}`
+
+		By("registering mocks")
+		httpmock.RegisterResponderWithQuery(
+			"GET", fmt.Sprintf("%s/v3/app_usage_events", cfAPIURL),
+			url.Values{
+				"after_guid": []string{"previous-guid"},
+				"order_by":   []string{"created_at"},
+				"per_page":   []string{"100"},
+			},
+			httpmock.NewStringResponder(200, fmt.Sprintf(
+				`{"pagination":{"next":{"href":"%s/v3/app_usage_events?page=2"}},"resources":[%s]}`,
+				cfAPIURL, firstEvent,
+			)),
+		)
+		httpmock.RegisterResponderWithQuery(
+			"GET", fmt.Sprintf("%s/v3/app_usage_events", cfAPIURL),
+			url.Values{"page": []string{"2"}},
+			httpmock.NewStringResponder(200, fmt.Sprintf(
+				`{"pagination":{"next":null},"resources":[%s]}`, secondEvent,
+			)),
+		)
+
+		By("fetching events")
+		go fetchers.FetchCFV3UsageEvents(
+			context.Background(), cfg, fetchers.AppUsageEventsPath,
+			fetchers.UsageEventQuery{AfterGUID: "previous-guid"}, resultsChan,
+		)
+
+		By("expecting results via the channel")
+		Eventually(resultsChan, "100ms", "1ms").Should(Receive(Equal(fetchers.UsageEventResult{
+			Events: []fetchers.UsageEvent{{
+				GUID:             "b1b0a1a6-0000-4000-8000-000000000001",
+				CreatedAt:        "2020-01-01T00:00:00Z",
+				State:            "STARTED",
+				SpaceGUID:        "space-guid",
+				OrganizationGUID: "org-guid",
+				Raw:              json.RawMessage(firstEvent),
+			}},
+		})))
+		Eventually(resultsChan, "100ms", "1ms").Should(Receive(Equal(fetchers.UsageEventResult{
+			Events: []fetchers.UsageEvent{{
+				GUID:      "b1b0a1a6-0000-4000-8000-000000000002",
+				CreatedAt: "2020-01-01T00:00:01Z",
+				State:     "STOPPED",
+				Raw:       json.RawMessage(secondEvent),
+			}},
+		})))
+
+		By("checking we are finished")
+		Eventually(resultsChan).Should(BeClosed())
+		Expect(httpmock.GetTotalCallCount()).To(Equal(2))
+	})
+
+	It("fetches from the start when there is no cursor", func() {
+		httpmock.RegisterResponderWithQuery(
+			"GET", fmt.Sprintf("%s/v3/service_usage_events", cfAPIURL),
+			url.Values{
+				"order_by": []string{"created_at"},
+				"per_page": []string{"100"},
+			},
+			httpmock.NewStringResponder(200, `{"pagination":{"next":null},"resources":[]}`),
+		)
+
+		go fetchers.FetchCFV3UsageEvents(
+			context.Background(), cfg, fetchers.ServiceUsageEventsPath,
+			fetchers.UsageEventQuery{}, resultsChan,
+		)
+
+		Eventually(resultsChan, "100ms", "1ms").Should(Receive(Equal(fetchers.UsageEventResult{
+			Events: []fetchers.UsageEvent{},
+		})))
+		Eventually(resultsChan).Should(BeClosed())
+		Expect(httpmock.GetTotalCallCount()).To(Equal(1))
+	})
+
+	It("retries server errors before returning an error and closing the chan", func() {
+		httpmock.RegisterResponder(
+			"GET", fmt.Sprintf("%s/v3/app_usage_events", cfAPIURL),
+			httpmock.NewStringResponder(503, `{"errors":[]}`),
+		)
+
+		go fetchers.FetchCFV3UsageEvents(
+			context.Background(), cfg, fetchers.AppUsageEventsPath,
+			fetchers.UsageEventQuery{}, resultsChan,
+		)
+
+		var result fetchers.UsageEventResult
+		Eventually(resultsChan, "100ms", "1ms").Should(Receive(&result))
+		Expect(result.Err).To(MatchError(ContainSubstring("status code 503")))
+		Eventually(resultsChan).Should(BeClosed())
+		Expect(httpmock.GetTotalCallCount()).To(Equal(1 + cfg.MaxRetries))
+	})
+})
@@ -1,6 +1,7 @@
 package fetchers
 
 import (
+	"net/http"
 	"time"
 
 	"code.cloudfoundry.org/lager"
@@ -8,7 +9,32 @@ import (
 )
 
 type FetcherConfig struct {
+	// Foundation is the name of the Cloud Foundry being fetched from, used to
+	// label metrics
+	Foundation string
+
 	CFClient           cfclient.CloudFoundryClient
 	Logger             lager.Logger
 	PaginationWaitTime time.Duration
+
+	// APIAddress and HTTPClient are used to make requests to Cloud Controller
+	// directly, so that we can see the status and headers of failed
+	// responses. CFClient is still used to authenticate those requests.
+	APIAddress string
+	HTTPClient *http.Client
+
+	// MaxRetries is how many times a page is retried after a transient
+	// failure before the error is returned to the collector
+	MaxRetries          int
+	RetryInitialBackoff time.Duration
+	RetryMaxBackoff     time.Duration
+
+	// EventTypes chooses which audit events are kept. Where possible the
+	// filtering is done by Cloud Controller, otherwise the events are
+	// filtered after they are fetched.
+	EventTypes EventTypeFilter
+
+	// RateLimiter, if set, limits how often requests are made, however many
+	// fetches are running at once
+	RateLimiter *RateLimiter
 }
@@ -0,0 +1,83 @@
+package fetchers
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+)
+
+// EventTypeFilter chooses which audit events are kept by event type. Patterns
+// are either exact event types, like audit.app.update, or use * as a
+// wildcard, like audit.user.* or audit.service_*.
+//
+// An event is kept if it matches any Include pattern, or Include is empty,
+// and it matches no Exclude pattern.
+type EventTypeFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// Validate returns an error if any of the patterns are malformed
+func (f EventTypeFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid event type pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Keeps returns whether events of eventType should be kept
+func (f EventTypeFilter) Keeps(eventType string) bool {
+	if len(f.Include) > 0 && !matchesAny(f.Include, eventType) {
+		return false
+	}
+	return !matchesAny(f.Exclude, eventType)
+}
+
+// ServerSideTypes returns the event types which Cloud Controller can be asked
+// to filter to, or nil if it cannot do the filtering. Cloud Controller only
+// understands exact types, so this is only possible when no Include pattern
+// has a wildcard. Exclude patterns are always applied client side.
+func (f EventTypeFilter) ServerSideTypes() []string {
+	for _, pattern := range f.Include {
+		if strings.ContainsAny(pattern, `*?[\`) {
+			return nil
+		}
+	}
+	return f.Include
+}
+
+// filterEvents removes the events the filter does not keep, and the items
+// of the page they were decoded from, counting them
+func (f EventTypeFilter) filterEvents(
+	foundation string, events []cfclient.Event, raw []json.RawMessage,
+) ([]cfclient.Event, []json.RawMessage) {
+	if len(f.Include) == 0 && len(f.Exclude) == 0 {
+		return events, raw
+	}
+
+	keptEvents := make([]cfclient.Event, 0, len(events))
+	keptRaw := make([]json.RawMessage, 0, len(raw))
+	for i, event := range events {
+		if f.Keeps(event.Type) {
+			keptEvents = append(keptEvents, event)
+			keptRaw = append(keptRaw, raw[i])
+			continue
+		}
+		CFAuditEventFetcherEventsFilteredTotal.WithLabelValues(foundation, event.Type).Inc()
+	}
+	return keptEvents, keptRaw
+}
+
+func matchesAny(patterns []string, eventType string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, eventType); matched {
+			return true
+		}
+	}
+	return false
+}
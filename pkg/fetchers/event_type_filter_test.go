@@ -0,0 +1,46 @@
+package fetchers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+)
+
+var _ = Describe("EventTypeFilter", func() {
+	It("keeps everything when there are no patterns", func() {
+		filter := fetchers.EventTypeFilter{}
+		Expect(filter.Keeps("audit.app.update")).To(BeTrue())
+		Expect(filter.ServerSideTypes()).To(BeEmpty())
+	})
+
+	It("keeps included types which are not excluded", func() {
+		filter := fetchers.EventTypeFilter{
+			Include: []string{"audit.user.*", "audit.app.ssh-*", "audit.service_*"},
+			Exclude: []string{"audit.service_binding.*"},
+		}
+		Expect(filter.Keeps("audit.user.space_developer_add")).To(BeTrue())
+		Expect(filter.Keeps("audit.app.ssh-authorized")).To(BeTrue())
+		Expect(filter.Keeps("audit.service_instance.create")).To(BeTrue())
+
+		Expect(filter.Keeps("audit.service_binding.create")).To(BeFalse())
+		Expect(filter.Keeps("audit.app.update")).To(BeFalse())
+		Expect(filter.Keeps("app.crash")).To(BeFalse())
+	})
+
+	It("only leaves filtering to Cloud Controller when every included type is exact", func() {
+		Expect(fetchers.EventTypeFilter{
+			Include: []string{"audit.app.create", "audit.app.delete-request"},
+			Exclude: []string{"audit.app.*"},
+		}.ServerSideTypes()).To(Equal([]string{"audit.app.create", "audit.app.delete-request"}))
+
+		Expect(fetchers.EventTypeFilter{
+			Include: []string{"audit.app.create", "audit.user.*"},
+		}.ServerSideTypes()).To(BeEmpty())
+	})
+
+	It("rejects malformed patterns", func() {
+		Expect(fetchers.EventTypeFilter{Include: []string{"audit.[app"}}.Validate()).To(HaveOccurred())
+		Expect(fetchers.EventTypeFilter{Exclude: []string{"audit.user.*"}}.Validate()).To(Succeed())
+	})
+})
@@ -0,0 +1,5 @@
+package fetchers
+
+func init() {
+	initMetrics()
+}
@@ -0,0 +1,28 @@
+package fetchers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	CFAuditEventFetcherRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_event_fetcher_retries_total",
+		Help: "Number of page requests retried by CF Audit Event Fetcher, by cause",
+	}, []string{"foundation", "cause"})
+
+	CFAuditEventFetcherRetriesExhaustedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_event_fetcher_retries_exhausted_total",
+		Help: "Number of page requests which failed after all retries by CF Audit Event Fetcher, by cause",
+	}, []string{"foundation", "cause"})
+
+	CFAuditEventFetcherEventsFilteredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_event_fetcher_events_filtered_total",
+		Help: "Number of events fetched but not kept because of their event type by CF Audit Event Fetcher, by event type",
+	}, []string{"foundation", "event_type"})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(CFAuditEventFetcherRetriesTotal)
+	prometheus.MustRegister(CFAuditEventFetcherRetriesExhaustedTotal)
+	prometheus.MustRegister(CFAuditEventFetcherEventsFilteredTotal)
+}
@@ -0,0 +1,39 @@
+package fetchers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out requests to Cloud Controller, across every fetch
+// sharing the same FetcherConfig
+type RateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateLimiter returns a RateLimiter which allows one request per interval
+func NewRateLimiter(interval time.Duration) *RateLimiter {
+	return &RateLimiter{interval: interval}
+}
+
+// Wait blocks until the next request is allowed, returning false if ctx is
+// cancelled first
+func (r *RateLimiter) Wait(ctx context.Context) bool {
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.mu.Unlock()
+
+	if wait == 0 {
+		return ctx.Err() == nil
+	}
+	return sleep(ctx, wait)
+}
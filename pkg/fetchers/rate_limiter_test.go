@@ -0,0 +1,45 @@
+package fetchers_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+)
+
+var _ = Describe("RateLimiter", func() {
+	It("spaces out requests across goroutines", func() {
+		limiter := fetchers.NewRateLimiter(20 * time.Millisecond)
+
+		startTime := time.Now()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(limiter.Wait(context.Background())).To(BeTrue())
+			}()
+		}
+		wg.Wait()
+
+		Expect(time.Since(startTime)).To(BeNumerically(">=", 80*time.Millisecond))
+	})
+
+	It("stops waiting when the context is cancelled", func() {
+		limiter := fetchers.NewRateLimiter(1 * time.Hour)
+		Expect(limiter.Wait(context.Background())).To(BeTrue())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		startTime := time.Now()
+		Expect(limiter.Wait(ctx)).To(BeFalse())
+		Expect(time.Since(startTime)).To(BeNumerically("<", 1*time.Second))
+	})
+})
@@ -0,0 +1,138 @@
+package fetchers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	retryCauseNetworkError = "network_error"
+	retryCauseTokenError   = "token_error"
+	retryCauseRateLimited  = "rate_limited"
+	retryCauseServerError  = "server_error"
+
+	// maxRetryAfter stops a misbehaving server from parking the fetcher
+	// indefinitely
+	maxRetryAfter = 15 * time.Minute
+)
+
+// retryableError is returned for failures which are likely to succeed if the
+// request is made again
+type retryableError struct {
+	err   error
+	cause string
+
+	// retryAfter is how long Cloud Controller asked us to wait, if it did
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// getPageWithRetries calls getPage, retrying transient failures with bounded
+// exponential backoff. Only non-retryable errors, or the last error once
+// retries are exhausted, are returned.
+func getPageWithRetries(
+	ctx context.Context, cfg *FetcherConfig, logger lager.Logger, getPage pageGetter, url string,
+) (cfAuditEventPage, error) {
+	var page cfAuditEventPage
+	err := withRetries(ctx, cfg, logger, func() error {
+		var err error
+		page, err = getPage(ctx, cfg, url)
+		return err
+	})
+	if err != nil {
+		return cfAuditEventPage{}, err
+	}
+	return page, nil
+}
+
+// withRetries calls attempt until it succeeds, retrying transient failures
+// with bounded exponential backoff
+func withRetries(ctx context.Context, cfg *FetcherConfig, logger lager.Logger, attempt func() error) error {
+	backoff := cfg.RetryInitialBackoff
+
+	for attemptNumber := 1; ; attemptNumber++ {
+		if cfg.RateLimiter != nil && !cfg.RateLimiter.Wait(ctx) {
+			return ctx.Err()
+		}
+
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var retryable *retryableError
+		if !errors.As(err, &retryable) {
+			return err
+		}
+
+		if attemptNumber > cfg.MaxRetries {
+			CFAuditEventFetcherRetriesExhaustedTotal.WithLabelValues(cfg.Foundation, retryable.cause).Inc()
+			return err
+		}
+
+		wait := backoff
+		if retryable.retryAfter > wait {
+			wait = retryable.retryAfter
+		}
+
+		CFAuditEventFetcherRetriesTotal.WithLabelValues(cfg.Foundation, retryable.cause).Inc()
+		logger.Info("fetched.page.retrying", lager.Data{
+			"attempt": attemptNumber,
+			"cause":   retryable.cause,
+			"error":   err.Error(),
+			"wait":    wait.String(),
+		})
+		if !sleep(ctx, wait) {
+			return ctx.Err()
+		}
+
+		backoff *= 2
+		if backoff > cfg.RetryMaxBackoff {
+			backoff = cfg.RetryMaxBackoff
+		}
+	}
+}
+
+// retryAfter works out how long Cloud Controller would like us to wait before
+// retrying, from either the standard Retry-After header or Cloud Controller's
+// own rate limiting headers
+func retryAfter(header http.Header) time.Duration {
+	var wait time.Duration
+
+	if v := header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		} else if t, err := http.ParseTime(v); err == nil {
+			wait = time.Until(t)
+		}
+	} else if header.Get("X-RateLimit-Remaining") == "0" {
+		if v := header.Get("X-RateLimit-Reset"); v != "" {
+			if epoch, err := strconv.ParseInt(v, 10, 64); err == nil {
+				wait = time.Until(time.Unix(epoch, 0))
+			}
+		}
+	}
+
+	if wait < 0 {
+		return 0
+	}
+	if wait > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return wait
+}
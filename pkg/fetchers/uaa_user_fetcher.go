@@ -0,0 +1,70 @@
+package fetchers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// UAAUser is the part of a UAA user which identifies who made a change
+type UAAUser struct {
+	GUID     string
+	Username string
+	// Origin is the identity provider the user logs in with, for example
+	// uaa, google or microsoft
+	Origin string
+	Email  string
+	Active bool
+}
+
+type uaaUserResource struct {
+	ID       string `json:"id"`
+	UserName string `json:"userName"`
+	Origin   string `json:"origin"`
+	Active   bool   `json:"active"`
+	Emails   []struct {
+		Value   string `json:"value"`
+		Primary bool   `json:"primary"`
+	} `json:"emails"`
+}
+
+// GetUAAUser looks up a user in UAA, returning ErrNotFound if they no longer
+// exist. cfg.APIAddress should be the address of UAA rather than Cloud
+// Controller, and the client needs the scim.read scope.
+func GetUAAUser(ctx context.Context, cfg *FetcherConfig, guid string) (UAAUser, error) {
+	path := "/Users/" + url.PathEscape(guid)
+	logger := cfg.Logger.WithData(lager.Data{"path": path})
+
+	var resource uaaUserResource
+	err := withRetries(ctx, cfg, logger, func() error {
+		resp, err := doRequest(ctx, cfg, path)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if err := json.NewDecoder(resp.Body).Decode(&resource); err != nil {
+			return fmt.Errorf("error unmarshaling %s: %s", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return UAAUser{}, err
+	}
+
+	user := UAAUser{
+		GUID:     resource.ID,
+		Username: resource.UserName,
+		Origin:   resource.Origin,
+		Active:   resource.Active,
+	}
+	for _, email := range resource.Emails {
+		if user.Email == "" || email.Primary {
+			user.Email = email.Value
+		}
+	}
+	return user, nil
+}
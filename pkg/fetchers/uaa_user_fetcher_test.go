@@ -0,0 +1,135 @@
+package fetchers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+)
+
+var _ = Describe("GetUAAUser", func() {
+	var (
+		uaa       *httptest.Server
+		userCalls int64
+		cfg       *fetchers.FetcherConfig
+	)
+
+	BeforeEach(func() {
+		atomic.StoreInt64(&userCalls, 0)
+
+		// A stand-in for Cloud Controller and UAA, enough for the CF client to
+		// get a token and for users to be looked up with it
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v2/info", func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"token_endpoint": uaa.URL,
+			})
+		})
+		mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "uaa-token",
+				"token_type":   "bearer",
+				"expires_in":   43199,
+			})
+		})
+		mux.HandleFunc("/Users/", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&userCalls, 1)
+			if r.Header.Get("Authorization") != "bearer uaa-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			switch r.URL.Path {
+			case "/Users/sso-user-guid":
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"id":       "sso-user-guid",
+					"userName": "someone@example.com",
+					"origin":   "google",
+					"active":   true,
+					"emails": []map[string]interface{}{
+						{"value": "old@example.com", "primary": false},
+						{"value": "someone@example.com", "primary": true},
+					},
+				})
+			case "/Users/flaky-user-guid":
+				if atomic.LoadInt64(&userCalls) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"id":       "flaky-user-guid",
+					"userName": "admin",
+					"origin":   "uaa",
+					"active":   false,
+				})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error":"scim_resource_not_found"}`))
+			}
+		})
+		uaa = httptest.NewServer(mux)
+
+		cfClient, err := cfclient.NewClient(&cfclient.Config{
+			ApiAddress:   uaa.URL,
+			ClientID:     "auditor",
+			ClientSecret: "secret",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		logger := lager.NewLogger("fetcher-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		cfg = &fetchers.FetcherConfig{
+			Foundation: "test-foundation",
+			CFClient:   cfClient,
+			Logger:     logger,
+
+			APIAddress: uaa.URL,
+			HTTPClient: uaa.Client(),
+
+			MaxRetries:          2,
+			RetryInitialBackoff: 1 * time.Millisecond,
+			RetryMaxBackoff:     2 * time.Millisecond,
+		}
+	})
+
+	AfterEach(func() {
+		uaa.Close()
+	})
+
+	It("looks up users, preferring their primary email address", func() {
+		user, err := fetchers.GetUAAUser(context.Background(), cfg, "sso-user-guid")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user).To(Equal(fetchers.UAAUser{
+			GUID:     "sso-user-guid",
+			Username: "someone@example.com",
+			Origin:   "google",
+			Email:    "someone@example.com",
+			Active:   true,
+		}))
+	})
+
+	It("retries server errors", func() {
+		user, err := fetchers.GetUAAUser(context.Background(), cfg, "flaky-user-guid")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user.Origin).To(Equal("uaa"))
+		Expect(user.Active).To(BeFalse())
+		Expect(atomic.LoadInt64(&userCalls)).To(Equal(int64(2)))
+	})
+
+	It("returns ErrNotFound for deleted users", func() {
+		_, err := fetchers.GetUAAUser(context.Background(), cfg, "deleted-user-guid")
+		Expect(err).To(MatchError(fetchers.ErrNotFound))
+		Expect(atomic.LoadInt64(&userCalls)).To(Equal(int64(1)))
+	})
+})
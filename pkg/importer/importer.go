@@ -0,0 +1,273 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const (
+	// maxLineSize is the longest line which can be read, which is much
+	// longer than any event
+	maxLineSize = 16 * 1024 * 1024
+
+	// maxInvalidLines is how many invalid lines are kept for the summary
+	maxInvalidLines = 100
+)
+
+type Config struct {
+	// DefaultFoundation is the foundation of events which do not say
+	DefaultFoundation string
+	// BatchSize is how many events of a foundation are stored at a time
+	BatchSize int
+	// Progress is written to every ProgressInterval
+	Progress         io.Writer
+	ProgressInterval time.Duration
+}
+
+// InvalidLine is a line which could not be imported
+type InvalidLine struct {
+	File   string
+	Line   int
+	Reason string
+}
+
+func (l InvalidLine) String() string {
+	return fmt.Sprintf("%s:%d: %s", l.File, l.Line, l.Reason)
+}
+
+// Summary is what has been imported
+type Summary struct {
+	Files int
+	Lines int
+	// Inserted and Duplicates are by foundation
+	Inserted   map[string]int
+	Duplicates map[string]int
+	// Skipped lines are of something other than audit events, like usage
+	// events or digests shipped to Splunk
+	Skipped int
+	Invalid int
+	// InvalidLines are the first of the invalid lines
+	InvalidLines []InvalidLine
+}
+
+// Importer reads newline-delimited JSON audit events and stores them, in
+// batches, a foundation at a time. Events which are already stored are
+// counted as duplicates. Each line is either:
+//
+//   - a line of an archive, which is an event with its foundation
+//   - an event as shipped to Splunk, in the splunkEvent envelope, with its
+//     foundation in fields
+//   - a result of a Splunk search export, whose _raw is one of those
+type Importer struct {
+	eventDB db.EventDB
+	cfg     Config
+
+	summary      Summary
+	batches      map[string][]cfclient.Event
+	lastProgress time.Time
+}
+
+func NewImporter(eventDB db.EventDB, cfg Config) *Importer {
+	return &Importer{
+		eventDB: eventDB,
+		cfg:     cfg,
+		summary: Summary{
+			Inserted:   map[string]int{},
+			Duplicates: map[string]int{},
+		},
+		batches:      map[string][]cfclient.Event{},
+		lastProgress: time.Now(),
+	}
+}
+
+// line is the fields of any of the formats read
+type line struct {
+	// A Splunk search export result
+	Result *struct {
+		Raw string `json:"_raw"`
+	} `json:"result"`
+
+	// A splunkEvent
+	SourceType string            `json:"sourcetype"`
+	Event      json.RawMessage   `json:"event"`
+	Fields     map[string]string `json:"fields"`
+
+	// An archived event
+	Foundation string `json:"foundation"`
+	GUID       string `json:"guid"`
+}
+
+// errSkipped is returned by parseLine for lines which are not audit events
+var errSkipped = fmt.Errorf("not an audit event")
+
+// parseLine returns the event in a line and its foundation, which is empty
+// if the line does not say
+func parseLine(b []byte) (string, cfclient.Event, error) {
+	var l line
+	if err := json.Unmarshal(b, &l); err != nil {
+		return "", cfclient.Event{}, fmt.Errorf("not JSON: %s", err)
+	}
+
+	var (
+		foundation string
+		eventJSON  []byte
+	)
+	switch {
+	case l.Result != nil:
+		if l.Result.Raw == "" {
+			return "", cfclient.Event{}, fmt.Errorf("Splunk result has no _raw")
+		}
+		var raw line
+		if err := json.Unmarshal([]byte(l.Result.Raw), &raw); err != nil || raw.Result != nil {
+			return "", cfclient.Event{}, fmt.Errorf("Splunk result _raw is not an event")
+		}
+		return parseLine([]byte(l.Result.Raw))
+	case l.Event != nil:
+		if l.SourceType != "" && l.SourceType != "cf-audit-event" {
+			return "", cfclient.Event{}, errSkipped
+		}
+		foundation = l.Fields["foundation"]
+		eventJSON = l.Event
+	case l.GUID != "":
+		foundation = l.Foundation
+		eventJSON = b
+	default:
+		return "", cfclient.Event{}, fmt.Errorf("neither an archived event nor a Splunk event")
+	}
+
+	var event cfclient.Event
+	if err := json.Unmarshal(eventJSON, &event); err != nil {
+		return "", cfclient.Event{}, fmt.Errorf("event is not valid: %s", err)
+	}
+	return foundation, event, nil
+}
+
+// Import reads the lines of a file, which may be gzipped, storing the
+// events in it as batches fill up. The last batches are stored by Finish.
+func (i *Importer) Import(ctx context.Context, name string, r io.Reader) error {
+	i.summary.Files++
+
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		i.summary.Lines++
+
+		foundation, event, err := parseLine(b)
+		if err == nil {
+			err = db.ValidateCFAuditEvent(event)
+		}
+		if err == errSkipped {
+			i.summary.Skipped++
+			continue
+		}
+		if err != nil {
+			i.invalid(InvalidLine{File: name, Line: lineNumber, Reason: err.Error()})
+			continue
+		}
+
+		if foundation == "" {
+			foundation = i.cfg.DefaultFoundation
+		}
+		i.batches[foundation] = append(i.batches[foundation], event)
+		if len(i.batches[foundation]) >= i.cfg.BatchSize {
+			if err := i.store(foundation); err != nil {
+				return err
+			}
+		}
+		i.progress(false)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	return nil
+}
+
+// Finish stores the last batches and returns the summary
+func (i *Importer) Finish() (Summary, error) {
+	foundations := make([]string, 0, len(i.batches))
+	for foundation := range i.batches {
+		foundations = append(foundations, foundation)
+	}
+	sort.Strings(foundations)
+	for _, foundation := range foundations {
+		if err := i.store(foundation); err != nil {
+			return i.summary, err
+		}
+	}
+	i.progress(true)
+	return i.summary, nil
+}
+
+func (i *Importer) store(foundation string) error {
+	batch := i.batches[foundation]
+	if len(batch) == 0 {
+		return nil
+	}
+	result, err := i.eventDB.StoreCFAuditEvents(foundation, batch)
+	if err != nil {
+		return fmt.Errorf("failed to store events of %s: %s", foundation, err)
+	}
+	i.summary.Inserted[foundation] += result.Inserted
+	i.summary.Duplicates[foundation] += result.Duplicates
+	// Events were validated before they were batched, so none should be
+	// quarantined, but they are counted if they are
+	i.summary.Invalid += result.Quarantined
+	delete(i.batches, foundation)
+	return nil
+}
+
+func (i *Importer) invalid(line InvalidLine) {
+	i.summary.Invalid++
+	if len(i.summary.InvalidLines) < maxInvalidLines {
+		i.summary.InvalidLines = append(i.summary.InvalidLines, line)
+	}
+	i.progress(false)
+}
+
+func (i *Importer) progress(force bool) {
+	if i.cfg.Progress == nil || (!force && time.Since(i.lastProgress) < i.cfg.ProgressInterval) {
+		return
+	}
+	i.lastProgress = time.Now()
+	inserted, duplicates := 0, 0
+	for _, n := range i.summary.Inserted {
+		inserted += n
+	}
+	for _, n := range i.summary.Duplicates {
+		duplicates += n
+	}
+	fmt.Fprintf(
+		i.cfg.Progress, "%d files, %d lines: %d inserted, %d duplicates, %d skipped, %d invalid\n",
+		i.summary.Files, i.summary.Lines, inserted, duplicates, i.summary.Skipped, i.summary.Invalid,
+	)
+}
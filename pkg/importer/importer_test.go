@@ -0,0 +1,171 @@
+package importer_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/archive"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/importer"
+)
+
+var _ = Describe("Importer", func() {
+	var (
+		fakeEventDB *fakes.FakeEventDB
+		progress    *bytes.Buffer
+		imp         *importer.Importer
+		ctx         context.Context
+	)
+
+	event := func(n int) cfclient.Event {
+		return cfclient.Event{
+			GUID:      fmt.Sprintf("00000000-0000-0000-0000-%012d", n),
+			CreatedAt: "2019-10-31T00:00:00Z",
+			Type:      "audit.app.create",
+			Actor:     "actor-guid",
+			Metadata:  map[string]interface{}{"request": map[string]interface{}{"name": "my-app"}},
+		}
+	}
+
+	archiveLine := func(foundation string, e cfclient.Event) string {
+		b, err := json.Marshal(archive.Event{Foundation: foundation, CFAuditEvent: db.CFAuditEvent{Event: e}})
+		Expect(err).NotTo(HaveOccurred())
+		return string(b)
+	}
+
+	splunkLine := func(sourceType string, foundation string, e cfclient.Event) string {
+		b, err := json.Marshal(map[string]interface{}{
+			"sourcetype": sourceType,
+			"source":     "prod",
+			"event":      e,
+			"fields":     map[string]string{"foundation": foundation},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return string(b)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		fakeEventDB = &fakes.FakeEventDB{}
+		fakeEventDB.StoreCFAuditEventsStub = func(foundation string, events []cfclient.Event) (db.StoreResult, error) {
+			return db.StoreResult{Inserted: len(events)}, nil
+		}
+		progress = &bytes.Buffer{}
+		imp = importer.NewImporter(fakeEventDB, importer.Config{
+			DefaultFoundation: "default",
+			BatchSize:         2,
+			Progress:          progress,
+		})
+	})
+
+	It("stores events from archives and from Splunk, by foundation", func() {
+		splunkExport, err := json.Marshal(map[string]interface{}{
+			"preview": false,
+			"result":  map[string]string{"_raw": splunkLine("cf-audit-event", "paris", event(3))},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		input := strings.Join([]string{
+			archiveLine("london", event(1)),
+			splunkLine("cf-audit-event", "paris", event(2)),
+			"",
+			string(splunkExport),
+			archiveLine("", event(4)),
+		}, "\n")
+		Expect(imp.Import(ctx, "events.ndjson", strings.NewReader(input))).To(Succeed())
+
+		By("storing a batch once it is full")
+		Expect(fakeEventDB.StoreCFAuditEventsCallCount()).To(Equal(1))
+		foundation, events := fakeEventDB.StoreCFAuditEventsArgsForCall(0)
+		Expect(foundation).To(Equal("paris"))
+		Expect(events).To(Equal([]cfclient.Event{event(2), event(3)}))
+
+		summary, err := imp.Finish()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fakeEventDB.StoreCFAuditEventsCallCount()).To(Equal(3))
+		foundation, events = fakeEventDB.StoreCFAuditEventsArgsForCall(1)
+		Expect(foundation).To(Equal("default"))
+		Expect(events).To(Equal([]cfclient.Event{event(4)}))
+		foundation, events = fakeEventDB.StoreCFAuditEventsArgsForCall(2)
+		Expect(foundation).To(Equal("london"))
+		Expect(events).To(Equal([]cfclient.Event{event(1)}))
+
+		Expect(summary.Files).To(Equal(1))
+		Expect(summary.Lines).To(Equal(4))
+		Expect(summary.Inserted).To(Equal(map[string]int{"london": 1, "paris": 2, "default": 1}))
+		Expect(summary.Invalid).To(Equal(0))
+		Expect(progress.String()).To(ContainSubstring("1 files, 4 lines: 4 inserted, 0 duplicates, 0 skipped, 0 invalid"))
+	})
+
+	It("reads gzipped archives", func() {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		fmt.Fprintln(gz, archiveLine("london", event(1)))
+		Expect(gz.Close()).To(Succeed())
+
+		Expect(imp.Import(ctx, "events.ndjson.gz", buf)).To(Succeed())
+		summary, err := imp.Finish()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary.Inserted).To(Equal(map[string]int{"london": 1}))
+		_, events := fakeEventDB.StoreCFAuditEventsArgsForCall(0)
+		Expect(events).To(Equal([]cfclient.Event{event(1)}))
+	})
+
+	It("counts events which are already stored as duplicates", func() {
+		fakeEventDB.StoreCFAuditEventsStub = nil
+		fakeEventDB.StoreCFAuditEventsReturns(db.StoreResult{Inserted: 1, Duplicates: 1}, nil)
+
+		input := archiveLine("london", event(1)) + "\n" + archiveLine("london", event(2))
+		Expect(imp.Import(ctx, "events.ndjson", strings.NewReader(input))).To(Succeed())
+		summary, err := imp.Finish()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary.Inserted).To(Equal(map[string]int{"london": 1}))
+		Expect(summary.Duplicates).To(Equal(map[string]int{"london": 1}))
+	})
+
+	It("skips other Splunk events and reports invalid lines without storing them", func() {
+		invalidEvent := event(2)
+		invalidEvent.CreatedAt = "yesterday"
+
+		input := strings.Join([]string{
+			splunkLine("cf-usage-event", "london", event(1)),
+			"not json",
+			archiveLine("london", invalidEvent),
+			`{"something": "else"}`,
+			archiveLine("london", event(3)),
+		}, "\n")
+		Expect(imp.Import(ctx, "events.ndjson", strings.NewReader(input))).To(Succeed())
+		summary, err := imp.Finish()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeEventDB.StoreCFAuditEventsCallCount()).To(Equal(1))
+		_, events := fakeEventDB.StoreCFAuditEventsArgsForCall(0)
+		Expect(events).To(Equal([]cfclient.Event{event(3)}))
+
+		Expect(summary.Lines).To(Equal(5))
+		Expect(summary.Skipped).To(Equal(1))
+		Expect(summary.Invalid).To(Equal(3))
+		Expect(summary.InvalidLines).To(HaveLen(3))
+		Expect(summary.InvalidLines[0].String()).To(HavePrefix("events.ndjson:2: not JSON"))
+		Expect(summary.InvalidLines[1].String()).To(ContainSubstring(`events.ndjson:3: created_at "yesterday" is not a time`))
+		Expect(summary.InvalidLines[2].String()).To(HavePrefix("events.ndjson:4: neither"))
+	})
+
+	It("returns an error if events cannot be stored", func() {
+		fakeEventDB.StoreCFAuditEventsStub = nil
+		fakeEventDB.StoreCFAuditEventsReturns(db.StoreResult{}, fmt.Errorf("connection refused"))
+
+		Expect(imp.Import(ctx, "events.ndjson", strings.NewReader(archiveLine("london", event(1))))).To(Succeed())
+		_, err := imp.Finish()
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+	})
+})
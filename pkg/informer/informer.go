@@ -9,18 +9,22 @@ import (
 )
 
 type Informer struct {
-	schedule time.Duration
-	logger   lager.Logger
-	eventDB  db.EventDB
+	foundations  []string
+	schedule     time.Duration
+	logger       lager.Logger
+	eventDB      db.EventDB
+	usageEventDB db.UsageEventDB
 }
 
 func NewInformer(
+	foundations []string,
 	schedule time.Duration,
 	logger lager.Logger,
 	eventDB db.EventDB,
+	usageEventDB db.UsageEventDB,
 ) *Informer {
 	logger = logger.Session("informer")
-	return &Informer{schedule, logger, eventDB}
+	return &Informer{foundations, schedule, logger, eventDB, usageEventDB}
 }
 
 func (i *Informer) Run(ctx context.Context) error {
@@ -41,14 +45,49 @@ func (i *Informer) Run(ctx context.Context) error {
 			}
 			InformerCFAuditEventsTotal.Set(float64(count)) // this will be 0 if err
 
-			timestamp, err := i.eventDB.GetLatestCFEventTime()
+			for _, foundation := range i.foundations {
+				gauge := InformerLatestCFAuditEventTimestamp.WithLabelValues(foundation)
+
+				timestamp, err := i.eventDB.GetLatestCFEventTime(foundation)
+				if err != nil {
+					lsession.Error("err-event-db-get-latest-cf-event-time", err, lager.Data{
+						"foundation": foundation,
+					})
+					gauge.Set(float64(0))
+				} else {
+					gauge.Set(float64(timestamp.Unix()))
+				}
+			}
+
+			i.informUsageEvents(lsession)
+
+		}
+	}
+}
+
+func (i *Informer) informUsageEvents(lsession lager.Logger) {
+	for _, kind := range []db.UsageEventKind{db.AppUsageEvents, db.ServiceUsageEvents} {
+		count, err := i.usageEventDB.GetUsageEventCount(kind)
+		if err != nil {
+			lsession.Error("err-event-db-get-usage-event-count", err, lager.Data{
+				"kind": kind,
+			})
+		}
+		InformerCFUsageEventsTotal.WithLabelValues(string(kind)).Set(float64(count)) // this will be 0 if err
+
+		for _, foundation := range i.foundations {
+			gauge := InformerLatestCFUsageEventTimestamp.WithLabelValues(foundation, string(kind))
+
+			timestamp, err := i.usageEventDB.GetLatestUsageEventTime(kind, foundation)
 			if err != nil {
-				lsession.Error("err-event-db-get-latest-cf-event-time", err)
-				InformerLatestCFAuditEventTimestamp.Set(float64(0))
+				lsession.Error("err-event-db-get-latest-usage-event-time", err, lager.Data{
+					"foundation": foundation,
+					"kind":       kind,
+				})
+				gauge.Set(float64(0))
 			} else {
-				InformerLatestCFAuditEventTimestamp.Set(float64(timestamp.Unix()))
+				gauge.Set(float64(timestamp.Unix()))
 			}
-
 		}
 	}
 }
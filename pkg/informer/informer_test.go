@@ -20,6 +20,8 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", func() {
 		logger  lager.Logger
 		eventDB *dbfakes.FakeEventDB
 
+		usageEventDB *dbfakes.FakeUsageEventDB
+
 		informerCFAuditEventsTotal          float64
 		informerLatestCFAuditEventTimestamp float64
 	)
@@ -33,17 +35,23 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", func() {
 			informer.InformerCFAuditEventsTotal,
 		)
 		informerLatestCFAuditEventTimestamp = h.CurrentMetricValue(
-			informer.InformerLatestCFAuditEventTimestamp,
+			informer.InformerLatestCFAuditEventTimestamp.WithLabelValues("test-foundation"),
 		)
 
 		eventDB = &dbfakes.FakeEventDB{}
 		eventDB.GetCFEventCountReturns(int64(100), nil)
 		eventDB.GetLatestCFEventTimeReturns(time.Now(), nil)
 
+		usageEventDB = &dbfakes.FakeUsageEventDB{}
+		usageEventDB.GetUsageEventCountReturns(int64(50), nil)
+		usageEventDB.GetLatestUsageEventTimeReturns(time.Now(), nil)
+
 		i = informer.NewInformer(
+			[]string{"test-foundation"},
 			10*time.Millisecond,
 			logger,
 			eventDB,
+			usageEventDB,
 		)
 	})
 
@@ -76,9 +84,23 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", func() {
 		Expect(informer.InformerCFAuditEventsTotal).To(
 			h.MetricIncrementedBy(informerCFAuditEventsTotal, "==", 100),
 		)
-		Expect(informer.InformerLatestCFAuditEventTimestamp).To(
+		Expect(informer.InformerLatestCFAuditEventTimestamp.WithLabelValues("test-foundation")).To(
 			h.MetricIncrementedBy(informerLatestCFAuditEventTimestamp, ">", 0),
 		)
+		Expect(eventDB.GetLatestCFEventTimeArgsForCall(0)).To(Equal("test-foundation"))
+
+		By("checking the usage event metrics")
+		Eventually(
+			func() float64 {
+				return h.CurrentMetricValue(informer.InformerCFUsageEventsTotal.WithLabelValues("app"))
+			}, "100ms", "1ms",
+		).Should(BeNumerically("==", float64(50)))
+		Expect(h.CurrentMetricValue(informer.InformerCFUsageEventsTotal.WithLabelValues("service"))).To(
+			BeNumerically("==", float64(50)),
+		)
+		Expect(h.CurrentMetricValue(
+			informer.InformerLatestCFUsageEventTimestamp.WithLabelValues("test-foundation", "app"),
+		)).To(BeNumerically(">", 0))
 
 		By("cleaning up")
 		cancelInf()
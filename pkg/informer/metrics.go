@@ -10,13 +10,25 @@ var (
 		Help: "Number of CF audit events in the database",
 	})
 
-	InformerLatestCFAuditEventTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+	InformerLatestCFAuditEventTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "informer_latest_cf_audit_event_timestamp",
 		Help: "Unix epoch seconds of most recent event in the database",
-	})
+	}, []string{"foundation"})
+
+	InformerCFUsageEventsTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "informer_cf_usage_events_total",
+		Help: "Number of CF usage events in the database",
+	}, []string{"kind"})
+
+	InformerLatestCFUsageEventTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "informer_latest_cf_usage_event_timestamp",
+		Help: "Unix epoch seconds of most recent usage event in the database",
+	}, []string{"foundation", "kind"})
 )
 
 func initMetrics() {
 	prometheus.MustRegister(InformerCFAuditEventsTotal)
 	prometheus.MustRegister(InformerLatestCFAuditEventTimestamp)
+	prometheus.MustRegister(InformerCFUsageEventsTotal)
+	prometheus.MustRegister(InformerLatestCFUsageEventTimestamp)
 }
@@ -0,0 +1,69 @@
+package integrity
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// Checkpointer periodically exports and logs the head of the hash chain over
+// cf_audit_events. The head is kept outside the database, in the logs and
+// metrics, so that the events in the chain cannot be changed and the chain
+// rewritten without the head no longer matching an earlier checkpoint.
+type Checkpointer struct {
+	schedule time.Duration
+	logger   lager.Logger
+	chainDB  db.ChainDB
+}
+
+func NewCheckpointer(schedule time.Duration, logger lager.Logger, chainDB db.ChainDB) *Checkpointer {
+	return &Checkpointer{
+		schedule: schedule,
+		logger:   logger.Session("chain-checkpointer"),
+		chainDB:  chainDB,
+	}
+}
+
+// Run takes a checkpoint straight away, and then every schedule until ctx is
+// cancelled
+func (c *Checkpointer) Run(ctx context.Context) error {
+	lsession := c.logger.Session("run")
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		c.checkpoint(lsession)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.schedule):
+		}
+	}
+}
+
+func (c *Checkpointer) checkpoint(logger lager.Logger) {
+	head, err := c.chainDB.GetCFAuditEventChainHead()
+	if err != nil {
+		CheckpointErrorsTotal.Inc()
+		logger.Error("err-get-chain-head", err)
+		return
+	}
+
+	hash := hex.EncodeToString(head.Hash)
+	ChainLength.Set(float64(head.Length))
+	// Only the current head is exported, so that there is one series at a
+	// time. Earlier heads are kept by Prometheus.
+	ChainHead.Reset()
+	ChainHead.WithLabelValues(hash).Set(float64(head.Length))
+
+	logger.Info("chain-checkpoint", lager.Data{
+		"length":     head.Length,
+		"head-hash":  hash,
+		"updated-at": head.UpdatedAt,
+	})
+}
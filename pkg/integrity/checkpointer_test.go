@@ -0,0 +1,74 @@
+package integrity_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	putil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/integrity"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Checkpointer", func() {
+	var (
+		logger  lager.Logger
+		chainDB *dbfakes.FakeChainDB
+		ctx     context.Context
+		cancel  context.CancelFunc
+		wg      sync.WaitGroup
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("integrity-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+		chainDB = &dbfakes.FakeChainDB{}
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	start := func() {
+		checkpointer := integrity.NewCheckpointer(10*time.Millisecond, logger, chainDB)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = checkpointer.Run(ctx)
+		}()
+	}
+
+	It("exports only the latest head of the chain", func() {
+		chainDB.GetCFAuditEventChainHeadReturnsOnCall(0, db.ChainHead{Length: 3, Hash: []byte{0xab, 0xcd}}, nil)
+		chainDB.GetCFAuditEventChainHeadReturns(db.ChainHead{Length: 5, Hash: []byte{0xef, 0x01}}, nil)
+
+		start()
+
+		Eventually(chainDB.GetCFAuditEventChainHeadCallCount).Should(BeNumerically(">=", 2))
+		cancel()
+		wg.Wait()
+
+		Expect(h.CurrentMetricValue(integrity.ChainLength)).To(Equal(float64(5)))
+		Expect(putil.CollectAndCount(integrity.ChainHead)).To(Equal(1))
+		Expect(h.CurrentMetricValue(integrity.ChainHead.WithLabelValues("ef01"))).To(Equal(float64(5)))
+	})
+
+	It("counts failures and tries again", func() {
+		errorsBefore := h.CurrentMetricValue(integrity.CheckpointErrorsTotal)
+		chainDB.GetCFAuditEventChainHeadReturns(db.ChainHead{}, fmt.Errorf("connection refused"))
+
+		start()
+
+		Eventually(chainDB.GetCFAuditEventChainHeadCallCount).Should(BeNumerically(">=", 2))
+		Expect(integrity.CheckpointErrorsTotal).To(h.MetricIncrementedBy(errorsBefore, ">=", 2))
+	})
+})
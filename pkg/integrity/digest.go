@@ -0,0 +1,231 @@
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const digestDateFormat = "2006-01-02"
+
+// statement is what is signed in a digest. It is encoded as JSON with the
+// fields in this order.
+type statement struct {
+	Date       string `json:"date"`
+	EventCount int64  `json:"event_count"`
+	FirstGUID  string `json:"first_guid"`
+	LastGUID   string `json:"last_guid"`
+	MerkleRoot string `json:"merkle_root"`
+	// MaxEventID is left out when it is 0, so that digests made before it
+	// was recorded are signed the same
+	MaxEventID int64 `json:"max_event_id,omitempty"`
+}
+
+func statementOf(digest db.Digest) []byte {
+	b, _ := json.Marshal(statement{
+		Date:       digest.Date.UTC().Format(digestDateFormat),
+		EventCount: digest.EventCount,
+		FirstGUID:  digest.FirstGUID,
+		LastGUID:   digest.LastGUID,
+		MerkleRoot: hex.EncodeToString(digest.MerkleRoot),
+		MaxEventID: digest.MaxEventID,
+	})
+	return b
+}
+
+// maxLateGUIDs is how many of the events stored after a digest was made are
+// listed by GUID
+const maxLateGUIDs = 20
+
+// Summary is the unsigned digest of the events of a day, worked out as their
+// hashes are added in order
+type Summary struct {
+	digest db.Digest
+	merkle MerkleBuilder
+
+	// LateEvents is how many events added were stored after MaxEventID, so
+	// are left out of the digest, and LateGUIDs are the first of them
+	LateEvents int64
+	LateGUIDs  []string
+}
+
+// NewSummary starts a summary of the events of the day starting at date.
+// If maxEventID is not 0, events stored after it are left out.
+func NewSummary(date time.Time, maxEventID int64) *Summary {
+	return &Summary{
+		digest: db.Digest{
+			Date:       date.UTC(),
+			MaxEventID: maxEventID,
+		},
+	}
+}
+
+// Add adds the hash of the next event
+func (s *Summary) Add(hash db.EventHash) {
+	if s.digest.MaxEventID != 0 && hash.ID > s.digest.MaxEventID {
+		s.LateEvents++
+		if len(s.LateGUIDs) < maxLateGUIDs {
+			s.LateGUIDs = append(s.LateGUIDs, strings.ToLower(hash.GUID))
+		}
+		return
+	}
+	guid := strings.ToLower(hash.GUID)
+	if s.digest.EventCount == 0 {
+		s.digest.FirstGUID = guid
+	}
+	s.digest.LastGUID = guid
+	s.digest.EventCount++
+	s.merkle.Add(hash.Hash)
+}
+
+// Digest returns the unsigned digest of the events added so far
+func (s *Summary) Digest() db.Digest {
+	digest := s.digest
+	digest.MerkleRoot = s.merkle.Root()
+	return digest
+}
+
+// SummariseDay reads the hashes of the events of the day starting at date
+// from digestDB into a summary. If maxEventID is 0, every event is included
+// and the summary's MaxEventID is of the latest event stored when they were
+// read.
+func SummariseDay(ctx context.Context, digestDB db.DigestDB, date time.Time, maxEventID int64) (*Summary, error) {
+	summary := NewSummary(date, maxEventID)
+	latest, err := digestDB.StreamCFAuditEventHashes(ctx, date, date.AddDate(0, 0, 1), func(hash db.EventHash) error {
+		summary.Add(hash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if maxEventID == 0 {
+		summary.digest.MaxEventID = latest
+	}
+	return summary, nil
+}
+
+// SignDigest signs an unsigned digest with key
+func SignDigest(digest db.Digest, key ed25519.PrivateKey) db.Digest {
+	digest.PublicKey = key.Public().(ed25519.PublicKey)
+	digest.Signature = ed25519.Sign(key, statementOf(digest))
+	return digest
+}
+
+// VerifyDigest checks that a digest was signed with the key publicKey, and
+// that it matches now, the summary of the events of its day stored by the
+// time it was made, as they are now
+func VerifyDigest(digest db.Digest, publicKey ed25519.PublicKey, now db.Digest) error {
+	if !bytes.Equal(digest.PublicKey, publicKey) {
+		return fmt.Errorf("the digest was signed with a different key")
+	}
+	if !ed25519.Verify(publicKey, statementOf(digest), digest.Signature) {
+		return fmt.Errorf("the signature does not match the digest, which has been changed")
+	}
+
+	problems := []string{}
+	if now.EventCount != digest.EventCount {
+		problems = append(problems, fmt.Sprintf("there are %d events, not %d", now.EventCount, digest.EventCount))
+	}
+	if now.FirstGUID != digest.FirstGUID {
+		problems = append(problems, fmt.Sprintf("the first event is %q, not %q", now.FirstGUID, digest.FirstGUID))
+	}
+	if now.LastGUID != digest.LastGUID {
+		problems = append(problems, fmt.Sprintf("the last event is %q, not %q", now.LastGUID, digest.LastGUID))
+	}
+	if !bytes.Equal(now.MerkleRoot, digest.MerkleRoot) {
+		problems = append(problems, fmt.Sprintf(
+			"the Merkle root is %s, not %s", hex.EncodeToString(now.MerkleRoot), hex.EncodeToString(digest.MerkleRoot),
+		))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("the events of %s have changed: %s", digest.Date.Format(digestDateFormat), strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// DigestJSON is a digest as written to files and shipped to Splunk
+type DigestJSON struct {
+	statement
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+func NewDigestJSON(digest db.Digest) DigestJSON {
+	var s statement
+	_ = json.Unmarshal(statementOf(digest), &s)
+	return DigestJSON{
+		statement: s,
+		PublicKey: base64.StdEncoding.EncodeToString(digest.PublicKey),
+		Signature: base64.StdEncoding.EncodeToString(digest.Signature),
+	}
+}
+
+// ParseDigestJSON reads a digest written by NewDigestJSON
+func ParseDigestJSON(b []byte) (db.Digest, error) {
+	var d DigestJSON
+	if err := json.Unmarshal(b, &d); err != nil {
+		return db.Digest{}, fmt.Errorf("digest is not JSON: %s", err)
+	}
+	date, err := time.Parse(digestDateFormat, d.Date)
+	if err != nil {
+		return db.Digest{}, fmt.Errorf("digest date %q is not a date", d.Date)
+	}
+	merkleRoot, err := hex.DecodeString(d.MerkleRoot)
+	if err != nil {
+		return db.Digest{}, fmt.Errorf("digest merkle_root is not hex: %s", err)
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(d.PublicKey)
+	if err != nil {
+		return db.Digest{}, fmt.Errorf("digest public_key is not base64: %s", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(d.Signature)
+	if err != nil {
+		return db.Digest{}, fmt.Errorf("digest signature is not base64: %s", err)
+	}
+	return db.Digest{
+		Date:       date,
+		EventCount: d.EventCount,
+		FirstGUID:  d.FirstGUID,
+		LastGUID:   d.LastGUID,
+		MerkleRoot: merkleRoot,
+		MaxEventID: d.MaxEventID,
+		PublicKey:  publicKey,
+		Signature:  signature,
+	}, nil
+}
+
+// ParseSigningKey reads a base64 ed25519 private key, either the 32 byte
+// seed or the 64 byte key
+func ParseSigningKey(s string) (ed25519.PrivateKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("signing key is not base64: %s", err)
+	}
+	switch len(b) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(b), nil
+	}
+	return nil, fmt.Errorf("signing key is %d bytes, not %d or %d", len(b), ed25519.SeedSize, ed25519.PrivateKeySize)
+}
+
+// ParsePublicKey reads a base64 ed25519 public key
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("public key is not base64: %s", err)
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key is %d bytes, not %d", len(b), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(b), nil
+}
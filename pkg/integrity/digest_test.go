@@ -0,0 +1,170 @@
+package integrity_test
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/integrity"
+)
+
+func sha(b ...[]byte) []byte {
+	h := sha256.New()
+	for _, p := range b {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+var _ = Describe("MerkleRoot", func() {
+	It("matches RFC 6962", func() {
+		Expect(hex.EncodeToString(integrity.MerkleRoot(nil))).To(Equal(
+			"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		))
+		Expect(hex.EncodeToString(integrity.MerkleRoot([][]byte{{}}))).To(Equal(
+			"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		))
+
+		a, b, c := []byte("a"), []byte("b"), []byte("c")
+		leaf := func(d []byte) []byte { return sha([]byte{0}, d) }
+		node := func(l, r []byte) []byte { return sha([]byte{1}, l, r) }
+		Expect(integrity.MerkleRoot([][]byte{a, b, c})).To(Equal(
+			node(node(leaf(a), leaf(b)), leaf(c)),
+		))
+	})
+
+	It("is the same built a leaf at a time", func() {
+		leaves := [][]byte{}
+		builder := integrity.MerkleBuilder{}
+		Expect(builder.Root()).To(Equal(integrity.MerkleRoot(leaves)))
+		for i := 0; i < 40; i++ {
+			leaf := sha([]byte{byte(i)})
+			leaves = append(leaves, leaf)
+			builder.Add(leaf)
+			Expect(builder.Root()).To(Equal(integrity.MerkleRoot(leaves)), "with %d leaves", len(leaves))
+		}
+	})
+})
+
+func summarise(date time.Time, maxEventID int64, hashes []db.EventHash) *integrity.Summary {
+	summary := integrity.NewSummary(date, maxEventID)
+	for _, hash := range hashes {
+		summary.Add(hash)
+	}
+	return summary
+}
+
+var _ = Describe("Digests", func() {
+	var (
+		key    ed25519.PrivateKey
+		date   time.Time
+		hashes []db.EventHash
+	)
+
+	BeforeEach(func() {
+		key = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+		date = time.Date(2019, 10, 31, 0, 0, 0, 0, time.UTC)
+		hashes = []db.EventHash{
+			{ID: 1, GUID: "10000000-0000-0000-0000-000000000001", Hash: sha([]byte("1"))},
+			{ID: 3, GUID: "20000000-0000-0000-0000-000000000002", Hash: sha([]byte("2"))},
+			{ID: 2, GUID: "30000000-0000-0000-0000-000000000003", Hash: sha([]byte("3"))},
+		}
+	})
+
+	newDigest := func(hashes []db.EventHash, key ed25519.PrivateKey) db.Digest {
+		return integrity.SignDigest(summarise(date, 0, hashes).Digest(), key)
+	}
+	now := func(digest db.Digest, hashes []db.EventHash) db.Digest {
+		return summarise(digest.Date, digest.MaxEventID, hashes).Digest()
+	}
+
+	It("signs a summary of the day's events", func() {
+		digest := newDigest(hashes, key)
+		Expect(digest.EventCount).To(BeNumerically("==", 3))
+		Expect(digest.FirstGUID).To(Equal("10000000-0000-0000-0000-000000000001"))
+		Expect(digest.LastGUID).To(Equal("30000000-0000-0000-0000-000000000003"))
+		Expect(digest.MerkleRoot).To(Equal(integrity.MerkleRoot([][]byte{hashes[0].Hash, hashes[1].Hash, hashes[2].Hash})))
+
+		Expect(integrity.VerifyDigest(digest, key.Public().(ed25519.PublicKey), now(digest, hashes))).To(Succeed())
+	})
+
+	It("leaves out events stored after the digest was made", func() {
+		digest := newDigest(hashes, key)
+		digest.MaxEventID = 3
+		digest = integrity.SignDigest(digest, key)
+
+		late := append([]db.EventHash{
+			{ID: 4, GUID: "00000000-0000-0000-0000-00000000000A", Hash: sha([]byte("late"))},
+		}, hashes...)
+		summary := summarise(digest.Date, digest.MaxEventID, late)
+		Expect(integrity.VerifyDigest(digest, key.Public().(ed25519.PublicKey), summary.Digest())).To(Succeed())
+		Expect(summary.LateEvents).To(BeNumerically("==", 1))
+		Expect(summary.LateGUIDs).To(Equal([]string{"00000000-0000-0000-0000-00000000000a"}))
+
+		By("covering every event in digests made before the latest event was recorded")
+		old := newDigest(hashes, key)
+		Expect(integrity.VerifyDigest(old, key.Public().(ed25519.PublicKey), now(old, late))).To(
+			MatchError(ContainSubstring("there are 4 events, not 3")),
+		)
+	})
+
+	It("finds events which have changed since", func() {
+		digest := newDigest(hashes, key)
+		publicKey := key.Public().(ed25519.PublicKey)
+
+		changed := append([]db.EventHash{}, hashes...)
+		changed[1] = db.EventHash{ID: changed[1].ID, GUID: changed[1].GUID, Hash: sha([]byte("changed"))}
+		Expect(integrity.VerifyDigest(digest, publicKey, now(digest, changed))).To(MatchError(ContainSubstring("Merkle root")))
+
+		Expect(integrity.VerifyDigest(digest, publicKey, now(digest, hashes[:2]))).To(MatchError(ContainSubstring("there are 2 events, not 3")))
+	})
+
+	It("finds digests which have been changed or signed with another key", func() {
+		digest := newDigest(hashes, key)
+		publicKey := key.Public().(ed25519.PublicKey)
+
+		forged := digest
+		forged.EventCount = 2
+		Expect(integrity.VerifyDigest(forged, publicKey, now(forged, hashes[:2]))).To(MatchError(ContainSubstring("signature")))
+
+		otherKey := ed25519.NewKeyFromSeed(sha([]byte("other")))
+		Expect(integrity.VerifyDigest(newDigest(hashes, otherKey), publicKey, now(digest, hashes))).To(
+			MatchError(ContainSubstring("different key")),
+		)
+	})
+
+	It("reads the JSON it writes", func() {
+		digest := newDigest(hashes, key)
+		digest.MaxEventID = 3
+		digest = integrity.SignDigest(digest, key)
+
+		b, err := json.Marshal(integrity.NewDigestJSON(digest))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(HavePrefix(`{"date":"2019-10-31","event_count":3,"first_guid":"10000000-0000-0000-0000-000000000001"`))
+
+		parsed, err := integrity.ParseDigestJSON(b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(digest))
+	})
+
+	It("reads keys as a seed or a whole key", func() {
+		seed := base64.StdEncoding.EncodeToString(key.Seed())
+		whole := base64.StdEncoding.EncodeToString(key)
+
+		Expect(integrity.ParseSigningKey(seed)).To(Equal(key))
+		Expect(integrity.ParseSigningKey(whole)).To(Equal(key))
+		_, err := integrity.ParseSigningKey("c2hvcnQ=")
+		Expect(err).To(HaveOccurred())
+
+		Expect(integrity.ParsePublicKey(base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))).To(
+			Equal(key.Public()),
+		)
+	})
+})
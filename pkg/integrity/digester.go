@@ -0,0 +1,160 @@
+package integrity
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// DigestSink is somewhere digests are sent as well as the digests table
+type DigestSink interface {
+	WriteDigest(digest db.Digest) error
+}
+
+type DigesterConfig struct {
+	// Schedule is how often the digester looks for days to digest
+	Schedule time.Duration
+	// Delay is how long after a day ends it is digested, so that events
+	// which are collected late are included
+	Delay time.Duration
+	// Key signs the digests
+	Key ed25519.PrivateKey
+}
+
+// Digester signs a digest of the events created on each UTC day, once the
+// day is over, and stores it and sends it to its sinks. It carries on from
+// the day after the latest digest, so every day is digested once.
+type Digester struct {
+	logger   lager.Logger
+	digestDB db.DigestDB
+	cfg      DigesterConfig
+	sinks    []DigestSink
+}
+
+func NewDigester(logger lager.Logger, digestDB db.DigestDB, cfg DigesterConfig, sinks ...DigestSink) *Digester {
+	return &Digester{
+		logger:   logger.Session("digester"),
+		digestDB: digestDB,
+		cfg:      cfg,
+		sinks:    sinks,
+	}
+}
+
+func (d *Digester) Run(ctx context.Context) error {
+	lsession := d.logger.Session("run")
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		select {
+		case <-ctx.Done():
+			lsession.Info("done")
+			return nil
+		case <-time.After(d.cfg.Schedule):
+			if err := d.digest(ctx, lsession, time.Now()); err != nil {
+				DigesterErrorsTotal.Inc()
+				lsession.Error("err-digest", err)
+			}
+		}
+	}
+}
+
+// digest signs digests of every day which has ended at least Delay before
+// now and has not been digested
+func (d *Digester) digest(ctx context.Context, logger lager.Logger, now time.Time) error {
+	next, err := d.nextDay()
+	if err != nil || next.IsZero() {
+		return err
+	}
+
+	for ; !next.Add(24*time.Hour + d.cfg.Delay).After(now); next = next.AddDate(0, 0, 1) {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		summary, err := SummariseDay(ctx, d.digestDB, next, 0)
+		if err != nil {
+			return fmt.Errorf("failed to get the events of %s: %s", next.Format(digestDateFormat), err)
+		}
+		digest := SignDigest(summary.Digest(), d.cfg.Key)
+
+		// The digest is only stored once every sink has it, so that a day
+		// which could not be sent is tried again. Signing is deterministic,
+		// so it is sent the same the next time.
+		for _, sink := range d.sinks {
+			if err := sink.WriteDigest(digest); err != nil {
+				return fmt.Errorf("failed to send the digest of %s: %s", next.Format(digestDateFormat), err)
+			}
+		}
+		if err := d.digestDB.StoreDigest(digest); err != nil {
+			return fmt.Errorf("failed to store the digest of %s: %s", next.Format(digestDateFormat), err)
+		}
+
+		DigestsCreatedTotal.Inc()
+		DigesterLatestDigestTimestamp.Set(float64(next.Unix()))
+		logger.Info("created-digest", lager.Data{
+			"digest": NewDigestJSON(digest),
+		})
+	}
+	return nil
+}
+
+// nextDay returns the day after the latest digest, or the day of the
+// earliest event if there are no digests, or the zero time if there are no
+// events either
+func (d *Digester) nextDay() (time.Time, error) {
+	latest, err := d.digestDB.GetLatestDigest()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get the latest digest: %s", err)
+	}
+	if latest != nil {
+		return latest.Date.UTC().AddDate(0, 0, 1), nil
+	}
+
+	earliest, err := d.digestDB.GetEarliestCFEventTime()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get the earliest event: %s", err)
+	}
+	if earliest.IsZero() {
+		return time.Time{}, nil
+	}
+	return earliest.UTC().Truncate(24 * time.Hour), nil
+}
+
+// FileDigestSink writes each digest to a file in a directory, named like
+// digest-2019-10-31.json
+type FileDigestSink struct {
+	Dir string
+}
+
+func (s FileDigestSink) WriteDigest(digest db.Digest) error {
+	b, err := json.MarshalIndent(NewDigestJSON(digest), "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.Dir, "digest-"+digest.Date.UTC().Format(digestDateFormat)+".json")
+
+	// Written to a temporary file first, so that a digest is never half
+	// written
+	tmp, err := os.CreateTemp(s.Dir, ".digest-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,135 @@
+package integrity_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/integrity"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+type failingSink struct{}
+
+func (failingSink) WriteDigest(digest db.Digest) error {
+	return fmt.Errorf("splunk is down")
+}
+
+var _ = Describe("Digester", func() {
+	var (
+		logger   lager.Logger
+		digestDB *dbfakes.FakeDigestDB
+		key      ed25519.PrivateKey
+		today    time.Time
+		ctx      context.Context
+		cancel   context.CancelFunc
+		wg       sync.WaitGroup
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("integrity-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+		key = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+		today = time.Now().UTC().Truncate(24 * time.Hour)
+
+		digestDB = &dbfakes.FakeDigestDB{}
+		var (
+			mu     sync.Mutex
+			latest *db.Digest
+		)
+		digestDB.GetLatestDigestStub = func() (*db.Digest, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return latest, nil
+		}
+		digestDB.StoreDigestStub = func(digest db.Digest) error {
+			mu.Lock()
+			defer mu.Unlock()
+			latest = &digest
+			return nil
+		}
+		digestDB.GetEarliestCFEventTimeReturns(today.AddDate(0, 0, -3).Add(13*time.Hour), nil)
+		digestDB.StreamCFAuditEventHashesStub = func(ctx context.Context, from time.Time, to time.Time, fn func(db.EventHash) error) (int64, error) {
+			return 7, fn(db.EventHash{ID: 1, GUID: "10000000-0000-0000-0000-000000000001", Hash: sha([]byte("1"))})
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	start := func(sinks ...integrity.DigestSink) {
+		digester := integrity.NewDigester(logger, digestDB, integrity.DigesterConfig{
+			Schedule: 10 * time.Millisecond,
+			Key:      key,
+		}, sinks...)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = digester.Run(ctx)
+		}()
+	}
+
+	It("digests every day which is over, once, from the earliest event", func() {
+		createdBefore := h.CurrentMetricValue(integrity.DigestsCreatedTotal)
+		dir := GinkgoT().TempDir()
+
+		start(integrity.FileDigestSink{Dir: dir})
+
+		Eventually(digestDB.StoreDigestCallCount).Should(Equal(3))
+		Consistently(digestDB.StoreDigestCallCount, "50ms").Should(Equal(3))
+		for i := 0; i < 3; i++ {
+			digest := digestDB.StoreDigestArgsForCall(i)
+			Expect(digest.Date).To(Equal(today.AddDate(0, 0, i-3)))
+			Expect(digest.MaxEventID).To(BeNumerically("==", 7))
+			Expect(integrity.VerifyDigest(digest, key.Public().(ed25519.PublicKey), summarise(digest.Date, digest.MaxEventID, []db.EventHash{
+				{ID: 1, GUID: "10000000-0000-0000-0000-000000000001", Hash: sha([]byte("1"))},
+			}).Digest())).To(Succeed())
+
+			_, from, to, _ := digestDB.StreamCFAuditEventHashesArgsForCall(i)
+			Expect(from).To(Equal(digest.Date))
+			Expect(to).To(Equal(digest.Date.AddDate(0, 0, 1)))
+		}
+		Expect(integrity.DigestsCreatedTotal).To(h.MetricIncrementedBy(createdBefore, "==", 3))
+
+		By("writing each digest to a file")
+		b, err := os.ReadFile(filepath.Join(dir, "digest-"+today.AddDate(0, 0, -1).Format("2006-01-02")+".json"))
+		Expect(err).NotTo(HaveOccurred())
+		digest, err := integrity.ParseDigestJSON(b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(digest).To(Equal(digestDB.StoreDigestArgsForCall(2)))
+	})
+
+	It("does not store digests which could not be sent", func() {
+		errorsBefore := h.CurrentMetricValue(integrity.DigesterErrorsTotal)
+
+		start(failingSink{})
+
+		Eventually(func() float64 {
+			return h.CurrentMetricValue(integrity.DigesterErrorsTotal)
+		}).Should(BeNumerically(">=", errorsBefore+2))
+		Expect(digestDB.StoreDigestCallCount()).To(Equal(0))
+	})
+
+	It("does nothing when there are no events", func() {
+		digestDB.GetEarliestCFEventTimeReturns(time.Time{}, nil)
+
+		start()
+
+		Eventually(digestDB.GetEarliestCFEventTimeCallCount).Should(BeNumerically(">=", 2))
+		Expect(digestDB.StreamCFAuditEventHashesCallCount()).To(Equal(0))
+	})
+})
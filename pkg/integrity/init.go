@@ -0,0 +1,5 @@
+package integrity
+
+func init() {
+	initMetrics()
+}
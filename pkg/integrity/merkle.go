@@ -0,0 +1,73 @@
+package integrity
+
+import (
+	"crypto/sha256"
+)
+
+// MerkleRoot is the root of a Merkle tree over the hashes of events, built
+// as in RFC 6962 so that it can be checked with common tools. Leaves and
+// interior nodes are hashed with different prefixes, so that a leaf cannot be
+// passed off as a node. The root of no leaves is the hash of nothing.
+func MerkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	}
+	if len(leaves) == 1 {
+		sum := sha256.Sum256(append([]byte{0x00}, leaves[0]...))
+		return sum[:]
+	}
+
+	// The left subtree has the largest power of two leaves less than all
+	split := 1
+	for split*2 < len(leaves) {
+		split *= 2
+	}
+	return merkleNode(MerkleRoot(leaves[:split]), MerkleRoot(leaves[split:]))
+}
+
+// MerkleBuilder works out the same root as MerkleRoot a leaf at a time, so
+// that a day of events need not be held at once. It keeps the roots of the
+// largest perfect subtrees of the leaves so far, biggest first, and joins
+// two the same size whenever a leaf is added.
+type MerkleBuilder struct {
+	subtrees []merkleSubtree
+}
+
+type merkleSubtree struct {
+	leaves int64
+	root   []byte
+}
+
+// Add adds the next leaf
+func (b *MerkleBuilder) Add(leaf []byte) {
+	sum := sha256.Sum256(append([]byte{0x00}, leaf...))
+	next := merkleSubtree{leaves: 1, root: sum[:]}
+	for len(b.subtrees) > 0 && b.subtrees[len(b.subtrees)-1].leaves == next.leaves {
+		left := b.subtrees[len(b.subtrees)-1]
+		b.subtrees = b.subtrees[:len(b.subtrees)-1]
+		next = merkleSubtree{leaves: left.leaves * 2, root: merkleNode(left.root, next.root)}
+	}
+	b.subtrees = append(b.subtrees, next)
+}
+
+// Root returns the root of the tree over the leaves added so far. The
+// smaller subtrees are joined from the right, as MerkleRoot splits them.
+func (b *MerkleBuilder) Root() []byte {
+	if len(b.subtrees) == 0 {
+		return MerkleRoot(nil)
+	}
+	root := b.subtrees[len(b.subtrees)-1].root
+	for i := len(b.subtrees) - 2; i >= 0; i-- {
+		root = merkleNode(b.subtrees[i].root, root)
+	}
+	return root
+}
+
+func merkleNode(left []byte, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
@@ -0,0 +1,46 @@
+package integrity
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ChainLength = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cf_audit_events_chain_length",
+		Help: "Number of events in the hash chain over cf_audit_events at the last checkpoint",
+	})
+
+	ChainHead = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cf_audit_events_chain_head",
+		Help: "Hash of the last event in the hash chain at the last checkpoint, as a label, with the length of the chain as the value",
+	}, []string{"hash"})
+
+	CheckpointErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cf_audit_events_chain_checkpoint_errors_total",
+		Help: "Number of checkpoints of the hash chain which failed",
+	})
+
+	DigestsCreatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "digester_digests_created_total",
+		Help: "Number of signed daily digests created",
+	})
+
+	DigesterLatestDigestTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "digester_latest_digest_timestamp",
+		Help: "Unix epoch seconds of the start of the latest day digested",
+	})
+
+	DigesterErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "digester_errors_total",
+		Help: "Number of errors encountered creating signed daily digests",
+	})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(ChainLength)
+	prometheus.MustRegister(ChainHead)
+	prometheus.MustRegister(CheckpointErrorsTotal)
+	prometheus.MustRegister(DigestsCreatedTotal)
+	prometheus.MustRegister(DigesterLatestDigestTimestamp)
+	prometheus.MustRegister(DigesterErrorsTotal)
+}
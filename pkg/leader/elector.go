@@ -0,0 +1,170 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// Elector campaigns for a LeaderLock so that, when several instances are
+// running, only one of them runs the components wrapped with Leading
+type Elector struct {
+	logger    lager.Logger
+	lock      db.LeaderLock
+	candidate string
+	interval  time.Duration
+
+	mu sync.Mutex
+	// leaderCtx is cancelled when leadership is lost, and is nil while this
+	// instance is not the leader
+	leaderCtx    context.Context
+	resignLeader context.CancelFunc
+	// changed is closed, and replaced, whenever leadership changes
+	changed chan struct{}
+}
+
+// New creates an Elector. candidate identifies this instance in logs and
+// metrics. The lock is tried, or checked while leader, every interval, so a
+// standby takes over within about one interval of the leader going away.
+// Each try or check must finish within half the interval.
+func New(logger lager.Logger, lock db.LeaderLock, candidate string, interval time.Duration) *Elector {
+	return &Elector{
+		logger:    logger.Session("leader-elector", lager.Data{"candidate": candidate}),
+		lock:      lock,
+		candidate: candidate,
+		interval:  interval,
+		changed:   make(chan struct{}),
+	}
+}
+
+// Run campaigns for leadership until ctx is cancelled, then gives up
+// leadership and releases the lock
+func (e *Elector) Run(ctx context.Context) error {
+	lsession := e.logger.Session("run")
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	IsLeader.WithLabelValues(e.candidate).Set(0)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		// A check which takes longer than half the interval counts as
+		// leadership being lost, so that a leader whose connection has hung
+		// stops before a standby could take over
+		lockCtx, cancelLock := context.WithTimeout(ctx, e.interval/2)
+		if e.IsLeader() {
+			if err := e.lock.Check(lockCtx); err != nil && ctx.Err() == nil {
+				lsession.Error("err-lost-leadership", err)
+				e.resign(lsession)
+			}
+		} else {
+			acquired, err := e.lock.TryAcquire(lockCtx)
+			if err != nil && ctx.Err() == nil {
+				lsession.Error("err-acquire-lock", err)
+			} else if acquired {
+				e.lead(lsession)
+			}
+		}
+		cancelLock()
+
+		select {
+		case <-ctx.Done():
+			e.resign(lsession)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Leading wraps run so that it only runs while this instance is the leader.
+// It is cancelled when leadership is lost, and started again when leadership
+// is regained.
+func (e *Elector) Leading(run func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		for {
+			leaderCtx, ok := e.waitForLeadership(ctx)
+			if !ok {
+				return nil
+			}
+
+			runCtx, cancel := context.WithCancel(ctx)
+			stop := context.AfterFunc(leaderCtx, cancel)
+			err := run(runCtx)
+			stop()
+			cancel()
+
+			// Only failures while still leading are left to the caller, so
+			// that losing leadership is not treated as the component failing
+			if ctx.Err() != nil || leaderCtx.Err() == nil {
+				return err
+			}
+			if err != nil {
+				e.logger.Error("err-stopping-after-lost-leadership", err)
+			}
+		}
+	}
+}
+
+func (e *Elector) waitForLeadership(ctx context.Context) (context.Context, bool) {
+	for {
+		e.mu.Lock()
+		leaderCtx, changed := e.leaderCtx, e.changed
+		e.mu.Unlock()
+
+		if leaderCtx != nil {
+			return leaderCtx, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-changed:
+		}
+	}
+}
+
+// IsLeader returns whether this instance is currently the leader
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leaderCtx != nil
+}
+
+func (e *Elector) lead(logger lager.Logger) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.leaderCtx, e.resignLeader = context.WithCancel(context.Background())
+	close(e.changed)
+	e.changed = make(chan struct{})
+
+	IsLeader.WithLabelValues(e.candidate).Set(1)
+	LeadershipChangesTotal.WithLabelValues(e.candidate).Inc()
+	logger.Info("became-leader")
+}
+
+func (e *Elector) resign(logger lager.Logger) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.leaderCtx != nil {
+		e.resignLeader()
+		e.leaderCtx, e.resignLeader = nil, nil
+		close(e.changed)
+		e.changed = make(chan struct{})
+
+		IsLeader.WithLabelValues(e.candidate).Set(0)
+		LeadershipChangesTotal.WithLabelValues(e.candidate).Inc()
+		logger.Info("stopped-leading")
+	}
+
+	if err := e.lock.Release(); err != nil {
+		logger.Error("err-release-lock", err)
+	}
+}
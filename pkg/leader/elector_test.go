@@ -0,0 +1,204 @@
+package leader_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/leader"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Elector", func() {
+	var (
+		logger   lager.Logger
+		lock     *fakes.FakeLeaderLock
+		elector  *leader.Elector
+		ctx      context.Context
+		cancel   context.CancelFunc
+		done     chan error
+		running  int64
+		starts   int64
+		follower func(ctx context.Context) error
+		wg       sync.WaitGroup
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("leader-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		lock = &fakes.FakeLeaderLock{}
+		elector = leader.New(logger, lock, "candidate-a", 5*time.Millisecond)
+
+		atomic.StoreInt64(&running, 0)
+		atomic.StoreInt64(&starts, 0)
+		follower = elector.Leading(func(ctx context.Context) error {
+			atomic.AddInt64(&starts, 1)
+			atomic.StoreInt64(&running, 1)
+			defer atomic.StoreInt64(&running, 0)
+			<-ctx.Done()
+			return nil
+		})
+
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan error, 2)
+	})
+
+	AfterEach(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	start := func() {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			done <- elector.Run(ctx)
+		}()
+		go func() {
+			defer wg.Done()
+			done <- follower(ctx)
+		}()
+	}
+
+	isLeader := func() float64 {
+		return h.CurrentMetricValue(leader.IsLeader.WithLabelValues("candidate-a"))
+	}
+
+	It("only runs components once it holds the lock", func() {
+		var acquired int64
+		lock.TryAcquireStub = func(ctx context.Context) (bool, error) {
+			return atomic.LoadInt64(&acquired) == 1, nil
+		}
+		start()
+
+		Eventually(lock.TryAcquireCallCount).Should(BeNumerically(">=", 2))
+		Consistently(func() int64 { return atomic.LoadInt64(&running) }, "20ms").Should(Equal(int64(0)))
+		Expect(isLeader()).To(Equal(0.0))
+
+		atomic.StoreInt64(&acquired, 1)
+		Eventually(func() int64 { return atomic.LoadInt64(&running) }).Should(Equal(int64(1)))
+		Expect(isLeader()).To(Equal(1.0))
+
+		Eventually(lock.CheckCallCount).Should(BeNumerically(">=", 1))
+	})
+
+	It("logs but keeps trying when the lock cannot be acquired", func() {
+		var attempts int64
+		lock.TryAcquireStub = func(ctx context.Context) (bool, error) {
+			if atomic.AddInt64(&attempts, 1) == 1 {
+				return false, fmt.Errorf("database is down")
+			}
+			return true, nil
+		}
+		start()
+
+		Eventually(func() int64 { return atomic.LoadInt64(&running) }).Should(Equal(int64(1)))
+	})
+
+	It("stops components when leadership is lost and starts them again when it is regained", func() {
+		changesBefore := h.CurrentMetricValue(
+			leader.LeadershipChangesTotal.WithLabelValues("candidate-a"),
+		)
+
+		var lost int64
+		lock.TryAcquireStub = func(ctx context.Context) (bool, error) {
+			return atomic.LoadInt64(&lost) == 0, nil
+		}
+		lock.CheckStub = func(ctx context.Context) error {
+			if atomic.LoadInt64(&lost) == 1 {
+				return fmt.Errorf("lock is not held")
+			}
+			return nil
+		}
+		start()
+
+		Eventually(func() int64 { return atomic.LoadInt64(&running) }).Should(Equal(int64(1)))
+
+		atomic.StoreInt64(&lost, 1)
+		Eventually(func() int64 { return atomic.LoadInt64(&running) }).Should(Equal(int64(0)))
+		Expect(isLeader()).To(Equal(0.0))
+		Expect(lock.ReleaseCallCount()).To(BeNumerically(">=", 1))
+		Consistently(done, "20ms").ShouldNot(Receive())
+
+		atomic.StoreInt64(&lost, 0)
+		Eventually(func() int64 { return atomic.LoadInt64(&running) }).Should(Equal(int64(1)))
+		Expect(atomic.LoadInt64(&starts)).To(Equal(int64(2)))
+
+		Expect(leader.LeadershipChangesTotal.WithLabelValues("candidate-a")).To(
+			h.MetricIncrementedBy(changesBefore, "==", 3),
+		)
+	})
+
+	It("stops components when checking the lock takes more than half the interval", func() {
+		lock.TryAcquireReturns(true, nil)
+		var hung, deadlines int64
+		lock.CheckStub = func(ctx context.Context) error {
+			if _, ok := ctx.Deadline(); ok {
+				atomic.AddInt64(&deadlines, 1)
+			}
+			if atomic.LoadInt64(&hung) == 1 {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		}
+		start()
+
+		Eventually(lock.CheckCallCount).Should(BeNumerically(">=", 1))
+		Expect(atomic.LoadInt64(&running)).To(Equal(int64(1)))
+		Expect(atomic.LoadInt64(&deadlines)).To(BeNumerically(">=", 1))
+
+		lock.TryAcquireReturns(false, nil)
+		atomic.StoreInt64(&hung, 1)
+		Eventually(func() int64 { return atomic.LoadInt64(&running) }).Should(Equal(int64(0)))
+		Expect(isLeader()).To(Equal(0.0))
+	})
+
+	It("releases the lock when stopped", func() {
+		lock.TryAcquireReturns(true, nil)
+		start()
+
+		Eventually(func() int64 { return atomic.LoadInt64(&running) }).Should(Equal(int64(1)))
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		Eventually(done).Should(Receive(BeNil()))
+
+		Expect(lock.ReleaseCallCount()).To(Equal(1))
+		Expect(isLeader()).To(Equal(0.0))
+	})
+
+	It("stops waiting for leadership when cancelled", func() {
+		lock.TryAcquireReturns(false, nil)
+		start()
+
+		Eventually(lock.TryAcquireCallCount).Should(BeNumerically(">=", 1))
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(atomic.LoadInt64(&starts)).To(Equal(int64(0)))
+	})
+
+	It("returns errors from components while still leading", func() {
+		lock.TryAcquireReturns(true, nil)
+		failing := elector.Leading(func(ctx context.Context) error {
+			return fmt.Errorf("failed")
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = elector.Run(ctx)
+		}()
+
+		Expect(failing(ctx)).To(MatchError("failed"))
+	})
+})
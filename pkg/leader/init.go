@@ -0,0 +1,5 @@
+package leader
+
+func init() {
+	initMetrics()
+}
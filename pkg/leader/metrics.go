@@ -0,0 +1,22 @@
+package leader
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	IsLeader = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "leader_election_is_leader",
+		Help: "Whether this instance is the leader (1) or a standby (0)",
+	}, []string{"candidate"})
+
+	LeadershipChangesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "leader_election_leadership_changes_total",
+		Help: "Number of times this instance has become leader or stopped being leader",
+	}, []string{"candidate"})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(IsLeader)
+	prometheus.MustRegister(LeadershipChangesTotal)
+}
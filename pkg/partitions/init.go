@@ -0,0 +1,5 @@
+package partitions
+
+func init() {
+	initMetrics()
+}
@@ -0,0 +1,140 @@
+package partitions
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+type Config struct {
+	// Schedule is how often partitions are maintained
+	Schedule time.Duration
+	// Ahead is how many months after the current one to create partitions for
+	Ahead int
+	// RetentionMonths is how many whole months of events are kept before the
+	// current one. Older partitions are retired. Zero keeps every partition.
+	RetentionMonths int
+	// Action is what is done with partitions which are retired
+	Action db.RetentionAction
+}
+
+// Maintainer creates monthly partitions of cf_audit_events before they are
+// needed, and retires partitions older than the retention period
+type Maintainer struct {
+	logger      lager.Logger
+	partitionDB db.PartitionDB
+	cfg         Config
+}
+
+func NewMaintainer(logger lager.Logger, partitionDB db.PartitionDB, cfg Config) *Maintainer {
+	return &Maintainer{
+		logger:      logger.Session("partition-maintainer"),
+		partitionDB: partitionDB,
+		cfg:         cfg,
+	}
+}
+
+// Run maintains partitions straight away, and then every Schedule until ctx
+// is cancelled
+func (m *Maintainer) Run(ctx context.Context) error {
+	lsession := m.logger.Session("run")
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		m.maintain(lsession, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(m.cfg.Schedule):
+		}
+	}
+}
+
+// maintain runs the retention policy as of now, logs what it did and records
+// it. Failures are left to be tried again on the next run.
+func (m *Maintainer) maintain(logger lager.Logger, now time.Time) {
+	run := db.RetentionRun{
+		StartedAt:         now,
+		RetentionMonths:   m.cfg.RetentionMonths,
+		Action:            m.cfg.Action,
+		PartitionsCreated: []string{},
+		PartitionsRetired: []string{},
+	}
+	if m.cfg.RetentionMonths > 0 {
+		run.Cutoff = db.PartitionMonth(now).AddDate(0, -m.cfg.RetentionMonths, 0)
+	}
+
+	run.Error = m.createPartitions(logger, &run, now)
+	if run.Error == nil && m.cfg.RetentionMonths > 0 {
+		run.Error = m.retirePartitions(logger, &run)
+	}
+	run.FinishedAt = time.Now()
+
+	data := lager.Data{
+		"cutoff":             run.Cutoff,
+		"action":             run.Action,
+		"partitions-created": run.PartitionsCreated,
+		"partitions-retired": run.PartitionsRetired,
+		"events-retired":     run.EventsRetired,
+	}
+	if run.Error != nil {
+		ErrorsTotal.Inc()
+		logger.Error("err-maintain-partitions", run.Error, data)
+	} else {
+		logger.Info("maintained-partitions", data)
+	}
+
+	if err := m.partitionDB.RecordRetentionRun(run); err != nil {
+		logger.Error("err-record-retention-run", err)
+	}
+}
+
+func (m *Maintainer) createPartitions(logger lager.Logger, run *db.RetentionRun, now time.Time) error {
+	for i := 0; i <= m.cfg.Ahead; i++ {
+		month := db.PartitionMonth(now).AddDate(0, i, 0)
+		created, err := m.partitionDB.CreateCFAuditEventPartition(month)
+		if err != nil {
+			return fmt.Errorf("failed to create partition for %s: %s", month.Format("2006-01"), err)
+		}
+		if created {
+			name := fmt.Sprintf("%s_%s", db.CFAuditEventsTable, month.Format("y2006m01"))
+			run.PartitionsCreated = append(run.PartitionsCreated, name)
+			PartitionsCreatedTotal.Inc()
+			logger.Info("created-partition", lager.Data{"partition": name})
+		}
+	}
+	return nil
+}
+
+func (m *Maintainer) retirePartitions(logger lager.Logger, run *db.RetentionRun) error {
+	partitions, err := m.partitionDB.GetCFAuditEventPartitions()
+	if err != nil {
+		return fmt.Errorf("failed to list partitions: %s", err)
+	}
+
+	for _, partition := range partitions {
+		if partition.End().After(run.Cutoff) {
+			continue
+		}
+		count, err := m.partitionDB.RetireCFAuditEventPartition(partition, m.cfg.Action)
+		if err != nil {
+			return fmt.Errorf("failed to retire partition %s: %s", partition.Name, err)
+		}
+		run.PartitionsRetired = append(run.PartitionsRetired, partition.Name)
+		run.EventsRetired += count
+		PartitionsRetiredTotal.WithLabelValues(string(m.cfg.Action)).Inc()
+		EventsRetiredTotal.WithLabelValues(string(m.cfg.Action)).Add(float64(count))
+		logger.Info("retired-partition", lager.Data{
+			"partition": partition.Name,
+			"action":    m.cfg.Action,
+			"events":    count,
+		})
+	}
+	return nil
+}
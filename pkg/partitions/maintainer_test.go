@@ -0,0 +1,148 @@
+package partitions_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/partitions"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Maintainer", func() {
+	var (
+		logger      lager.Logger
+		partitionDB *dbfakes.FakePartitionDB
+		ctx         context.Context
+		cancel      context.CancelFunc
+		wg          sync.WaitGroup
+		thisMonth   time.Time
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("partitions-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		partitionDB = &dbfakes.FakePartitionDB{}
+		thisMonth = db.PartitionMonth(time.Now())
+
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	start := func(cfg partitions.Config) {
+		maintainer := partitions.NewMaintainer(logger, partitionDB, cfg)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = maintainer.Run(ctx)
+		}()
+	}
+
+	partition := func(month time.Time) db.Partition {
+		return db.Partition{
+			Name:  fmt.Sprintf("cf_audit_events_%s", month.Format("y2006m01")),
+			Month: month,
+		}
+	}
+
+	It("creates partitions ahead of time", func() {
+		createdBefore := h.CurrentMetricValue(partitions.PartitionsCreatedTotal)
+		partitionDB.CreateCFAuditEventPartitionStub = func(month time.Time) (bool, error) {
+			return !month.Equal(thisMonth), nil
+		}
+
+		start(partitions.Config{Schedule: time.Hour, Ahead: 2})
+
+		Eventually(partitionDB.RecordRetentionRunCallCount).Should(Equal(1))
+		Expect(partitionDB.CreateCFAuditEventPartitionCallCount()).To(Equal(3))
+		for i := 0; i < 3; i++ {
+			Expect(partitionDB.CreateCFAuditEventPartitionArgsForCall(i)).To(Equal(thisMonth.AddDate(0, i, 0)))
+		}
+
+		run := partitionDB.RecordRetentionRunArgsForCall(0)
+		Expect(run.PartitionsCreated).To(Equal([]string{
+			partition(thisMonth.AddDate(0, 1, 0)).Name,
+			partition(thisMonth.AddDate(0, 2, 0)).Name,
+		}))
+		Expect(run.Error).NotTo(HaveOccurred())
+		Expect(partitions.PartitionsCreatedTotal).To(h.MetricIncrementedBy(createdBefore, "==", 2))
+
+		By("keeping every partition when there is no retention period")
+		Expect(partitionDB.GetCFAuditEventPartitionsCallCount()).To(Equal(0))
+		Expect(run.Cutoff.IsZero()).To(BeTrue())
+	})
+
+	It("retires partitions older than the retention period", func() {
+		retiredBefore := h.CurrentMetricValue(partitions.PartitionsRetiredTotal.WithLabelValues("archive"))
+		eventsBefore := h.CurrentMetricValue(partitions.EventsRetiredTotal.WithLabelValues("archive"))
+
+		partitionDB.GetCFAuditEventPartitionsReturns([]db.Partition{
+			partition(thisMonth.AddDate(0, -4, 0)),
+			partition(thisMonth.AddDate(0, -3, 0)),
+			partition(thisMonth.AddDate(0, -2, 0)),
+			partition(thisMonth.AddDate(0, -1, 0)),
+			partition(thisMonth),
+		}, nil)
+		partitionDB.RetireCFAuditEventPartitionReturns(10, nil)
+
+		start(partitions.Config{Schedule: time.Hour, RetentionMonths: 2, Action: db.RetentionArchive})
+
+		Eventually(partitionDB.RecordRetentionRunCallCount).Should(Equal(1))
+		Expect(partitionDB.RetireCFAuditEventPartitionCallCount()).To(Equal(2))
+		retired, action := partitionDB.RetireCFAuditEventPartitionArgsForCall(0)
+		Expect(retired).To(Equal(partition(thisMonth.AddDate(0, -4, 0))))
+		Expect(action).To(Equal(db.RetentionArchive))
+		retired, _ = partitionDB.RetireCFAuditEventPartitionArgsForCall(1)
+		Expect(retired).To(Equal(partition(thisMonth.AddDate(0, -3, 0))))
+
+		run := partitionDB.RecordRetentionRunArgsForCall(0)
+		Expect(run.Cutoff).To(Equal(thisMonth.AddDate(0, -2, 0)))
+		Expect(run.RetentionMonths).To(Equal(2))
+		Expect(run.PartitionsRetired).To(HaveLen(2))
+		Expect(run.EventsRetired).To(BeNumerically("==", 20))
+
+		Expect(partitions.PartitionsRetiredTotal.WithLabelValues("archive")).To(
+			h.MetricIncrementedBy(retiredBefore, "==", 2),
+		)
+		Expect(partitions.EventsRetiredTotal.WithLabelValues("archive")).To(
+			h.MetricIncrementedBy(eventsBefore, "==", 20),
+		)
+	})
+
+	It("records failures and tries again on the next run", func() {
+		errorsBefore := h.CurrentMetricValue(partitions.ErrorsTotal)
+
+		partitionDB.GetCFAuditEventPartitionsReturns([]db.Partition{
+			partition(thisMonth.AddDate(0, -6, 0)),
+			partition(thisMonth.AddDate(0, -5, 0)),
+		}, nil)
+		partitionDB.RetireCFAuditEventPartitionReturnsOnCall(0, 0, fmt.Errorf("lock timeout"))
+
+		start(partitions.Config{Schedule: 10 * time.Millisecond, RetentionMonths: 1, Action: db.RetentionDrop})
+
+		Eventually(partitionDB.RecordRetentionRunCallCount).Should(BeNumerically(">=", 2))
+		run := partitionDB.RecordRetentionRunArgsForCall(0)
+		Expect(run.Error).To(MatchError(ContainSubstring("lock timeout")))
+		Expect(run.PartitionsRetired).To(BeEmpty())
+
+		By("not going on to retire newer partitions after a failure")
+		retired, _ := partitionDB.RetireCFAuditEventPartitionArgsForCall(0)
+		Expect(retired).To(Equal(partition(thisMonth.AddDate(0, -6, 0))))
+		retired, _ = partitionDB.RetireCFAuditEventPartitionArgsForCall(1)
+		Expect(retired).To(Equal(partition(thisMonth.AddDate(0, -6, 0))))
+
+		Expect(partitions.ErrorsTotal).To(h.MetricIncrementedBy(errorsBefore, ">=", 1))
+	})
+})
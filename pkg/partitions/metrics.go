@@ -0,0 +1,34 @@
+package partitions
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	PartitionsCreatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "partition_maintainer_partitions_created_total",
+		Help: "Number of monthly partitions of cf_audit_events created ahead of time",
+	})
+
+	PartitionsRetiredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "partition_maintainer_partitions_retired_total",
+		Help: "Number of monthly partitions of cf_audit_events dropped or archived by the retention policy",
+	}, []string{"action"})
+
+	EventsRetiredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "partition_maintainer_events_retired_total",
+		Help: "Number of events in partitions dropped or archived by the retention policy",
+	}, []string{"action"})
+
+	ErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "partition_maintainer_errors_total",
+		Help: "Number of partition maintenance runs which failed",
+	})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(PartitionsCreatedTotal)
+	prometheus.MustRegister(PartitionsRetiredTotal)
+	prometheus.MustRegister(EventsRetiredTotal)
+	prometheus.MustRegister(ErrorsTotal)
+}
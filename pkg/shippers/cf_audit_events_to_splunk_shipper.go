@@ -1,17 +1,10 @@
 package shippers
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"net/http"
 	"time"
 
 	"code.cloudfoundry.org/lager"
-	cfclient "github.com/cloudfoundry-community/go-cfclient"
-	"github.com/gojektech/heimdall"
 	"github.com/gojektech/heimdall/httpclient"
 
 	"github.com/alphagov/paas-auditor/pkg/db"
@@ -21,72 +14,48 @@ const (
 	cfAuditEventsToSplunkShipperName = "cf-audit-events-to-splunk"
 )
 
-type splunkEvent struct {
-	SourceType string      `json:"sourcetype"`
-	Source     string      `json:"source"`
-	Event      interface{} `json:"event"`
-}
-
-type splunkHTTPClient struct {
-	client       http.Client
-	splunkAPIKey string
-}
-
-func (c *splunkHTTPClient) Do(req *http.Request) (*http.Response, error) {
-	req.Header.Set("Authorization", fmt.Sprintf("Splunk %s", c.splunkAPIKey))
-	req.Header.Set("Content-Type", "application/json")
-	return c.client.Do(req)
+// shipperCursorName returns the name of the cursor used to ship events from a
+// foundation. Events from the default foundation use the original cursor, so
+// that they are not shipped again.
+func shipperCursorName(shipperName string, foundation string) string {
+	if foundation == db.DefaultFoundation {
+		return shipperName
+	}
+	return shipperName + "/" + foundation
 }
 
 type CFAuditEventsToSplunkShipper struct {
-	schedule  time.Duration
-	logger    lager.Logger
-	eventDB   db.EventDB
-	deployEnv string
-	client    *httpclient.Client
-	splunkURL string
+	foundation string
+	cursorName string
+	schedule   time.Duration
+	batchSize  int
+	logger     lager.Logger
+	eventDB    db.EventDB
+	deployEnv  string
+	client     *httpclient.Client
+	splunkURL  string
 
 	eventsShipped int
 }
 
 func NewCFAuditEventsToSplunkShipper(
+	foundation string,
 	schedule time.Duration,
+	batchSize int,
 	logger lager.Logger,
 	eventDB db.EventDB,
 	deployEnv string,
 	splunkAPIKey string,
 	splunkURL string,
 ) *CFAuditEventsToSplunkShipper {
-	logger = logger.Session("cf-audit-events-to-splunk-shipper")
-
-	var (
-		requestTimeout         = 2 * time.Second
-		initalTimeout          = 100 * time.Millisecond
-		maxTimeout             = 2 * time.Second
-		exponent       float64 = 2
-		jitter                 = 500 * time.Millisecond
-		maxRetries             = 3
-
-		backoff = heimdall.NewExponentialBackoff(
-			initalTimeout, maxTimeout,
-			exponent, jitter,
-		)
-
-		retrier = heimdall.NewRetrier(backoff)
-	)
-
-	client := httpclient.NewClient(
-		httpclient.WithHTTPClient(&splunkHTTPClient{
-			client:       *http.DefaultClient,
-			splunkAPIKey: splunkAPIKey,
-		}),
-		httpclient.WithHTTPTimeout(requestTimeout),
-		httpclient.WithRetrier(retrier),
-		httpclient.WithRetryCount(maxRetries),
-	)
+	logger = logger.Session("cf-audit-events-to-splunk-shipper", lager.Data{"foundation": foundation})
+
+	client := newSplunkClient(splunkAPIKey)
 
 	return &CFAuditEventsToSplunkShipper{
-		schedule, logger, eventDB, deployEnv, client, splunkURL, 0,
+		foundation,
+		shipperCursorName(cfAuditEventsToSplunkShipperName, foundation),
+		schedule, batchSize, logger, eventDB, deployEnv, client, splunkURL, 0,
 	}
 }
 
@@ -105,53 +74,60 @@ func (s *CFAuditEventsToSplunkShipper) Run(ctx context.Context) error {
 			startTime := time.Now()
 
 			eventsToShip, err := s.eventDB.GetUnshippedCFAuditEventsForShipper(
-				cfAuditEventsToSplunkShipperName,
+				s.cursorName, s.foundation, s.batchSize,
 			)
 
 			if err != nil {
 				lsession.Error("err-get-unshipped-cf-audit-events-for-shipper", err)
-				CFAuditEventsToSplunkShipperErrorsTotal.Inc()
+				CFAuditEventsToSplunkShipperErrorsTotal.WithLabelValues(s.foundation).Inc()
 				continue
 			}
 
 			var (
-				shippedEvents    = make([]cfclient.Event, 0)
+				shippedEvents    = make([]db.CFAuditEvent, 0)
 				allEventsShipped = true
 			)
 
 			for _, event := range eventsToShip {
+				if ctx.Err() != nil {
+					// Stop part way through, but still save the cursor for
+					// what has been shipped so that it is not shipped again
+					allEventsShipped = false
+					break
+				}
+
 				err := s.shipEvent(event)
 
 				if err != nil {
 					lsession.Error("err-ship-event", err)
 					allEventsShipped = false
-					CFAuditEventsToSplunkShipperErrorsTotal.Inc()
+					CFAuditEventsToSplunkShipperErrorsTotal.WithLabelValues(s.foundation).Inc()
 					break
 				}
 
 				shippedEvents = append(shippedEvents, event)
 				s.eventsShipped++
-				CFAuditEventsToSplunkShipperEventsShippedTotal.Inc()
+				CFAuditEventsToSplunkShipperEventsShippedTotal.WithLabelValues(s.foundation).Inc()
 			}
 
 			if len(shippedEvents) > 0 {
 				lastEvent := shippedEvents[len(shippedEvents)-1]
 
 				err := s.eventDB.UpdateShipperCursor(
-					cfAuditEventsToSplunkShipperName,
+					s.cursorName,
 					lastEvent.CreatedAt, lastEvent.GUID,
 				)
 
 				if err != nil {
 					lsession.Error("err-update-shipper-cursor", err, lager.Data{
-						"shipper": cfAuditEventsToSplunkShipperName,
+						"shipper": s.cursorName,
 					})
-					CFAuditEventsToSplunkShipperErrorsTotal.Inc()
+					CFAuditEventsToSplunkShipperErrorsTotal.WithLabelValues(s.foundation).Inc()
 					continue
 				}
 
 				lsession.Info("updated-shipper-cursor", lager.Data{
-					"shipper":        cfAuditEventsToSplunkShipperName,
+					"shipper":        s.cursorName,
 					"events-shipped": len(shippedEvents),
 				})
 
@@ -161,10 +137,10 @@ func (s *CFAuditEventsToSplunkShipper) Run(ctx context.Context) error {
 					lsession.Error("err-parse-event-time", err, lager.Data{
 						"raw-created-at": lastEvent.CreatedAt,
 					})
-					CFAuditEventsToSplunkShipperErrorsTotal.Inc()
+					CFAuditEventsToSplunkShipperErrorsTotal.WithLabelValues(s.foundation).Inc()
 					continue
 				}
-				CFAuditEventsToSplunkShipperLatestEventTimestamp.Set(
+				CFAuditEventsToSplunkShipperLatestEventTimestamp.WithLabelValues(s.foundation).Set(
 					float64(lastEventCreatedAt.Unix()),
 				)
 			}
@@ -179,47 +155,16 @@ func (s *CFAuditEventsToSplunkShipper) Run(ctx context.Context) error {
 					"all-events-shipped":   allEventsShipped,
 				},
 			)
-			CFAuditEventsToSplunkShipperShipDurationTotal.Add(duration.Seconds())
+			CFAuditEventsToSplunkShipperShipDurationTotal.WithLabelValues(s.foundation).Add(duration.Seconds())
 		}
 	}
 }
 
-func (s *CFAuditEventsToSplunkShipper) shipEvent(event cfclient.Event) error {
-	bytesToShip, err := json.Marshal(splunkEvent{
+func (s *CFAuditEventsToSplunkShipper) shipEvent(event db.CFAuditEvent) error {
+	return postToSplunk(s.client, s.splunkURL, splunkEvent{
 		SourceType: "cf-audit-event",
 		Source:     s.deployEnv,
 		Event:      event,
+		Fields:     map[string]string{"foundation": s.foundation},
 	})
-
-	if err != nil {
-		return err
-	}
-
-	resp, err := s.client.Post(
-		s.splunkURL,
-		bytes.NewReader(bytesToShip),
-		http.Header{},
-	)
-
-	defer func() {
-		if resp.Body != nil {
-			resp.Body.Close()
-		}
-	}()
-
-	if err != nil {
-		return err
-	}
-
-	if 200 <= resp.StatusCode && resp.StatusCode < 300 {
-		return nil
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-
-	if err != nil {
-		return err
-	}
-
-	return fmt.Errorf("Status: %d Body: %s", resp.StatusCode, body)
 }
@@ -2,6 +2,7 @@ package shippers_test
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"sync"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/jarcoal/httpmock"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/alphagov/paas-auditor/pkg/db"
 	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
 	"github.com/alphagov/paas-auditor/pkg/shippers"
 	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
@@ -51,24 +53,31 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", Ordered, func() {
 
 		By("checking the value of the metrics to test against them later")
 		cfAuditEventsToSplunkShipperEventsShippedTotal = h.CurrentMetricValue(
-			shippers.CFAuditEventsToSplunkShipperErrorsTotal,
+			shippers.CFAuditEventsToSplunkShipperErrorsTotal.WithLabelValues("test-foundation"),
 		)
 		cfAuditEventsToSplunkShipperEventsShippedTotal = h.CurrentMetricValue(
-			shippers.CFAuditEventsToSplunkShipperEventsShippedTotal,
+			shippers.CFAuditEventsToSplunkShipperEventsShippedTotal.WithLabelValues("test-foundation"),
 		)
 
+		actorActive := true
 		eventDB = &dbfakes.FakeEventDB{}
 		eventDB.GetUnshippedCFAuditEventsForShipperReturns(
-			[]cfclient.Event{
-				cfclient.Event{GUID: "abcd", CreatedAt: "2006-01-02T15:04:05Z"},
-				cfclient.Event{GUID: "efgh", CreatedAt: "2006-01-02T15:04:05Z"},
-				cfclient.Event{GUID: "ijkl", CreatedAt: "2006-01-02T15:04:05Z"},
+			[]db.CFAuditEvent{
+				{
+					Event:            cfclient.Event{GUID: "abcd", CreatedAt: "2006-01-02T15:04:05Z"},
+					OrganizationName: "my-org", SpaceName: "my-space",
+					ActorOrigin: "google", ActorEmail: "someone@example.com", ActorActive: &actorActive,
+				},
+				{Event: cfclient.Event{GUID: "efgh", CreatedAt: "2006-01-02T15:04:05Z"}},
+				{Event: cfclient.Event{GUID: "ijkl", CreatedAt: "2006-01-02T15:04:05Z"}},
 			},
 			nil,
 		)
 
 		shipper = shippers.NewCFAuditEventsToSplunkShipper(
+			"test-foundation",
 			10*time.Millisecond,
+			500,
 			logger,
 			eventDB,
 			"dev", "splunk-key", splunkURL,
@@ -113,12 +122,12 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", Ordered, func() {
 		Expect(shipError).NotTo(HaveOccurred())
 
 		By("checking the metrics")
-		Expect(shippers.CFAuditEventsToSplunkShipperEventsShippedTotal).To(
+		Expect(shippers.CFAuditEventsToSplunkShipperEventsShippedTotal.WithLabelValues("test-foundation")).To(
 			h.MetricIncrementedBy(cfAuditEventsToSplunkShipperEventsShippedTotal, ">=", 3),
 		)
 
 		By("checking that there were no errors")
-		Expect(shippers.CFAuditEventsToSplunkShipperErrorsTotal).To(
+		Expect(shippers.CFAuditEventsToSplunkShipperErrorsTotal.WithLabelValues("test-foundation")).To(
 			h.MetricIncrementedBy(cfAuditEventsToSplunkShipperErrorsTotal, "==", 0),
 		)
 
@@ -128,6 +137,116 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", Ordered, func() {
 		Expect(shipError).NotTo(HaveOccurred())
 	})
 
+	It("saves the cursor for the events shipped before it was stopped", func() {
+		shipContext, cancelShip := context.WithCancel(context.Background())
+		defer cancelShip()
+
+		httpmock.RegisterResponder(
+			"POST", splunkURL,
+			func(req *http.Request) (*http.Response, error) {
+				// Stop the shipper while it is shipping the first event
+				cancelShip()
+				return httpmock.NewJsonResponse(200, map[string]interface{}{
+					"message": "success",
+				})
+			},
+		)
+
+		By("running the shipper until it is stopped")
+		Expect(shipper.Run(shipContext)).To(Succeed())
+
+		Expect(httpmock.GetTotalCallCount()).To(Equal(1))
+		Expect(eventDB.UpdateShipperCursorCallCount()).To(Equal(1))
+		_, cursorTime, cursorGUID := eventDB.UpdateShipperCursorArgsForCall(0)
+		Expect(cursorTime).To(Equal("2006-01-02T15:04:05Z"))
+		Expect(cursorGUID).To(Equal("abcd"))
+	})
+
+	It("ships with a per-foundation cursor and tags events with the foundation and names", func() {
+		var (
+			bodies   []string
+			bodiesMu sync.Mutex
+		)
+		httpmock.RegisterResponder(
+			"POST", splunkURL,
+			func(req *http.Request) (*http.Response, error) {
+				body, err := io.ReadAll(req.Body)
+				Expect(err).NotTo(HaveOccurred())
+				bodiesMu.Lock()
+				bodies = append(bodies, string(body))
+				bodiesMu.Unlock()
+				return httpmock.NewJsonResponse(200, map[string]interface{}{
+					"message": "success",
+				})
+			},
+		)
+
+		shipContext, cancelShip := context.WithCancel(context.Background())
+		defer cancelShip()
+
+		By("running the shipper")
+		go func() {
+			defer GinkgoRecover()
+			Expect(shipper.Run(shipContext)).To(Succeed())
+		}()
+
+		By("waiting for the cursor to be updated")
+		Eventually(
+			eventDB.UpdateShipperCursorCallCount, "1000ms", "1ms",
+		).Should(BeNumerically(">=", 1))
+		cancelShip()
+
+		name, foundation, limit := eventDB.GetUnshippedCFAuditEventsForShipperArgsForCall(0)
+		Expect(name).To(Equal("cf-audit-events-to-splunk/test-foundation"))
+		Expect(foundation).To(Equal("test-foundation"))
+		Expect(limit).To(Equal(500))
+
+		cursorName, _, _ := eventDB.UpdateShipperCursorArgsForCall(0)
+		Expect(cursorName).To(Equal("cf-audit-events-to-splunk/test-foundation"))
+
+		bodiesMu.Lock()
+		defer bodiesMu.Unlock()
+		Expect(bodies).NotTo(BeEmpty())
+		Expect(bodies[0]).To(ContainSubstring(`"fields":{"foundation":"test-foundation"}`))
+		Expect(bodies[0]).To(ContainSubstring(`"guid":"abcd"`))
+		Expect(bodies[0]).To(ContainSubstring(`"organization_name":"my-org","space_name":"my-space"`))
+		Expect(bodies[0]).To(ContainSubstring(`"actor_origin":"google","actor_email":"someone@example.com","actor_active":true`))
+	})
+
+	It("uses the original cursor for the default foundation", func() {
+		httpmock.RegisterResponder(
+			"POST", splunkURL,
+			httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+				"message": "success",
+			}),
+		)
+
+		shipper = shippers.NewCFAuditEventsToSplunkShipper(
+			db.DefaultFoundation,
+			10*time.Millisecond,
+			500,
+			logger,
+			eventDB,
+			"dev", "splunk-key", splunkURL,
+		)
+
+		shipContext, cancelShip := context.WithCancel(context.Background())
+		defer cancelShip()
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(shipper.Run(shipContext)).To(Succeed())
+		}()
+
+		Eventually(
+			eventDB.UpdateShipperCursorCallCount, "1000ms", "1ms",
+		).Should(BeNumerically(">=", 1))
+		cancelShip()
+
+		cursorName, _, _ := eventDB.UpdateShipperCursorArgsForCall(0)
+		Expect(cursorName).To(Equal("cf-audit-events-to-splunk"))
+	})
+
 	It("appears is resilient to errors", func() {
 		splunkPOSTs := 0
 
@@ -178,7 +297,7 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", Ordered, func() {
 		By("checking the metrics")
 		Eventually(
 			func() prometheus.Collector {
-				return shippers.CFAuditEventsToSplunkShipperErrorsTotal
+				return shippers.CFAuditEventsToSplunkShipperErrorsTotal.WithLabelValues("test-foundation")
 			}, "10s", "1ms",
 		).Should(
 			h.MetricIncrementedBy(cfAuditEventsToSplunkShipperErrorsTotal, ">=", 1),
@@ -195,10 +314,10 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", Ordered, func() {
 		).Should(BeNumerically(">=", 10))
 
 		By("checking the metrics")
-		Expect(shippers.CFAuditEventsToSplunkShipperEventsShippedTotal).To(
+		Expect(shippers.CFAuditEventsToSplunkShipperEventsShippedTotal.WithLabelValues("test-foundation")).To(
 			h.MetricIncrementedBy(cfAuditEventsToSplunkShipperEventsShippedTotal, ">=", 2),
 		)
-		Expect(shippers.CFAuditEventsToSplunkShipperErrorsTotal).To(
+		Expect(shippers.CFAuditEventsToSplunkShipperErrorsTotal.WithLabelValues("test-foundation")).To(
 			h.MetricIncrementedBy(cfAuditEventsToSplunkShipperErrorsTotal, "==", 1),
 		)
 
@@ -5,25 +5,40 @@ import (
 )
 
 var (
-	CFAuditEventsToSplunkShipperErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	CFAuditEventsToSplunkShipperErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "cf_audit_events_to_splunk_shipper_errors_total",
 		Help: "Number of errors encountered by CF Audit Events to Splunk shipper",
-	})
+	}, []string{"foundation"})
 
-	CFAuditEventsToSplunkShipperEventsShippedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	CFAuditEventsToSplunkShipperEventsShippedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "cf_audit_events_to_splunk_shipper_events_shipped_total",
 		Help: "Number of CF audit events shipped to Splunk by CF Audit Events to Splunk shipper",
-	})
+	}, []string{"foundation"})
 
-	CFAuditEventsToSplunkShipperLatestEventTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+	CFAuditEventsToSplunkShipperLatestEventTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "cf_audit_events_to_splunk_shipper_latest_event_timestamp",
 		Help: "Unix epoch seconds of most recent event shipped to Splunk",
-	})
+	}, []string{"foundation"})
 
-	CFAuditEventsToSplunkShipperShipDurationTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	CFAuditEventsToSplunkShipperShipDurationTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "cf_audit_events_to_splunk_shipper_ship_duration_total",
 		Help: "Number of seconds spent shipping events by CF Audit Events to Splunk Shipper",
-	})
+	}, []string{"foundation"})
+
+	UsageEventsToSplunkShipperErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_usage_events_to_splunk_shipper_errors_total",
+		Help: "Number of errors encountered by CF Usage Events to Splunk shipper",
+	}, []string{"foundation", "kind"})
+
+	UsageEventsToSplunkShipperEventsShippedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_usage_events_to_splunk_shipper_events_shipped_total",
+		Help: "Number of CF usage events shipped to Splunk by CF Usage Events to Splunk shipper",
+	}, []string{"foundation", "kind"})
+
+	UsageEventsToSplunkShipperShipDurationTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_usage_events_to_splunk_shipper_ship_duration_total",
+		Help: "Number of seconds spent shipping events by CF Usage Events to Splunk Shipper",
+	}, []string{"foundation", "kind"})
 )
 
 func initMetrics() {
@@ -31,4 +46,7 @@ func initMetrics() {
 	prometheus.MustRegister(CFAuditEventsToSplunkShipperEventsShippedTotal)
 	prometheus.MustRegister(CFAuditEventsToSplunkShipperLatestEventTimestamp)
 	prometheus.MustRegister(CFAuditEventsToSplunkShipperShipDurationTotal)
+	prometheus.MustRegister(UsageEventsToSplunkShipperErrorsTotal)
+	prometheus.MustRegister(UsageEventsToSplunkShipperEventsShippedTotal)
+	prometheus.MustRegister(UsageEventsToSplunkShipperShipDurationTotal)
 }
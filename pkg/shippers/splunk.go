@@ -0,0 +1,95 @@
+package shippers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gojektech/heimdall"
+	"github.com/gojektech/heimdall/httpclient"
+)
+
+type splunkEvent struct {
+	SourceType string            `json:"sourcetype"`
+	Source     string            `json:"source"`
+	Event      interface{}       `json:"event"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+type splunkHTTPClient struct {
+	client       http.Client
+	splunkAPIKey string
+}
+
+func (c *splunkHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", fmt.Sprintf("Splunk %s", c.splunkAPIKey))
+	req.Header.Set("Content-Type", "application/json")
+	return c.client.Do(req)
+}
+
+func newSplunkClient(splunkAPIKey string) *httpclient.Client {
+	var (
+		requestTimeout         = 2 * time.Second
+		initalTimeout          = 100 * time.Millisecond
+		maxTimeout             = 2 * time.Second
+		exponent       float64 = 2
+		jitter                 = 500 * time.Millisecond
+		maxRetries             = 3
+
+		backoff = heimdall.NewExponentialBackoff(
+			initalTimeout, maxTimeout,
+			exponent, jitter,
+		)
+
+		retrier = heimdall.NewRetrier(backoff)
+	)
+
+	return httpclient.NewClient(
+		httpclient.WithHTTPClient(&splunkHTTPClient{
+			client:       *http.DefaultClient,
+			splunkAPIKey: splunkAPIKey,
+		}),
+		httpclient.WithHTTPTimeout(requestTimeout),
+		httpclient.WithRetrier(retrier),
+		httpclient.WithRetryCount(maxRetries),
+	)
+}
+
+func postToSplunk(client *httpclient.Client, splunkURL string, event splunkEvent) error {
+	bytesToShip, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(
+		splunkURL,
+		bytes.NewReader(bytesToShip),
+		http.Header{},
+	)
+
+	defer func() {
+		if resp.Body != nil {
+			resp.Body.Close()
+		}
+	}()
+
+	if err != nil {
+		return err
+	}
+
+	if 200 <= resp.StatusCode && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("Status: %d Body: %s", resp.StatusCode, body)
+}
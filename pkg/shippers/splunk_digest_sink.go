@@ -0,0 +1,32 @@
+package shippers
+
+import (
+	"github.com/gojektech/heimdall/httpclient"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/integrity"
+)
+
+// SplunkDigestSink ships signed daily digests to Splunk, with the
+// cf-audit-digest sourcetype
+type SplunkDigestSink struct {
+	deployEnv string
+	client    *httpclient.Client
+	splunkURL string
+}
+
+func NewSplunkDigestSink(deployEnv string, splunkAPIKey string, splunkURL string) *SplunkDigestSink {
+	return &SplunkDigestSink{
+		deployEnv: deployEnv,
+		client:    newSplunkClient(splunkAPIKey),
+		splunkURL: splunkURL,
+	}
+}
+
+func (s *SplunkDigestSink) WriteDigest(digest db.Digest) error {
+	return postToSplunk(s.client, s.splunkURL, splunkEvent{
+		SourceType: "cf-audit-digest",
+		Source:     s.deployEnv,
+		Event:      integrity.NewDigestJSON(digest),
+	})
+}
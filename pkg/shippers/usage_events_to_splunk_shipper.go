@@ -0,0 +1,149 @@
+package shippers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/gojektech/heimdall/httpclient"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// UsageEventsToSplunkShipper ships app or service usage events to Splunk,
+// using a separate sourcetype for each kind of usage event
+type UsageEventsToSplunkShipper struct {
+	kind         db.UsageEventKind
+	foundation   string
+	cursorName   string
+	sourceType   string
+	schedule     time.Duration
+	batchSize    int
+	logger       lager.Logger
+	usageEventDB db.UsageEventDB
+	deployEnv    string
+	client       *httpclient.Client
+	splunkURL    string
+
+	eventsShipped int
+}
+
+func NewUsageEventsToSplunkShipper(
+	kind db.UsageEventKind,
+	foundation string,
+	schedule time.Duration,
+	batchSize int,
+	logger lager.Logger,
+	usageEventDB db.UsageEventDB,
+	deployEnv string,
+	splunkAPIKey string,
+	splunkURL string,
+) *UsageEventsToSplunkShipper {
+	logger = logger.Session("usage-events-to-splunk-shipper", lager.Data{
+		"foundation": foundation,
+		"kind":       kind,
+	})
+
+	return &UsageEventsToSplunkShipper{
+		kind,
+		foundation,
+		shipperCursorName(fmt.Sprintf("cf-%s-usage-events-to-splunk", kind), foundation),
+		fmt.Sprintf("cf-%s-usage-event", kind),
+		schedule, batchSize, logger, usageEventDB, deployEnv,
+		newSplunkClient(splunkAPIKey), splunkURL, 0,
+	}
+}
+
+func (s *UsageEventsToSplunkShipper) Run(ctx context.Context) error {
+	lsession := s.logger.Session("run")
+
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		select {
+		case <-ctx.Done():
+			lsession.Info("done")
+			return nil
+		case <-time.After(s.schedule):
+			startTime := time.Now()
+
+			eventsToShip, err := s.usageEventDB.GetUnshippedUsageEventsForShipper(
+				s.kind, s.cursorName, s.foundation, s.batchSize,
+			)
+
+			if err != nil {
+				lsession.Error("err-get-unshipped-usage-events-for-shipper", err)
+				UsageEventsToSplunkShipperErrorsTotal.WithLabelValues(s.foundation, string(s.kind)).Inc()
+				continue
+			}
+
+			var (
+				shippedEvents    = make([]db.UsageEvent, 0)
+				allEventsShipped = true
+			)
+
+			for _, event := range eventsToShip {
+				if ctx.Err() != nil {
+					// Stop part way through, but still save the cursor for
+					// what has been shipped so that it is not shipped again
+					allEventsShipped = false
+					break
+				}
+
+				err := postToSplunk(s.client, s.splunkURL, splunkEvent{
+					SourceType: s.sourceType,
+					Source:     s.deployEnv,
+					Event:      event.Raw,
+					Fields:     map[string]string{"foundation": s.foundation},
+				})
+
+				if err != nil {
+					lsession.Error("err-ship-event", err)
+					allEventsShipped = false
+					UsageEventsToSplunkShipperErrorsTotal.WithLabelValues(s.foundation, string(s.kind)).Inc()
+					break
+				}
+
+				shippedEvents = append(shippedEvents, event)
+				s.eventsShipped++
+				UsageEventsToSplunkShipperEventsShippedTotal.WithLabelValues(s.foundation, string(s.kind)).Inc()
+			}
+
+			if len(shippedEvents) > 0 {
+				lastEvent := shippedEvents[len(shippedEvents)-1]
+
+				err := s.usageEventDB.UpdateShipperCursor(
+					s.cursorName,
+					lastEvent.CreatedAt, lastEvent.GUID,
+				)
+
+				if err != nil {
+					lsession.Error("err-update-shipper-cursor", err, lager.Data{
+						"shipper": s.cursorName,
+					})
+					UsageEventsToSplunkShipperErrorsTotal.WithLabelValues(s.foundation, string(s.kind)).Inc()
+					continue
+				}
+
+				lsession.Info("updated-shipper-cursor", lager.Data{
+					"shipper":        s.cursorName,
+					"events-shipped": len(shippedEvents),
+				})
+			}
+
+			duration := time.Since(startTime)
+			lsession.Info(
+				"shipped-events",
+				lager.Data{
+					"duration":             duration,
+					"events-shipped":       len(shippedEvents),
+					"total-events-shipped": s.eventsShipped,
+					"all-events-shipped":   allEventsShipped,
+				},
+			)
+			UsageEventsToSplunkShipperShipDurationTotal.WithLabelValues(s.foundation, string(s.kind)).Add(duration.Seconds())
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package shippers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/jarcoal/httpmock"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/shippers"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("UsageEventsToSplunkShipper Run", Ordered, func() {
+	BeforeAll(func() {
+		httpmock.Activate()
+	})
+
+	BeforeEach(func() {
+		httpmock.Reset()
+	})
+
+	AfterAll(func() {
+		httpmock.DeactivateAndReset()
+	})
+
+	var (
+		logger       lager.Logger
+		usageEventDB *dbfakes.FakeUsageEventDB
+
+		usageEventsToSplunkShipperEventsShippedTotal float64
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("shipper-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		usageEventsToSplunkShipperEventsShippedTotal = h.CurrentMetricValue(
+			shippers.UsageEventsToSplunkShipperEventsShippedTotal.WithLabelValues("test-foundation", "service"),
+		)
+
+		usageEventDB = &dbfakes.FakeUsageEventDB{}
+		usageEventDB.GetUnshippedUsageEventsForShipperReturns(
+			[]db.UsageEvent{
+				{GUID: "abcd", CreatedAt: "2006-01-02T15:04:05Z", Raw: json.RawMessage(`{"guid":"abcd"}`)},
+				{GUID: "efgh", CreatedAt: "2006-01-02T15:04:06Z", Raw: json.RawMessage(`{"guid":"efgh"}`)},
+			},
+			nil,
+		)
+	})
+
+	It("ships the raw events with their own sourcetype and cursor", func() {
+		var (
+			bodies   []map[string]interface{}
+			bodiesMu sync.Mutex
+		)
+		httpmock.RegisterResponder(
+			"POST", splunkURL,
+			func(req *http.Request) (*http.Response, error) {
+				body, err := io.ReadAll(req.Body)
+				Expect(err).NotTo(HaveOccurred())
+				var decoded map[string]interface{}
+				Expect(json.Unmarshal(body, &decoded)).To(Succeed())
+				bodiesMu.Lock()
+				bodies = append(bodies, decoded)
+				bodiesMu.Unlock()
+				return httpmock.NewJsonResponse(200, map[string]interface{}{
+					"message": "success",
+				})
+			},
+		)
+
+		shipper := shippers.NewUsageEventsToSplunkShipper(
+			db.ServiceUsageEvents,
+			"test-foundation",
+			10*time.Millisecond,
+			500,
+			logger,
+			usageEventDB,
+			"dev", "splunk-key", splunkURL,
+		)
+
+		shipContext, cancelShip := context.WithCancel(context.Background())
+		defer cancelShip()
+
+		By("running the shipper")
+		go func() {
+			defer GinkgoRecover()
+			Expect(shipper.Run(shipContext)).To(Succeed())
+		}()
+
+		By("waiting for the cursor to be updated")
+		Eventually(
+			usageEventDB.UpdateShipperCursorCallCount, "1000ms", "1ms",
+		).Should(BeNumerically(">=", 1))
+		cancelShip()
+
+		kind, name, foundation, limit := usageEventDB.GetUnshippedUsageEventsForShipperArgsForCall(0)
+		Expect(kind).To(Equal(db.ServiceUsageEvents))
+		Expect(name).To(Equal("cf-service-usage-events-to-splunk/test-foundation"))
+		Expect(foundation).To(Equal("test-foundation"))
+		Expect(limit).To(Equal(500))
+
+		cursorName, cursorTime, cursorGUID := usageEventDB.UpdateShipperCursorArgsForCall(0)
+		Expect(cursorName).To(Equal("cf-service-usage-events-to-splunk/test-foundation"))
+		Expect(cursorTime).To(Equal("2006-01-02T15:04:06Z"))
+		Expect(cursorGUID).To(Equal("efgh"))
+
+		bodiesMu.Lock()
+		defer bodiesMu.Unlock()
+		Expect(len(bodies)).To(BeNumerically(">=", 2))
+		Expect(bodies[0]).To(Equal(map[string]interface{}{
+			"sourcetype": "cf-service-usage-event",
+			"source":     "dev",
+			"event":      map[string]interface{}{"guid": "abcd"},
+			"fields":     map[string]interface{}{"foundation": "test-foundation"},
+		}))
+
+		Expect(shippers.UsageEventsToSplunkShipperEventsShippedTotal.WithLabelValues("test-foundation", "service")).To(
+			h.MetricIncrementedBy(usageEventsToSplunkShipperEventsShippedTotal, ">=", 2),
+		)
+	})
+})
@@ -0,0 +1,5 @@
+package supervisor
+
+func init() {
+	initMetrics()
+}
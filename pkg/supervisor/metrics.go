@@ -0,0 +1,22 @@
+package supervisor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ComponentUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "supervisor_component_up",
+		Help: "Whether a component is running (1) or not (0)",
+	}, []string{"component"})
+
+	ComponentRestartsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "supervisor_component_restarts_total",
+		Help: "Number of times a component has been restarted after failing",
+	}, []string{"component"})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(ComponentUp)
+	prometheus.MustRegister(ComponentRestartsTotal)
+}
@@ -0,0 +1,181 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// Component is a long running part of the program. Run should block until
+// ctx is cancelled and then return nil, or return an error if it fails.
+type Component struct {
+	Name string
+	// Stage orders shutdown. Every component in a stage has stopped before
+	// any in a later stage are asked to stop.
+	Stage int
+	Run   func(ctx context.Context) error
+}
+
+// RestartPolicy controls how failed components are restarted
+type RestartPolicy struct {
+	// MaxRestarts is how many times a component is restarted before the
+	// supervisor gives up and stops everything
+	MaxRestarts int
+	// InitialBackoff is how long to wait before the first restart, doubling
+	// for each subsequent restart up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// ResetAfter, if set, forgets a component's restarts once it has run for
+	// this long, so that occasional failures over a long time do not add up
+	ResetAfter time.Duration
+}
+
+// Supervisor runs components, restarting them when they fail, and stops them
+// in order when it is done
+type Supervisor struct {
+	logger     lager.Logger
+	policy     RestartPolicy
+	components []Component
+}
+
+func New(logger lager.Logger, policy RestartPolicy) *Supervisor {
+	return &Supervisor{
+		logger: logger.Session("supervisor"),
+		policy: policy,
+	}
+}
+
+func (s *Supervisor) Add(components ...Component) {
+	s.components = append(s.components, components...)
+}
+
+type stage struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Run starts every component and supervises them until ctx is cancelled, or
+// until a component fails more than MaxRestarts times. Either way the
+// components are then stopped stage by stage, and the error from the
+// component which failed, if any, is returned.
+func (s *Supervisor) Run(ctx context.Context) error {
+	lsession := s.logger.Session("run")
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	// Each stage has its own context, rather than one derived from ctx, so
+	// that the stages can be stopped one at a time
+	stages := map[int]*stage{}
+	for _, component := range s.components {
+		if _, ok := stages[component.Stage]; !ok {
+			stageCtx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stages[component.Stage] = &stage{ctx: stageCtx, cancel: cancel}
+		}
+	}
+	stageOrder := make([]int, 0, len(stages))
+	for n := range stages {
+		stageOrder = append(stageOrder, n)
+	}
+	sort.Ints(stageOrder)
+
+	failed := make(chan error, len(s.components))
+	for _, component := range s.components {
+		st := stages[component.Stage]
+		st.wg.Add(1)
+		go func() {
+			defer st.wg.Done()
+			if err := s.supervise(st.ctx, component); err != nil {
+				failed <- err
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		lsession.Info("stopping")
+	case err = <-failed:
+		lsession.Error("err-giving-up", err)
+	}
+
+	for _, n := range stageOrder {
+		lsession.Info("stopping-stage", lager.Data{"stage": n})
+		stages[n].cancel()
+		stages[n].wg.Wait()
+	}
+	return err
+}
+
+// supervise runs a component until ctx is cancelled, restarting it when it
+// fails. An error is only returned once the component has used up all its
+// restarts.
+func (s *Supervisor) supervise(ctx context.Context, component Component) error {
+	logger := s.logger.Session("component", lager.Data{"component": component.Name})
+
+	restarts := 0
+	backoff := s.policy.InitialBackoff
+
+	for {
+		startTime := time.Now()
+		ComponentUp.WithLabelValues(component.Name).Set(1)
+		err := run(ctx, component)
+		ComponentUp.WithLabelValues(component.Name).Set(0)
+
+		if ctx.Err() != nil {
+			if err != nil {
+				logger.Error("err-stopping", err)
+			}
+			logger.Info("stopped")
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("exited unexpectedly")
+		}
+
+		if s.policy.ResetAfter > 0 && time.Since(startTime) >= s.policy.ResetAfter {
+			restarts = 0
+			backoff = s.policy.InitialBackoff
+		}
+		if restarts >= s.policy.MaxRestarts {
+			return fmt.Errorf("%s failed after %d restarts: %w", component.Name, restarts, err)
+		}
+
+		restarts++
+		ComponentRestartsTotal.WithLabelValues(component.Name).Inc()
+		logger.Error("err-restarting", err, lager.Data{
+			"restart": restarts,
+			"wait":    backoff.String(),
+		})
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("stopped")
+			return nil
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > s.policy.MaxBackoff {
+			backoff = s.policy.MaxBackoff
+		}
+	}
+}
+
+// run calls component.Run, turning a panic into an error so that it can be
+// restarted like any other failure
+func run(ctx context.Context, component Component) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return component.Run(ctx)
+}
@@ -0,0 +1,205 @@
+package supervisor_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/supervisor"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Supervisor", func() {
+	var (
+		logger lager.Logger
+		policy supervisor.RestartPolicy
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("supervisor-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		policy = supervisor.RestartPolicy{
+			MaxRestarts:    2,
+			InitialBackoff: 1 * time.Millisecond,
+			MaxBackoff:     2 * time.Millisecond,
+		}
+	})
+
+	It("stops components stage by stage when the context is cancelled", func() {
+		var (
+			stoppedMu sync.Mutex
+			stopped   []string
+		)
+		stopsAfter := func(name string, delay time.Duration) func(ctx context.Context) error {
+			return func(ctx context.Context) error {
+				<-ctx.Done()
+				time.Sleep(delay)
+				stoppedMu.Lock()
+				defer stoppedMu.Unlock()
+				stopped = append(stopped, name)
+				return nil
+			}
+		}
+
+		sup := supervisor.New(logger, policy)
+		sup.Add(
+			supervisor.Component{Name: "database", Stage: 3, Run: stopsAfter("database", 0)},
+			supervisor.Component{Name: "collector", Stage: 0, Run: stopsAfter("collector", 20*time.Millisecond)},
+			supervisor.Component{Name: "server", Stage: 2, Run: stopsAfter("server", 0)},
+			supervisor.Component{Name: "shipper", Stage: 1, Run: stopsAfter("shipper", 10*time.Millisecond)},
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- sup.Run(ctx)
+		}()
+
+		Eventually(func() float64 {
+			return h.CurrentMetricValue(supervisor.ComponentUp.WithLabelValues("database"))
+		}).Should(Equal(1.0))
+
+		cancel()
+		Eventually(done, "1s").Should(Receive(BeNil()))
+
+		Expect(stopped).To(Equal([]string{"collector", "shipper", "server", "database"}))
+		Expect(h.CurrentMetricValue(supervisor.ComponentUp.WithLabelValues("database"))).To(Equal(0.0))
+	})
+
+	It("restarts failed components", func() {
+		restartsBefore := h.CurrentMetricValue(
+			supervisor.ComponentRestartsTotal.WithLabelValues("flaky"),
+		)
+
+		var runs int64
+		sup := supervisor.New(logger, policy)
+		sup.Add(supervisor.Component{Name: "flaky", Run: func(ctx context.Context) error {
+			if atomic.AddInt64(&runs, 1) <= 2 {
+				return fmt.Errorf("failed")
+			}
+			<-ctx.Done()
+			return nil
+		}})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- sup.Run(ctx)
+		}()
+
+		Eventually(func() int64 { return atomic.LoadInt64(&runs) }).Should(Equal(int64(3)))
+		Consistently(done, "20ms").ShouldNot(Receive())
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+
+		Expect(supervisor.ComponentRestartsTotal.WithLabelValues("flaky")).To(
+			h.MetricIncrementedBy(restartsBefore, "==", 2),
+		)
+	})
+
+	It("restarts components which panic or exit early", func() {
+		var runs int64
+		sup := supervisor.New(logger, policy)
+		sup.Add(supervisor.Component{Name: "panicky", Run: func(ctx context.Context) error {
+			switch atomic.AddInt64(&runs, 1) {
+			case 1:
+				panic("oh no")
+			case 2:
+				return nil
+			}
+			<-ctx.Done()
+			return nil
+		}})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- sup.Run(ctx)
+		}()
+
+		Eventually(func() int64 { return atomic.LoadInt64(&runs) }).Should(Equal(int64(3)))
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("gives up and stops everything once a component runs out of restarts", func() {
+		var otherStopped int64
+
+		sup := supervisor.New(logger, policy)
+		sup.Add(
+			supervisor.Component{Name: "broken", Stage: 1, Run: func(ctx context.Context) error {
+				return fmt.Errorf("always fails")
+			}},
+			supervisor.Component{Name: "other", Stage: 0, Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				atomic.StoreInt64(&otherStopped, 1)
+				return nil
+			}},
+		)
+
+		done := make(chan error)
+		go func() {
+			done <- sup.Run(context.Background())
+		}()
+
+		var err error
+		Eventually(done, "1s").Should(Receive(&err))
+		Expect(err).To(MatchError(ContainSubstring("broken failed after 2 restarts: always fails")))
+		Expect(atomic.LoadInt64(&otherStopped)).To(Equal(int64(1)))
+	})
+
+	It("forgets restarts once a component has run for long enough", func() {
+		policy.MaxRestarts = 1
+		policy.ResetAfter = 5 * time.Millisecond
+
+		var runs int64
+		sup := supervisor.New(logger, policy)
+		sup.Add(supervisor.Component{Name: "slow-failer", Run: func(ctx context.Context) error {
+			if atomic.AddInt64(&runs, 1) <= 3 {
+				time.Sleep(10 * time.Millisecond)
+				return fmt.Errorf("failed")
+			}
+			<-ctx.Done()
+			return nil
+		}})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- sup.Run(ctx)
+		}()
+
+		Eventually(func() int64 { return atomic.LoadInt64(&runs) }).Should(Equal(int64(4)))
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("does not restart anything while stopping", func() {
+		var runs int64
+		sup := supervisor.New(logger, policy)
+		sup.Add(supervisor.Component{Name: "fails-on-stop", Run: func(ctx context.Context) error {
+			atomic.AddInt64(&runs, 1)
+			<-ctx.Done()
+			return fmt.Errorf("failed to stop cleanly")
+		}})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- sup.Run(ctx)
+		}()
+
+		Eventually(func() int64 { return atomic.LoadInt64(&runs) }).Should(Equal(int64(1)))
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(atomic.LoadInt64(&runs)).To(Equal(int64(1)))
+	})
+})